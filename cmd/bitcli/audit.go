@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// runAudit prints the events recorded in the audit log.
+func runAudit(dir string, args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	event := fs.String("event", "", "only list the events with this name")
+	since := fs.Duration("since", 0, "only list the events newer than this duration")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	events, err := bitcask.ReadAuditLog(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range events {
+		if *event != "" && e.Event != *event {
+			continue
+		}
+		if *since > 0 && time.Since(e.Time) > *since {
+			continue
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n", e.Time.Format(time.RFC3339), e.Event, e.Label, e.Outcome, e.Detail)
+	}
+
+	return nil
+}
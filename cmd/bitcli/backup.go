@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// runBackup copies the datastore files and their manifest into a backup directory.
+func runBackup(dir string, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := fs.String("out", "", "the backup directory, it must not exist or be empty")
+	keyFile := fs.String("key", "", "a file holding the key signing the manifest")
+	base := fs.String("base", "", "a previous backup, only the files changed since are copied")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		return fmt.Errorf("missing -out directory")
+	}
+
+	key, err := readKey(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	b, err := bitcask.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	var manifest *bitcask.BackupManifest
+	if *base == "" {
+		manifest, err = b.Backup(*out, key)
+	} else {
+		manifest, err = b.BackupIncremental(*out, *base, key)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("backed up %d files, %d bytes, %d keys, %d files unchanged since the base backup\n",
+		manifest.FileCount, manifest.TotalBytes, manifest.Keys, len(manifest.Inherited))
+
+	return nil
+}
+
+// runRestore verifies a backup and copies it into the datastore directory.
+func runRestore(dir string, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	from := fs.String("from", "", "the backup directory")
+	keyFile := fs.String("key", "", "a file holding the key the manifest must be signed with")
+	verifyOnly := fs.Bool("verify", false, "only verify the backup without restoring it")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *from == "" {
+		return fmt.Errorf("missing -from directory")
+	}
+
+	key, err := readKey(*keyFile)
+	if err != nil {
+		return err
+	}
+
+	var manifest *bitcask.BackupManifest
+	if *verifyOnly {
+		manifest, err = bitcask.VerifyBackup(*from, key)
+	} else {
+		manifest, err = bitcask.Restore(*from, dir, key)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("verified %d files, %d bytes, %d keys\n", manifest.FileCount, manifest.TotalBytes, manifest.Keys)
+
+	return nil
+}
+
+// readKey reads a signing key from the given file, no file means no key.
+func readKey(name string) ([]byte, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	return os.ReadFile(name)
+}
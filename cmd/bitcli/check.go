@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// runCheck validates the checksums of all the records of the datastore.
+func runCheck(dir string, args []string) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	workers := fs.Int("workers", 0, "the number of files checked in parallel, 0 for the number of CPUs")
+	rate := fs.Int64("rate", 0, "the maximum read rate in MB/s, 0 for no limit")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	b, err := bitcask.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	res, err := b.Check(bitcask.CheckOptions{Workers: *workers, BytesPerSecond: *rate << 20})
+	if err != nil {
+		return err
+	}
+
+	for _, c := range res.Corruptions {
+		fmt.Println(c)
+	}
+	fmt.Printf("%d records in %d files (%d bytes) checked, %d corrupted files\n",
+		res.Records, res.Files, res.Bytes, len(res.Corruptions))
+	if len(res.Corruptions) > 0 {
+		return fmt.Errorf("%d corrupted files", len(res.Corruptions))
+	}
+
+	return nil
+}
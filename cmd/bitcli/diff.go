@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// runDiff prints the keys added, updated and deleted since a snapshot of the datastore.
+func runDiff(dir string, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	from := fs.String("from", "", "the snapshot directory, such as a backup")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *from == "" {
+		return errors.New("missing -from directory")
+	}
+
+	snap, err := bitcask.OpenSnapshot(*from)
+	if err != nil {
+		return err
+	}
+	defer snap.Close()
+
+	b, err := bitcask.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	diff, err := bitcask.Diff(snap, b)
+	if err != nil {
+		return err
+	}
+	for _, key := range diff.Added {
+		fmt.Printf("+\t%q\n", key)
+	}
+	for _, key := range diff.Updated {
+		fmt.Printf("~\t%q\n", key)
+	}
+	for _, key := range diff.Deleted {
+		fmt.Printf("-\t%q\n", key)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// runFrag prints the live and dead records of every data file.
+func runFrag(dir string, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments %v", args)
+	}
+
+	b, err := bitcask.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	files, err := b.AnalyzeFragmentation()
+	if err != nil {
+		return err
+	}
+
+	var live, dead int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tLIVE\tDEAD\tDEAD BYTES\tHOT KEYS")
+	for _, f := range files {
+		hot := ""
+		for i, k := range f.HotKeys {
+			if i > 0 {
+				hot += " "
+			}
+			hot += fmt.Sprintf("%q(%d)", k.Key, k.Writes)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", f.File, f.LiveRecords, f.DeadRecords, f.DeadBytes, hot)
+		live += f.LiveBytes
+		dead += f.DeadBytes
+	}
+	err = w.Flush()
+	if err != nil {
+		return err
+	}
+
+	if live+dead > 0 {
+		fmt.Printf("\n%d of %d bytes are dead (%.1f%%)\n", dead, live+dead, float64(dead)*100/float64(live+dead))
+	}
+
+	return nil
+}
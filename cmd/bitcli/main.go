@@ -0,0 +1,107 @@
+// Command bitcli provides administrative tooling for bitcask datastores.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// command represents a bitcli subcommand.
+type command struct {
+	usage string
+	run   func(dir string, args []string) error
+}
+
+// commands holds all the subcommands by name.
+var commands = map[string]command{
+	"restore": {
+		usage: "restore -from dir [-key file] [-verify]: verify a backup and restore it into the datastore directory",
+		run:   runRestore,
+	},
+	"top": {
+		usage: "top [-n count] [-writes]: list the keys with the largest values, or the keys written the most times",
+		run:   runTop,
+	},
+	"audit": {
+		usage: "audit [-event name] [-since duration]: list the events of the audit log",
+		run:   runAudit,
+	},
+	"backup": {
+		usage: "backup -out dir [-key file] [-base dir]: copy the datastore files, or those changed since the base backup, into dir with a manifest of their hashes",
+		run:   runBackup,
+	},
+	"check": {
+		usage: "check [-workers n] [-rate MB/s]: validate the checksums of all the records, in parallel and throttled",
+		run:   runCheck,
+	},
+	"diff": {
+		usage: "diff -from dir: list the keys added (+), updated (~) and deleted (-) since the snapshot in dir",
+		run:   runDiff,
+	},
+	"frag": {
+		usage: "frag: report the live and dead records of every data file",
+		run:   runFrag,
+	},
+	"plan": {
+		usage: "plan: report the files a merge would compact and the space it would reclaim, without merging",
+		run:   runPlan,
+	},
+	"scan": {
+		usage: "scan [-keys] [prefix]: list the keys starting with prefix along with their values",
+		run:   runScan,
+	},
+	"stats": {
+		usage: "stats: report the histograms of the key lengths, value sizes and ages",
+		run:   runStats,
+	},
+	"passwd": {
+		usage: "passwd [-iterations n]: print the salted hash of the password read from the standard input, for the users file of the servers",
+		run:   runPasswd,
+	},
+	"rebuild-hints": {
+		usage: "rebuild-hints: write again the missing or corrupted hint files and the keydir file",
+		run:   runRebuildHints,
+	},
+}
+
+func main() {
+	directoryFlag := flag.String("directory", os.Getenv("HOME")+"/resp_server_datastore", "the directory of db")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, isExist := commands[flag.Arg(0)]
+	if !isExist {
+		usage()
+		os.Exit(2)
+	}
+
+	err := cmd.run(*directoryFlag, flag.Args()[1:])
+	if err != nil {
+		log.Fatalf("bitcli %s: %v", flag.Arg(0), err)
+	}
+}
+
+// usage prints the flags and the available subcommands.
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: bitcli [-directory dir] <command> [args]\n\nFlags:\n")
+	flag.PrintDefaults()
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(flag.CommandLine.Output(), "\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(flag.CommandLine.Output(), "  %s\n", commands[name].usage)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/zaher1307/bitcask/pkg/auth"
+)
+
+// runPasswd prints the hash of the password read from the standard input,
+// to be written in the users file of the servers.
+func runPasswd(dir string, args []string) error {
+	fs := flag.NewFlagSet("passwd", flag.ContinueOnError)
+	iterations := fs.Int("iterations", auth.DefaultIterations, "the PBKDF2 iteration count")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if password == "" {
+		return errors.New("empty password")
+	}
+
+	hash, err := auth.HashPassword(password, *iterations)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+
+	return nil
+}
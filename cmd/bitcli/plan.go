@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// runPlan prints the work a merge of the datastore would do.
+func runPlan(dir string, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments %v", args)
+	}
+
+	b, err := bitcask.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	plan := b.PlanMerge()
+	for _, file := range plan.Files {
+		fmt.Println(file)
+	}
+	fmt.Printf("\nfiles\t%d\nkeys written\t%d\nkeys expired\t%d\nread bytes\t%d\nwrite bytes\t%d\nreclaimed bytes\t%d\n",
+		len(plan.Files), plan.KeysWritten, plan.KeysExpired, plan.ReadBytes, plan.WriteBytes, plan.ReclaimedBytes)
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// runRebuildHints writes again the missing or corrupted hint files of the datastore.
+func runRebuildHints(dir string, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("unexpected arguments %v", args)
+	}
+
+	res, err := bitcask.RebuildHints(dir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("checked %d hint files, rebuilt %d, removed %d\n", res.HintsChecked, res.HintsRebuilt, res.HintsRemoved)
+	for _, name := range res.DamagedFiles {
+		fmt.Printf("damaged data file %s: records after the damaged one are not indexed\n", name)
+	}
+
+	return nil
+}
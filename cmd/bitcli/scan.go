@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// runScan prints the keys starting with a prefix along with their values.
+func runScan(dir string, args []string) error {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	keysOnly := fs.Bool("keys", false, "print the keys without their values")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args()[1:])
+	}
+
+	b, err := bitcask.Open(dir, bitcask.WithKeyDir(bitcask.OrderedKeyDir))
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	it := b.Scan(fs.Arg(0))
+	defer it.Close()
+	for it.Next() {
+		if *keysOnly {
+			fmt.Printf("%q\n", it.Key())
+		} else {
+			fmt.Printf("%q\t%q\n", it.Key(), it.Value())
+		}
+	}
+
+	return it.Err()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// runStats prints the histograms of the key lengths, value sizes and ages.
+func runStats(dir string, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	b, err := bitcask.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	stats := b.KeyspaceStats()
+	fmt.Printf("keys\t%d\nkey bytes\t%d\nvalue bytes\t%d\n", stats.Keys, stats.KeyBytes, stats.ValueBytes)
+	printHistogram("key lengths (bytes)", stats.KeyLengths)
+	printHistogram("value sizes (bytes)", stats.ValueSizes)
+	printHistogram("ages (seconds)", stats.Ages)
+
+	return nil
+}
+
+// printHistogram prints the count of every bucket of the histogram.
+func printHistogram(title string, h bitcask.Histogram) {
+	fmt.Printf("\n%s\n", title)
+	for _, bucket := range h {
+		fmt.Printf("<= %d\t%d\n", bucket.Max, bucket.Count)
+	}
+}
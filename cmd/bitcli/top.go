@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// runTop prints the keys with the largest values, or the most written keys.
+func runTop(dir string, args []string) error {
+	fs := flag.NewFlagSet("top", flag.ContinueOnError)
+	n := fs.Int("n", 10, "the number of keys to list")
+	writes := fs.Bool("writes", false, "list the keys written the most times since the last merge")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	b, err := bitcask.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	if *writes {
+		keys, err := b.MostWrittenKeys(*n)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			fmt.Printf("%d\t%q\n", key.Writes, key.Key)
+		}
+		return nil
+	}
+
+	for _, stat := range b.LargestKeys(*n) {
+		fmt.Printf("%d\t%q\n", stat.ValueSize, stat.Key)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"github.com/zaher1307/bitcask/pkg/auth"
+	"github.com/zaher1307/bitcask/pkg/httpserver"
+)
+
+func main() {
+	directoryFlag := flag.String("directory", os.Getenv("HOME")+"/http_server_datastore", "the directory of db")
+	addrFlag := flag.String("addr", "127.0.0.1:8080", "the listen address, it must be a loopback address without -users")
+	spoolFlag := flag.String("spool", "", "the directory of the backup snapshots and uploads, a new temporary directory if empty")
+	restoreFlag := flag.String("restore-dir", "", "the directory where uploaded backups are restored, restores are disabled if empty")
+	keyFlag := flag.String("key-file", "", "the file holding the key signing the backups")
+	maxUploadFlag := flag.Int64("max-upload-size", 0, "the largest upload request body in bytes, 0 for 64MB")
+	usersFlag := flag.String("users", "", "the users file, requests must use basic authentication if it is set")
+	flag.Parse()
+
+	cfg := httpserver.Config{
+		SpoolDir:      *spoolFlag,
+		RestoreDir:    *restoreFlag,
+		MaxUploadSize: *maxUploadFlag,
+	}
+	if *keyFlag != "" {
+		key, err := os.ReadFile(*keyFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.SigningKey = key
+	}
+	if *usersFlag != "" {
+		users, err := auth.LoadFile(*usersFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.Auth = users
+	}
+
+	err := httpserver.StartServer(*directoryFlag, *addrFlag, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
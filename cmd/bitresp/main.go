@@ -6,15 +6,54 @@ import (
 	"log"
 	"os"
 
+	"github.com/zaher1307/bitcask/pkg/auth"
 	resp "github.com/zaher1307/bitcask/pkg/respserver"
 )
 
 func main() {
 	directoryFlag := flag.String("directory", os.Getenv("HOME")+"/resp_server_datastore", "the directory of db")
 	listenPortFlagInt := flag.Int("port", 6379, "the listen port")
-    flag.Parse()
-    listenPortFlagString := fmt.Sprint(*listenPortFlagInt)
-	err := resp.StartServer(*directoryFlag, listenPortFlagString)
+	usersFlag := flag.String("users", "", "the users file, clients must authenticate with AUTH if it is set")
+	rolesFlag := flag.String("roles", "", "the file of the commands allowed or denied by role")
+	maxKeyFlag := flag.Int("max-key-size", 0, "the longest key in bytes, 0 for the datastore limit")
+	maxValueFlag := flag.Int("max-value-size", 0, "the largest argument in bytes up to 256MB, 0 for 16MB")
+	maxInlineFlag := flag.Int("max-inline-size", 0, "the longest inline command in bytes, 0 for 64KB")
+	handoffFlag := flag.Bool("handoff", false, "take the datastore over from the running server and hand it over to the next one")
+	selftestFlag := flag.Bool("selftest", false, "run the readiness checks against a temporary datastore, print a report and exit")
+	flag.Parse()
+	listenPortFlagString := fmt.Sprint(*listenPortFlagInt)
+
+	if *selftestFlag {
+		if !runSelftest(*directoryFlag, listenPortFlagString, os.Stdout) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	cfg := resp.Config{
+		Handoff: *handoffFlag,
+		Limits: resp.Limits{
+			MaxKeySize:    *maxKeyFlag,
+			MaxValueSize:  *maxValueFlag,
+			MaxInlineSize: *maxInlineFlag,
+		},
+	}
+	if *usersFlag != "" {
+		users, err := auth.LoadFile(*usersFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.Auth = users
+	}
+	if *rolesFlag != "" {
+		roles, err := resp.LoadRules(*rolesFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cfg.Roles = roles
+	}
+
+	err := resp.StartServerWithConfig(*directoryFlag, listenPortFlagString, cfg)
 	if err != nil {
 		log.Fatal("error connection")
 		return
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// selftestKeys is the number of keys written by the self-test.
+const selftestKeys = 1000
+
+type (
+	// selftest runs the readiness checks against a temporary datastore.
+	selftest struct {
+		dir     string
+		db      *bitcask.Bitcask
+		out     io.Writer
+		failed  bool
+		current map[string]string
+	}
+
+	// latencies records the duration of the operations of a check.
+	latencies []time.Duration
+)
+
+// runSelftest checks that the host can serve a datastore in dataDir and listen on port,
+// then prints a readiness report to out.
+// Return false if any check failed.
+func runSelftest(dataDir, port string, out io.Writer) bool {
+	dir, err := os.MkdirTemp("", "bitresp-selftest")
+	if err != nil {
+		fmt.Fprintf(out, "FAIL\tsetup\t%v\n", err)
+		return false
+	}
+	defer os.RemoveAll(dir)
+
+	s := &selftest{dir: dir, out: out, current: make(map[string]string)}
+	s.check("directory", func() (string, error) { return checkDirectory(dataDir) })
+	s.check("listen", func() (string, error) { return checkListen(port) })
+	s.check("write", s.write)
+	s.check("read", s.read)
+	s.check("merge", s.merge)
+	s.check("recovery", s.recover)
+	s.check("sync", s.sync)
+	if s.db != nil {
+		s.db.Close()
+	}
+
+	if s.failed {
+		fmt.Fprintln(out, "not ready")
+	} else {
+		fmt.Fprintln(out, "ready")
+	}
+
+	return !s.failed
+}
+
+// check runs a single check and reports its outcome,
+// the checks after a failed one still run to give a complete report.
+func (s *selftest) check(name string, fn func() (string, error)) {
+	detail, err := fn()
+	if err != nil {
+		s.failed = true
+		fmt.Fprintf(s.out, "FAIL\t%s\t%v\n", name, err)
+		return
+	}
+	fmt.Fprintf(s.out, "PASS\t%s\t%s\n", name, detail)
+}
+
+// checkDirectory verifies that the datastore directory can be created and written.
+// The probe file is hidden so that it is never taken for a file of the datastore.
+func checkDirectory(dir string) (string, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.CreateTemp(dir, ".selftest-*")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+
+	return dir, os.Remove(f.Name())
+}
+
+// checkListen verifies that the port is free.
+func checkListen(port string) (string, error) {
+	l, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return "", err
+	}
+
+	return "port " + port, l.Close()
+}
+
+// write puts the keys into a new datastore and measures the latency of Put.
+func (s *selftest) write() (string, error) {
+	db, err := bitcask.Open(s.dir, bitcask.WithReadWrite())
+	if err != nil {
+		return "", err
+	}
+	s.db = db
+
+	var lat latencies
+	for i := 0; i < selftestKeys; i++ {
+		key, value := fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)
+		start := time.Now()
+		err := s.db.Put(key, value)
+		if err != nil {
+			return "", err
+		}
+		lat = append(lat, time.Since(start))
+		s.current[key] = value
+	}
+
+	return lat.summary("put"), nil
+}
+
+// read gets all the keys back and measures the latency of Get.
+func (s *selftest) read() (string, error) {
+	if s.db == nil {
+		return "", errors.New("no datastore")
+	}
+
+	var lat latencies
+	for key := range s.current {
+		start := time.Now()
+		err := s.verify(key)
+		if err != nil {
+			return "", err
+		}
+		lat = append(lat, time.Since(start))
+	}
+
+	return lat.summary("get"), nil
+}
+
+// merge overwrites and deletes part of the keys, merges the datastore and
+// verifies that every key is still correct.
+func (s *selftest) merge() (string, error) {
+	if s.db == nil {
+		return "", errors.New("no datastore")
+	}
+
+	for i := 0; i < selftestKeys; i += 2 {
+		key := fmt.Sprintf("key%d", i)
+		if i%4 == 0 {
+			err := s.db.Delete(key)
+			if err != nil {
+				return "", err
+			}
+			delete(s.current, key)
+		} else {
+			value := fmt.Sprintf("value%d-2", i)
+			err := s.db.Put(key, value)
+			if err != nil {
+				return "", err
+			}
+			s.current[key] = value
+		}
+	}
+
+	start := time.Now()
+	err := s.db.Merge()
+	if err != nil {
+		return "", err
+	}
+	took := time.Since(start)
+
+	return fmt.Sprintf("took %v", took), s.verifyAll()
+}
+
+// recover reopens the datastore, rebuilding the keydir from the files,
+// and verifies that every key is still correct.
+func (s *selftest) recover() (string, error) {
+	if s.db == nil {
+		return "", errors.New("no datastore")
+	}
+
+	err := s.db.Close()
+	s.db = nil
+	if err != nil {
+		return "", err
+	}
+
+	start := time.Now()
+	db, err := bitcask.Open(s.dir, bitcask.WithReadWrite())
+	if err != nil {
+		return "", err
+	}
+	took := time.Since(start)
+	s.db = db
+
+	return fmt.Sprintf("reopened in %v", took), s.verifyAll()
+}
+
+// sync measures the latency of Put when every write is flushed to the disk.
+func (s *selftest) sync() (string, error) {
+	if s.db != nil {
+		s.db.Close()
+		s.db = nil
+	}
+
+	db, err := bitcask.Open(s.dir, bitcask.WithReadWrite(), bitcask.WithSyncOnPut())
+	if err != nil {
+		return "", err
+	}
+	s.db = db
+
+	var lat latencies
+	for i := 0; i < selftestKeys/10; i++ {
+		start := time.Now()
+		err := s.db.Put(fmt.Sprintf("sync%d", i), "value")
+		if err != nil {
+			return "", err
+		}
+		lat = append(lat, time.Since(start))
+	}
+
+	return lat.summary("synced put"), nil
+}
+
+// verifyAll checks the value of every key and that the deleted keys are gone.
+func (s *selftest) verifyAll() error {
+	for i := 0; i < selftestKeys; i++ {
+		err := s.verify(fmt.Sprintf("key%d", i))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verify checks the value of a single key against what was written.
+func (s *selftest) verify(key string) error {
+	want, isExist := s.current[key]
+	got, err := s.db.Get(key)
+	if !isExist {
+		if err == nil {
+			return fmt.Errorf("deleted key %q is still readable", key)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get %q: %v", key, err)
+	}
+	if got != want {
+		return fmt.Errorf("get %q: got %q, want %q", key, got, want)
+	}
+
+	return nil
+}
+
+// summary summarizes the latencies by their percentiles.
+func (l latencies) summary(op string) string {
+	sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+	percentile := func(p int) time.Duration {
+		return l[(len(l)-1)*p/100]
+	}
+
+	return fmt.Sprintf("%d %ss p50=%v p99=%v max=%v", len(l), op, percentile(50), percentile(99), l[len(l)-1])
+}
@@ -0,0 +1,175 @@
+// Command bitsoak runs a long mixed workload against a bitcask datastore
+// and checks after every step that the datastore agrees with an in-memory model.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// soak holds the datastore under test and the model of what it must contain.
+type soak struct {
+	dir   string
+	db    *bitcask.Bitcask
+	rnd   *rand.Rand
+	model map[string]string
+	keys  int
+	ops   map[string]int
+}
+
+func main() {
+	directoryFlag := flag.String("directory", os.Getenv("HOME")+"/bitsoak_datastore", "the directory of db")
+	durationFlag := flag.Duration("duration", time.Hour, "how long to run the workload")
+	keysFlag := flag.Int("keys", 1000, "the number of distinct keys used by the workload")
+	seedFlag := flag.Int64("seed", time.Now().UnixNano(), "the seed of the workload")
+	reportFlag := flag.Duration("report", time.Minute, "the interval between progress reports")
+	flag.Parse()
+
+	log.Printf("bitsoak: directory=%s duration=%s keys=%d seed=%d",
+		*directoryFlag, *durationFlag, *keysFlag, *seedFlag)
+
+	s := &soak{
+		dir:   *directoryFlag,
+		rnd:   rand.New(rand.NewSource(*seedFlag)),
+		model: make(map[string]string),
+		keys:  *keysFlag,
+		ops:   make(map[string]int),
+	}
+
+	err := s.run(*durationFlag, *reportFlag)
+	if err != nil {
+		log.Fatalf("bitsoak: invariant violated (seed %d): %v", *seedFlag, err)
+	}
+	log.Printf("bitsoak: finished without violations: %v", s.ops)
+}
+
+// run drives the workload until the duration elapses or an invariant breaks.
+func (s *soak) run(duration, report time.Duration) error {
+	err := s.open()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if s.db != nil {
+			s.db.Close()
+		}
+	}()
+
+	deadline := time.Now().Add(duration)
+	nextReport := time.Now().Add(report)
+	for time.Now().Before(deadline) {
+		err := s.step()
+		if err != nil {
+			return err
+		}
+
+		if time.Now().After(nextReport) {
+			log.Printf("bitsoak: %d live keys, ops so far: %v", len(s.model), s.ops)
+			nextReport = time.Now().Add(report)
+		}
+	}
+
+	return s.verifyAll()
+}
+
+// step performs one random operation and checks its outcome against the model.
+func (s *soak) step() error {
+	key := fmt.Sprintf("key%d", s.rnd.Intn(s.keys))
+
+	switch p := s.rnd.Intn(1000); {
+	case p < 450:
+		s.ops["put"]++
+		value := fmt.Sprintf("value%d", s.rnd.Int63())
+		err := s.db.Put(key, value)
+		if err != nil {
+			return fmt.Errorf("put %s: %w", key, err)
+		}
+		s.model[key] = value
+	case p < 850:
+		s.ops["get"]++
+		return s.verify(key)
+	case p < 990:
+		s.ops["delete"]++
+		err := s.db.Delete(key)
+		_, isExist := s.model[key]
+		if isExist && err != nil {
+			return fmt.Errorf("delete %s: %w", key, err)
+		}
+		if !isExist && !errors.Is(err, bitcask.ErrKeyNotFound) {
+			return fmt.Errorf("delete of missing key %s: got %v", key, err)
+		}
+		delete(s.model, key)
+	case p < 995:
+		s.ops["merge"]++
+		err := s.db.Merge()
+		if err != nil {
+			return fmt.Errorf("merge: %w", err)
+		}
+		return s.verifyAll()
+	default:
+		s.ops["reopen"]++
+		err := s.db.Close()
+		s.db = nil
+		if err != nil {
+			return fmt.Errorf("close: %w", err)
+		}
+		err = s.open()
+		if err != nil {
+			return err
+		}
+		return s.verifyAll()
+	}
+
+	return nil
+}
+
+// open opens the datastore with write permission.
+func (s *soak) open() error {
+	db, err := bitcask.Open(s.dir, bitcask.WithReadWrite())
+	if err != nil {
+		return fmt.Errorf("open %s: %w", s.dir, err)
+	}
+	s.db = db
+
+	return nil
+}
+
+// verify checks that every acknowledged write of the key is readable
+// and that deleted keys are not resurrected.
+func (s *soak) verify(key string) error {
+	want, isExist := s.model[key]
+	got, err := s.db.Get(key)
+	if !isExist {
+		if !errors.Is(err, bitcask.ErrKeyNotFound) {
+			return fmt.Errorf("deleted key %s resurrected: got %q, %v", key, got, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("get %s: %w", key, err)
+	}
+	if got != want {
+		return fmt.Errorf("get %s: got %q, want %q", key, got, want)
+	}
+
+	return nil
+}
+
+// verifyAll checks every key of the key space.
+func (s *soak) verifyAll() error {
+	for i := 0; i < s.keys; i++ {
+		err := s.verify(fmt.Sprintf("key%d", i))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
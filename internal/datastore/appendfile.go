@@ -16,8 +16,8 @@ const (
 	// Merge represents that the file type is an active file.
 	Active AppendType = 1
 
-	// maxFileSize represents the maximum size for each file.
-	maxFileSize = 10 * 1024
+	// DefaultMaxFileSize is the size in bytes past which the append files rotate by default.
+	DefaultMaxFileSize = 10 * 1024
 )
 
 type (
@@ -32,18 +32,57 @@ type (
 		filePath    string
 		fileFlags   int
 		appendType  AppendType
+		now         func() time.Time
+		maxFileSize int64
 		currentPos  int
 		currentSize int
 	}
 )
 
-// WriteData writes a data record to the given append file.
+// WriteData writes a data record to the given append file,
+// the metadata is stored with the value if it is not empty.
+// Return the position of the written data.
+// Return error if the value is too large for a record or on system failures.
+func (a *AppendFile) WriteData(key, value string, meta map[string]string, tstamp int64) (int, error) {
+	err := recfmt.CheckValueSize(value, meta)
+	if err != nil {
+		return 0, err
+	}
+
+	return a.writeRec(recfmt.CompressDataFileRecMeta(key, value, meta, tstamp))
+}
+
+// WriteImmutable writes a data record flagged as immutable to the given append file,
+// the metadata is stored with the value if it is not empty.
+// Return the position of the written data.
+// Return error if the value is too large for a record or on system failures.
+func (a *AppendFile) WriteImmutable(key, value string, meta map[string]string, tstamp int64) (int, error) {
+	err := recfmt.CheckValueSize(value, meta)
+	if err != nil {
+		return 0, err
+	}
+
+	return a.writeRec(recfmt.CompressDataFileRecImmutable(key, value, meta, tstamp))
+}
+
+// WriteRef writes a data record whose value is the value of the record located by ref.
 // Return the position of the written data.
 // Return error on system failures.
-func (a *AppendFile) WriteData(key, value string, tstamp int64) (int, error) {
-	rec := recfmt.CompressDataFileRec(key, value, tstamp)
+func (a *AppendFile) WriteRef(key string, ref recfmt.ValueRef, tstamp int64) (int, error) {
+	return a.writeRec(recfmt.CompressDataFileRecRef(key, ref, tstamp))
+}
 
-	if a.fileWrapper == nil || len(rec)+a.currentSize > maxFileSize {
+// WriteTombstone writes the tombstone of a deleted key to the given append file.
+// Return the position of the written data.
+// Return error on system failures.
+func (a *AppendFile) WriteTombstone(key string, tstamp int64) (int, error) {
+	return a.writeRec(recfmt.CompressDataFileRecTombstone(key, tstamp))
+}
+
+// writeRec appends a data record, rotating the file if the record does not fit.
+// Return the position of the written record.
+func (a *AppendFile) writeRec(rec []byte) (int, error) {
+	if a.fileWrapper == nil || int64(len(rec)+a.currentSize) > a.maxFileSize {
 		err := a.newAppendFile()
 		if err != nil {
 			return 0, err
@@ -62,6 +101,51 @@ func (a *AppendFile) WriteData(key, value string, tstamp int64) (int, error) {
 	return writePos, nil
 }
 
+// WriteBatch writes the records of a batch with a single write, after a batch header,
+// so that readers of the file skip the batch if it is cut by a crash.
+// The keys flagged in deleted are written as tombstones.
+// The batch is never split over two files.
+// Return the positions of the written records.
+// Return error on system failures.
+func (a *AppendFile) WriteBatch(keys, values []string, deleted []bool, tstamp int64) ([]int, error) {
+	buf := recfmt.CompressBatchHdr(len(keys), tstamp)
+	positions := make([]int, len(keys))
+	for i := range keys {
+		positions[i] = len(buf)
+		if !deleted[i] {
+			err := recfmt.CheckValueSize(values[i], nil)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if deleted[i] {
+			buf = append(buf, recfmt.CompressDataFileRecTombstone(keys[i], tstamp)...)
+		} else {
+			buf = append(buf, recfmt.CompressDataFileRec(keys[i], values[i], tstamp)...)
+		}
+	}
+
+	if a.fileWrapper == nil || int64(len(buf)+a.currentSize) > a.maxFileSize {
+		err := a.newAppendFile()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	n, err := a.fileWrapper.Write(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range positions {
+		positions[i] += a.currentPos
+	}
+	a.currentPos += n
+	a.currentSize += n
+
+	return positions, nil
+}
+
 // WriteData writes a hint record to the hint file
 // associated with the given append file.
 // Return error on system failures.
@@ -75,12 +159,28 @@ func (a *AppendFile) WriteHint(key string, rec recfmt.KeyDirRec) error {
 	return nil
 }
 
+// Create creates the file of the append file if it was not created yet by a write.
+// Return error on system failures.
+func (a *AppendFile) Create() error {
+	if a.fileWrapper != nil {
+		return nil
+	}
+
+	return a.newAppendFile()
+}
+
 // newAppendFile creates new append file.
 // create a hint file associated with it if the file type is merge.
+// The previous file is flushed to the disk before it is closed, since Sync
+// only flushes the current one.
 // return error on system failures.
 func (a *AppendFile) newAppendFile() error {
 	if a.fileWrapper != nil {
-		err := a.fileWrapper.File.Close()
+		err := a.fileWrapper.File.Sync()
+		if err != nil {
+			return err
+		}
+		err = a.fileWrapper.File.Close()
 		if err != nil {
 			return err
 		}
@@ -92,9 +192,16 @@ func (a *AppendFile) newAppendFile() error {
 		}
 	}
 
-	tstamp := time.Now().UnixMicro()
+	// files are named by their creation time, a name that is already taken
+	// by a file created in the same microsecond is bumped to the next one.
+	tstamp := a.now().UnixMicro()
 	fileName := fmt.Sprintf("%d.data", tstamp)
-	file, err := sio.OpenFile(path.Join(a.filePath, fileName), a.fileFlags, os.FileMode(0666))
+	file, err := sio.OpenFile(path.Join(a.filePath, fileName), a.fileFlags|os.O_EXCL, os.FileMode(0666))
+	for os.IsExist(err) {
+		tstamp++
+		fileName = fmt.Sprintf("%d.data", tstamp)
+		file, err = sio.OpenFile(path.Join(a.filePath, fileName), a.fileFlags|os.O_EXCL, os.FileMode(0666))
+	}
 	if err != nil {
 		return err
 	}
@@ -103,6 +210,7 @@ func (a *AppendFile) newAppendFile() error {
 		hintName := fmt.Sprintf("%d.hint", tstamp)
 		hint, err := sio.OpenFile(path.Join(a.filePath, hintName), a.fileFlags, os.FileMode(0666))
 		if err != nil {
+			file.File.Close()
 			return err
 		}
 		a.hintWrapper = hint
@@ -131,11 +239,19 @@ func (a *AppendFile) Sync() error {
 }
 
 // Close closes the append file and its associated hint file if exists.
-func (a *AppendFile) Close() {
-	if a.fileWrapper != nil {
-		a.fileWrapper.File.Close()
-		if a.appendType == Merge {
-			a.hintWrapper.File.Close()
+// Return error on system failures.
+func (a *AppendFile) Close() error {
+	if a.fileWrapper == nil {
+		return nil
+	}
+
+	err := a.fileWrapper.File.Close()
+	if a.appendType == Merge {
+		hintErr := a.hintWrapper.File.Close()
+		if err == nil {
+			err = hintErr
 		}
 	}
+
+	return err
 }
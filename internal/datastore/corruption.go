@@ -0,0 +1,32 @@
+package datastore
+
+import (
+	"fmt"
+
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+// CorruptionError locates a corrupted record in the datastore files.
+// It unwraps to recfmt.ErrDataCorruption.
+type CorruptionError struct {
+	// File is the name of the data file holding the record.
+	File string
+	// Offset is the position of the record in the file.
+	Offset int64
+	// Key is the key of the record, it is empty when the key itself cannot be trusted.
+	Key string
+}
+
+// Error describes the location of the corrupted record.
+func (e *CorruptionError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("%s at offset %d: %v", e.File, e.Offset, recfmt.ErrDataCorruption)
+	}
+
+	return fmt.Sprintf("%s at offset %d, key %s: %v", e.File, e.Offset, PrintableKey(e.Key), recfmt.ErrDataCorruption)
+}
+
+// Unwrap returns recfmt.ErrDataCorruption.
+func (e *CorruptionError) Unwrap() error {
+	return recfmt.ErrDataCorruption
+}
@@ -0,0 +1,137 @@
+package datastore
+
+import (
+	"container/list"
+	"path"
+	"sync"
+
+	"github.com/zaher1307/bitcask/internal/sio"
+)
+
+// DefaultMaxOpenFiles is the number of data files kept open for reading by default.
+const DefaultMaxOpenFiles = 64
+
+type (
+	// fileCache keeps the most recently read data files open,
+	// so that reading a value does not open and close its file.
+	fileCache struct {
+		mu    sync.Mutex
+		dir   string
+		max   int
+		files map[string]*list.Element
+		lru   *list.List
+	}
+
+	// cachedFile is an open data file along with the number of reads using it.
+	// It is closed once it is removed from the cache and no read uses it anymore.
+	cachedFile struct {
+		name    string
+		f       *sio.File
+		refs    int
+		removed bool
+	}
+)
+
+// newFileCache creates a cache keeping up to max files of the directory dir open.
+func newFileCache(dir string, max int) *fileCache {
+	return &fileCache{
+		dir:   dir,
+		max:   max,
+		files: make(map[string]*list.Element),
+		lru:   list.New(),
+	}
+}
+
+// acquire returns the open file with the given name, opening it if it is not cached.
+// The file must be released once the read is done.
+// The least recently used files that are not in use are closed when the cache is full.
+func (c *fileCache) acquire(name string) (*cachedFile, error) {
+	c.mu.Lock()
+	if elem, isExist := c.files[name]; isExist {
+		c.lru.MoveToFront(elem)
+		cf := elem.Value.(*cachedFile)
+		cf.refs++
+		c.mu.Unlock()
+		return cf, nil
+	}
+	c.mu.Unlock()
+
+	f, err := sio.Open(path.Join(c.dir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// another read may have opened the same file meanwhile
+	if elem, isExist := c.files[name]; isExist {
+		f.File.Close()
+		c.lru.MoveToFront(elem)
+		cf := elem.Value.(*cachedFile)
+		cf.refs++
+		return cf, nil
+	}
+
+	cf := &cachedFile{name: name, f: f, refs: 1}
+	if c.max <= 0 {
+		// caching is disabled, the file is closed when released
+		cf.removed = true
+		return cf, nil
+	}
+	c.files[name] = c.lru.PushFront(cf)
+	for c.lru.Len() > c.max {
+		c.remove(c.lru.Back())
+	}
+
+	return cf, nil
+}
+
+// release ends a read of the file, closing it if it was removed from the cache meanwhile.
+func (c *fileCache) release(cf *cachedFile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cf.refs--
+	if cf.removed && cf.refs == 0 {
+		cf.f.File.Close()
+	}
+}
+
+// invalidate removes the file with the given name from the cache, it is called
+// before the file is deleted or replaced so that no read uses its old content.
+func (c *fileCache) invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, isExist := c.files[name]; isExist {
+		c.remove(elem)
+	}
+}
+
+// setMax changes the number of files kept open, closing the files exceeding it.
+func (c *fileCache) setMax(max int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.max = max
+	for c.lru.Len() > 0 && c.lru.Len() > c.max {
+		c.remove(c.lru.Back())
+	}
+}
+
+// close removes all the files from the cache.
+func (c *fileCache) close() {
+	c.setMax(0)
+}
+
+// remove removes the file of elem from the cache, closing it unless a read uses it.
+// It is called with the cache lock held.
+func (c *fileCache) remove(elem *list.Element) {
+	cf := c.lru.Remove(elem).(*cachedFile)
+	delete(c.files, cf.name)
+	cf.removed = true
+	if cf.refs == 0 {
+		cf.f.File.Close()
+	}
+}
@@ -0,0 +1,48 @@
+package datastore
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// MaxKeySize is the maximum key length in bytes that fits in the record formats.
+	MaxKeySize = 1<<16 - 1
+
+	// maxPrintedKey is the maximum number of key bytes written in error messages.
+	maxPrintedKey = 128
+)
+
+// KeyError wraps err with the given key in a form that is safe to print.
+func KeyError(key string, err error) error {
+	return fmt.Errorf("%s: %w", PrintableKey(key), err)
+}
+
+// PrintableKey returns the key unchanged if it only contains printable characters,
+// otherwise it returns the key quoted with its control and invalid bytes escaped.
+// Long keys are cut to keep messages and logs readable.
+func PrintableKey(key string) string {
+	cut := len(key) > maxPrintedKey
+	if cut {
+		key = key[:maxPrintedKey]
+	}
+
+	printable := utf8.ValidString(key)
+	for _, r := range key {
+		if !printable || !unicode.IsPrint(r) {
+			printable = false
+			break
+		}
+	}
+
+	if !printable {
+		key = strconv.Quote(key)
+	}
+	if cut {
+		key += "..."
+	}
+
+	return key
+}
@@ -0,0 +1,75 @@
+package datastore
+
+import (
+	"path/filepath"
+	"sync"
+
+	"github.com/gofrs/flock"
+)
+
+// heldLocks holds the datastore locks acquired by this process by directory,
+// so that the locks of datastores that were never closed can be released.
+var heldLocks = struct {
+	mu    sync.Mutex
+	locks map[string][]*flock.Flock
+}{locks: make(map[string][]*flock.Flock)}
+
+// lockKey returns the absolute path identifying the datastore directory in heldLocks.
+func lockKey(dirPath string) string {
+	abs, err := filepath.Abs(dirPath)
+	if err != nil {
+		return filepath.Clean(dirPath)
+	}
+
+	return abs
+}
+
+// registerLock records a lock acquired on the given datastore directory.
+func registerLock(dirPath string, l *flock.Flock) {
+	heldLocks.mu.Lock()
+	defer heldLocks.mu.Unlock()
+
+	key := lockKey(dirPath)
+	heldLocks.locks[key] = append(heldLocks.locks[key], l)
+}
+
+// unregisterLock forgets a lock released on the given datastore directory.
+func unregisterLock(dirPath string, l *flock.Flock) {
+	heldLocks.mu.Lock()
+	defer heldLocks.mu.Unlock()
+
+	key := lockKey(dirPath)
+	locks := heldLocks.locks[key]
+	for i := range locks {
+		if locks[i] == l {
+			locks = append(locks[:i], locks[i+1:]...)
+			break
+		}
+	}
+	if len(locks) == 0 {
+		delete(heldLocks.locks, key)
+	} else {
+		heldLocks.locks[key] = locks
+	}
+}
+
+// ForceUnlock releases the locks this process holds on the given datastore directory,
+// including the locks of datastores that were never closed.
+// The locks held by other processes are left untouched.
+// Return whether a lock was released, and an error if a lock could not be released.
+func ForceUnlock(dirPath string) (bool, error) {
+	heldLocks.mu.Lock()
+	key := lockKey(dirPath)
+	locks := heldLocks.locks[key]
+	delete(heldLocks.locks, key)
+	heldLocks.mu.Unlock()
+
+	for _, l := range locks {
+		err := l.Unlock()
+		if err != nil {
+			return true, err
+		}
+	}
+
+	return len(locks) > 0, nil
+}
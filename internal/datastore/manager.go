@@ -6,10 +6,11 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"time"
 
+	"github.com/gofrs/flock"
 	"github.com/zaher1307/bitcask/internal/recfmt"
 	"github.com/zaher1307/bitcask/internal/sio"
-	"github.com/gofrs/flock"
 )
 
 const (
@@ -17,18 +18,17 @@ const (
 	ExclusiveLock LockMode = 0
 	// SharedLock is an option to make the datastore lock shared.
 	SharedLock LockMode = 1
-
-	// TompStone is a special value to mark the deleted values.
-	TompStone = "8890fc70294d02dbde257989e802451c2276be7fb177c3ca4399dc4728e4e1e0"
+	// NoLock opens the datastore without locking it, for copies of datastores nothing writes to.
+	NoLock LockMode = 2
 
 	// lockFile is the name of the file used to lock the datastore directory.
 	lockFile = ".lck"
 )
 
 var (
-	// errAccessDenied happens when a bitcask process tries to access to the datastore
+	// ErrLocked happens when a bitcask process tries to access to the datastore
 	// when the directory is locked.
-	errAccessDenied = errors.New("access denied: datastore is locked")
+	ErrLocked = errors.New("access denied: datastore is locked")
 
 	// ErrKeyNotExist happens when accessing value does not exist.
 	ErrKeyNotExist = errors.New("key does not exist")
@@ -40,9 +40,11 @@ type (
 
 	// DataStore represents and contains the metadata of the datastore directory.
 	DataStore struct {
-		path string
-		lock LockMode
-		flck *flock.Flock
+		path       string
+		lock       LockMode
+		flck       *flock.Flock
+		readPolicy sio.ReadPolicy
+		files      *fileCache
 	}
 )
 
@@ -50,19 +52,24 @@ type (
 // Return an error on system failures or when access to the directory is denied.
 func NewDataStore(dataStorePath string, lock LockMode) (*DataStore, error) {
 	d := &DataStore{
-		path: dataStorePath,
-		lock: lock,
+		path:       dataStorePath,
+		lock:       lock,
+		readPolicy: sio.DefaultReadPolicy,
+		files:      newFileCache(dataStorePath, DefaultMaxOpenFiles),
 	}
 
 	dir, dirErr := os.Open(dataStorePath)
 
-	if dirErr == nil {
+	if dirErr == nil && lock == NoLock {
+		dir.Close()
+	} else if dirErr == nil {
+		defer dir.Close()
 		acquired, err := d.openDataStoreDir()
 		if err != nil {
 			return nil, err
 		}
 		if !acquired {
-			return nil, errAccessDenied
+			return nil, ErrLocked
 		}
 	} else if os.IsNotExist(dirErr) && lock == ExclusiveLock {
 		err := d.createDataStoreDir()
@@ -72,17 +79,20 @@ func NewDataStore(dataStorePath string, lock LockMode) (*DataStore, error) {
 	} else {
 		return nil, dirErr
 	}
-	defer dir.Close()
 
 	return d, nil
 }
 
 // NewAppendFile creates new append files object with the given path, flags and type.
-func NewAppendFile(dataStorePath string, fileFlags int, appendType AppendType) *AppendFile {
+// now is used to name the files created by the append file, a new file is created
+// whenever a write would grow the current one past maxFileSize bytes.
+func NewAppendFile(dataStorePath string, fileFlags int, appendType AppendType, now func() time.Time, maxFileSize int64) *AppendFile {
 	a := &AppendFile{
-		filePath:   dataStorePath,
-		fileFlags:  fileFlags,
-		appendType: appendType,
+		filePath:    dataStorePath,
+		fileFlags:   fileFlags,
+		appendType:  appendType,
+		now:         now,
+		maxFileSize: maxFileSize,
 	}
 
 	return a
@@ -136,34 +146,129 @@ func (d *DataStore) acquireFileLock() (bool, error) {
 	if err != nil {
 		return false, err
 	}
+	if ok {
+		registerLock(d.path, d.flck)
+	}
 
 	return ok, nil
 }
 
 // ReadValueFromFile parses the valued corresponding to the given key.
+// The record checksum is validated only when verify is true.
 // Return the parsed value and a non-nil error if values is not exist
 // or on system failures.
-func (d *DataStore) ReadValueFromFile(fileId, key string, valuePos, valueSize uint32) (string, error) {
+func (d *DataStore) ReadValueFromFile(fileId, key string, valuePos, valueSize uint32, verify bool) (string, error) {
+	data, err := d.ReadRecordFromFile(fileId, key, valuePos, valueSize, verify)
+	if err != nil {
+		return "", err
+	}
+
+	return data.Value, nil
+}
+
+// ReadRecordFromFile parses the record corresponding to the given key,
+// along with the metadata stored with its value.
+// The value of a record referencing another record is read from the referenced record.
+// The record checksum is validated only when verify is true.
+// Return a non-nil error if the record is a tombstone or on system failures.
+func (d *DataStore) ReadRecordFromFile(fileId, key string, valuePos, valueSize uint32, verify bool) (*recfmt.DataRec, error) {
 	bufsz := recfmt.DataFileRecHdr + uint32(len(key)) + valueSize
 	buf := make([]byte, bufsz)
 
-	f, err := sio.Open(path.Join(d.path, fileId))
+	err := d.readAt(fileId, buf, int64(valuePos))
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	var data *recfmt.DataRec
+	if verify {
+		data, _, err = recfmt.ExtractDataFileRec(buf)
+		if err != nil {
+			return nil, &CorruptionError{File: fileId, Offset: int64(valuePos), Key: key}
+		}
+	} else {
+		data, _, err = recfmt.ParseDataFileRec(buf)
+		if err != nil {
+			return nil, &CorruptionError{File: fileId, Offset: int64(valuePos), Key: key}
+		}
+	}
+
+	if data.Tombstone {
+		return nil, KeyError(data.Key, ErrKeyNotExist)
+	}
+	if data.Ref != nil {
+		shared, err := d.ReadRecordFromFile(data.Ref.FileId, data.Ref.Key, data.Ref.ValuePos, data.Ref.ValueSize, verify)
+		if err != nil {
+			return nil, err
+		}
+		data.Value = shared.Value
 	}
-	defer f.File.Close()
 
-	f.ReadAt(buf, int64(valuePos))
-	data, _, err := recfmt.ExtractDataFileRec(buf)
+	return data, nil
+}
+
+// ReadImmutable reports whether the record at the given position of the file
+// is flagged as immutable, reading only its header.
+// Return an error on system failures.
+func (d *DataStore) ReadImmutable(fileId string, valuePos uint32) (bool, error) {
+	hdr := make([]byte, recfmt.DataFileRecHdr)
+	err := d.readAt(fileId, hdr, int64(valuePos))
 	if err != nil {
-		return "", err
+		return false, err
+	}
+
+	return recfmt.DataFileRecImmutable(hdr), nil
+}
+
+// SetReadPolicy sets how the reads of values handle transient errors and slow storage.
+func (d *DataStore) SetReadPolicy(p sio.ReadPolicy) {
+	d.readPolicy = p
+}
+
+// readAt fills buf from the given position of the file with the read policy of the datastore.
+// A read exceeding the policy timeout returns sio.ErrTimeout and is left running in the background.
+func (d *DataStore) readAt(fileId string, buf []byte, off int64) error {
+	read := func(buf []byte) error {
+		cf, err := d.files.acquire(fileId)
+		if err != nil {
+			return err
+		}
+		defer d.files.release(cf)
+
+		_, err = cf.f.ReadAtPolicy(buf, off, d.readPolicy)
+		return err
 	}
 
-	if data.Value == TompStone {
-		return "", fmt.Errorf("%s: %s", data.Key, ErrKeyNotExist)
+	if d.readPolicy.Timeout <= 0 {
+		return read(buf)
 	}
 
-	return data.Value, nil
+	// the abandoned read fills its own buffer, so buf is never written after a timeout
+	tmp := make([]byte, len(buf))
+	done := make(chan error, 1)
+	go func() { done <- read(tmp) }()
+
+	timer := time.NewTimer(d.readPolicy.Timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		copy(buf, tmp)
+		return err
+	case <-timer.C:
+		return fmt.Errorf("%s: %w", fileId, sio.ErrTimeout)
+	}
+}
+
+// SetMaxOpenFiles sets the number of data files kept open for reading values,
+// the least recently read files are closed beyond it. Files are opened on every read when max is 0.
+func (d *DataStore) SetMaxOpenFiles(max int) {
+	d.files.setMax(max)
+}
+
+// Invalidate closes the cached handle of the given data file,
+// it must be called before the file is deleted or replaced.
+func (d *DataStore) Invalidate(fileId string) {
+	d.files.invalidate(fileId)
 }
 
 // Path returns the path of the datastore directory.
@@ -171,7 +276,14 @@ func (d *DataStore) Path() string {
 	return d.path
 }
 
-// Close frees the acquired lock on the datastore directory.
-func (d *DataStore) Close() {
-	d.flck.Unlock()
+// Close closes the cached data files and frees the acquired lock on the datastore directory.
+// Return an error if the lock could not be released.
+func (d *DataStore) Close() error {
+	d.files.close()
+	if d.flck == nil {
+		// the datastore was opened with NoLock
+		return nil
+	}
+	unregisterLock(d.path, d.flck)
+	return d.flck.Unlock()
 }
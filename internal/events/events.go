@@ -0,0 +1,131 @@
+// Package events provides the bus the datastore publishes its activity on,
+// so the frontends, metrics and loggers can observe it.
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Rotation happens whenever a new active data file is created.
+	Rotation Kind = 0
+	// Merge happens whenever a merge finishes, successfully or not.
+	Merge Kind = 1
+	// Corruption happens whenever a read detects a corrupted record.
+	Corruption Kind = 2
+	// Eviction happens whenever a key is evicted by the memory limit.
+	Eviction Kind = 3
+)
+
+type (
+	// Kind represents the type of an event.
+	Kind int
+
+	// Event represents an activity of the datastore.
+	Event struct {
+		Kind Kind
+		// Time is when the event happened.
+		Time time.Time
+		// File is the data file created by a rotation.
+		File string
+		// Key is the key of a corrupted record or an evicted key.
+		Key string
+		// Err is the error of a failed merge or the corruption of a record.
+		Err error
+	}
+
+	// Bus delivers the published events to the subscribers.
+	// Publishing never blocks, the events a subscriber is too slow to receive are dropped.
+	Bus struct {
+		// dropped is accessed atomically, it is kept first to stay 64-bit aligned on 32-bit platforms.
+		dropped uint64
+
+		mu     sync.RWMutex
+		subs   map[int]*subscription
+		nextId int
+	}
+
+	// subscription holds the channel of a subscriber and the kinds it receives.
+	subscription struct {
+		ch    chan Event
+		kinds map[Kind]bool
+	}
+)
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	switch k {
+	case Rotation:
+		return "rotation"
+	case Merge:
+		return "merge"
+	case Corruption:
+		return "corruption"
+	case Eviction:
+		return "eviction"
+	default:
+		return "unknown"
+	}
+}
+
+// NewBus creates a bus without subscribers.
+func NewBus() *Bus {
+	return &Bus{
+		subs: make(map[int]*subscription),
+	}
+}
+
+// Subscribe returns a channel receiving the events of the given kinds, or of every kind
+// if none is given, buffered to hold buffer events.
+// The returned function cancels the subscription and closes the channel.
+func (b *Bus) Subscribe(buffer int, kinds ...Kind) (<-chan Event, func()) {
+	sub := &subscription{ch: make(chan Event, buffer)}
+	if len(kinds) > 0 {
+		sub.kinds = make(map[Kind]bool, len(kinds))
+		for _, kind := range kinds {
+			sub.kinds[kind] = true
+		}
+	}
+
+	b.mu.Lock()
+	id := b.nextId
+	b.nextId++
+	b.subs[id] = sub
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+			close(sub.ch)
+		})
+	}
+
+	return sub.ch, cancel
+}
+
+// Publish delivers the event to the subscribers of its kind.
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, sub := range b.subs {
+		if sub.kinds != nil && !sub.kinds[e.Kind] {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			atomic.AddUint64(&b.dropped, 1)
+		}
+	}
+}
+
+// Dropped returns the number of events not delivered to a subscriber with a full channel.
+func (b *Bus) Dropped() uint64 {
+	return atomic.LoadUint64(&b.dropped)
+}
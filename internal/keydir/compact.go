@@ -0,0 +1,200 @@
+package keydir
+
+import (
+	"encoding/binary"
+
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+const (
+	// arenaSize is the size of every byte arena of a compact keydir,
+	// it fits the largest entry.
+	arenaSize = 4 << 20
+
+	// compactEntryHdr is the size of an entry header in the arenas:
+	// next entry ref (8), file index (4), value size (4), value position (4),
+	// timestamp (8) and key size (2).
+	compactEntryHdr = 30
+
+	// noEntry ends the chains of entries.
+	noEntry = ^uint64(0)
+)
+
+// compact is a keydir that stores its entries in large byte arenas instead of
+// map values holding strings, so that the garbage collector has no pointers to scan
+// however many keys there are. The index maps the hash of the keys to a chain of
+// entries referenced by arena and offset, and the file ids are stored once in a table.
+// The space of deleted entries is only reclaimed when a new keydir is built by a merge.
+type compact struct {
+	index   map[uint64]uint64
+	arenas  [][]byte
+	files   []string
+	fileIdx map[string]uint32
+	len     int
+}
+
+// newCompact creates an empty compact keydir.
+func newCompact() *compact {
+	return &compact{
+		index:   make(map[uint64]uint64),
+		fileIdx: make(map[string]uint32),
+	}
+}
+
+// hashKey returns the FNV-1a hash of the key.
+func hashKey(key string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+
+	return h
+}
+
+// entry returns the bytes of the entry referenced by ref.
+func (k *compact) entry(ref uint64) []byte {
+	return k.arenas[ref>>32][uint32(ref):]
+}
+
+// entryKey returns the key bytes of the given entry.
+func entryKey(e []byte) []byte {
+	keySize := int(binary.LittleEndian.Uint16(e[28:]))
+	return e[compactEntryHdr : compactEntryHdr+keySize]
+}
+
+// find returns the ref of the entry of the key and the ref of the entry before it in its chain,
+// prev is noEntry if the entry is the head of the chain and ref is noEntry if the key does not exist.
+func (k *compact) find(key string, h uint64) (ref, prev uint64) {
+	ref, isExist := k.index[h]
+	if !isExist {
+		return noEntry, noEntry
+	}
+
+	prev = noEntry
+	for ref != noEntry {
+		e := k.entry(ref)
+		if string(entryKey(e)) == key {
+			return ref, prev
+		}
+		prev = ref
+		ref = binary.LittleEndian.Uint64(e)
+	}
+
+	return noEntry, noEntry
+}
+
+// Get returns the record of the key and whether the key exists.
+func (k *compact) Get(key string) (recfmt.KeyDirRec, bool) {
+	ref, _ := k.find(key, hashKey(key))
+	if ref == noEntry {
+		return recfmt.KeyDirRec{}, false
+	}
+
+	return k.entryRec(k.entry(ref)), true
+}
+
+// entryRec decodes the record of the given entry.
+func (k *compact) entryRec(e []byte) recfmt.KeyDirRec {
+	return recfmt.KeyDirRec{
+		FileId:    k.files[binary.LittleEndian.Uint32(e[8:])],
+		ValueSize: binary.LittleEndian.Uint32(e[12:]),
+		ValuePos:  binary.LittleEndian.Uint32(e[16:]),
+		Tstamp:    int64(binary.LittleEndian.Uint64(e[20:])),
+	}
+}
+
+// putRec encodes the record into the given entry.
+func (k *compact) putRec(e []byte, rec recfmt.KeyDirRec) {
+	idx, isExist := k.fileIdx[rec.FileId]
+	if !isExist {
+		idx = uint32(len(k.files))
+		k.files = append(k.files, rec.FileId)
+		k.fileIdx[rec.FileId] = idx
+	}
+
+	binary.LittleEndian.PutUint32(e[8:], idx)
+	binary.LittleEndian.PutUint32(e[12:], rec.ValueSize)
+	binary.LittleEndian.PutUint32(e[16:], rec.ValuePos)
+	binary.LittleEndian.PutUint64(e[20:], uint64(rec.Tstamp))
+}
+
+// Set adds or replaces the record of the key.
+func (k *compact) Set(key string, rec recfmt.KeyDirRec) {
+	h := hashKey(key)
+	if ref, _ := k.find(key, h); ref != noEntry {
+		k.putRec(k.entry(ref), rec)
+		return
+	}
+
+	size := compactEntryHdr + len(key)
+	last := len(k.arenas) - 1
+	if last < 0 || len(k.arenas[last])+size > arenaSize {
+		k.arenas = append(k.arenas, make([]byte, 0, arenaSize))
+		last++
+	}
+	offset := len(k.arenas[last])
+	k.arenas[last] = k.arenas[last][:offset+size]
+	e := k.arenas[last][offset:]
+
+	next, isExist := k.index[h]
+	if !isExist {
+		next = noEntry
+	}
+	binary.LittleEndian.PutUint64(e, next)
+	k.putRec(e, rec)
+	binary.LittleEndian.PutUint16(e[28:], uint16(len(key)))
+	copy(e[compactEntryHdr:], key)
+
+	k.index[h] = uint64(last)<<32 | uint64(offset)
+	k.len++
+}
+
+// Delete removes the key if it exists.
+func (k *compact) Delete(key string) {
+	h := hashKey(key)
+	ref, prev := k.find(key, h)
+	if ref == noEntry {
+		return
+	}
+
+	next := binary.LittleEndian.Uint64(k.entry(ref))
+	switch {
+	case prev != noEntry:
+		binary.LittleEndian.PutUint64(k.entry(prev), next)
+	case next != noEntry:
+		k.index[h] = next
+	default:
+		delete(k.index, h)
+	}
+	k.len--
+}
+
+// Iterate calls fn for every key until fn returns false.
+func (k *compact) Iterate(fn func(key string, rec recfmt.KeyDirRec) bool) {
+	for _, ref := range k.index {
+		for ref != noEntry {
+			e := k.entry(ref)
+			if !fn(string(entryKey(e)), k.entryRec(e)) {
+				return
+			}
+			ref = binary.LittleEndian.Uint64(e)
+		}
+	}
+}
+
+// RandomKey returns a key picked at random with its record,
+// the head of the chain the iteration of the index starts at.
+func (k *compact) RandomKey() (string, recfmt.KeyDirRec, bool) {
+	for _, ref := range k.index {
+		e := k.entry(ref)
+		return string(entryKey(e)), k.entryRec(e), true
+	}
+
+	return "", recfmt.KeyDirRec{}, false
+}
+
+// Len returns the number of keys.
+func (k *compact) Len() int {
+	return k.len
+}
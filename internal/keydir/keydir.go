@@ -2,11 +2,16 @@
 package keydir
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"os"
 	"path"
+	"sort"
 	"strings"
 
+	"github.com/zaher1307/bitcask/internal/datastore"
 	"github.com/zaher1307/bitcask/internal/recfmt"
 	"github.com/zaher1307/bitcask/internal/sio"
 )
@@ -34,41 +39,213 @@ type (
 	// KeyDirPrivacy specifies whether the keydir is private or shared.
 	KeyDirPrivacy int
 
-	// KeyDir represents the map used by the bitcask.
-	KeyDir map[string]recfmt.KeyDirRec
+	// Kind specifies the implementation of the keydir.
+	Kind int
+
+	// KeyDir represents the index used by the bitcask to locate the records of the keys.
+	// Implementations are not safe for concurrent use, the bitcask guards them with its locks.
+	KeyDir interface {
+		// Get returns the record of the key and whether the key exists.
+		Get(key string) (recfmt.KeyDirRec, bool)
+		// Set adds or replaces the record of the key.
+		Set(key string, rec recfmt.KeyDirRec)
+		// Delete removes the key if it exists.
+		Delete(key string)
+		// Iterate calls fn for every key until fn returns false.
+		// The keys must not be added or deleted during the iteration.
+		Iterate(fn func(key string, rec recfmt.KeyDirRec) bool)
+		// RandomKey returns a key picked at random with its record,
+		// and false if the keydir is empty.
+		RandomKey() (string, recfmt.KeyDirRec, bool)
+		// Len returns the number of keys.
+		Len() int
+	}
+
+	// Ordered is implemented by the keydirs keeping the keys sorted,
+	// which iterate over a range of keys without visiting the others.
+	Ordered interface {
+		KeyDir
+		// IterateFrom calls fn for every key from start in ascending order until fn returns false.
+		IterateFrom(start string, fn func(key string, rec recfmt.KeyDirRec) bool)
+	}
+
+	// Map is the default keydir, a plain map with no ordering of the keys.
+	Map map[string]recfmt.KeyDirRec
+
+	// Report describes how a keydir was built.
+	Report struct {
+		// KeyDirFile is set when the keydir was loaded from the keydir file.
+		KeyDirFile bool
+		// KeyDirFileRejected is the reason an existing keydir file was ignored.
+		KeyDirFileRejected string
+		// DataFiles are the data files parsed, ordered by name.
+		DataFiles []string
+		// HintFiles are the hint files used instead of their data files, ordered by name.
+		HintFiles []string
+		// RejectedHints are the hint files that did not match their data files, ordered by name.
+		RejectedHints []string
+		// TornFiles are the data files ending with a record cut by a crash, ordered by name.
+		// The record is left out of the keydir, and the file is truncated before it when repairing.
+		TornFiles []string
+	}
 )
 
-// New creates a new keydir map from the given datastore.
+const (
+	// MapKind selects the Map keydir.
+	MapKind Kind = iota
+	// ShardedKind selects a keydir split over several maps, each map grows
+	// on its own so that large keydirs avoid long pauses while rehashing.
+	ShardedKind
+	// OrderedKind selects a keydir that iterates over the keys in ascending order,
+	// at the cost of more memory and logarithmic lookups.
+	OrderedKind
+	// CompactKind selects a keydir that keeps its entries in byte arenas,
+	// so that keydirs of many millions of keys put no load on the garbage collector.
+	CompactKind
+)
+
+// New creates a new keydir of the given kind from the given datastore.
 // Select the convenient mechanism of building the keydir.
 // Share the built keydir map if shared privacy is specified.
+// Truncate the data files ending with a record cut by a crash if repair is specified.
+// Return a report of the files used to build the keydir.
 // Return an error on system failures.
-func New(dataStorePath string, privacy KeyDirPrivacy) (KeyDir, error) {
-	k := KeyDir{}
+func New(dataStorePath string, privacy KeyDirPrivacy, kind Kind, repair bool) (KeyDir, Report, error) {
+	k := Map{}
+	var report Report
 
-	okay, err := k.keyDirFileBuild(dataStorePath)
+	okay, err := k.keyDirFileBuild(dataStorePath, &report)
 	if err != nil {
-		return nil, err
+		return nil, report, err
 	}
 	if okay {
-		return k, nil
+		report.KeyDirFile = true
+		return convert(k, kind), report, nil
 	}
 
-	err = k.dataStoreFilesBuild(dataStorePath)
+	err = k.dataStoreFilesBuild(dataStorePath, repair, &report)
 	if err != nil {
-		return nil, err
+		return nil, report, err
 	}
+	sort.Strings(report.DataFiles)
+	sort.Strings(report.HintFiles)
+	sort.Strings(report.RejectedHints)
+	sort.Strings(report.TornFiles)
 
 	if privacy == SharedKeyDir {
-		k.share(dataStorePath)
+		err = k.share(dataStorePath)
+		if err != nil {
+			log.Printf("keydir: cannot share keydir of %s: %v", dataStorePath, err)
+		}
+	}
+
+	return convert(k, kind), report, nil
+}
+
+// RemoveFile removes the shared keydir file of the given datastore if it exists.
+// Writers call it once they change the datastore, as the keydir file is then stale.
+func RemoveFile(dataStorePath string) error {
+	err := os.Remove(path.Join(dataStorePath, keyDirFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Share writes the given keydir to the keydir file of the datastore, so that the next
+// process opening the datastore builds its keydir from the file instead of the data files.
+// The datastore must not be changed anymore by the caller.
+// Return an error on system failures.
+func Share(dataStorePath string, k KeyDir) error {
+	m, isMap := k.(Map)
+	if !isMap {
+		m = make(Map, k.Len())
+		k.Iterate(func(key string, rec recfmt.KeyDirRec) bool {
+			m[key] = rec
+			return true
+		})
+	}
+
+	return m.share(dataStorePath)
+}
+
+// Empty creates an empty keydir of the given kind.
+func Empty(kind Kind) KeyDir {
+	switch kind {
+	case ShardedKind:
+		return newSharded()
+	case OrderedKind:
+		return newOrdered()
+	case CompactKind:
+		return newCompact()
+	default:
+		return Map{}
+	}
+}
+
+// convert moves the records of the built map into a keydir of the given kind.
+// The keydir is always built as a map since the keydir file is shared from it.
+func convert(m Map, kind Kind) KeyDir {
+	if kind == MapKind {
+		return m
+	}
+
+	k := Empty(kind)
+	for key, rec := range m {
+		k.Set(key, rec)
+		delete(m, key)
+	}
+
+	return k
+}
+
+// Get returns the record of the key and whether the key exists.
+func (k Map) Get(key string) (recfmt.KeyDirRec, bool) {
+	rec, isExist := k[key]
+	return rec, isExist
+}
+
+// Set adds or replaces the record of the key.
+func (k Map) Set(key string, rec recfmt.KeyDirRec) {
+	k[key] = rec
+}
+
+// Delete removes the key if it exists.
+func (k Map) Delete(key string) {
+	delete(k, key)
+}
+
+// Iterate calls fn for every key until fn returns false.
+func (k Map) Iterate(fn func(key string, rec recfmt.KeyDirRec) bool) {
+	for key, rec := range k {
+		if !fn(key, rec) {
+			return
+		}
+	}
+}
+
+// RandomKey returns a key picked at random with its record,
+// the iteration of a map starts at a random key.
+func (k Map) RandomKey() (string, recfmt.KeyDirRec, bool) {
+	for key, rec := range k {
+		return key, rec, true
 	}
 
-	return k, nil
+	return "", recfmt.KeyDirRec{}, false
+}
+
+// Len returns the number of keys.
+func (k Map) Len() int {
+	return len(k)
 }
 
 // keyDirFileBuild tries to build the keydir from the shared keydir file.
-// return false if there is no keydir or the existing keydir is old.
+// return false if there is no keydir or the existing keydir is old, corrupted
+// or references data files that changed since it was written.
 // return an error on system failures.
-func (k KeyDir) keyDirFileBuild(dataStorePath string) (bool, error) {
+// The reason an existing keydir file is ignored is recorded in report.
+func (k Map) keyDirFileBuild(dataStorePath string, report *Report) (bool, error) {
 	data, err := os.ReadFile(path.Join(dataStorePath, keyDirFile))
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -77,17 +254,37 @@ func (k KeyDir) keyDirFileBuild(dataStorePath string) (bool, error) {
 		return false, err
 	}
 
-	okay, err := isOld(dataStorePath)
-	if err != nil || !okay {
+	old, err := isOld(dataStorePath)
+	if err != nil || old {
+		report.KeyDirFileRejected = "older than the datastore directory"
 		return false, nil
 	}
 
-	i := 0
-	n := len(data)
-	for i < n {
-		key, rec, recLen := recfmt.ExtractKeyDirRec(data[i:])
+	files, recs, err := recfmt.ExtractKeyDirFile(data)
+	if err != nil {
+		log.Printf("keydir: ignoring keydir file of %s: %v", dataStorePath, err)
+		report.KeyDirFileRejected = err.Error()
+		return false, nil
+	}
+
+	sizes, err := dataFileSizes(dataStorePath)
+	if err != nil {
+		return false, err
+	}
+	if len(sizes) != len(files) {
+		report.KeyDirFileRejected = "data files were added or removed since it was written"
+		return false, nil
+	}
+	for _, file := range files {
+		size, isExist := sizes[file.Name]
+		if !isExist || size != file.Size {
+			report.KeyDirFileRejected = fmt.Sprintf("data file %s changed since it was written", file.Name)
+			return false, nil
+		}
+	}
+
+	for key, rec := range recs {
 		k[key] = rec
-		i += recLen
 	}
 
 	return true, nil
@@ -104,7 +301,7 @@ func isOld(dataStorePath string) (bool, error) {
 		return false, err
 	}
 
-	keydirStat, err := os.Stat(path.Join(dataStorePath, "keydir"))
+	keydirStat, err := os.Stat(path.Join(dataStorePath, keyDirFile))
 	if err != nil {
 		return false, err
 	}
@@ -116,7 +313,7 @@ func isOld(dataStorePath string) (bool, error) {
 // it uses the current data and hint files to build it.
 // it prefer the hint files on data files.
 // return and error on system failures.
-func (k KeyDir) dataStoreFilesBuild(dataStorePath string) error {
+func (k Map) dataStoreFilesBuild(dataStorePath string, repair bool, report *Report) error {
 	dataStore, err := os.Open(dataStorePath)
 	if err != nil {
 		return err
@@ -134,7 +331,7 @@ func (k KeyDir) dataStoreFilesBuild(dataStorePath string) error {
 		}
 	}
 
-	err = k.parseFiles(dataStorePath, categorizeFiles(fileNames))
+	err = k.parseFiles(dataStorePath, categorizeFiles(fileNames), repair, report)
 	if err != nil {
 		return err
 	}
@@ -145,16 +342,17 @@ func (k KeyDir) dataStoreFilesBuild(dataStorePath string) error {
 // parseFiles parses the data from the given data and hint files
 // to create the keydir map.
 // return and error on system failures.
-func (k KeyDir) parseFiles(dataStorePath string, files map[string]fileType) error {
+func (k Map) parseFiles(dataStorePath string, files map[string]fileType, repair bool, report *Report) error {
 	for name, ftype := range files {
 		switch ftype {
 		case data:
-			err := k.parseDataFile(dataStorePath, name)
+			report.DataFiles = append(report.DataFiles, name)
+			err := k.parseDataFile(dataStorePath, name, repair, report)
 			if err != nil {
 				return err
 			}
 		case hint:
-			err := k.parseHintFile(dataStorePath, name)
+			err := k.parseHintFile(dataStorePath, name, repair, report)
 			if err != nil {
 				return err
 			}
@@ -165,97 +363,236 @@ func (k KeyDir) parseFiles(dataStorePath string, files map[string]fileType) erro
 }
 
 // parseDataFile parses the data from a data files.
+// The batches cut by a crash at the end of the file are skipped, and so is a torn final record,
+// the file is truncated before the torn record if repair is specified.
 // return and error on system failures.
-func (k KeyDir) parseDataFile(dataStorePath, name string) error {
+func (k Map) parseDataFile(dataStorePath, name string, repair bool, report *Report) error {
 	data, err := os.ReadFile(path.Join(dataStorePath, name))
 	if err != nil {
 		return err
 	}
 
-	i := 0
-	n := len(data)
-	for i < n {
-		rec, recLen, err := recfmt.ExtractDataFileRec(data[i:])
-		if err != nil {
-			return err
+	offset, err := recfmt.ScanDataFile(data, func(rec *recfmt.DataRec, offset uint32) {
+		newRec := recfmt.KeyDirRec{
+			FileId:    name,
+			ValuePos:  offset,
+			ValueSize: rec.ValueSize,
+			Tstamp:    rec.Tstamp,
 		}
-
 		old, isExist := k[rec.Key]
-		if !isExist || old.Tstamp < rec.Tstamp {
-			k[rec.Key] = recfmt.KeyDirRec{
-				FileId:    name,
-				ValuePos:  uint32(i),
-				ValueSize: rec.ValueSize,
-				Tstamp:    rec.Tstamp,
-			}
+		if !isExist || newer(newRec, old) {
+			k[rec.Key] = newRec
+		}
+	})
+	if err != nil && !tornTail(data, offset, err) {
+		return &datastore.CorruptionError{File: name, Offset: int64(offset)}
+	}
+	if err != nil {
+		report.TornFiles = append(report.TornFiles, name)
+		if !repair {
+			log.Printf("keydir: ignoring torn record of %s at offset %d", name, offset)
+			return nil
+		}
+		err = os.Truncate(path.Join(dataStorePath, name), int64(offset))
+		if err != nil {
+			return err
 		}
-		i += int(recLen)
+		log.Printf("keydir: truncated %s from %d to %d bytes after a torn record", name, len(data), offset)
 	}
 
 	return nil
 }
 
+// newer reports whether rec replaces old in the keydir, the files being parsed in any order.
+// The record with the greater timestamp wins, and of two records with the same timestamp
+// the one of the file created last, such as the merge file holding the copy of a record
+// of an old file that a crash kept from being deleted.
+func newer(rec, old recfmt.KeyDirRec) bool {
+	if rec.Tstamp != old.Tstamp {
+		return rec.Tstamp > old.Tstamp
+	}
+	if len(rec.FileId) != len(old.FileId) {
+		return len(rec.FileId) > len(old.FileId)
+	}
+
+	return rec.FileId > old.FileId
+}
+
+// tornTail reports whether the scan of the data file failed at its final record,
+// that is the record is cut short or it is corrupted and nothing follows it.
+func tornTail(data []byte, offset uint32, err error) bool {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	recLen, err := recfmt.DataFileRecLen(data[offset:])
+
+	return err == nil && int(offset)+int(recLen) == len(data)
+}
+
 // parseHintFile parses the data from hint files.
+// The hint entries are checked against the size of their data file, and the data file
+// is parsed instead if the hint file is truncated or points past the end of the data file.
 // return and error on system failures.
-func (k KeyDir) parseHintFile(dataStorePath, name string) error {
+func (k Map) parseHintFile(dataStorePath, name string, repair bool, report *Report) error {
 	data, err := os.ReadFile(path.Join(dataStorePath, name))
 	if err != nil {
 		return err
 	}
 
+	dataFile := strings.TrimSuffix(name, ".hint") + ".data"
+	stat, err := os.Stat(path.Join(dataStorePath, dataFile))
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0)
+	recs := make([]recfmt.KeyDirRec, 0)
 	i := 0
 	n := len(data)
 	for i < n {
-		key, rec, recLen := recfmt.ExtractHintFileRec(data[i:])
-		rec.FileId = fmt.Sprintf("%s.data", strings.Trim(name, ".hint"))
-		k[key] = rec
+		key, rec, recLen, err := recfmt.ExtractHintFileRec(data[i:])
+		if err != nil {
+			return k.hintMismatch(dataStorePath, name, repair, report, fmt.Sprintf("truncated entry at offset %d", i))
+		}
+		end := int64(rec.ValuePos) + int64(recfmt.DataFileRecHdr+len(key)) + int64(rec.ValueSize)
+		if end > stat.Size() {
+			return k.hintMismatch(dataStorePath, name, repair, report, fmt.Sprintf("entry of key %s ends at %d past the %d bytes of %s",
+				datastore.PrintableKey(key), end, stat.Size(), dataFile))
+		}
+		rec.FileId = dataFile
+		keys = append(keys, key)
+		recs = append(recs, rec)
 		i += recLen
 	}
 
+	for j, key := range keys {
+		old, isExist := k[key]
+		if !isExist || newer(recs[j], old) {
+			k[key] = recs[j]
+		}
+	}
+	report.HintFiles = append(report.HintFiles, name)
+
 	return nil
 }
 
+// hintMismatch reports a hint file that does not match its data file
+// and parses the data file instead.
+func (k Map) hintMismatch(dataStorePath, name string, repair bool, report *Report, reason string) error {
+	log.Printf("keydir: hint file %s of %s does not match its data file: %s, "+
+		"the data file is parsed instead, rebuild the hints to fix it", name, dataStorePath, reason)
+
+	dataFile := strings.TrimSuffix(name, ".hint") + ".data"
+	report.RejectedHints = append(report.RejectedHints, name)
+	report.DataFiles = append(report.DataFiles, dataFile)
+
+	return k.parseDataFile(dataStorePath, dataFile, repair, report)
+}
+
 // categorizeFiles specifies whether the file is data or hint file.
+// A hint file is preferred on its data file, it is ignored if its data file does not exist.
+// The file ids are the file names without their extension.
 func categorizeFiles(allFiles []string) map[string]fileType {
 	res := make(map[string]fileType)
 
-	hintFiles := make(map[string]int)
+	dataFiles := make(map[string]bool)
 	for _, file := range allFiles {
-		if strings.HasSuffix(file, ".hint") {
-			fileWithoutExt := strings.Trim(file, ".hint")
-			hintFiles[fileWithoutExt] = 1
-			res[file] = hint
+		if strings.HasSuffix(file, ".data") {
+			dataFiles[strings.TrimSuffix(file, ".data")] = true
 		}
 	}
 
+	hintFiles := make(map[string]bool)
 	for _, file := range allFiles {
-		if strings.HasSuffix(file, ".data") {
-			if _, okay := hintFiles[strings.Trim(file, ".data")]; !okay {
-				res[file] = data
+		if strings.HasSuffix(file, ".hint") {
+			fileWithoutExt := strings.TrimSuffix(file, ".hint")
+			if dataFiles[fileWithoutExt] {
+				hintFiles[fileWithoutExt] = true
+				res[file] = hint
 			}
 		}
 	}
 
+	for id := range dataFiles {
+		if !hintFiles[id] {
+			res[id+".data"] = data
+		}
+	}
+
 	return res
 }
 
+// dataFileSizes returns the sizes of the data files of the datastore by name.
+func dataFileSizes(dataStorePath string) (map[string]int64, error) {
+	entries, err := os.ReadDir(dataStorePath)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]int64)
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".data") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		sizes[entry.Name()] = info.Size()
+	}
+
+	return sizes, nil
+}
+
 // share writes the keydir map data in keydir file to be used by other readers.
+// The sizes of all the data files are recorded so that the keydir file
+// is ignored once any data file is added, removed or modified.
 // return an error on system failures.
-func (k KeyDir) share(dataStorePath string) error {
-	flags := os.O_CREATE | os.O_RDWR
-	perm := os.FileMode(0666)
-	file, err := sio.OpenFile(path.Join(dataStorePath, "keydir"), flags, perm)
+func (k Map) share(dataStorePath string) error {
+	sizes, err := dataFileSizes(dataStorePath)
 	if err != nil {
 		return err
 	}
+	for _, rec := range k {
+		if _, isExist := sizes[rec.FileId]; !isExist {
+			return fmt.Errorf("keydir references missing data file %s", rec.FileId)
+		}
+	}
 
-	for key, rec := range k {
-		buf := recfmt.CompressKeyDirRec(key, rec)
-		_, err := file.Write(buf)
-		if err != nil {
-			return err
+	// the file is written aside then renamed over the keydir file, so that the readers
+	// and the crashes never see a partial file, the hidden name is skipped by the builds
+	tmp, err := os.CreateTemp(dataStorePath, "."+keyDirFile+"-*")
+	if err != nil {
+		return err
+	}
+	file := &sio.File{File: tmp}
+
+	_, err = file.Write(recfmt.CompressKeyDirFile(k, sizes))
+	if err == nil {
+		err = tmp.Chmod(os.FileMode(0644))
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path.Join(dataStorePath, keyDirFile))
+	}
+	if err != nil {
+		if removeErr := os.Remove(tmp.Name()); removeErr != nil {
+			err = fmt.Errorf("%v, %v", err, removeErr)
 		}
+		return err
 	}
 
-	return nil
+	// the rename changed the directory, which must not make the keydir file look older
+	dirStat, err := os.Stat(dataStorePath)
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(path.Join(dataStorePath, keyDirFile), dirStat.ModTime(), dirStat.ModTime())
 }
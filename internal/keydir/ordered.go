@@ -0,0 +1,157 @@
+package keydir
+
+import (
+	"math/rand"
+
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+// orderedMaxLevel bounds the levels of the skip list,
+// enough for 4^16 keys with a promotion chance of 1/4.
+const orderedMaxLevel = 16
+
+type (
+	// ordered is a keydir kept in a skip list sorted by key.
+	ordered struct {
+		head  orderedNode
+		level int
+		len   int
+		rnd   *rand.Rand
+	}
+
+	// orderedNode is a key of the skip list with its links on every level it is in.
+	orderedNode struct {
+		key  string
+		rec  recfmt.KeyDirRec
+		next []*orderedNode
+	}
+)
+
+// newOrdered creates an empty ordered keydir.
+func newOrdered() *ordered {
+	return &ordered{
+		head:  orderedNode{next: make([]*orderedNode, orderedMaxLevel)},
+		level: 1,
+		rnd:   rand.New(rand.NewSource(rand.Int63())),
+	}
+}
+
+// find returns the last node before the key on every level.
+func (k *ordered) find(key string) [orderedMaxLevel]*orderedNode {
+	var prev [orderedMaxLevel]*orderedNode
+	node := &k.head
+	for i := k.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && node.next[i].key < key {
+			node = node.next[i]
+		}
+		prev[i] = node
+	}
+
+	return prev
+}
+
+// Get returns the record of the key and whether the key exists.
+func (k *ordered) Get(key string) (recfmt.KeyDirRec, bool) {
+	node := &k.head
+	for i := k.level - 1; i >= 0; i-- {
+		for node.next[i] != nil && node.next[i].key < key {
+			node = node.next[i]
+		}
+	}
+
+	node = node.next[0]
+	if node == nil || node.key != key {
+		return recfmt.KeyDirRec{}, false
+	}
+
+	return node.rec, true
+}
+
+// Set adds or replaces the record of the key.
+func (k *ordered) Set(key string, rec recfmt.KeyDirRec) {
+	prev := k.find(key)
+	if node := prev[0].next[0]; node != nil && node.key == key {
+		node.rec = rec
+		return
+	}
+
+	level := 1
+	for level < orderedMaxLevel && k.rnd.Intn(4) == 0 {
+		level++
+	}
+	for i := k.level; i < level; i++ {
+		prev[i] = &k.head
+	}
+	if level > k.level {
+		k.level = level
+	}
+
+	node := &orderedNode{key: key, rec: rec, next: make([]*orderedNode, level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = prev[i].next[i]
+		prev[i].next[i] = node
+	}
+	k.len++
+}
+
+// Delete removes the key if it exists.
+func (k *ordered) Delete(key string) {
+	prev := k.find(key)
+	node := prev[0].next[0]
+	if node == nil || node.key != key {
+		return
+	}
+
+	for i := range node.next {
+		prev[i].next[i] = node.next[i]
+	}
+	for k.level > 1 && k.head.next[k.level-1] == nil {
+		k.level--
+	}
+	k.len--
+}
+
+// Iterate calls fn for every key in ascending order until fn returns false.
+func (k *ordered) Iterate(fn func(key string, rec recfmt.KeyDirRec) bool) {
+	for node := k.head.next[0]; node != nil; node = node.next[0] {
+		if !fn(node.key, node.rec) {
+			return
+		}
+	}
+}
+
+// IterateFrom calls fn for every key from start in ascending order until fn returns false.
+func (k *ordered) IterateFrom(start string, fn func(key string, rec recfmt.KeyDirRec) bool) {
+	prev := k.find(start)
+	for node := prev[0].next[0]; node != nil; node = node.next[0] {
+		if !fn(node.key, node.rec) {
+			return
+		}
+	}
+}
+
+// RandomKey returns a key picked at random with its record.
+// It skips a random number of keys taking the longest links that fit,
+// which are only about 4^level keys long, so the pick is nearly uniform.
+func (k *ordered) RandomKey() (string, recfmt.KeyDirRec, bool) {
+	if k.len == 0 {
+		return "", recfmt.KeyDirRec{}, false
+	}
+
+	skip := k.rnd.Intn(k.len) + 1
+	node := &k.head
+	for i := k.level - 1; i >= 0; i-- {
+		span := 1 << (2 * i)
+		for skip >= span && node.next[i] != nil {
+			node = node.next[i]
+			skip -= span
+		}
+	}
+
+	return node.key, node.rec, true
+}
+
+// Len returns the number of keys.
+func (k *ordered) Len() int {
+	return k.len
+}
@@ -0,0 +1,91 @@
+package keydir
+
+import (
+	"math/rand"
+
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+// shardCount is the number of maps of a sharded keydir.
+const shardCount = 64
+
+// sharded is a keydir split over several maps by the hash of the keys.
+type sharded struct {
+	shards [shardCount]map[string]recfmt.KeyDirRec
+	len    int
+}
+
+// newSharded creates an empty sharded keydir.
+func newSharded() *sharded {
+	k := &sharded{}
+	for i := range k.shards {
+		k.shards[i] = make(map[string]recfmt.KeyDirRec)
+	}
+
+	return k
+}
+
+// shard returns the map that holds the given key.
+func (k *sharded) shard(key string) map[string]recfmt.KeyDirRec {
+	// FNV-1a
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+
+	return k.shards[h%shardCount]
+}
+
+// Get returns the record of the key and whether the key exists.
+func (k *sharded) Get(key string) (recfmt.KeyDirRec, bool) {
+	rec, isExist := k.shard(key)[key]
+	return rec, isExist
+}
+
+// Set adds or replaces the record of the key.
+func (k *sharded) Set(key string, rec recfmt.KeyDirRec) {
+	shard := k.shard(key)
+	if _, isExist := shard[key]; !isExist {
+		k.len++
+	}
+	shard[key] = rec
+}
+
+// Delete removes the key if it exists.
+func (k *sharded) Delete(key string) {
+	shard := k.shard(key)
+	if _, isExist := shard[key]; isExist {
+		k.len--
+		delete(shard, key)
+	}
+}
+
+// Iterate calls fn for every key until fn returns false.
+func (k *sharded) Iterate(fn func(key string, rec recfmt.KeyDirRec) bool) {
+	for _, shard := range k.shards {
+		for key, rec := range shard {
+			if !fn(key, rec) {
+				return
+			}
+		}
+	}
+}
+
+// RandomKey returns a key picked at random with its record,
+// from the first shard holding keys after a random one.
+func (k *sharded) RandomKey() (string, recfmt.KeyDirRec, bool) {
+	start := rand.Intn(shardCount)
+	for i := 0; i < shardCount; i++ {
+		for key, rec := range k.shards[(start+i)%shardCount] {
+			return key, rec, true
+		}
+	}
+
+	return "", recfmt.KeyDirRec{}, false
+}
+
+// Len returns the number of keys.
+func (k *sharded) Len() int {
+	return k.len
+}
@@ -0,0 +1,67 @@
+package recfmt
+
+import (
+	"io"
+	"strconv"
+)
+
+// BatchKey is the key of the header record starting a batch, its value is the number
+// of records of the batch. The empty key is never written by the datastore users.
+const BatchKey = ""
+
+// CompressBatchHdr compresses the header record of a batch of n records.
+func CompressBatchHdr(n int, tstamp int64) []byte {
+	return CompressDataFileRec(BatchKey, strconv.Itoa(n), tstamp)
+}
+
+// ScanDataFile calls fn with every record of the data file held in buf, along with its offset.
+// The records of a batch are passed only once the whole batch is read, so the batch cut
+// by a crash at the end of the file is skipped, the batch headers are not passed.
+// Return the offset of the first corrupted record with ErrDataCorruption,
+// or with io.ErrUnexpectedEOF if it is cut outside a batch.
+func ScanDataFile(buf []byte, fn func(rec *DataRec, offset uint32)) (uint32, error) {
+	type batchRec struct {
+		rec    *DataRec
+		offset uint32
+	}
+
+	batch := make([]batchRec, 0)
+	remaining := 0
+	i := uint32(0)
+	for i < uint32(len(buf)) {
+		recLen, err := DataFileRecLen(buf[i:])
+		if err == io.ErrUnexpectedEOF && remaining > 0 {
+			return 0, nil
+		}
+		if err != nil {
+			return i, err
+		}
+		rec, _, err := ExtractDataFileRec(buf[i : i+recLen])
+		if err != nil {
+			return i, err
+		}
+
+		switch {
+		case remaining > 0:
+			batch = append(batch, batchRec{rec: rec, offset: i})
+			remaining--
+			if remaining == 0 {
+				for _, r := range batch {
+					fn(r.rec, r.offset)
+				}
+			}
+		case rec.Key == BatchKey:
+			n, err := strconv.Atoi(rec.Value)
+			if err != nil || n < 0 {
+				return i, ErrDataCorruption
+			}
+			batch = batch[:0]
+			remaining = n
+		default:
+			fn(rec, i)
+		}
+		i += recLen
+	}
+
+	return 0, nil
+}
@@ -1,36 +1,146 @@
 // Package recfmt(record format) provides functionality to compress and extrct datastore file records.
+// Keys are stored as raw bytes prefixed by their length in every format, so binary keys
+// round trip through the data, hint and keydir files unchanged.
 package recfmt
 
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"hash/crc32"
+	"io"
 )
 
-// DataFileRecHdr represents the constant header length of data file records.
-const DataFileRecHdr = 18
+const (
+	// DataFileRecHdr represents the constant header length of data file records.
+	DataFileRecHdr = 18
 
-// errDataCorruption happens whenever a data file record is corrupted.
-var errDataCorruption = errors.New("corrution detected: datastore files are corrupted")
+	// MaxValueSize is the maximum size in bytes of a value along with its metadata.
+	MaxValueSize = tombstoneFlag - 1
 
-// DataRec represents the data parsed from a data file record.
-type DataRec struct {
-	Key       string
-	Value     string
-	Tstamp    int64
-	KeySize   uint16
-	ValueSize uint32
-}
+	// metaFlag is set in the value size of the records holding metadata,
+	// the metadata block is then stored before the value.
+	metaFlag = 1 << 31
+	// refFlag is set in the value size of the records holding a reference
+	// to the record storing their value instead of the value itself.
+	refFlag = 1 << 30
+	// immutableFlag is set in the value size of the records of immutable keys.
+	immutableFlag = 1 << 29
+	// tombstoneFlag is set in the value size of the tombstones, the empty records of the deleted keys.
+	tombstoneFlag = 1 << 28
+	// sizeFlags are the flags of the value size.
+	sizeFlags = metaFlag | refFlag | immutableFlag | tombstoneFlag
+	// metaBlockHdr is the length of the size of the metadata block.
+	metaBlockHdr = 4
+
+	// LegacyTombstone is the value of the tombstones written before the tombstone flag,
+	// a record without flags holding it is still read as a tombstone. A value equal to it
+	// is written with an empty metadata block, so that it is not mistaken for a tombstone.
+	LegacyTombstone = "8890fc70294d02dbde257989e802451c2276be7fb177c3ca4399dc4728e4e1e0"
+)
+
+// ErrDataCorruption happens whenever a data file record is corrupted.
+var ErrDataCorruption = errors.New("corrution detected: datastore files are corrupted")
+
+type (
+	// DataRec represents the data parsed from a data file record.
+	// ValueSize is the size of the value along with its metadata block, if any.
+	// Ref is set for the records referencing the record storing their value,
+	// Value is then empty until the reference is resolved.
+	// Immutable is set for the records written as immutable.
+	// Tombstone is set for the records of the deleted keys, their value is empty.
+	DataRec struct {
+		Key       string
+		Value     string
+		Meta      map[string]string
+		Ref       *ValueRef
+		Immutable bool
+		Tombstone bool
+		Tstamp    int64
+		KeySize   uint16
+		ValueSize uint32
+	}
+
+	// ValueRef locates the data file record storing a value shared by several keys.
+	ValueRef struct {
+		FileId    string
+		Key       string
+		ValuePos  uint32
+		ValueSize uint32
+	}
+)
 
 // CompressDataFileRec compresses the given data into a data file record.
 func CompressDataFileRec(key, value string, tstamp int64) []byte {
-	buf := make([]byte, DataFileRecHdr+len(key)+len(value))
+	return CompressDataFileRecMeta(key, value, nil, tstamp)
+}
+
+// CompressDataFileRecMeta compresses the given data into a data file record
+// storing the metadata before the value.
+// The metadata keys and values must not exceed 65535 bytes.
+func CompressDataFileRecMeta(key, value string, meta map[string]string, tstamp int64) []byte {
+	return compressDataFileRec(key, value, meta, false, tstamp)
+}
+
+// CompressDataFileRecImmutable compresses the given data into a data file record
+// flagged as immutable, storing the metadata before the value.
+func CompressDataFileRecImmutable(key, value string, meta map[string]string, tstamp int64) []byte {
+	return compressDataFileRec(key, value, meta, true, tstamp)
+}
+
+// CompressDataFileRecTombstone compresses the tombstone of a deleted key into a data file record.
+func CompressDataFileRecTombstone(key string, tstamp int64) []byte {
+	buf := make([]byte, DataFileRecHdr+len(key))
 
 	binary.LittleEndian.PutUint64(buf[4:], uint64(tstamp))
 	binary.LittleEndian.PutUint16(buf[12:], uint16(len(key)))
-	binary.LittleEndian.PutUint32(buf[14:], uint32(len(value)))
+	binary.LittleEndian.PutUint32(buf[14:], tombstoneFlag)
 	copy(buf[DataFileRecHdr:], []byte(key))
-	copy(buf[DataFileRecHdr+len(key):], []byte(value))
+
+	checkSum := crc32.ChecksumIEEE(buf[4:])
+	binary.LittleEndian.PutUint32(buf, checkSum)
+
+	return buf
+}
+
+// compressDataFileRec compresses the given data into a data file record.
+func compressDataFileRec(key, value string, meta map[string]string, immutable bool, tstamp int64) []byte {
+	payload := value
+	sizeField := uint32(len(value))
+	if len(meta) > 0 || value == LegacyTombstone {
+		payload = string(compressMeta(meta)) + value
+		sizeField = uint32(len(payload)) | metaFlag
+	}
+	if immutable {
+		sizeField |= immutableFlag
+	}
+
+	buf := make([]byte, DataFileRecHdr+len(key)+len(payload))
+
+	binary.LittleEndian.PutUint64(buf[4:], uint64(tstamp))
+	binary.LittleEndian.PutUint16(buf[12:], uint16(len(key)))
+	binary.LittleEndian.PutUint32(buf[14:], sizeField)
+	copy(buf[DataFileRecHdr:], []byte(key))
+	copy(buf[DataFileRecHdr+len(key):], []byte(payload))
+
+	checkSum := crc32.ChecksumIEEE(buf[4:])
+	binary.LittleEndian.PutUint32(buf, checkSum)
+
+	return buf
+}
+
+// CompressDataFileRecRef compresses a data file record whose value
+// is the value of the record located by ref.
+func CompressDataFileRecRef(key string, ref ValueRef, tstamp int64) []byte {
+	payload := compressRef(ref)
+
+	buf := make([]byte, DataFileRecHdr+len(key)+len(payload))
+
+	binary.LittleEndian.PutUint64(buf[4:], uint64(tstamp))
+	binary.LittleEndian.PutUint16(buf[12:], uint16(len(key)))
+	binary.LittleEndian.PutUint32(buf[14:], uint32(len(payload))|refFlag)
+	copy(buf[DataFileRecHdr:], []byte(key))
+	copy(buf[DataFileRecHdr+len(key):], payload)
 
 	checkSum := crc32.ChecksumIEEE(buf[4:])
 	binary.LittleEndian.PutUint32(buf, checkSum)
@@ -40,28 +150,240 @@ func CompressDataFileRec(key, value string, tstamp int64) []byte {
 
 // ExtractDataFileRec extracts the data file record into a data record.
 // Return the data record and its length in the file.
-// Return an error whenever the data is corrupted.
+// Return ErrDataCorruption whenever the data is corrupted, including sizes past the end of buf.
 func ExtractDataFileRec(buf []byte) (*DataRec, uint32, error) {
+	rec, recLen, err := ParseDataFileRec(buf)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	parsedSum := binary.LittleEndian.Uint32(buf)
-	tstamp := binary.LittleEndian.Uint64(buf[4:])
+	err = validateCheckSum(parsedSum, buf[4:recLen])
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return rec, recLen, nil
+}
+
+// DataFileRecLen returns the length of the data file record at the start of buf.
+// Return io.ErrUnexpectedEOF if buf is shorter than the record.
+func DataFileRecLen(buf []byte) (uint32, error) {
+	if len(buf) < DataFileRecHdr {
+		return 0, io.ErrUnexpectedEOF
+	}
+
 	keySize := binary.LittleEndian.Uint16(buf[12:])
-	valueSize := binary.LittleEndian.Uint32(buf[14:])
-	key := string(buf[DataFileRecHdr : DataFileRecHdr+keySize])
-	valueOffset := uint32(DataFileRecHdr + keySize)
-	value := string(buf[valueOffset : valueOffset+valueSize])
+	valueSize := binary.LittleEndian.Uint32(buf[14:]) &^ sizeFlags
+	recLen := uint64(DataFileRecHdr) + uint64(keySize) + uint64(valueSize)
+	if recLen > uint64(len(buf)) {
+		return 0, io.ErrUnexpectedEOF
+	}
+
+	return uint32(recLen), nil
+}
+
+// MayBeTombstone reports whether a record whose value is stored in valueSize bytes
+// may be a tombstone, the other records are never tombstones.
+func MayBeTombstone(valueSize uint32) bool {
+	return valueSize == 0 || valueSize == uint32(len(LegacyTombstone))
+}
 
-	err := validateCheckSum(parsedSum, buf[4:DataFileRecHdr+uint32(keySize)+valueSize])
+// DataFileRecImmutable reports whether the data file record starting with
+// the given header is flagged as immutable, a header too short is not.
+func DataFileRecImmutable(hdr []byte) bool {
+	if len(hdr) < DataFileRecHdr {
+		return false
+	}
+
+	return binary.LittleEndian.Uint32(hdr[14:])&immutableFlag != 0
+}
+
+// ParseDataFileRec extracts the data file record into a data record
+// without validating its checksum.
+// Return the data record and its length in the file.
+// Return ErrDataCorruption if buf is shorter than the header or the sizes it holds.
+func ParseDataFileRec(buf []byte) (*DataRec, uint32, error) {
+	recLen, err := DataFileRecLen(buf)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, ErrDataCorruption
+	}
+
+	tstamp := binary.LittleEndian.Uint64(buf[4:])
+	keySize := binary.LittleEndian.Uint16(buf[12:])
+	sizeField := binary.LittleEndian.Uint32(buf[14:])
+	valueSize := sizeField &^ sizeFlags
+	valueOffset := DataFileRecHdr + uint32(keySize)
+	key := string(buf[DataFileRecHdr:valueOffset])
+	payload := buf[valueOffset : valueOffset+valueSize]
+
+	var meta map[string]string
+	if sizeField&metaFlag != 0 {
+		meta, payload = extractMeta(payload)
+		if len(meta) == 0 {
+			// the empty block of a value equal to LegacyTombstone
+			meta = nil
+		}
+	}
+	var ref *ValueRef
+	if sizeField&refFlag != 0 {
+		ref = extractRef(payload)
+		if ref != nil {
+			payload = nil
+		}
+	}
+
+	tombstone := sizeField&tombstoneFlag != 0 ||
+		sizeField&sizeFlags == 0 && string(payload) == LegacyTombstone
+	if tombstone {
+		payload = nil
 	}
 
 	return &DataRec{
 		Key:       key,
-		Value:     value,
+		Value:     string(payload),
+		Meta:      meta,
+		Ref:       ref,
+		Immutable: sizeField&immutableFlag != 0,
+		Tombstone: tombstone,
 		Tstamp:    int64(tstamp),
 		KeySize:   keySize,
 		ValueSize: valueSize,
-	}, DataFileRecHdr + valueSize + uint32(keySize), nil
+	}, recLen, nil
+}
+
+// ErrValueTooLarge happens whenever a value along with its metadata exceeds MaxValueSize,
+// its size would overflow into the flags of the record.
+var ErrValueTooLarge = errors.New("value is too large")
+
+// CheckValueSize verifies that the value along with its metadata fits in a data file record.
+func CheckValueSize(value string, meta map[string]string) error {
+	size := len(value)
+	if len(meta) > 0 || value == LegacyTombstone {
+		size += metaSize(meta)
+	}
+	if size > MaxValueSize {
+		return fmt.Errorf("%w: %d bytes exceeds the maximum of %d bytes", ErrValueTooLarge, size, MaxValueSize)
+	}
+
+	return nil
+}
+
+// StoredValueSize returns the size of the value along with its metadata block
+// as stored in a data file record.
+func StoredValueSize(value string, meta map[string]string) uint32 {
+	if len(meta) == 0 && value != LegacyTombstone {
+		return uint32(len(value))
+	}
+
+	return uint32(metaSize(meta) + len(value))
+}
+
+// metaSize returns the size of the metadata block.
+func metaSize(meta map[string]string) int {
+	size := metaBlockHdr
+	for k, v := range meta {
+		size += 4 + len(k) + len(v)
+	}
+
+	return size
+}
+
+// RefSize returns the size of the reference as stored in a data file record.
+func RefSize(ref ValueRef) uint32 {
+	return uint32(2 + len(ref.FileId) + 2 + len(ref.Key) + 8)
+}
+
+// compressRef compresses the reference into the length prefixed file id and key
+// followed by the position and the size of the value.
+func compressRef(ref ValueRef) []byte {
+	buf := make([]byte, 0, RefSize(ref))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(ref.FileId)))
+	buf = append(buf, ref.FileId...)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(ref.Key)))
+	buf = append(buf, ref.Key...)
+	buf = binary.LittleEndian.AppendUint32(buf, ref.ValuePos)
+	buf = binary.LittleEndian.AppendUint32(buf, ref.ValueSize)
+
+	return buf
+}
+
+// extractRef extracts the reference of the payload of a record.
+// Return nil for a malformed reference, only found in corrupted records.
+func extractRef(payload []byte) *ValueRef {
+	fileId, rest, ok := extractMetaString(payload)
+	if !ok {
+		return nil
+	}
+	key, rest, ok := extractMetaString(rest)
+	if !ok || len(rest) != 8 {
+		return nil
+	}
+
+	return &ValueRef{
+		FileId:    fileId,
+		Key:       key,
+		ValuePos:  binary.LittleEndian.Uint32(rest),
+		ValueSize: binary.LittleEndian.Uint32(rest[4:]),
+	}
+}
+
+// compressMeta compresses the metadata into a block of its size followed by
+// the length prefixed keys and values.
+func compressMeta(meta map[string]string) []byte {
+	buf := make([]byte, metaBlockHdr, metaSize(meta))
+	for k, v := range meta {
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(k)))
+		buf = append(buf, k...)
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(v)))
+		buf = append(buf, v...)
+	}
+	binary.LittleEndian.PutUint32(buf, uint32(len(buf)))
+
+	return buf
+}
+
+// extractMeta extracts the metadata block at the start of payload and returns
+// the metadata and the value following it.
+// A malformed block, only found in corrupted records, is returned as part of the value.
+func extractMeta(payload []byte) (map[string]string, []byte) {
+	if len(payload) < metaBlockHdr {
+		return nil, payload
+	}
+	blockLen := binary.LittleEndian.Uint32(payload)
+	if blockLen < metaBlockHdr || uint64(blockLen) > uint64(len(payload)) {
+		return nil, payload
+	}
+
+	meta := make(map[string]string)
+	block := payload[metaBlockHdr:blockLen]
+	for len(block) > 0 {
+		k, rest, ok := extractMetaString(block)
+		if !ok {
+			return nil, payload
+		}
+		v, rest, ok := extractMetaString(rest)
+		if !ok {
+			return nil, payload
+		}
+		meta[k] = v
+		block = rest
+	}
+
+	return meta, payload[blockLen:]
+}
+
+// extractMetaString extracts a length prefixed string of a metadata block.
+func extractMetaString(buf []byte) (string, []byte, bool) {
+	if len(buf) < 2 {
+		return "", nil, false
+	}
+	n := int(binary.LittleEndian.Uint16(buf))
+	if len(buf) < 2+n {
+		return "", nil, false
+	}
+
+	return string(buf[2 : 2+n]), buf[2+n:], true
 }
 
 // validateCheckSum runs the validate check on the data.
@@ -69,7 +391,7 @@ func ExtractDataFileRec(buf []byte) (*DataRec, uint32, error) {
 func validateCheckSum(parsedSum uint32, rec []byte) error {
 	wantedSum := crc32.ChecksumIEEE(rec)
 	if parsedSum != wantedSum {
-		return errDataCorruption
+		return ErrDataCorruption
 	}
 
 	return nil
@@ -1,6 +1,9 @@
 package recfmt
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"io"
+)
 
 // HintFileRecHdr represents the constant header length of hint file records.
 const HintFileRecHdr = 18
@@ -26,18 +29,26 @@ func CompressHintFileRec(key string, rec KeyDirRec) []byte {
 	return buf
 }
 
-// ExtractDataFileRec extracts the hint file record into a hint record.
+// ExtractHintFileRec extracts the hint file record into a hint record.
 // Return the hint record and its length in the file.
-func ExtractHintFileRec(buf []byte) (string, KeyDirRec, int) {
+// Return io.ErrUnexpectedEOF if buf is shorter than the record.
+func ExtractHintFileRec(buf []byte) (string, KeyDirRec, int, error) {
+	if len(buf) < HintFileRecHdr {
+		return "", KeyDirRec{}, 0, io.ErrUnexpectedEOF
+	}
+	if len(buf) < HintFileRecHdr+int(binary.LittleEndian.Uint16(buf[8:])) {
+		return "", KeyDirRec{}, 0, io.ErrUnexpectedEOF
+	}
+
 	tstamp := binary.LittleEndian.Uint64(buf)
 	keySize := binary.LittleEndian.Uint16(buf[8:])
 	valueSize := binary.LittleEndian.Uint32(buf[10:])
 	valuePos := binary.LittleEndian.Uint32(buf[14:])
-	key := string(buf[HintFileRecHdr : HintFileRecHdr+keySize])
+	key := string(buf[HintFileRecHdr : HintFileRecHdr+int(keySize)])
 
 	return key, KeyDirRec{
 		ValuePos:  valuePos,
 		ValueSize: valueSize,
 		Tstamp:    int64(tstamp),
-	}, HintFileRecHdr + int(keySize)
+	}, HintFileRecHdr + int(keySize), nil
 }
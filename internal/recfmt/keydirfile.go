@@ -2,49 +2,160 @@ package recfmt
 
 import (
 	"encoding/binary"
-	"strconv"
+	"errors"
+	"hash/crc32"
+	"sort"
 )
 
-// keyDirFileHdr represents the constant header length of keydir file records.
-const keyDirFileHdr = 26
+const (
+	// keyDirFileMagic identifies the keydir files written in the file table format
+	// ending with the record count.
+	keyDirFileMagic = "KDR3"
 
-// KeyDirRec represents the data parsed from a keydir file record.
-type KeyDirRec struct {
-	FileId    string
-	ValuePos  uint32
-	ValueSize uint32
-	Tstamp    int64
-}
+	// keyDirFileHdr represents the constant header length of keydir files:
+	// the magic and the number of entries of the file table.
+	keyDirFileHdr = 8
+
+	// keyDirFileEntryHdr represents the constant header length of file table entries.
+	keyDirFileEntryHdr = 10
+
+	// keyDirRecHdr represents the constant header length of keydir file records.
+	keyDirRecHdr = 22
+
+	// keyDirFileFooter represents the length of the footer ending keydir files:
+	// the number of records and the checksum of the whole file.
+	keyDirFileFooter = 8
+)
+
+// ErrKeyDirCorruption happens whenever a keydir file is corrupted or written in an older format.
+var ErrKeyDirCorruption = errors.New("keydir file is corrupted")
+
+type (
+	// KeyDirRec represents the data parsed from a keydir file record.
+	KeyDirRec struct {
+		FileId    string
+		ValuePos  uint32
+		ValueSize uint32
+		Tstamp    int64
+	}
+
+	// KeyDirFile represents a data file referenced by a keydir file,
+	// along with its size when the keydir file was written.
+	KeyDirFile struct {
+		Name string
+		Size int64
+	}
+)
 
-// CompressKeyDirRec compresses the given data into a keydir file record.
-func CompressKeyDirRec(key string, rec KeyDirRec) []byte {
-	keySize := len(key)
-	buf := make([]byte, keyDirFileHdr+keySize)
-	fid, _ := strconv.ParseUint(rec.FileId, 10, 64)
-	binary.LittleEndian.PutUint64(buf, fid)
-	binary.LittleEndian.PutUint16(buf[8:], uint16(keySize))
-	binary.LittleEndian.PutUint32(buf[10:], rec.ValueSize)
-	binary.LittleEndian.PutUint32(buf[14:], rec.ValuePos)
-	binary.LittleEndian.PutUint64(buf[18:], uint64(rec.Tstamp))
-	copy(buf[26:], []byte(key))
+// CompressKeyDirFile compresses the given keydir into a keydir file.
+// The file ids of the records are stored once in a file table holding
+// the given sizes of the data files, and the file ends with the number of records
+// and the checksum of the whole file.
+// Every file id of the keydir must be in sizes, which may hold files not referenced by any record.
+func CompressKeyDirFile(keyDir map[string]KeyDirRec, sizes map[string]int64) []byte {
+	names := make([]string, 0, len(sizes))
+	for name := range sizes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	index := make(map[string]uint32, len(names))
+	bufsz := keyDirFileHdr + keyDirFileFooter
+	for i, name := range names {
+		index[name] = uint32(i)
+		bufsz += keyDirFileEntryHdr + len(name)
+	}
+	for key := range keyDir {
+		bufsz += keyDirRecHdr + len(key)
+	}
+
+	buf := make([]byte, bufsz)
+	copy(buf, keyDirFileMagic)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(names)))
+	i := keyDirFileHdr
+	for _, name := range names {
+		binary.LittleEndian.PutUint16(buf[i:], uint16(len(name)))
+		binary.LittleEndian.PutUint64(buf[i+2:], uint64(sizes[name]))
+		copy(buf[i+keyDirFileEntryHdr:], name)
+		i += keyDirFileEntryHdr + len(name)
+	}
+
+	for key, rec := range keyDir {
+		binary.LittleEndian.PutUint32(buf[i:], index[rec.FileId])
+		binary.LittleEndian.PutUint16(buf[i+4:], uint16(len(key)))
+		binary.LittleEndian.PutUint32(buf[i+6:], rec.ValueSize)
+		binary.LittleEndian.PutUint32(buf[i+10:], rec.ValuePos)
+		binary.LittleEndian.PutUint64(buf[i+14:], uint64(rec.Tstamp))
+		copy(buf[i+keyDirRecHdr:], key)
+		i += keyDirRecHdr + len(key)
+	}
+
+	binary.LittleEndian.PutUint32(buf[i:], uint32(len(keyDir)))
+	binary.LittleEndian.PutUint32(buf[i+4:], crc32.ChecksumIEEE(buf[:i+4]))
 
 	return buf
 }
 
-// ExtractKeyDirRec extracts the keydir file record into a keydir record.
-// Return the keydir record and its length in the file.
-func ExtractKeyDirRec(buf []byte) (string, KeyDirRec, int) {
-	fileId := strconv.FormatUint(binary.LittleEndian.Uint64(buf), 10)
-	keySize := binary.LittleEndian.Uint16(buf[8:])
-	valueSize := binary.LittleEndian.Uint32(buf[10:])
-	valuePos := binary.LittleEndian.Uint32(buf[14:])
-	tstamp := binary.LittleEndian.Uint64(buf[18:])
-	key := string(buf[26 : keySize+26])
-
-	return key, KeyDirRec{
-		FileId:    fileId,
-		ValuePos:  valuePos,
-		ValueSize: valueSize,
-		Tstamp:    int64(tstamp),
-	}, keyDirFileHdr + int(keySize)
+// ExtractKeyDirFile extracts a keydir file into the file table and the keydir records.
+// Return ErrKeyDirCorruption if the checksum or the record count does not match or the file is malformed.
+func ExtractKeyDirFile(buf []byte) ([]KeyDirFile, map[string]KeyDirRec, error) {
+	if len(buf) < keyDirFileHdr+keyDirFileFooter || string(buf[:4]) != keyDirFileMagic {
+		return nil, nil, ErrKeyDirCorruption
+	}
+
+	end := len(buf) - keyDirFileFooter
+	err := validateCheckSum(binary.LittleEndian.Uint32(buf[end+4:]), buf[:end+4])
+	if err != nil {
+		return nil, nil, ErrKeyDirCorruption
+	}
+	count := binary.LittleEndian.Uint32(buf[end:])
+
+	n := binary.LittleEndian.Uint32(buf[4:])
+	if uint64(n)*keyDirFileEntryHdr > uint64(end) {
+		return nil, nil, ErrKeyDirCorruption
+	}
+	files := make([]KeyDirFile, 0, n)
+	i := keyDirFileHdr
+	for len(files) < int(n) {
+		if i+keyDirFileEntryHdr > end {
+			return nil, nil, ErrKeyDirCorruption
+		}
+		nameSize := int(binary.LittleEndian.Uint16(buf[i:]))
+		size := binary.LittleEndian.Uint64(buf[i+2:])
+		if i+keyDirFileEntryHdr+nameSize > end {
+			return nil, nil, ErrKeyDirCorruption
+		}
+		files = append(files, KeyDirFile{
+			Name: string(buf[i+keyDirFileEntryHdr : i+keyDirFileEntryHdr+nameSize]),
+			Size: int64(size),
+		})
+		i += keyDirFileEntryHdr + nameSize
+	}
+
+	keyDir := make(map[string]KeyDirRec)
+	records := uint32(0)
+	for i < end {
+		if i+keyDirRecHdr > end {
+			return nil, nil, ErrKeyDirCorruption
+		}
+		fileIdx := binary.LittleEndian.Uint32(buf[i:])
+		keySize := int(binary.LittleEndian.Uint16(buf[i+4:]))
+		if fileIdx >= n || i+keyDirRecHdr+keySize > end {
+			return nil, nil, ErrKeyDirCorruption
+		}
+		key := string(buf[i+keyDirRecHdr : i+keyDirRecHdr+keySize])
+		keyDir[key] = KeyDirRec{
+			FileId:    files[fileIdx].Name,
+			ValueSize: binary.LittleEndian.Uint32(buf[i+6:]),
+			ValuePos:  binary.LittleEndian.Uint32(buf[i+10:]),
+			Tstamp:    int64(binary.LittleEndian.Uint64(buf[i+14:])),
+		}
+		i += keyDirRecHdr + keySize
+		records++
+	}
+	if records != count || uint32(len(keyDir)) != count {
+		return nil, nil, ErrKeyDirCorruption
+	}
+
+	return files, keyDir, nil
 }
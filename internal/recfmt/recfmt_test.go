@@ -0,0 +1,42 @@
+package recfmt
+
+import (
+	"errors"
+	"testing"
+)
+
+func FuzzExtractDataFileRec(f *testing.F) {
+	f.Add(CompressDataFileRec("key", "value", 1))
+	f.Add(CompressDataFileRecMeta("key", "value", map[string]string{"k": "v"}, 1))
+	f.Add(CompressDataFileRecImmutable("key", LegacyTombstone, nil, 1))
+	f.Add(CompressDataFileRecTombstone("key", 1))
+	f.Add(CompressDataFileRecRef("key", ValueRef{FileId: "1.data", Key: "shared", ValueSize: 5}, 1))
+	f.Add(CompressBatchHdr(2, 1))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		rec, recLen, err := ParseDataFileRec(buf)
+		if err == nil && (int(recLen) > len(buf) || len(rec.Key) != int(rec.KeySize)) {
+			t.Fatalf("got a record of %d bytes with a key of %d bytes out of %d bytes", recLen, len(rec.Key), len(buf))
+		}
+		if _, _, err := ExtractDataFileRec(buf); err != nil && !errors.Is(err, ErrDataCorruption) {
+			t.Fatalf("got:%v, want:%v", err, ErrDataCorruption)
+		}
+		offset, err := ScanDataFile(buf, func(*DataRec, uint32) {})
+		if err != nil && int(offset) >= len(buf) {
+			t.Fatalf("got the offset %d past the %d bytes", offset, len(buf))
+		}
+	})
+}
+
+func FuzzExtractHintFileRec(f *testing.F) {
+	f.Add(CompressHintFileRec("key", KeyDirRec{ValuePos: 10, ValueSize: 5, Tstamp: 1}))
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		key, _, recLen, err := ExtractHintFileRec(buf)
+		if err == nil && (recLen > len(buf) || recLen != HintFileRecHdr+len(key)) {
+			t.Fatalf("got a record of %d bytes with a key of %d bytes out of %d bytes", recLen, len(key), len(buf))
+		}
+	})
+}
@@ -3,14 +3,44 @@
 package sio
 
 import (
+	"errors"
+	"io"
 	"io/fs"
 	"os"
+	"syscall"
+	"time"
 )
 
 // maxAttempts defines the total number of attempts done by read
 // or write functions to handle short count problem.
 const maxAttempts = 5
 
+// ErrTimeout happens whenever a read takes longer than the timeout of its read policy.
+var ErrTimeout = errors.New("read timed out")
+
+// ReadPolicy sets how reads handle transient errors.
+type ReadPolicy struct {
+	// Attempts is the maximum number of attempts of a read.
+	Attempts int
+	// Backoff is the wait before the first retry, it doubles after every retry.
+	Backoff time.Duration
+	// Timeout bounds the duration of a whole read, zero means no timeout.
+	Timeout time.Duration
+}
+
+// DefaultReadPolicy is the read policy of ReadAt.
+var DefaultReadPolicy = ReadPolicy{Attempts: maxAttempts, Backoff: time.Millisecond}
+
+// IsTransient reports whether the error may go away when the operation is retried,
+// such as interrupted calls, temporarily unavailable resources and timeouts.
+func IsTransient(err error) bool {
+	return errors.Is(err, syscall.EINTR) ||
+		errors.Is(err, syscall.EAGAIN) ||
+		errors.Is(err, syscall.ETIMEDOUT) ||
+		errors.Is(err, os.ErrDeadlineExceeded) ||
+		errors.Is(err, ErrTimeout)
+}
+
 // File represents the file with safe i/o functions.
 type File struct {
 	File *os.File
@@ -47,37 +77,52 @@ func Open(name string) (*File, error) {
 }
 
 // ReadAt reads the data from the given position with length
-// equal to the length of the given buffer.
+// equal to the length of the given buffer, retrying transient errors
+// as set by DefaultReadPolicy.
 // Return the number of read bytes.
-// Return error on system failures.
+// Return error on system failures or if the file ends before the buffer is filled.
 func (f *File) ReadAt(b []byte, off int64) (int, error) {
-	attempts := 0
-	n, err := f.File.ReadAt(b, off)
-	for i := n; err != nil; i += n {
-		if attempts == maxAttempts {
-			return 0, err
+	return f.ReadAtPolicy(b, off, DefaultReadPolicy)
+}
+
+// ReadAtPolicy is like ReadAt with the given retry policy.
+// Only the transient errors are retried, the other errors are returned right away.
+func (f *File) ReadAtPolicy(b []byte, off int64, p ReadPolicy) (int, error) {
+	read := 0
+	backoff := p.Backoff
+	for attempts := 1; read < len(b); attempts++ {
+		n, err := f.File.ReadAt(b[read:], off+int64(read))
+		read += n
+		if err == io.EOF && read < len(b) {
+			return read, io.ErrUnexpectedEOF
+		}
+		if err == nil || read == len(b) {
+			continue
+		}
+		if !IsTransient(err) || attempts >= p.Attempts {
+			return read, err
+		}
+		if backoff > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
 		}
-		off += int64(i)
-		n, err = f.File.ReadAt(b[i:], int64(off))
 	}
 
-	return len(b), nil
+	return read, nil
 }
 
 // Write writes the given buffer to the file.
 // Return the number of written bytes.
 // Return error on system failures.
 func (f *File) Write(b []byte) (int, error) {
-	n, err := f.File.Write(b)
-
-	attempts := 0
-	for i := n; err != nil; i += n {
-		if attempts == maxAttempts {
-			return 0, err
+	written := 0
+	for attempts := 0; written < len(b); attempts++ {
+		n, err := f.File.Write(b[written:])
+		written += n
+		if err != nil && attempts == maxAttempts {
+			return written, err
 		}
-		n, err = f.File.Write(b[i:])
-		attempts++
 	}
 
-	return len(b), nil
+	return written, nil
 }
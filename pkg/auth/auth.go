@@ -0,0 +1,85 @@
+// Package auth authenticates the users of the server frontends,
+// so that the RESP and HTTP servers share the same access control.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Read allows reading keys and values.
+	Read Permission = 1 << iota
+	// Write allows changing keys and values.
+	Write
+	// Admin allows configuring the server, managing its clients and taking or restoring backups.
+	Admin
+)
+
+// ErrUnauthorized happens whenever a user name and password do not match.
+var ErrUnauthorized = errors.New("invalid username-password pair or user is disabled")
+
+type (
+	// Permission is a set of operations a user is allowed to do.
+	Permission int
+
+	// Identity represents an authenticated user.
+	Identity struct {
+		// User is the name of the user.
+		User string
+		// Role groups users sharing the same access rules.
+		Role string
+		// Permissions is the set of operations the user is allowed to do.
+		Permissions Permission
+	}
+
+	// Authenticator checks the credentials of the users.
+	// Implementations must be safe for concurrent use.
+	Authenticator interface {
+		// Authenticate returns the identity of the user or ErrUnauthorized.
+		Authenticate(user, password string) (Identity, error)
+	}
+)
+
+// Has reports whether every permission of want is in p.
+func (p Permission) Has(want Permission) bool {
+	return p&want == want
+}
+
+// String returns the permissions as letters: r for Read, w for Write and a for Admin.
+func (p Permission) String() string {
+	var sb strings.Builder
+	for i, letter := range "rwa" {
+		if p.Has(1 << i) {
+			sb.WriteRune(letter)
+		}
+	}
+	if sb.Len() == 0 {
+		return "-"
+	}
+
+	return sb.String()
+}
+
+// ParsePermission parses permissions written as by Permission.String.
+func ParsePermission(s string) (Permission, error) {
+	var p Permission
+	if s == "-" {
+		return p, nil
+	}
+	for _, letter := range s {
+		switch letter {
+		case 'r':
+			p |= Read
+		case 'w':
+			p |= Write
+		case 'a':
+			p |= Admin
+		default:
+			return 0, fmt.Errorf("invalid permission %q", letter)
+		}
+	}
+
+	return p, nil
+}
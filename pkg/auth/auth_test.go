@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestStatic(t *testing.T) {
+	a := NewStatic(NewUser("alice", "secret", "app", Read|Write))
+
+	identity, err := a.Authenticate("alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Identity{User: "alice", Role: "app", Permissions: Read | Write}
+	if identity != want {
+		t.Errorf("got:%+v, want:%+v", identity, want)
+	}
+
+	for _, creds := range [][2]string{{"alice", "wrong"}, {"bob", "secret"}} {
+		if _, err := a.Authenticate(creds[0], creds[1]); !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("%v: got:%v, want:%v", creds, err, ErrUnauthorized)
+		}
+	}
+}
+
+func TestPBKDF2(t *testing.T) {
+	// test vector of RFC 7914
+	got := hex.EncodeToString(pbkdf2("password", []byte("salt"), 4096))
+	want := "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"
+	if got != want {
+		t.Errorf("got:%s, want:%s", got, want)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	hash, err := HashPassword("secret", 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := HashPassword("secret", 1000)
+	if other == hash {
+		t.Errorf("Expected every hash to have its own salt, got %s twice", hash)
+	}
+
+	name := path.Join(t.TempDir(), "users")
+	content := "# user hash role permissions\n\n" +
+		"alice " + hash + " admin rwa\n" +
+		"bob " + other + " app r\n"
+	os.WriteFile(name, []byte(content), 0600)
+
+	a, err := LoadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity, _ := a.Authenticate("bob", "secret")
+	if identity.Role != "app" || identity.Permissions != Read {
+		t.Errorf("got:%+v", identity)
+	}
+	identity, _ = a.Authenticate("alice", "secret")
+	if identity.Permissions.String() != "rwa" {
+		t.Errorf("got:%s, want:%s", identity.Permissions, "rwa")
+	}
+	if _, err := a.Authenticate("alice", "wrong"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("got:%v, want:%v", err, ErrUnauthorized)
+	}
+
+	unsalted := sha256.Sum256([]byte("secret"))
+	for _, hash := range []string{"nothex", hex.EncodeToString(unsalted[:]), "pbkdf2-sha256$0$00$" + hex.EncodeToString(unsalted[:])} {
+		os.WriteFile(name, []byte("carol "+hash+" app r\n"), 0600)
+		_, err = LoadFile(name)
+		if err == nil || err.Error() != name+":1: invalid password hash of user carol" {
+			t.Errorf("%s: got:%v", hash, err)
+		}
+	}
+}
+
+func TestParsePermission(t *testing.T) {
+	for _, s := range []string{"-", "r", "rw", "rwa", "wa"} {
+		p, err := ParsePermission(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.String() != s {
+			t.Errorf("got:%s, want:%s", p, s)
+		}
+	}
+	if _, err := ParsePermission("rx"); err == nil {
+		t.Errorf("Expected an invalid permission to be rejected")
+	}
+}
@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultIterations is the PBKDF2 iteration count of the password hashes made by NewUser.
+	DefaultIterations = 100000
+
+	// hashScheme starts the password hashes of the users files.
+	hashScheme = "pbkdf2-sha256"
+
+	// saltSize is the size in bytes of the random salt of every password.
+	saltSize = 16
+)
+
+// errInvalidHash happens when a password hash is not written as pbkdf2-sha256$iterations$salt$key.
+var errInvalidHash = errors.New("invalid password hash")
+
+type (
+	// User is a user known by a Static authenticator.
+	User struct {
+		Identity
+		// PasswordHash is the PBKDF2-HMAC-SHA256 key derived from the password and the salt.
+		PasswordHash []byte
+		// Salt is the random salt of the password.
+		Salt []byte
+		// Iterations is the PBKDF2 iteration count.
+		Iterations int
+	}
+
+	// Static authenticates a fixed set of users.
+	Static struct {
+		users map[string]User
+	}
+)
+
+// NewStatic creates an authenticator of the given users.
+func NewStatic(users ...User) *Static {
+	s := &Static{users: make(map[string]User, len(users))}
+	for _, u := range users {
+		s.users[u.User] = u
+	}
+
+	return s
+}
+
+// NewUser creates a user with the given password, hashed with a new random salt
+// and DefaultIterations.
+func NewUser(name, password, role string, permissions Permission) User {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		panic(fmt.Sprintf("auth: cannot read a random salt: %v", err))
+	}
+
+	return User{
+		Identity:     Identity{User: name, Role: role, Permissions: permissions},
+		PasswordHash: pbkdf2(password, salt, DefaultIterations),
+		Salt:         salt,
+		Iterations:   DefaultIterations,
+	}
+}
+
+// HashPassword returns the password hash to write in a users file,
+// pbkdf2-sha256$iterations$salt$key with a new random salt and the hex salt and key.
+func HashPassword(password string, iterations int) (string, error) {
+	if iterations <= 0 {
+		return "", fmt.Errorf("invalid iteration count %d", iterations)
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := pbkdf2(password, salt, iterations)
+
+	return fmt.Sprintf("%s$%d$%s$%s", hashScheme, iterations, hex.EncodeToString(salt), hex.EncodeToString(key)), nil
+}
+
+// pbkdf2 derives a key of sha256.Size bytes from the password as PBKDF2-HMAC-SHA256 does.
+func pbkdf2(password string, salt []byte, iterations int) []byte {
+	mac := hmac.New(sha256.New, []byte(password))
+	mac.Write(salt)
+	// the index of the only block, big endian
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+
+	key := make([]byte, len(u))
+	copy(key, u)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+
+	return key
+}
+
+// LoadFile creates an authenticator of the users listed in the given file.
+// Every line holds a user name, its password hash, its role and its permissions
+// written as letters (r, w and a, or - for none), separated by spaces.
+// The password hash is written as pbkdf2-sha256$iterations$salt$key, the salt and the key
+// in hex, the key being the PBKDF2-HMAC-SHA256 of the password, as made by HashPassword.
+// Empty lines and lines starting with # are ignored.
+func LoadFile(name string) (*Static, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	users := make([]User, 0)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		u, err := parseUser(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", name, line, err)
+		}
+		users = append(users, u)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewStatic(users...), nil
+}
+
+// parseUser parses a line of a users file.
+func parseUser(line string) (User, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 4 {
+		return User{}, fmt.Errorf("want 4 fields, got %d", len(fields))
+	}
+
+	salt, hash, iterations, err := parseHash(fields[1])
+	if err != nil {
+		return User{}, fmt.Errorf("%w of user %s", err, fields[0])
+	}
+	permissions, err := ParsePermission(fields[3])
+	if err != nil {
+		return User{}, err
+	}
+
+	return User{
+		Identity:     Identity{User: fields[0], Role: fields[2], Permissions: permissions},
+		PasswordHash: hash,
+		Salt:         salt,
+		Iterations:   iterations,
+	}, nil
+}
+
+// parseHash parses a password hash written as pbkdf2-sha256$iterations$salt$key.
+func parseHash(s string) ([]byte, []byte, int, error) {
+	parts := strings.Split(s, "$")
+	if len(parts) != 4 || parts[0] != hashScheme {
+		return nil, nil, 0, errInvalidHash
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return nil, nil, 0, errInvalidHash
+	}
+	salt, err := hex.DecodeString(parts[2])
+	if err != nil || len(salt) == 0 {
+		return nil, nil, 0, errInvalidHash
+	}
+	hash, err := hex.DecodeString(parts[3])
+	if err != nil || len(hash) != sha256.Size {
+		return nil, nil, 0, errInvalidHash
+	}
+
+	return salt, hash, iterations, nil
+}
+
+// Authenticate returns the identity of the user or ErrUnauthorized.
+// The password of an unknown user is hashed all the same, so that the time taken
+// does not tell which users exist.
+func (s *Static) Authenticate(user, password string) (Identity, error) {
+	u, isExist := s.users[user]
+	if !isExist {
+		u = User{PasswordHash: make([]byte, sha256.Size), Salt: make([]byte, saltSize), Iterations: DefaultIterations}
+	}
+
+	hash := pbkdf2(password, u.Salt, u.Iterations)
+	if subtle.ConstantTimeCompare(hash, u.PasswordHash) != 1 || !isExist {
+		return Identity{}, ErrUnauthorized
+	}
+
+	return u.Identity, nil
+}
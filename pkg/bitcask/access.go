@@ -0,0 +1,134 @@
+package bitcask
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+)
+
+// errAccessNotTracked happens whenever the access stats are requested
+// from a bitcask opened without WithAccessTracking.
+var errAccessNotTracked = errors.New("access tracking is not enabled")
+
+type (
+	// KeyAccess represents the access stats of a single key.
+	KeyAccess struct {
+		// Writes is the number of writes to the key since the bitcask was opened.
+		Writes uint64
+		// LastAccess is the approximate time of the last read or write of the key,
+		// with a precision of one second.
+		LastAccess time.Time
+	}
+
+	// accessTracker holds the access stats of the keys.
+	// It has its own lock since reads update it while sharing the access lock.
+	accessTracker struct {
+		mu    sync.Mutex
+		stats map[string]*keyAccess
+	}
+
+	// keyAccess is the compact form of KeyAccess kept per key.
+	keyAccess struct {
+		writes     uint64
+		lastAccess int64
+	}
+)
+
+// WithAccessTracking tracks the write count and the approximate last access time of every key.
+// The stats are kept in memory only and start from zero every time the bitcask is opened,
+// they cost a few tens of bytes per key.
+func WithAccessTracking() Option {
+	return optionFunc(func(o *options) {
+		o.trackAccess = true
+	})
+}
+
+// KeyAccess returns the access stats of the given key.
+// Return an error if access tracking is not enabled or the key does not exist.
+func (b *Bitcask) KeyAccess(key string) (KeyAccess, error) {
+	access := b.access.Load()
+	if access == nil {
+		return KeyAccess{}, errAccessNotTracked
+	}
+
+	access.mu.Lock()
+	stats, isExist := access.stats[key]
+	var res KeyAccess
+	if isExist {
+		res = KeyAccess{Writes: stats.writes, LastAccess: time.Unix(stats.lastAccess, 0)}
+	}
+	access.mu.Unlock()
+	if isExist {
+		return res, nil
+	}
+
+	// keys not accessed since the bitcask was opened report the time of their last write
+	b.startRead()
+	rec, isExist := b.keyDir.Get(key)
+	var err error
+	if isExist {
+		_, err = b.readValue(key, rec, false)
+	} else {
+		err = datastore.KeyError(key, datastore.ErrKeyNotExist)
+	}
+	b.endRead()
+	if err != nil {
+		return KeyAccess{}, err
+	}
+
+	return KeyAccess{LastAccess: time.Unix(time.UnixMicro(rec.Tstamp).Unix(), 0)}, nil
+}
+
+// newAccessTracker creates an empty access tracker.
+func newAccessTracker() *accessTracker {
+	return &accessTracker{stats: make(map[string]*keyAccess)}
+}
+
+// read records a read of the key at the given time.
+func (t *accessTracker) read(key string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats, isExist := t.stats[key]
+	if !isExist {
+		stats = &keyAccess{}
+		t.stats[key] = stats
+	}
+	stats.lastAccess = now.Unix()
+}
+
+// write records a write of the key at the given time.
+func (t *accessTracker) write(key string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats, isExist := t.stats[key]
+	if !isExist {
+		stats = &keyAccess{}
+		t.stats[key] = stats
+	}
+	stats.writes++
+	stats.lastAccess = now.Unix()
+}
+
+// get returns a copy of the stats of the key.
+func (t *accessTracker) get(key string) (keyAccess, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats, isExist := t.stats[key]
+	if !isExist {
+		return keyAccess{}, false
+	}
+
+	return *stats, true
+}
+
+// remove forgets the stats of a deleted key.
+func (t *accessTracker) remove(key string) {
+	t.mu.Lock()
+	delete(t.stats, key)
+	t.mu.Unlock()
+}
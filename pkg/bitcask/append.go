@@ -0,0 +1,61 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+)
+
+// AppendValue appends suffix to the value stored by key, a missing key is created with suffix as its value.
+// The value is read and rewritten under the write lock as a single new record,
+// so concurrent appends are not lost and readers never see a partial value.
+// Return the length of the value after the append or an error on any system failure.
+func (b *Bitcask) AppendValue(key, suffix string) (int, error) {
+	if b.usrOpts.accessPermission == ReadOnly {
+		return 0, fmt.Errorf("AppendValue: %w", ErrReadOnly)
+	}
+
+	err := b.usrOpts.keyValidator(key)
+	if err != nil {
+		return 0, fmt.Errorf("AppendValue: %w", err)
+	}
+
+	b.accessMu.Lock()
+	defer b.accessMu.Unlock()
+	tstamp := b.usrOpts.clock.Now().UnixMicro()
+
+	if b.frozen {
+		return 0, fmt.Errorf("AppendValue: %w", ErrFrozen)
+	}
+
+	value := ""
+	var meta map[string]string
+	if rec, isExist := b.keyDir.Get(key); isExist {
+		data, err := b.readRecord(key, rec, b.shouldVerify())
+		if err != nil && !errors.Is(err, datastore.ErrKeyNotExist) {
+			return 0, err
+		}
+		if err == nil {
+			value, meta = data.Value, data.Meta
+		}
+	}
+	value += suffix
+
+	err = b.store(key, value, meta, tstamp)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(value), nil
+}
+
+// AppendValue appends suffix to the value stored by key in the partition owning the key.
+func (p *Partitioned) AppendValue(key, suffix string) (int, error) {
+	b, err := p.partition(key)
+	if err != nil {
+		return 0, err
+	}
+
+	return b.AppendValue(key, suffix)
+}
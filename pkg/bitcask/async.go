@@ -0,0 +1,96 @@
+package bitcask
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// asyncQueueSize is the number of writes PutAsync queues before blocking.
+const asyncQueueSize = 1024
+
+// errClosed happens whenever a write is queued after the bitcask is closed.
+var errClosed = errors.New("bitcask is closed")
+
+type (
+	// asyncWriter applies the writes queued by PutAsync in the background.
+	asyncWriter struct {
+		mu     sync.Mutex
+		queue  chan asyncPut
+		closed bool
+		wg     sync.WaitGroup
+	}
+
+	// asyncPut is a write waiting in the queue of the async writer.
+	asyncPut struct {
+		key   string
+		value string
+		done  func(error)
+	}
+)
+
+// PutAsync queues a write and returns without waiting for it, done is called
+// with the result of the write once it reached the durability of the sync option:
+// on disk with SyncOnPut, or handed to the operating system with SyncOnDemand.
+// The writes are applied in the order they are queued and done is called from a
+// single background goroutine, so it should return quickly; done may be nil.
+// PutAsync blocks while the queue is full, or fails with ErrBusy after the timeout set by WithBusyTimeout.
+// Close waits for the queued writes to be applied.
+func (b *Bitcask) PutAsync(key, value string, done func(error)) {
+	if done == nil {
+		done = func(error) {}
+	}
+
+	w := b.asyncWriter()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		done(errClosed)
+		return
+	}
+
+	op := asyncPut{key: key, value: value, done: done}
+	if b.usrOpts.busyTimeout <= 0 {
+		w.queue <- op
+		return
+	}
+
+	timer := time.NewTimer(b.usrOpts.busyTimeout)
+	defer timer.Stop()
+	select {
+	case w.queue <- op:
+	case <-timer.C:
+		done(ErrBusy)
+	}
+}
+
+// asyncWriter returns the async writer, starting it on first use.
+func (b *Bitcask) asyncWriter() *asyncWriter {
+	b.asyncOnce.Do(func() {
+		w := &asyncWriter{queue: make(chan asyncPut, asyncQueueSize)}
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			for op := range w.queue {
+				op.done(b.Put(op.key, op.value))
+			}
+		}()
+		b.async = w
+	})
+
+	return b.async
+}
+
+// close stops accepting writes and waits for the queued writes to be applied.
+func (w *asyncWriter) close() {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	w.wg.Wait()
+}
@@ -0,0 +1,116 @@
+package bitcask
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/sio"
+)
+
+// auditFile is the name of the file holding the audit log of a datastore.
+const auditFile = ".audit"
+
+// AuditEvent represents an administrative operation recorded in the audit log.
+type AuditEvent struct {
+	// Time is when the operation finished.
+	Time time.Time `json:"time"`
+	// Event is the name of the operation, e.g. open, close or merge.
+	Event string `json:"event"`
+	// Label is the label given to WithAudit by the process doing the operation.
+	Label string `json:"label"`
+	// Outcome is "ok" or the error returned by the operation.
+	Outcome string `json:"outcome"`
+	// Detail holds optional information about the operation.
+	Detail string `json:"detail,omitempty"`
+}
+
+// WithAudit records the administrative operations done by the bitcask, such as
+// opening, closing and merging, into an append-only audit log inside the datastore.
+// Every event carries the given label, e.g. the name of the host or the operator.
+// Failures to write the audit log are logged and do not fail the operations.
+func WithAudit(label string) Option {
+	return optionFunc(func(o *options) {
+		o.audit = true
+		o.auditLabel = label
+	})
+}
+
+// ReadAuditLog returns the events recorded in the audit log of the datastore
+// at the given path, from the oldest to the newest.
+func ReadAuditLog(dataStorePath string) ([]AuditEvent, error) {
+	res := make([]AuditEvent, 0)
+
+	file, err := os.Open(path.Join(dataStorePath, auditFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return res, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+	for scanner.Scan() {
+		var event AuditEvent
+		err := json.Unmarshal(scanner.Bytes(), &event)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", auditFile, err)
+		}
+		res = append(res, event)
+	}
+
+	return res, scanner.Err()
+}
+
+// audit appends an event with the outcome of the given error to the audit log
+// if auditing is enabled.
+func (b *Bitcask) audit(event string, opErr error, detail string) {
+	if !b.usrOpts.audit {
+		return
+	}
+
+	outcome := "ok"
+	if opErr != nil {
+		outcome = opErr.Error()
+	}
+
+	err := appendAuditEvent(b.dataStore.Path(), AuditEvent{
+		Time:    b.usrOpts.clock.Now().UTC(),
+		Event:   event,
+		Label:   b.usrOpts.auditLabel,
+		Outcome: outcome,
+		Detail:  detail,
+	})
+	if err != nil {
+		log.Printf("bitcask: cannot record %s in the audit log: %v", event, err)
+	}
+}
+
+// appendAuditEvent appends a single event as a line to the audit log.
+func appendAuditEvent(dataStorePath string, event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	file, err := sio.OpenFile(path.Join(dataStorePath, auditFile), flags, os.FileMode(0666))
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(line)
+	if err != nil {
+		file.File.Close()
+		return err
+	}
+
+	return file.File.Close()
+}
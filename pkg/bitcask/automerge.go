@@ -0,0 +1,198 @@
+package bitcask
+
+import (
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/keydir"
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+// autoMergeRetry is the time an automatic merge waits after a failure before trying again.
+const autoMergeRetry = time.Minute
+
+type (
+	// diskUsage estimates the total and dead bytes of every data file.
+	// It is loaded from the file sizes and the keydir, then updated by every write,
+	// a write makes the previous record of its key dead.
+	diskUsage struct {
+		files map[string]*fileUsage
+		total int64
+		dead  int64
+	}
+
+	// fileUsage holds the size of a data file and the size of its dead records.
+	fileUsage struct {
+		total int64
+		dead  int64
+	}
+)
+
+// WithAutoMerge makes a writer merge the datastore in the background once the data files
+// other than the active file hold at least staleRatio dead bytes out of their total size,
+// or at least deadBytes dead bytes. A threshold of 0 is ignored.
+// The dead bytes are the overwritten and deleted records, tracked as the keys are written.
+// Merge can still be called at any time, the failed automatic merges are logged and
+// retried a minute later.
+func WithAutoMerge(staleRatio float64, deadBytes int64) Option {
+	return optionFunc(func(o *options) {
+		o.autoMergeRatio = staleRatio
+		o.autoMergeBytes = deadBytes
+	})
+}
+
+// recordSize returns the size in bytes of the data file record of the given keydir record.
+func recordSize(key string, rec recfmt.KeyDirRec) int64 {
+	return int64(recfmt.DataFileRecHdr + len(key) + int(rec.ValueSize))
+}
+
+// loadDiskUsage estimates the usage of the data files of the directory,
+// the bytes of a file not referenced by the keydir are dead.
+func loadDiskUsage(dirPath string, kd keydir.KeyDir) (*diskUsage, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	u := &diskUsage{files: make(map[string]*fileUsage)}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".data") {
+			continue
+		}
+		info, err := entry.Info()
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		u.files[entry.Name()] = &fileUsage{total: info.Size(), dead: info.Size()}
+		u.total += info.Size()
+		u.dead += info.Size()
+	}
+
+	kd.Iterate(func(key string, rec recfmt.KeyDirRec) bool {
+		if f, isExist := u.files[rec.FileId]; isExist {
+			size := recordSize(key, rec)
+			f.dead -= size
+			u.dead -= size
+		}
+		return true
+	})
+
+	return u, nil
+}
+
+// write accounts a record of size bytes appended to the given file,
+// replacing the previous record of its key if there is one.
+func (u *diskUsage) write(fileId string, size int64, old *recfmt.KeyDirRec, oldSize int64) {
+	f, isExist := u.files[fileId]
+	if !isExist {
+		f = &fileUsage{}
+		u.files[fileId] = f
+	}
+	f.total += size
+	u.total += size
+
+	if old == nil {
+		return
+	}
+	if f, isExist := u.files[old.FileId]; isExist {
+		f.dead += oldSize
+		u.dead += oldSize
+	}
+}
+
+// old returns the dead and total bytes of the data files other than the active file,
+// which are the files a merge compacts.
+func (u *diskUsage) old(activeFile string) (dead, total int64) {
+	dead, total = u.dead, u.total
+	if f, isExist := u.files[activeFile]; isExist {
+		dead -= f.dead
+		total -= f.total
+	}
+
+	return dead, total
+}
+
+// mergeDue reports whether the dead bytes of the old files reached a threshold of WithAutoMerge.
+// It is called with the access lock held.
+func (b *Bitcask) mergeDue() bool {
+	dead, total := b.usage.old(b.activeFile.Name())
+	if dead <= 0 {
+		return false
+	}
+	if b.usrOpts.autoMergeBytes > 0 && dead >= b.usrOpts.autoMergeBytes {
+		return true
+	}
+
+	return b.usrOpts.autoMergeRatio > 0 && float64(dead) >= b.usrOpts.autoMergeRatio*float64(total)
+}
+
+// kickAutoMerge wakes the automatic merger up if a merge is due.
+// It is called with the access lock held.
+func (b *Bitcask) kickAutoMerge() {
+	if b.autoMergeKick == nil || !b.mergeDue() {
+		return
+	}
+
+	select {
+	case b.autoMergeKick <- struct{}{}:
+	default:
+		// a merge is already pending
+	}
+}
+
+// startAutoMerge merges the datastore in the background whenever kickAutoMerge
+// finds a merge due, until stopAutoMerge is called.
+func (b *Bitcask) startAutoMerge() {
+	b.autoMergeKick = make(chan struct{}, 1)
+	b.autoMergeStop = make(chan struct{})
+	b.autoMergeDone = make(chan struct{})
+
+	go func() {
+		defer close(b.autoMergeDone)
+
+		var failed time.Time
+		for {
+			select {
+			case <-b.autoMergeStop:
+				return
+			case <-b.autoMergeKick:
+			}
+
+			if !failed.IsZero() && time.Since(failed) < autoMergeRetry {
+				continue
+			}
+			// the merge may have become unnecessary since the kick, after a manual merge for example
+			b.accessMu.Lock()
+			due := b.mergeDue()
+			b.accessMu.Unlock()
+			if !due {
+				continue
+			}
+
+			_, err := b.merge()
+			if err != nil {
+				log.Printf("bitcask: automatic merge of %s failed: %v", b.dataStore.Path(), err)
+				failed = time.Now()
+			} else {
+				failed = time.Time{}
+			}
+		}
+	}()
+}
+
+// stopAutoMerge stops the automatic merger and waits for the merge in progress, if any.
+// The merger is stopped once, the later calls do nothing.
+func (b *Bitcask) stopAutoMerge() {
+	if b.autoMergeStop == nil {
+		return
+	}
+
+	close(b.autoMergeStop)
+	<-b.autoMergeDone
+	b.autoMergeStop, b.autoMergeDone = nil, nil
+}
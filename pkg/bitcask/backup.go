@@ -0,0 +1,458 @@
+package bitcask
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// manifestFile is the name of the manifest written last in backup directories.
+const manifestFile = "manifest.json"
+
+var (
+	// ErrBackupInvalid happens whenever a backup does not match its manifest
+	// or the manifest signature is wrong.
+	ErrBackupInvalid = errors.New("backup does not match its manifest")
+
+	// errNotEmpty happens whenever a backup or a restore targets a non empty directory.
+	errNotEmpty = errors.New("directory is not empty")
+)
+
+type (
+	// BackupManifest describes the files of a backup.
+	BackupManifest struct {
+		// Created is when the backup was taken.
+		Created time.Time `json:"created"`
+		// Files lists the backed up data and hint files.
+		Files []BackupFile `json:"files"`
+		// FileCount is the number of files copied in the backup.
+		FileCount int `json:"file_count"`
+		// TotalBytes is the sum of the sizes of the files.
+		TotalBytes int64 `json:"total_bytes"`
+		// Keys is the number of keys in the keydir when the backup was taken.
+		Keys int `json:"keys"`
+		// Base is the directory of the backup an incremental backup is based on,
+		// relative to the backup directory. It is empty for full backups.
+		Base string `json:"base,omitempty"`
+		// Inherited lists the files unchanged since the base backup, they are not copied
+		// and not counted in FileCount and TotalBytes.
+		Inherited []BackupFile `json:"inherited,omitempty"`
+		// Signature is the hex HMAC-SHA256 of the manifest without its signature,
+		// it is empty for unsigned backups.
+		Signature string `json:"signature,omitempty"`
+	}
+
+	// BackupFile describes a single file of a backup.
+	BackupFile struct {
+		Name   string `json:"name"`
+		Size   int64  `json:"size"`
+		SHA256 string `json:"sha256"`
+	}
+)
+
+// Backup copies the data and hint files into the given directory, which must
+// not exist or be empty, and writes a manifest holding their sizes and hashes.
+// The manifest is signed with HMAC-SHA256 when signingKey is not empty.
+// Writes and merges are rejected with ErrFrozen while the files are copied, reads are still served.
+// The manifest is written last, so an interrupted backup has no manifest and cannot be restored.
+func (b *Bitcask) Backup(dir string, signingKey []byte) (*BackupManifest, error) {
+	manifest, err := b.backup(dir, "", nil, signingKey)
+	detail := ""
+	if err == nil {
+		detail = fmt.Sprintf("dir=%s files=%d bytes=%d", dir, manifest.FileCount, manifest.TotalBytes)
+	}
+	b.audit("backup", err, detail)
+
+	return manifest, err
+}
+
+// BackupIncremental is like Backup but only copies the files created or grown since
+// the backup in baseDir, which may be incremental as well. The data and hint files are
+// only appended to, so a file with the same name and size as in the base backup is
+// unchanged: it is listed in the Inherited files of the manifest instead of being copied.
+// Restore and VerifyBackup read the inherited files from the chain of base backups,
+// which must be kept at the same place relative to the incremental backup.
+// When signingKey is not empty the base manifest must carry a valid signature made with it.
+func (b *Bitcask) BackupIncremental(dir, baseDir string, signingKey []byte) (*BackupManifest, error) {
+	var manifest *BackupManifest
+	base, err := readManifest(baseDir, signingKey)
+	if err == nil {
+		manifest, err = b.backup(dir, baseDir, base, signingKey)
+	}
+	detail := ""
+	if err == nil {
+		detail = fmt.Sprintf("dir=%s base=%s files=%d bytes=%d inherited=%d",
+			dir, baseDir, manifest.FileCount, manifest.TotalBytes, len(manifest.Inherited))
+	}
+	b.audit("backup", err, detail)
+
+	return manifest, err
+}
+
+// backup freezes the datastore and copies its files,
+// but the files of the base backup when there is one.
+func (b *Bitcask) backup(dir, baseDir string, base *BackupManifest, signingKey []byte) (*BackupManifest, error) {
+	err := createEmptyDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	baseFiles := make(map[string]BackupFile)
+	if base != nil {
+		for _, file := range append(base.Files, base.Inherited...) {
+			baseFiles[file.Name] = file
+		}
+	}
+
+	b.accessMu.Lock()
+	wasFrozen := b.frozen
+	b.frozen = true
+	keys := b.keyDir.Len() - len(b.deleted)
+	b.accessMu.Unlock()
+	defer func() {
+		b.accessMu.Lock()
+		b.frozen = wasFrozen
+		b.accessMu.Unlock()
+	}()
+
+	if b.usrOpts.accessPermission == ReadWrite {
+		err := b.activeFile.Sync()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the entries are sorted by name, and so are the manifest files
+	entries, err := os.ReadDir(b.dataStore.Path())
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &BackupManifest{
+		Created: b.usrOpts.clock.Now().UTC(),
+		Files:   make([]BackupFile, 0),
+		Keys:    keys,
+	}
+	if base != nil {
+		manifest.Base, err = relativePath(dir, baseDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".data") && !strings.HasSuffix(name, ".hint") {
+			continue
+		}
+		if file, isExist := baseFiles[name]; isExist {
+			info, err := entry.Info()
+			if err == nil && info.Size() == file.Size {
+				manifest.Inherited = append(manifest.Inherited, file)
+				continue
+			}
+		}
+
+		file, err := copyFile(path.Join(b.dataStore.Path(), name), path.Join(dir, name))
+		if os.IsNotExist(err) {
+			// the file was removed by a merge that finished before the freeze
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, file)
+		manifest.TotalBytes += file.Size
+	}
+	manifest.FileCount = len(manifest.Files)
+
+	if len(signingKey) > 0 {
+		manifest.Signature, err = manifest.sign(signingKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = writeManifest(dir, manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return manifest, nil
+}
+
+// Restore verifies the backup in backupDir against its manifest and copies its
+// files into dataStorePath, which must not exist or be empty.
+// When signingKey is not empty the manifest must carry a valid signature made with it.
+// Return ErrBackupInvalid if a file is missing, truncated or altered, or the signature is wrong.
+func Restore(backupDir, dataStorePath string, signingKey []byte) (*BackupManifest, error) {
+	manifest, err := VerifyBackup(backupDir, signingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = createEmptyDir(dataStorePath)
+	if err != nil {
+		return nil, err
+	}
+
+	inherited, err := inheritedFiles(backupDir, manifest, signingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, want := range append(manifest.Files, manifest.Inherited...) {
+		src := path.Join(backupDir, want.Name)
+		if dir, isExist := inherited[want.Name]; isExist {
+			src = path.Join(dir, want.Name)
+		}
+		got, err := copyFile(src, path.Join(dataStorePath, want.Name))
+		if err != nil {
+			return nil, err
+		}
+		if got != want {
+			return nil, fmt.Errorf("%s: %w", want.Name, ErrBackupInvalid)
+		}
+	}
+
+	return manifest, nil
+}
+
+// VerifyBackup checks the files of the backup in the given directory against its manifest
+// and the manifest signature when signingKey is not empty.
+// The files of an incremental backup inherited from its base backups are checked as well.
+// Return the manifest or ErrBackupInvalid describing the first mismatch.
+func VerifyBackup(dir string, signingKey []byte) (*BackupManifest, error) {
+	manifest, err := readManifest(dir, signingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	for _, want := range manifest.Files {
+		got, err := hashFile(path.Join(dir, want.Name))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w: %v", want.Name, ErrBackupInvalid, err)
+		}
+		if got != want {
+			return nil, fmt.Errorf("%s: %w", want.Name, ErrBackupInvalid)
+		}
+		total += got.Size
+	}
+	if manifest.FileCount != len(manifest.Files) || manifest.TotalBytes != total {
+		return nil, fmt.Errorf("totals: %w", ErrBackupInvalid)
+	}
+
+	inherited, err := inheritedFiles(dir, manifest, signingKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, want := range manifest.Inherited {
+		got, err := hashFile(path.Join(inherited[want.Name], want.Name))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w: %v", want.Name, ErrBackupInvalid, err)
+		}
+		if got != want {
+			return nil, fmt.Errorf("%s: %w", want.Name, ErrBackupInvalid)
+		}
+	}
+
+	return manifest, nil
+}
+
+// readManifest reads the manifest of the backup in the given directory
+// and checks its signature when signingKey is not empty.
+func readManifest(dir string, signingKey []byte) (*BackupManifest, error) {
+	data, err := os.ReadFile(path.Join(dir, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &BackupManifest{}
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", manifestFile, err)
+	}
+
+	if len(signingKey) > 0 {
+		want, err := manifest.sign(signingKey)
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal([]byte(manifest.Signature), []byte(want)) {
+			return nil, fmt.Errorf("signature: %w", ErrBackupInvalid)
+		}
+	}
+
+	return manifest, nil
+}
+
+// inheritedFiles walks the chain of base backups of the backup in dir and returns
+// the directory holding the copy of every inherited file, the closest base first.
+// Return ErrBackupInvalid if an inherited file is copied by no base backup.
+func inheritedFiles(dir string, manifest *BackupManifest, signingKey []byte) (map[string]string, error) {
+	res := make(map[string]string)
+	missing := make(map[string]bool)
+	for _, file := range manifest.Inherited {
+		missing[file.Name] = true
+	}
+
+	for len(missing) > 0 && manifest.Base != "" {
+		if filepath.IsAbs(manifest.Base) {
+			dir = manifest.Base
+		} else {
+			dir = path.Join(dir, manifest.Base)
+		}
+
+		var err error
+		manifest, err = readManifest(dir, signingKey)
+		if err != nil {
+			return nil, fmt.Errorf("base %s: %w", dir, err)
+		}
+		for _, file := range manifest.Files {
+			if missing[file.Name] {
+				res[file.Name] = dir
+				delete(missing, file.Name)
+			}
+		}
+	}
+	for name := range missing {
+		return nil, fmt.Errorf("%s: %w: missing from the base backups", name, ErrBackupInvalid)
+	}
+
+	return res, nil
+}
+
+// sign returns the hex HMAC-SHA256 of the manifest without its signature.
+func (m *BackupManifest) sign(key []byte) (string, error) {
+	unsigned := *m
+	unsigned.Signature = ""
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	_, err = mac.Write(data)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// relativePath returns the path of target relative to dir.
+func relativePath(dir, target string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	target, err = filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Rel(dir, target)
+}
+
+// createEmptyDir creates the directory if it does not exist
+// and fails if it exists and is not empty.
+func createEmptyDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s: %w", dir, errNotEmpty)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.MkdirAll(dir, os.FileMode(0777))
+}
+
+// copyFile copies src to dst, flushing dst to the disk, and describes the copied content.
+func copyFile(src, dst string) (BackupFile, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return BackupFile{}, err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_EXCL, os.FileMode(0666))
+	if err != nil {
+		return BackupFile{}, err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, h), in)
+	if err == nil {
+		err = out.Sync()
+	}
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return BackupFile{}, err
+	}
+
+	return describeFile(path.Base(dst), n, h), nil
+}
+
+// hashFile describes the content of the given file.
+func hashFile(name string) (BackupFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return BackupFile{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return BackupFile{}, err
+	}
+
+	return describeFile(path.Base(name), n, h), nil
+}
+
+// describeFile builds the manifest entry of a file.
+func describeFile(name string, size int64, h hash.Hash) BackupFile {
+	return BackupFile{Name: name, Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}
+}
+
+// writeManifest writes the manifest into the backup directory through a temporary file,
+// so the manifest is either complete or missing.
+func writeManifest(dir string, manifest *BackupManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path.Join(dir, "."+manifestFile)
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(0666))
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path.Join(dir, manifestFile))
+}
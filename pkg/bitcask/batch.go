@@ -0,0 +1,155 @@
+package bitcask
+
+import (
+	"fmt"
+
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+// Batch buffers puts and deletes until Commit writes them all at once.
+// A batch is not safe for concurrent use.
+type Batch struct {
+	b       *Bitcask
+	keys    []string
+	values  []string
+	deleted []bool
+}
+
+// WriteBatch creates an empty batch of writes to the bitcask datastore.
+func (b *Bitcask) WriteBatch() *Batch {
+	return &Batch{b: b}
+}
+
+// Put buffers storing value by key.
+func (bt *Batch) Put(key, value string) {
+	bt.keys = append(bt.keys, key)
+	bt.values = append(bt.values, value)
+	bt.deleted = append(bt.deleted, false)
+}
+
+// Delete buffers removing key, unlike Bitcask.Delete it is not an error if key does not exist.
+func (bt *Batch) Delete(key string) {
+	bt.keys = append(bt.keys, key)
+	bt.values = append(bt.values, "")
+	bt.deleted = append(bt.deleted, true)
+}
+
+// Len returns the number of buffered writes.
+func (bt *Batch) Len() int {
+	return len(bt.keys)
+}
+
+// Commit writes the buffered writes to the active file with a single write followed
+// by a single sync, and makes them visible to the readers at once.
+// The batch is applied entirely or not at all, including after a crash: the records
+// of a batch cut by a crash are skipped when the datastore is opened again.
+// When a key is written several times, only its last write is kept.
+// Return an error if a key is invalid, a value is too large, the datastore is frozen or on system failures,
+// the datastore is left unchanged in that case.
+func (bt *Batch) Commit() error {
+	b := bt.b
+	if b.usrOpts.accessPermission == ReadOnly {
+		return fmt.Errorf("Commit: %w", ErrReadOnly)
+	}
+
+	keys, values, deleted := bt.lastWrites()
+	if len(keys) == 0 {
+		return nil
+	}
+	for i, key := range keys {
+		err := b.usrOpts.keyValidator(key)
+		if err != nil {
+			return fmt.Errorf("Commit: %w", err)
+		}
+		err = recfmt.CheckValueSize(values[i], nil)
+		if err != nil {
+			return fmt.Errorf("Commit: %w", err)
+		}
+	}
+
+	b.accessMu.Lock()
+	defer b.accessMu.Unlock()
+	tstamp := b.usrOpts.clock.Now().UnixMicro()
+
+	if b.frozen {
+		return fmt.Errorf("Commit: %w", ErrFrozen)
+	}
+
+	if b.mirror != nil {
+		err := b.mirror.reserve()
+		if err != nil {
+			return err
+		}
+	}
+	for _, key := range keys {
+		err := b.checkImmutable(key)
+		if err != nil {
+			return err
+		}
+		err = b.checkMemory(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := b.removeKeyDirFile()
+	if err != nil {
+		return err
+	}
+
+	tstamp = b.nextTstamp(tstamp)
+
+	activeName := b.activeFile.Name()
+	positions, err := b.activeFile.WriteBatch(keys, values, deleted, tstamp)
+	if err != nil {
+		return err
+	}
+	if b.activeFile.Name() != activeName {
+		b.publish(Event{Kind: RotationEvent, File: b.activeFile.Name()})
+	}
+	if b.usrOpts.syncOption != SyncOnPut {
+		// the active file of SyncOnPut is opened with O_SYNC, the write is already synced
+		err = b.activeFile.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, key := range keys {
+		size := recfmt.StoredValueSize(values[i], nil)
+		if deleted[i] {
+			size = 0
+		}
+		indexErr := b.index(key, values[i], nil, deleted[i], positions[i], size, tstamp)
+		if err == nil {
+			err = indexErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return b.evict(keys[len(keys)-1], tstamp)
+}
+
+// lastWrites returns the buffered writes keeping only the last write of every key,
+// in the order of these last writes.
+func (bt *Batch) lastWrites() ([]string, []string, []bool) {
+	last := make(map[string]int, len(bt.keys))
+	for i, key := range bt.keys {
+		last[key] = i
+	}
+
+	keys := make([]string, 0, len(last))
+	values := make([]string, 0, len(last))
+	deleted := make([]bool, 0, len(last))
+	for i, key := range bt.keys {
+		if last[key] == i {
+			keys = append(keys, key)
+			values = append(values, bt.values[i])
+			deleted = append(deleted, bt.deleted[i])
+		}
+	}
+
+	return keys, values, deleted
+}
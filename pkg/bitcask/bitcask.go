@@ -2,73 +2,154 @@
 package bitcask
 
 import (
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/zaher1307/bitcask/internal/datastore"
+	"github.com/zaher1307/bitcask/internal/events"
 	"github.com/zaher1307/bitcask/internal/keydir"
 	"github.com/zaher1307/bitcask/internal/recfmt"
 )
 
-const (
-	// ReadOnly gives the bitcask process a read only permission.
-	ReadOnly ConfigOpt = 0
-	// ReadWrite gives the bitcask process read and write permissions.
-	ReadWrite ConfigOpt = 1
-	// SyncOnPut makes the bitcask flush all the writes directly to the disk.
-	SyncOnPut ConfigOpt = 2
-	// SyncOnDemand gives the user the control on whenever to do flush operation.
-	SyncOnDemand ConfigOpt = 3
-)
-
-// errRequireWrite happens whenever a user with ReadOnly permission tries to do a writing operation.
-var errRequireWrite = errors.New("require write permission")
-
-type (
-	// ConfigOpt represents the config options the user can have.
-	ConfigOpt int
-
-	// options groups the config options passed to Open.
-	options struct {
-		syncOption       ConfigOpt
-		accessPermission ConfigOpt
-	}
+// MergeResult summarizes the work done by a merge.
+type MergeResult struct {
+	// FilesRemoved is the number of old data and hint files removed.
+	FilesRemoved int
+	// KeysWritten is the number of live records rewritten into merge files.
+	KeysWritten int
+	// BytesWritten is the size in bytes of the rewritten records.
+	BytesWritten int64
+	// KeysExpired is the number of keys dropped for being older than WithMaxRecordAge.
+	KeysExpired int
+	// ValuesShared is the number of rewritten records referencing an identical value under WithDedup.
+	ValuesShared int
+}
 
-	// Bitcask represents the bitcask object.
-	// Bitcask contains the metadata needed to manipulate the bitcask datastore.
-	// User creates an object of it with to use the bitcask.
-	// Provides several methods to manipulate the datastore data.
-	Bitcask struct {
-		keyDir     keydir.KeyDir
-		usrOpts    options
-		accessMu   sync.Mutex
-		readerCnt  int32
-		dataStore  *datastore.DataStore
-		activeFile *datastore.AppendFile
-		fileFlags  int
-	}
-)
+// Bitcask represents the bitcask object.
+// Bitcask contains the metadata needed to manipulate the bitcask datastore.
+// User creates an object of it with to use the bitcask.
+// Provides several methods to manipulate the datastore data.
+//
+// A Bitcask is safe to share between goroutines: the reads run in parallel
+// and the writes are serialized, waiting for the reads in progress.
+// The callbacks of DeleteIf and the corruption handler run while the
+// bitcask is locked, they must not call the methods of the same bitcask.
+type Bitcask struct {
+	// reads, corruptions, evictions and clockSkews are accessed atomically,
+	// they are kept first to stay 64-bit aligned on 32-bit platforms.
+	reads       uint64
+	corruptions uint64
+	evictions   uint64
+	clockSkews  uint64
+
+	keyDir     keydir.KeyDir
+	usrOpts    options
+	accessMu   sync.RWMutex
+	dataStore  *datastore.DataStore
+	activeFile *datastore.AppendFile
+	fileFlags  int
+	frozen     bool
+	mirror     *mirror
+	// access is set by SetMaxMemory while the readers run, so it is loaded atomically.
+	access     atomic.Pointer[accessTracker]
+	lastTstamp int64
+	lastClock  int64
+	skewed     bool
+
+	// keyDirFileRemoved is set once the shared keydir file is removed by the first change.
+	keyDirFileRemoved bool
+
+	// keyDirBytes is the keydir size estimated as in MemoryUsage, kept for the memory limit.
+	keyDirBytes int64
+
+	// deleted holds the deleted keys whose tombstone is still in the keydir,
+	// until a merge drops them, so that the live keys are counted without reading the records.
+	deleted map[string]struct{}
+
+	// lastMerge is when the last merge since the bitcask was opened finished.
+	lastMerge time.Time
+
+	// mergeMu serializes the merges, which release accessMu while rewriting the records.
+	mergeMu sync.Mutex
+
+	// readMu is held for reading by every reader of the keydir,
+	// merge takes it to wait for the reads of the old files to finish.
+	readMu sync.RWMutex
+
+	async     *asyncWriter
+	asyncOnce sync.Once
+
+	flight   flight
+	events   *events.Bus
+	openInfo OpenInfo
+
+	sweepStop chan struct{}
+	sweepDone chan struct{}
+	syncStop  chan struct{}
+	syncDone  chan struct{}
+
+	// usage is updated with the access lock held.
+	usage         *diskUsage
+	autoMergeKick chan struct{}
+	autoMergeStop chan struct{}
+	autoMergeDone chan struct{}
+
+	// shared locates the stored values by hash for WithDedup,
+	// it is updated with the access lock held.
+	shared map[[sha256.Size]byte]recfmt.ValueRef
+
+	// prefixUsage tracks the prefixes of WithPrefixes, it is nil without them.
+	prefixUsage *prefixUsage
+
+	// snapshots are the snapshots of the open iterators, updated with the access lock held.
+	// snapshotsClosed is closed once the last iterator is closed.
+	snapshots       []*keySnapshot
+	snapshotsClosed chan struct{}
+
+	// mergePaused is set by PauseMerge and mergeThrottled by the latency controller,
+	// they are updated with the access lock held.
+	// mergeResumed is closed once both are lifted.
+	mergePaused    bool
+	mergeThrottled bool
+	mergeResumed   chan struct{}
+
+	// latency collects the latencies of Get for WithMergeLatencyTarget, it is nil without it.
+	latency        *latencyMonitor
+	controllerStop chan struct{}
+	controllerDone chan struct{}
+}
 
 // Open creates a new bitcask object to manipulate the given datastore path.
-// It can take options ReadWrite, ReadOnly, SyncOnPut and SyncOnDemand as config options.
+// It takes the With* functional options, such as WithReadWrite and WithSyncOnPut,
+// the ConfigOpt constants ReadWrite, ReadOnly, SyncOnPut and SyncOnDemand are still accepted.
 // Only one ReadWrite process can open a bitcask at a time.
 // Only ReadWrite permission can create a new bitcask datastore.
 // Multiple Readers or a single writer is allowed to be in the same datastore in the same time.
 // If there is no bitcask datastore in the given path a new datastore is created when ReadWrite permission is given.
-func Open(dataStorePath string, opts ...ConfigOpt) (*Bitcask, error) {
-	b := &Bitcask{}
-	b.usrOpts = parseUsrOpts(opts)
+func Open(dataStorePath string, opts ...Option) (*Bitcask, error) {
+	return open(dataStorePath, parseUsrOpts(opts), false)
+}
+
+// open opens the datastore with the parsed options,
+// a snapshot is opened without locking it nor writing anything to it.
+func open(dataStorePath string, usrOpts options, snapshot bool) (*Bitcask, error) {
+	b := &Bitcask{events: events.NewBus()}
+	b.usrOpts = usrOpts
 
 	var privacy keydir.KeyDirPrivacy
 	var lockMode datastore.LockMode
 
-	if b.usrOpts.accessPermission == ReadWrite {
+	if snapshot {
+		privacy = keydir.PrivateKeyDir
+		lockMode = datastore.NoLock
+	} else if b.usrOpts.accessPermission == ReadWrite {
 		privacy = keydir.PrivateKeyDir
 		lockMode = datastore.ExclusiveLock
 		fileFlags := os.O_CREATE | os.O_RDWR
@@ -76,7 +157,7 @@ func Open(dataStorePath string, opts ...ConfigOpt) (*Bitcask, error) {
 			fileFlags |= os.O_SYNC
 		}
 		b.fileFlags = fileFlags
-		b.activeFile = datastore.NewAppendFile(dataStorePath, b.fileFlags, datastore.Active)
+		b.activeFile = datastore.NewAppendFile(dataStorePath, b.fileFlags, datastore.Active, b.usrOpts.clock.Now, b.usrOpts.maxFileSize)
 	} else {
 		privacy = keydir.SharedKeyDir
 		lockMode = datastore.SharedLock
@@ -86,14 +167,71 @@ func Open(dataStorePath string, opts ...ConfigOpt) (*Bitcask, error) {
 	if err != nil {
 		return nil, err
 	}
+	dataStore.SetReadPolicy(b.usrOpts.readPolicy)
+	dataStore.SetMaxOpenFiles(b.usrOpts.maxOpenFiles)
+
+	start := time.Now()
+	keyDir, report, err := keydir.New(dataStorePath, privacy, keydir.Kind(b.usrOpts.keyDirKind), !snapshot && b.usrOpts.accessPermission == ReadWrite)
+	if err != nil {
+		dataStore.Close()
+		return nil, err
+	}
+	b.openInfo = newOpenInfo(report, keyDir.Len(), time.Since(start))
 
-	keyDir, err := keydir.New(dataStorePath, privacy)
+	usage, err := loadDiskUsage(dataStorePath, keyDir)
 	if err != nil {
+		dataStore.Close()
 		return nil, err
 	}
+	b.usage = usage
+	if len(b.usrOpts.prefixes) > 0 {
+		b.prefixUsage = newPrefixUsage(b.usrOpts.prefixes)
+		err = b.prefixUsage.load(dataStorePath, keyDir)
+		if err != nil {
+			dataStore.Close()
+			return nil, err
+		}
+	}
+
+	if b.usrOpts.accessPermission == ReadWrite && b.usrOpts.precreateActiveFile {
+		err = b.activeFile.Create()
+		if err != nil {
+			dataStore.Close()
+			return nil, err
+		}
+	}
 
 	b.dataStore = dataStore
 	b.keyDir = keyDir
+	b.lastTstamp = latestTstamp(keyDir)
+	b.lastClock = b.lastTstamp
+	policy := b.usrOpts.evictionPolicy
+	if b.usrOpts.trackAccess || policy == AllKeysLRU || policy == AllKeysLFU {
+		b.access.Store(newAccessTracker())
+	}
+	b.keyDirBytes = b.MemoryUsage().KeyDir
+	b.deleted = b.deletedKeys()
+	if b.usrOpts.mirror != nil && b.usrOpts.accessPermission == ReadWrite {
+		b.mirror = newMirror(b.usrOpts.mirror, b.usrOpts.mirrorQueueSize, b.usrOpts.busyTimeout)
+	}
+	if b.usrOpts.dedup && b.usrOpts.accessPermission == ReadWrite {
+		b.shared = make(map[[sha256.Size]byte]recfmt.ValueRef)
+	}
+	if b.usrOpts.accessPermission == ReadWrite && b.usrOpts.sweepInterval > 0 {
+		b.startSweeper()
+	}
+	if b.usrOpts.accessPermission == ReadWrite && b.usrOpts.syncOption != SyncOnPut && b.usrOpts.syncInterval > 0 {
+		b.startSyncer()
+	}
+	if b.usrOpts.accessPermission == ReadWrite && (b.usrOpts.autoMergeRatio > 0 || b.usrOpts.autoMergeBytes > 0) {
+		b.startAutoMerge()
+	}
+	if b.usrOpts.accessPermission == ReadWrite && b.usrOpts.mergeLatencyTarget > 0 {
+		b.latency = newLatencyMonitor(b.usrOpts.mergeLatencyTarget)
+		b.startMergeController()
+	}
+	b.audit("open", nil, fmt.Sprintf("permission=%s", permissionName(b.usrOpts.accessPermission)))
+	b.setFinalizer()
 
 	return b, nil
 }
@@ -104,22 +242,30 @@ func (b *Bitcask) Get(key string) (string, error) {
 	var value string
 	var err error
 
-	if b.readerCnt == 0 {
-		b.accessMu.Lock()
+	var start time.Time
+	if b.latency != nil {
+		start = time.Now()
 	}
-	atomic.AddInt32(&b.readerCnt, 1)
+	b.startRead()
 
-	rec, isExist := b.keyDir[key]
-	if !isExist {
+	rec, isExist := b.keyDir.Get(key)
+	if !isExist || b.expired(rec) {
 		value = ""
-		err = fmt.Errorf("%s: %s", key, datastore.ErrKeyNotExist)
+		err = datastore.KeyError(key, datastore.ErrKeyNotExist)
 	} else {
-		value, err = b.dataStore.ReadValueFromFile(rec.FileId, key, rec.ValuePos, rec.ValueSize)
+		// concurrent gets of the same record share a single disk read
+		value, err = b.flight.do(flightKey{fileId: rec.FileId, pos: rec.ValuePos}, func() (string, error) {
+			return b.readValue(key, rec, b.shouldVerify())
+		})
 	}
 
-	atomic.AddInt32(&b.readerCnt, -1)
-	if b.readerCnt == 0 {
-		b.accessMu.Unlock()
+	b.endRead()
+
+	if b.latency != nil {
+		b.latency.observe(time.Since(start))
+	}
+	if access := b.access.Load(); err == nil && access != nil {
+		access.read(key, b.usrOpts.clock.Now())
 	}
 
 	return value, err
@@ -129,35 +275,183 @@ func (b *Bitcask) Get(key string) (string, error) {
 // Return an error on any system failure when writing the data.
 func (b *Bitcask) Put(key, value string) error {
 	if b.usrOpts.accessPermission == ReadOnly {
-		return fmt.Errorf("Put: %s", errRequireWrite)
+		return fmt.Errorf("Put: %w", ErrReadOnly)
 	}
 
-	tstamp := time.Now().UnixMicro()
+	err := b.usrOpts.keyValidator(key)
+	if err != nil {
+		return fmt.Errorf("Put: %w", err)
+	}
 
 	b.accessMu.Lock()
 	defer b.accessMu.Unlock()
+	tstamp := b.usrOpts.clock.Now().UnixMicro()
+
+	if b.frozen {
+		return fmt.Errorf("Put: %w", ErrFrozen)
+	}
+
+	return b.store(key, value, nil, tstamp)
+}
+
+// recordKind tells which record a write appends.
+type recordKind int
+
+const (
+	// valueRecord stores a value.
+	valueRecord recordKind = iota
+	// immutableRecord stores the value of an immutable key.
+	immutableRecord
+	// tombstoneRecord marks a key as deleted.
+	tombstoneRecord
+)
+
+// store writes the record of a key that is not immutable with storeValue.
+// It is called with the access lock held.
+func (b *Bitcask) store(key, value string, meta map[string]string, tstamp int64) error {
+	err := b.checkImmutable(key)
+	if err != nil {
+		return err
+	}
+
+	return b.storeValue(key, value, meta, valueRecord, tstamp)
+}
+
+// storeTombstone deletes a key that is not immutable with storeValue.
+// It is called with the access lock held.
+func (b *Bitcask) storeTombstone(key string, tstamp int64) error {
+	err := b.checkImmutable(key)
+	if err != nil {
+		return err
+	}
+
+	return b.storeValue(key, "", nil, tombstoneRecord, tstamp)
+}
+
+// storeValue writes the record within the memory limit, it either rejects
+// the write or evicts other keys when the limit is reached.
+// The write is rejected as well when the mirror queue stays full.
+// It is called with the access lock held.
+func (b *Bitcask) storeValue(key, value string, meta map[string]string, kind recordKind, tstamp int64) error {
+	err := recfmt.CheckValueSize(value, meta)
+	if err != nil {
+		return err
+	}
+
+	if b.mirror != nil {
+		err := b.mirror.reserve()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = b.checkMemory(key)
+	if err != nil {
+		return err
+	}
+
+	err = b.put(key, value, meta, kind, tstamp)
+	if err != nil {
+		return err
+	}
+
+	return b.evict(key, tstamp)
+}
+
+// put appends the record to the active file, updates the keydir and the mirror.
+// It is called with the access lock held.
+func (b *Bitcask) put(key, value string, meta map[string]string, kind recordKind, tstamp int64) error {
+	err := b.removeKeyDirFile()
+	if err != nil {
+		return err
+	}
+
+	tstamp = b.nextTstamp(tstamp)
 
-	n, err := b.activeFile.WriteData(key, value, tstamp)
+	activeName := b.activeFile.Name()
+	n, size, _, err := b.writeValue(b.activeFile, b.shared, key, value, meta, kind, tstamp)
 	if err != nil {
 		return err
 	}
+	if b.activeFile.Name() != activeName {
+		b.publish(Event{Kind: RotationEvent, File: b.activeFile.Name()})
+	}
+
+	return b.index(key, value, meta, kind == tombstoneRecord, n, size, tstamp)
+}
 
-	b.keyDir[key] = recfmt.KeyDirRec{
+// index records the record written at the given position of the active file
+// in the keydir, the access stats and the mirror.
+// size is the size of the value as stored in the record, deleted is set for tombstones.
+// It is called with the access lock held.
+func (b *Bitcask) index(key, value string, meta map[string]string, deleted bool, n int, size uint32, tstamp int64) error {
+	rec := recfmt.KeyDirRec{
 		FileId:    b.activeFile.Name(),
 		ValuePos:  uint32(n),
-		ValueSize: uint32(len(value)),
+		ValueSize: size,
 		Tstamp:    tstamp,
 	}
+	b.saveSnapshots(key)
+	old, isExist := b.keyDir.Get(key)
+	if isExist {
+		b.usage.write(rec.FileId, recordSize(key, rec), &old, recordSize(key, old))
+	} else {
+		b.usage.write(rec.FileId, recordSize(key, rec), nil, 0)
+		b.keyDirBytes += keyDirEntrySize + int64(len(key))
+	}
+	if b.prefixUsage != nil {
+		if isExist {
+			b.prefixUsage.write(key, rec.FileId, recordSize(key, rec), &old, recordSize(key, old))
+		} else {
+			b.prefixUsage.write(key, rec.FileId, recordSize(key, rec), nil, 0)
+		}
+	}
+	b.keyDir.Set(key, rec)
+	if deleted {
+		b.deleted[key] = struct{}{}
+	} else {
+		delete(b.deleted, key)
+	}
+	b.kickAutoMerge()
+
+	if access := b.access.Load(); access != nil {
+		if deleted {
+			access.remove(key)
+		} else {
+			access.write(key, time.UnixMicro(tstamp))
+		}
+	}
+
+	if b.mirror != nil {
+		return b.mirror.write(key, value, meta, deleted)
+	}
+
+	return nil
+}
+
+// removeKeyDirFile removes the shared keydir file before the first change of the datastore,
+// so that no reader can build its keydir from the file once it is stale.
+// It is called with the access lock held.
+func (b *Bitcask) removeKeyDirFile() error {
+	if b.keyDirFileRemoved {
+		return nil
+	}
+
+	err := keydir.RemoveFile(b.dataStore.Path())
+	if err != nil {
+		return err
+	}
+	b.keyDirFileRemoved = true
 
 	return nil
 }
 
 // Delete removes a key from a bitcask datastore
-// by appending a special TompStone value that will be deleted in the next merge.
+// by appending a tombstone record, the key is dropped by the next merge.
 // Return an error if key does not exist in the bitcask datastore.
 func (b *Bitcask) Delete(key string) error {
 	if b.usrOpts.accessPermission == ReadOnly {
-		return fmt.Errorf("Delete: %s", errRequireWrite)
+		return fmt.Errorf("Delete: %w", ErrReadOnly)
 	}
 
 	_, err := b.Get(key)
@@ -165,48 +459,52 @@ func (b *Bitcask) Delete(key string) error {
 		return err
 	}
 
-	b.Put(key, datastore.TompStone)
+	b.accessMu.Lock()
+	defer b.accessMu.Unlock()
+	tstamp := b.usrOpts.clock.Now().UnixMicro()
+
+	if b.frozen {
+		return fmt.Errorf("Delete: %w", ErrFrozen)
+	}
 
-	return nil
+	return b.storeTombstone(key, tstamp)
 }
 
 // ListKeys list all keys in a bitcask datastore.
 func (b *Bitcask) ListKeys() []string {
 	res := make([]string, 0)
 
-	if b.readerCnt == 0 {
-		b.accessMu.Lock()
-	}
-	atomic.AddInt32(&b.readerCnt, 1)
+	b.startRead()
 
-	for key := range b.keyDir {
+	b.keyDir.Iterate(func(key string, _ recfmt.KeyDirRec) bool {
 		res = append(res, key)
-	}
+		return true
+	})
 
-	atomic.AddInt32(&b.readerCnt, -1)
-	if b.readerCnt == 0 {
-		b.accessMu.Unlock()
-	}
+	b.endRead()
 
 	return res
 }
 
 // Fold folds over all key/value pairs in a bitcask datastore.
 // fun is expected to be in the form: F(K, V, Acc) -> Acc
+// Fold sees the key/value pairs as they were when it was called: the records of the keydir
+// are copied at once, then the values are read without holding back the writes.
+// fn may thus call the methods of the bitcask but Merge, which waits for the fold to end,
+// the writes of fn are not seen by the fold.
 func (b *Bitcask) Fold(fn func(string, string, any) any, acc any) any {
-	if b.readerCnt == 0 {
-		b.accessMu.Lock()
-	}
-	atomic.AddInt32(&b.readerCnt, 1)
-
-	for key := range b.keyDir {
-		value, _ := b.Get(key)
-		acc = fn(key, value, acc)
-	}
+	snap, entries := b.copyKeyDir()
+	defer b.closeSnapshot(snap)
 
-	atomic.AddInt32(&b.readerCnt, -1)
-	if b.readerCnt == 0 {
-		b.accessMu.Unlock()
+	for _, entry := range entries {
+		value, err := b.readValue(entry.key, entry.rec, b.shouldVerify())
+		if err != nil {
+			if !errors.Is(err, datastore.ErrKeyNotExist) {
+				log.Printf("bitcask: fold skipped key %q: %v", entry.key, err)
+			}
+			continue
+		}
+		acc = fn(entry.key, value, acc)
 	}
 
 	return acc
@@ -216,50 +514,192 @@ func (b *Bitcask) Fold(fn func(string, string, any) any, acc any) any {
 // Delete values with older timestamps.
 // Reduces the disk usage after as it deletes unneeded values.
 // Produces hintfiles to provide a faster startup.
+// The bitcask is only locked to look the keys up and to swap in the new keydir,
+// reads and writes go on while the records are rewritten, unless WithDedup is set.
 // Return an error if ReadWrite permission is not set or on any system failures when writing data.
 func (b *Bitcask) Merge() error {
+	_, err := b.merge()
+	return err
+}
+
+// merge performs the merge, records it in the audit log and reports the work done.
+func (b *Bitcask) merge() (MergeResult, error) {
+	res, err := b.mergeFiles()
+	b.publish(Event{Kind: MergeEvent, Err: err})
+	b.audit("merge", err, fmt.Sprintf("files_removed=%d keys_written=%d bytes_written=%d",
+		res.FilesRemoved, res.KeysWritten, res.BytesWritten))
+
+	return res, err
+}
+
+// mergeFiles rewrites the live records of the old files into merge files
+// and removes the old files.
+func (b *Bitcask) mergeFiles() (MergeResult, error) {
+	var res MergeResult
+
 	if b.usrOpts.accessPermission == ReadOnly {
-		return fmt.Errorf("Merge: %s", errRequireWrite)
+		return res, fmt.Errorf("Merge: %w", ErrReadOnly)
 	}
 
+	b.mergeMu.Lock()
+	defer b.mergeMu.Unlock()
+
+	b.accessMu.Lock()
+	b.waitMergeResumed()
+	if b.frozen {
+		b.accessMu.Unlock()
+		return res, fmt.Errorf("Merge: %w", ErrFrozen)
+	}
+	// the files are listed once the previous merge is done with them
 	oldFiles, err := b.listOldFiles()
 	if err != nil {
-		return err
+		b.accessMu.Unlock()
+		return res, err
 	}
+	err = b.removeKeyDirFile()
+	if err != nil {
+		b.accessMu.Unlock()
+		return res, err
+	}
+	// the records of the files created while the merge runs are kept as is
+	isOld := make(map[string]bool, len(b.usage.files))
+	for file := range b.usage.files {
+		isOld[file] = file != b.activeFile.Name()
+	}
+	newKeyDir := keydir.Empty(keydir.Kind(b.usrOpts.keyDirKind))
+	mergeFile := datastore.NewAppendFile(b.dataStore.Path(), b.fileFlags, datastore.Merge, b.usrOpts.clock.Now, b.usrOpts.maxFileSize)
+	var shared map[[sha256.Size]byte]recfmt.ValueRef
+	if b.usrOpts.dedup {
+		shared = make(map[[sha256.Size]byte]recfmt.ValueRef)
+	}
+
+	// the keys are copied so that the keydir can change while the records are rewritten
+	keys := make([]string, 0, b.keyDir.Len())
+	b.keyDir.Iterate(func(key string, _ recfmt.KeyDirRec) bool {
+		keys = append(keys, key)
+		return true
+	})
+	for _, key := range keys {
+		if shared == nil {
+			b.waitMergeResumed()
+			if b.frozen {
+				err = fmt.Errorf("Merge: %w", ErrFrozen)
+				break
+			}
+		}
 
-	b.accessMu.Lock()
-	newKeyDir := keydir.KeyDir{}
-	mergeFile := datastore.NewAppendFile(b.dataStore.Path(), b.fileFlags, datastore.Merge)
-	defer mergeFile.Close()
-
-	for key, rec := range b.keyDir {
-		if rec.FileId != b.activeFile.Name() {
-			newRec, err := b.mergeWrite(mergeFile, key)
-			if err != nil {
-				if !strings.HasSuffix(err.Error(), datastore.ErrKeyNotExist.Error()) {
-					b.accessMu.Unlock()
-					return err
+		rec, isExist := b.keyDir.Get(key)
+		if !isExist {
+			// evicted while the bitcask was released
+			continue
+		}
+		if isOld[rec.FileId] && b.expired(rec) {
+			res.KeysExpired++
+			if access := b.access.Load(); access != nil {
+				access.remove(key)
+			}
+		} else if isOld[rec.FileId] || b.sharesOldValue(key, rec) {
+			// the keys of the active file sharing an old value are rewritten,
+			// their new record wins over the one of the active file
+			tstamp := rec.Tstamp
+			if !isOld[rec.FileId] {
+				// the record of the active file stays next to its copy, which must win over it
+				tstamp = b.nextTstamp(b.usrOpts.clock.Now().UnixMicro())
+			}
+			if shared == nil {
+				// the old files and the merge file only change by the merge,
+				// so the record is copied without holding back the writers
+				b.accessMu.Unlock()
+			}
+			newRec, isRef, writeErr := b.mergeWrite(mergeFile, shared, key, rec, tstamp)
+			if shared == nil {
+				b.accessMu.Lock()
+			}
+			if writeErr != nil {
+				if !errors.Is(writeErr, datastore.ErrKeyNotExist) {
+					err = writeErr
+					break
 				}
 			} else {
-				newKeyDir[key] = newRec
+				newKeyDir.Set(key, newRec)
+				res.KeysWritten++
+				res.BytesWritten += int64(recfmt.DataFileRecHdr + len(key) + int(newRec.ValueSize))
+				if isRef {
+					res.ValuesShared++
+				}
 			}
 		} else {
-			newKeyDir[key] = rec
+			newKeyDir.Set(key, rec)
 		}
 	}
+	if err != nil {
+		b.accessMu.Unlock()
+		mergeFile.Close()
+		return res, err
+	}
+	err = mergeFile.Close()
+	if err != nil {
+		b.accessMu.Unlock()
+		return res, err
+	}
 
+	oldKeyDir := b.keyDir
 	b.keyDir = newKeyDir
+	if shared == nil {
+		b.applyConcurrentWrites(oldKeyDir, isOld)
+	}
+	if shared != nil {
+		b.keepActiveShared(shared)
+		b.shared = shared
+	}
+	b.keyDirBytes = 0
+	newKeyDir.Iterate(func(key string, _ recfmt.KeyDirRec) bool {
+		b.keyDirBytes += keyDirEntrySize + int64(len(key))
+		return true
+	})
+	// the tombstones of the old files are dropped along with their keys
+	for key := range b.deleted {
+		if _, isExist := b.keyDir.Get(key); !isExist {
+			delete(b.deleted, key)
+		}
+	}
 	b.accessMu.Unlock()
-	b.deleteOldFiles(oldFiles)
 
-	return nil
+	// the reads started before the keydir was swapped may still use records
+	// of the old files, the files are deleted once these reads are done.
+	b.readMu.Lock()
+	b.readMu.Unlock()
+	b.waitIterators()
+
+	err = b.deleteOldFiles(oldFiles)
+	if err != nil {
+		return res, err
+	}
+	res.FilesRemoved = len(oldFiles)
+
+	b.accessMu.Lock()
+	b.lastMerge = b.usrOpts.clock.Now()
+	usage, err := loadDiskUsage(b.dataStore.Path(), b.keyDir)
+	if err == nil {
+		b.usage = usage
+	}
+	if b.prefixUsage != nil {
+		b.prefixUsage.count(b.keyDir)
+		b.prefixUsage.forget(oldFiles)
+	}
+	b.accessMu.Unlock()
+	if err != nil {
+		return res, err
+	}
+
+	return res, nil
 }
 
 // Sync flushes all data to the disk.
 // Return an error if ReadWrite permission is not set.
 func (b *Bitcask) Sync() error {
 	if b.usrOpts.accessPermission == ReadOnly {
-		return fmt.Errorf("Sync: %s", errRequireWrite)
+		return fmt.Errorf("Sync: %w", ErrReadOnly)
 	}
 
 	return b.activeFile.Sync()
@@ -267,34 +707,74 @@ func (b *Bitcask) Sync() error {
 
 // Close flushes all data to the disk and closes the bitcask datastore.
 // After close the bitcask object cannot be used anymore.
-func (b *Bitcask) Close() {
+// Return the first error encountered while flushing or releasing the datastore,
+// the datastore lock is released even if flushing fails.
+func (b *Bitcask) Close() error {
+	return b.close("close", false)
+}
+
+// close closes the bitcask and records it in the audit log as the given event.
+// The keydir is written to the keydir file before releasing the lock when share is true.
+func (b *Bitcask) close(event string, share bool) error {
+	b.clearFinalizer()
+	b.stopSweeper()
+	b.stopSyncer()
+	// a paused automatic merge must finish before the files are closed
+	b.stopMergeController()
+	b.ResumeMerge()
+	b.stopAutoMerge()
+	b.asyncWriter().close()
+
+	var err error
 	if b.usrOpts.accessPermission == ReadWrite {
-		b.Sync()
-		b.activeFile.Close()
+		if b.mirror != nil {
+			b.mirror.close()
+		}
+		err = b.Sync()
+		closeErr := b.activeFile.Close()
+		if err == nil {
+			err = closeErr
+		}
 	}
-	b.dataStore.Close()
-}
+	if share && err == nil {
+		err = keydir.Share(b.dataStore.Path(), b.keyDir)
+	}
+	b.audit(event, err, "")
 
-// parseUsrOpts fills an options struct with the passed user options.
-func parseUsrOpts(opts []ConfigOpt) options {
-	usrOpts := options{
-		syncOption:       SyncOnDemand,
-		accessPermission: ReadOnly,
+	unlockErr := b.dataStore.Close()
+	if err == nil {
+		err = unlockErr
 	}
 
-	for _, opt := range opts {
-		switch opt {
-		case SyncOnPut:
-			usrOpts.syncOption = SyncOnPut
-		case ReadWrite:
-			usrOpts.accessPermission = ReadWrite
-		}
+	return err
+}
+
+// permissionName returns the name of the given access permission.
+func permissionName(permission ConfigOpt) string {
+	if permission == ReadWrite {
+		return "read-write"
 	}
 
-	return usrOpts
+	return "read-only"
+}
+
+// startRead registers a reader of the keydir, holding the access lock for reading
+// so that the readers run in parallel while the writers wait for them.
+// It must not be called again before endRead by the same reader,
+// a recursive read lock deadlocks once a writer waits for it.
+func (b *Bitcask) startRead() {
+	b.readMu.RLock()
+	b.accessMu.RLock()
+}
+
+// endRead unregisters a reader of the keydir.
+func (b *Bitcask) endRead() {
+	b.accessMu.RUnlock()
+	b.readMu.RUnlock()
 }
 
 // listOldFiles prepares a list with all old files to be deleted after merge.
+// It is called with the access lock held.
 func (b *Bitcask) listOldFiles() ([]string, error) {
 	res := make([]string, 0)
 
@@ -304,9 +784,7 @@ func (b *Bitcask) listOldFiles() ([]string, error) {
 	}
 	defer dataStore.Close()
 
-	b.accessMu.Lock()
 	files, err := dataStore.Readdir(0)
-	b.accessMu.Unlock()
 	if err != nil {
 		return nil, err
 	}
@@ -321,42 +799,71 @@ func (b *Bitcask) listOldFiles() ([]string, error) {
 	return res, nil
 }
 
-// mergeWrite performs a writing to the created merge file.
-// returns the new record about the written data
-// returns error if the data is deleted and will not be written again or on any system failures.
-func (b *Bitcask) mergeWrite(mergeFile *datastore.AppendFile, key string) (recfmt.KeyDirRec, error) {
-	rec := b.keyDir[key]
+// applyConcurrentWrites applies the writes made to the previous keydir while the merge
+// released the bitcask to the keydir built by the merge: the records of the files kept by
+// the merge win, and the keys deleted or evicted meanwhile are deleted.
+// It is called with the access lock held.
+func (b *Bitcask) applyConcurrentWrites(prev keydir.KeyDir, isOld map[string]bool) {
+	prev.Iterate(func(key string, rec recfmt.KeyDirRec) bool {
+		if !isOld[rec.FileId] {
+			b.keyDir.Set(key, rec)
+		}
+		return true
+	})
 
-	value, err := b.dataStore.ReadValueFromFile(rec.FileId, key, rec.ValuePos, rec.ValueSize)
-	if err != nil {
-		return recfmt.KeyDirRec{}, err
+	evicted := make([]string, 0)
+	b.keyDir.Iterate(func(key string, _ recfmt.KeyDirRec) bool {
+		if _, isExist := prev.Get(key); !isExist {
+			evicted = append(evicted, key)
+		}
+		return true
+	})
+	for _, key := range evicted {
+		b.keyDir.Delete(key)
 	}
+}
 
-	tstamp := time.Now().UnixMicro()
+// mergeWrite performs a writing of the record rec of key to the created merge file with the given timestamp.
+// The values found in shared are written as references, shared is nil without WithDedup.
+// The records of the old files keep their timestamp, so a write of the key made while the merge
+// released the bitcask still wins over the copy when the keydir is rebuilt.
+// returns the new record about the written data and whether it references a shared value
+// returns error if the data is deleted and will not be written again or on any system failures.
+func (b *Bitcask) mergeWrite(mergeFile *datastore.AppendFile, shared map[[sha256.Size]byte]recfmt.ValueRef,
+	key string, rec recfmt.KeyDirRec, tstamp int64) (recfmt.KeyDirRec, bool, error) {
+	data, err := b.readRecord(key, rec, true)
+	if err != nil {
+		return recfmt.KeyDirRec{}, false, err
+	}
 
-	n, err := mergeFile.WriteData(key, value, tstamp)
+	kind := valueRecord
+	if data.Immutable {
+		kind = immutableRecord
+	}
+	n, size, isRef, err := b.writeValue(mergeFile, shared, key, data.Value, data.Meta, kind, tstamp)
 	if err != nil {
-		return recfmt.KeyDirRec{}, err
+		return recfmt.KeyDirRec{}, false, err
 	}
 
 	newRec := recfmt.KeyDirRec{
 		FileId:    mergeFile.Name(),
 		ValuePos:  uint32(n),
-		ValueSize: uint32(len(value)),
+		ValueSize: size,
 		Tstamp:    tstamp,
 	}
 
 	err = mergeFile.WriteHint(key, newRec)
 	if err != nil {
-		return recfmt.KeyDirRec{}, err
+		return recfmt.KeyDirRec{}, false, err
 	}
 
-	return newRec, nil
+	return newRec, isRef, nil
 }
 
 // deleteOldFiles deletes all files passed to it.
 func (b *Bitcask) deleteOldFiles(files []string) error {
 	for _, file := range files {
+		b.dataStore.Invalidate(file)
 		err := os.Remove(path.Join(b.dataStore.Path(), file))
 		if err != nil {
 			return err
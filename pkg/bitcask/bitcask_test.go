@@ -1,12 +1,33 @@
 package bitcask
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"hash/crc32"
+	"io/fs"
+	"math"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+	"github.com/zaher1307/bitcask/internal/keydir"
+	"github.com/zaher1307/bitcask/internal/recfmt"
 )
 
 var testBitcaskPath = path.Join("testing_dir")
@@ -100,13 +121,17 @@ func TestOpen(t *testing.T) {
 
 	t.Run("open bitcask failed", func(t *testing.T) {
 		// create a directory that cannot be openned since it has no execute permission
-		os.MkdirAll(path.Join("no open dir"), 000)
-
-		want := "open no open dir: permission denied"
-		_, err := Open("no open dir")
+		dir := path.Join(t.TempDir(), "no open dir")
+		os.MkdirAll(dir, 000)
+		defer os.Chmod(dir, 0700)
+
+		want := "open " + dir + ": permission denied"
+		b, err := Open(dir)
+		if err == nil {
+			b.Close()
+		}
 
 		assertError(t, err, want)
-		os.RemoveAll("no open dir")
 	})
 }
 
@@ -237,6 +262,154 @@ func TestFold(t *testing.T) {
 	os.RemoveAll(testBitcaskPath)
 }
 
+func TestFoldSnapshot(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	defer b.Close()
+
+	for i := 0; i < 10; i++ {
+		b.Put(fmt.Sprint(i), "old")
+	}
+
+	// the writes of the callback are not seen by the fold
+	got := b.Fold(func(key, value string, a any) any {
+		if value != "old" {
+			t.Errorf("key %s: got:%s, want:old", key, value)
+		}
+		b.Put("added"+key, "new")
+		b.Delete(fmt.Sprint((len(key) + 4) % 10))
+		return a.(int) + 1
+	}, 0)
+	if got != 10 {
+		t.Errorf("got:%d, want:10", got)
+	}
+
+	if _, err := b.Get("5"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected key 5 to be deleted, got:%v", err)
+	}
+	value, _ := b.Get("added3")
+	assertString(t, value, "new")
+}
+
+func TestHas(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	defer func() { b.Close() }()
+
+	b.Put("key1", "value")
+	b.Put("key2", strings.Repeat("v", len(recfmt.LegacyTombstone)))
+	b.Put("key3", "value")
+	b.Delete("key3")
+
+	for key, want := range map[string]bool{"key1": true, "key2": true, "key3": false, "key4": false} {
+		if got := b.Has(key); got != want {
+			t.Errorf("key %s: got:%v, want:%v", key, got, want)
+		}
+	}
+	// the deleted keys are not counted, before and after a merge
+	if got, stats := b.Len(), b.Stats(); got != 2 || stats.Keys != 2 {
+		t.Errorf("got:%d, %d keys, want:2", got, stats.Keys)
+	}
+	b.Put("key3", "value")
+	b.Delete("key1")
+	if err := b.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if got, stats := b.Len(), b.Stats(); got != 2 || stats.Keys != 2 {
+		t.Errorf("got:%d, %d keys, want:2", got, stats.Keys)
+	}
+	b.Delete("key2")
+	b.Close()
+
+	b, _ = Open(testBitcaskPath, ReadWrite)
+	if got := b.Len(); got != 1 {
+		t.Errorf("got:%d after reopening, want:1", got)
+	}
+}
+
+func TestTombstones(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	os.MkdirAll(testBitcaskPath, os.FileMode(0777))
+
+	// a legacy tombstone, written as a value before the tombstone flag
+	legacy := recfmt.CompressDataFileRec("legacy", strings.Repeat("v", len(recfmt.LegacyTombstone)), 2)
+	copy(legacy[recfmt.DataFileRecHdr+len("legacy"):], recfmt.LegacyTombstone)
+	binary.LittleEndian.PutUint32(legacy, crc32.ChecksumIEEE(legacy[4:]))
+	data := append(recfmt.CompressDataFileRec("legacy", "value", 1), legacy...)
+	os.WriteFile(path.Join(testBitcaskPath, "1.data"), data, os.FileMode(0666))
+
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	b.Put("magic", recfmt.LegacyTombstone)
+	b.Put("key", "value")
+	b.Delete("key")
+	if usage, _ := b.KeySize("key"); usage.Record != int64(recfmt.DataFileRecHdr+len("key")) {
+		t.Errorf("Expected the tombstone to hold no value, got:%+v", usage)
+	}
+	b.Close()
+
+	for _, merge := range []bool{false, true} {
+		b, _ = Open(testBitcaskPath, ReadWrite)
+		if merge {
+			b.Merge()
+		} else if _, isExist := b.keyDir.Get("legacy"); !isExist {
+			t.Fatal("Expected the legacy tombstone to be loaded")
+		}
+		value, err := b.Get("magic")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertString(t, value, recfmt.LegacyTombstone)
+		for _, key := range []string{"key", "legacy"} {
+			if _, err := b.Get(key); !errors.Is(err, ErrKeyNotFound) {
+				t.Errorf("key %s: got:%v, want:%v", key, err, ErrKeyNotFound)
+			}
+			if b.Has(key) {
+				t.Errorf("Expected key %s to be deleted", key)
+			}
+		}
+		b.Close()
+	}
+}
+
+func TestTornRecord(t *testing.T) {
+	valid := append(recfmt.CompressDataFileRec("key1", "value1", 1), recfmt.CompressDataFileRec("key2", "value2", 2)...)
+	last := recfmt.CompressDataFileRec("key3", "value3", 3)
+	corrupted := append([]byte{}, last...)
+	corrupted[len(corrupted)-1] ^= 0xff
+
+	for name, tail := range map[string][]byte{"cut": last[:len(last)-3], "corrupted": corrupted} {
+		t.Run(name, func(t *testing.T) {
+			defer os.RemoveAll(testBitcaskPath)
+			os.MkdirAll(testBitcaskPath, os.FileMode(0777))
+			dataFile := path.Join(testBitcaskPath, "1.data")
+			os.WriteFile(dataFile, append(append([]byte{}, valid...), tail...), os.FileMode(0666))
+
+			b, err := Open(testBitcaskPath, ReadWrite)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info := b.OpenInfo(); len(info.TornFiles) != 1 || info.TornFiles[0] != "1.data" {
+				t.Errorf("got:%+v, want 1.data torn", info.TornFiles)
+			}
+			for _, key := range []string{"key1", "key2"} {
+				value, err := b.Get(key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertString(t, value, "value"+key[3:])
+			}
+			if b.Has("key3") {
+				t.Error("Expected the torn record to be left out")
+			}
+			b.Close()
+
+			if stat, _ := os.Stat(dataFile); stat.Size() != int64(len(valid)) {
+				t.Errorf("got:%d bytes, want:%d", stat.Size(), len(valid))
+			}
+		})
+	}
+}
+
 func TestMerge(t *testing.T) {
 	t.Run("merge with write permission", func(t *testing.T) {
 		b, _ := Open(testBitcaskPath, ReadWrite)
@@ -294,18 +467,3188 @@ func TestSync(t *testing.T) {
 	})
 }
 
-func assertError(t testing.TB, err error, want string) {
-	t.Helper()
-	if err == nil {
-		t.Fatalf("Expected Error %q", want)
+func TestMemoryUsage(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	b.Put("key1", "value1")
+	b.Put("key12", "value12")
+	b.Put("key12", "value12345")
+
+	got := b.MemoryUsage()
+	want := MemoryStats{
+		KeyDir: 2*keyDirEntrySize + 9,
+		Total:  2*keyDirEntrySize + 9,
 	}
-	assertString(t, err.Error(), want)
+
+	if got != want {
+		t.Errorf("got:%+v, want:%+v", got, want)
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
 }
 
-func assertString(t testing.TB, got, want string) {
-	t.Helper()
+func TestStats(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	clock := &testClock{now: time.UnixMicro(1000)}
+	b, _ := Open(testBitcaskPath, ReadWrite, WithClock(clock))
+	defer b.Close()
+	b.Put("key1", "value1")
+	b.Put("key12", "value12")
+	b.Put("key12", "value12345")
+
+	got := b.Stats()
+	want := Stats{
+		Keys:        2,
+		LiveBytes:   (18 + 4 + 6) + (18 + 5 + 10),
+		DeadBytes:   18 + 5 + 7,
+		DataFiles:   1,
+		KeyDirBytes: 2*keyDirEntrySize + 9,
+	}
 	if got != want {
-		t.Errorf("got:\n%q\nwant:\n%q", got, want)
+		t.Errorf("got:%+v, want:%+v", got, want)
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	b.Merge()
+	if got := b.Stats().LastMerge; !got.Equal(clock.now) {
+		t.Errorf("got:%v, want:%v", got, clock.now)
+	}
+}
+
+func TestKeySize(t *testing.T) {
+	t.Run("size of existing key", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite)
+		b.Put("key12", "value12345")
+
+		got, _ := b.KeySize("key12")
+		want := KeyUsage{Record: 18 + 5 + 10, KeyDir: keyDirEntrySize + 5}
+
+		if got != want {
+			t.Errorf("got:%+v, want:%+v", got, want)
+		}
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("size of not existing key", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite)
+
+		_, err := b.KeySize("key12")
+		assertError(t, err, "key12: key does not exist")
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+}
+
+func TestLargestKeys(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	b.Put("small", "v")
+	b.Put("large", "value12345")
+	b.Put("medium", "value")
+	b.Put("medium2", "value")
+
+	got := b.LargestKeys(3)
+	want := []KeyStat{{"large", 10}, {"medium", 5}, {"medium2", 5}}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%v\nwant:\n%v", got, want)
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestMostWrittenKeys(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	b, _ := Open(testBitcaskPath, ReadWrite, WithMaxFileSize(64))
+	defer b.Close()
+
+	for i := 0; i < 3; i++ {
+		b.Put("hot", fmt.Sprintf("value%d", i))
+		b.Put("warm", "value")
+	}
+	b.Put("hot", "value")
+	b.Put("once", "value")
+	b.Delete("warm")
+	// the batch headers are not counted as writes
+	for i := 0; i < 2; i++ {
+		bt := b.WriteBatch()
+		bt.Put(fmt.Sprintf("batched%d", i), "value")
+		if err := bt.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := b.MostWrittenKeys(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HotKey{{"hot", 4}, {"warm", 4}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:%v, want:%v", got, want)
+	}
+
+	if err := b.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := b.MostWrittenKeys(2); len(got) != 0 {
+		t.Errorf("got:%v, want no key written twice after a merge", got)
+	}
+}
+
+func TestKeyspaceStats(t *testing.T) {
+	clock := &testClock{now: time.UnixMicro(1000)}
+	b, _ := Open(testBitcaskPath, ReadWrite, WithClock(clock))
+	b.Put("k", "v")
+	b.Put("key2", "value")
+	clock.now = clock.now.Add(3 * time.Second)
+
+	got := b.KeyspaceStats()
+	want := KeyspaceStats{
+		Keys:       2,
+		KeyBytes:   5,
+		ValueBytes: 6,
+		KeyLengths: Histogram{{0, 0}, {1, 1}, {3, 0}, {7, 1}},
+		ValueSizes: Histogram{{0, 0}, {1, 1}, {3, 0}, {7, 1}},
+		Ages:       Histogram{{0, 0}, {1, 0}, {3, 2}},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:\n%+v\nwant:\n%+v", got, want)
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestEvents(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	all, cancelAll := b.Subscribe(100)
+	merges, cancelMerges := b.Subscribe(100, MergeEvent)
+
+	value := strings.Repeat("v", 1024)
+	for i := 0; i < 20; i++ {
+		b.Put(fmt.Sprintf("key%d", i), value)
+	}
+	b.Merge()
+	cancelAll()
+	cancelMerges()
+
+	kinds := make(map[EventKind]int)
+	for e := range all {
+		kinds[e.Kind]++
+	}
+	if kinds[RotationEvent] < 2 || kinds[MergeEvent] != 1 {
+		t.Errorf("got:%v, want several rotations and one merge", kinds)
+	}
+
+	e, ok := <-merges
+	if !ok || e.Kind != MergeEvent || e.Err != nil {
+		t.Errorf("got:%+v, want a successful merge", e)
+	}
+	if _, ok := <-merges; ok {
+		t.Errorf("got events of other kinds than merge")
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestHandoff(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	b.Put("key12", "value12345")
+	err := b.Handoff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(testBitcaskPath, "keydir")); err != nil {
+		t.Errorf("the keydir file was not written: %v", err)
+	}
+
+	b, err = Open(testBitcaskPath, ReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, _ := b.Get("key12")
+	assertString(t, value, "value12345")
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestOpenInfo(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	b.Put("key12", "value12345")
+	b.Put("key13", "value13")
+	b.Close()
+
+	b, _ = Open(testBitcaskPath, ReadWrite)
+	info := b.OpenInfo()
+	if info.Keys != 2 || info.KeyDirFile || len(info.DataFilesParsed) != 1 || len(info.HintFilesUsed) != 0 {
+		t.Errorf("got:%+v, want 2 keys parsed from 1 data file", info)
+	}
+	b.Merge()
+	b.Close()
+
+	b, _ = Open(testBitcaskPath)
+	info = b.OpenInfo()
+	if info.KeyDirFile || len(info.DataFilesParsed) != 0 || len(info.HintFilesUsed) != 1 {
+		t.Errorf("got:%+v, want the keys read from 1 hint file", info)
+	}
+	b.Close()
+
+	b, _ = Open(testBitcaskPath)
+	info = b.OpenInfo()
+	if !info.KeyDirFile || info.Keys != 2 {
+		t.Errorf("got:%+v, want the keys read from the keydir file", info)
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestWriteBatch(t *testing.T) {
+	t.Run("commit", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite)
+		b.Put("key12", "value12345")
+		batch := b.WriteBatch()
+		batch.Put("key13", "value13")
+		batch.Put("key14", "value14")
+		batch.Put("key13", "value13-2")
+		batch.Delete("key12")
+		if err := batch.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		b.Close()
+
+		b, _ = Open(testBitcaskPath)
+		value, _ := b.Get("key13")
+		assertString(t, value, "value13-2")
+		value, _ = b.Get("key14")
+		assertString(t, value, "value14")
+		if _, err := b.Get("key12"); err == nil {
+			t.Errorf("Expected key12 to be deleted by the batch")
+		}
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("batch cut by a crash is skipped", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite)
+		b.Put("key12", "value12345")
+		batch := b.WriteBatch()
+		batch.Put("key13", "value13")
+		batch.Put("key14", "value14")
+		batch.Commit()
+		name := keyDirRec(b, "key12").FileId
+		b.Close()
+
+		dataPath := path.Join(testBitcaskPath, name)
+		stat, _ := os.Stat(dataPath)
+		os.Truncate(dataPath, stat.Size()-3)
+
+		b, err := Open(testBitcaskPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, _ := b.Get("key12")
+		assertString(t, value, "value12345")
+		if _, err := b.Get("key13"); err == nil {
+			t.Errorf("Expected the records of the cut batch to be skipped")
+		}
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite)
+		batch := b.WriteBatch()
+		batch.Put("key13", "value13")
+		batch.Put("", "value")
+		if err := batch.Commit(); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("got:%v, want:%v", err, ErrInvalidKey)
+		}
+		if _, err := b.Get("key13"); err == nil {
+			t.Errorf("Expected the batch to be rejected entirely")
+		}
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+}
+
+func TestMaxRecordAge(t *testing.T) {
+	clock := &testClock{now: time.UnixMicro(1000)}
+	b, _ := Open(testBitcaskPath, ReadWrite, WithClock(clock), WithMaxRecordAge(time.Hour))
+	b.Put("key12", "value12345")
+	b.Put("key13", "value13")
+	b.Close()
+
+	clock.now = clock.now.Add(2 * time.Hour)
+	b, _ = Open(testBitcaskPath, ReadWrite, WithClock(clock), WithMaxRecordAge(time.Hour))
+	b.Put("key14", "value14")
+	if _, err := b.Get("key12"); !errors.Is(err, datastore.ErrKeyNotExist) {
+		t.Errorf("got:%v, want:%v", err, datastore.ErrKeyNotExist)
+	}
+
+	res, err := b.merge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.KeysExpired != 2 || res.KeysWritten != 0 {
+		t.Errorf("got:%+v, want 2 expired keys", res)
+	}
+	value, _ := b.Get("key14")
+	assertString(t, value, "value14")
+	if got := len(b.ListKeys()); got != 1 {
+		t.Errorf("got:%d keys, want:%d", got, 1)
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestPutWithMeta(t *testing.T) {
+	meta := map[string]string{"content-type": "text/plain", "origin": "import"}
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	b.PutWithMeta("key12", "value12345", meta)
+	b.Put("key13", "value13")
+	b.AppendValue("key12", "678")
+
+	value, got, err := b.GetWithMeta("key12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, value, "value12345678")
+	if !reflect.DeepEqual(got, meta) {
+		t.Errorf("got:%v, want:%v", got, meta)
+	}
+	if _, got, _ := b.GetWithMeta("key13"); got != nil {
+		t.Errorf("got:%v, want no metadata", got)
+	}
+
+	err = b.PutWithMeta("key14", "value14", map[string]string{"big": strings.Repeat("x", 1<<16)})
+	if !errors.Is(err, ErrMetaTooLarge) {
+		t.Errorf("got:%v, want:%v", err, ErrMetaTooLarge)
+	}
+
+	b.Merge()
+	b.Close()
+
+	b, _ = Open(testBitcaskPath, ReadWrite)
+	value, got, _ = b.GetWithMeta("key12")
+	assertString(t, value, "value12345678")
+	if !reflect.DeepEqual(got, meta) {
+		t.Errorf("got:%v, want:%v", got, meta)
+	}
+	value, _ = b.Get("key12")
+	assertString(t, value, "value12345678")
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestBytes(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	key := []byte{0x00, 0xff, 'k'}
+	value := []byte{0xc3, 0x28, 0x00, 0xfe, 0xff}
+
+	err := b.PutBytes(key, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key[2], value[0] = 'x', 0
+
+	got, err := b.GetBytes([]byte{0x00, 0xff, 'k'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0xc3, 0x28, 0x00, 0xfe, 0xff}; !bytes.Equal(got, want) {
+		t.Errorf("got:%v, want:%v", got, want)
+	}
+
+	err = b.DeleteBytes([]byte{0x00, 0xff, 'k'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GetBytes([]byte{0x00, 0xff, 'k'}); !errors.Is(err, datastore.ErrKeyNotExist) {
+		t.Errorf("got:%v, want:%v", err, datastore.ErrKeyNotExist)
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestDeleteIf(t *testing.T) {
+	clock := &testClock{now: time.UnixMicro(1000)}
+	b, _ := Open(testBitcaskPath, ReadWrite, WithClock(clock))
+	b.Put("key12", "value12")
+	b.Put("key13", "value13")
+	cutoff := clock.Now()
+	b.Put("key14", "value14")
+
+	t.Run("value mismatch keeps the key", func(t *testing.T) {
+		deleted, err := b.DeleteIfValue("key12", "other")
+		if err != nil || deleted {
+			t.Errorf("got:%v %v, want:false <nil>", deleted, err)
+		}
+		value, _ := b.Get("key12")
+		assertString(t, value, "value12")
+	})
+
+	t.Run("value match deletes the key", func(t *testing.T) {
+		deleted, err := b.DeleteIfValue("key12", "value12")
+		if err != nil || !deleted {
+			t.Errorf("got:%v %v, want:true <nil>", deleted, err)
+		}
+		if _, err := b.Get("key12"); !errors.Is(err, datastore.ErrKeyNotExist) {
+			t.Errorf("got:%v, want:%v", err, datastore.ErrKeyNotExist)
+		}
+	})
+
+	t.Run("older than deletes only the old keys", func(t *testing.T) {
+		deleted, _ := b.DeleteIfOlderThan("key13", cutoff)
+		if !deleted {
+			t.Error("key13 is older than the cutoff, want it deleted")
+		}
+		deleted, _ = b.DeleteIfOlderThan("key14", cutoff)
+		if deleted {
+			t.Error("key14 is newer than the cutoff, want it kept")
+		}
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		_, err := b.DeleteIfValue("key12", "value12")
+		if !errors.Is(err, datastore.ErrKeyNotExist) {
+			t.Errorf("got:%v, want:%v", err, datastore.ErrKeyNotExist)
+		}
+	})
+
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	defer b.Close()
+
+	if swapped, err := b.CompareAndSwap("key", "v1", 0); !swapped || err != nil {
+		t.Fatalf("got:%v, %v, want the missing key created", swapped, err)
+	}
+	value, version, err := b.GetVersion("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, value, "v1")
+	if swapped, _ := b.CompareAndSwap("key", "v2", 0); swapped {
+		t.Error("Expected the existing key not to be swapped at version 0")
+	}
+
+	b.Put("key", "other")
+	if swapped, _ := b.CompareAndSwap("key", "v2", version); swapped {
+		t.Error("Expected the changed key not to be swapped")
+	}
+	_, version, _ = b.GetVersion("key")
+	if swapped, err := b.CompareAndSwap("key", "v2", version); !swapped || err != nil {
+		t.Errorf("got:%v, %v, want the key swapped", swapped, err)
+	}
+	value, _ = b.Get("key")
+	assertString(t, value, "v2")
+
+	b.Delete("key")
+	if _, _, err := b.GetVersion("key"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("got:%v, want:%v", err, ErrKeyNotFound)
+	}
+	if swapped, _ := b.CompareAndSwap("key", "v3", 0); !swapped {
+		t.Error("Expected the deleted key to be swapped at version 0")
+	}
+}
+
+func TestLock(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	clock := &testClock{now: time.UnixMicro(1000)}
+	b, _ := Open(testBitcaskPath, ReadWrite, WithClock(clock))
+	defer b.Close()
+
+	first, err := b.AcquireLock("lock", "owner1", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.AcquireLock("lock", "owner2", time.Second); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("got:%v, want:%v", err, ErrLockHeld)
+	}
+	if released, _ := b.ReleaseLock("lock", "owner2"); released {
+		t.Error("Expected the lock not to be released by another owner")
+	}
+	if held, _ := b.LockHeld(first); !held {
+		t.Error("Expected the lock to be held")
+	}
+
+	// the expired lock is taken over with a greater fence
+	clock.now = clock.now.Add(time.Second)
+	if held, _ := b.LockHeld(first); held {
+		t.Error("Expected the expired lock not to be held")
+	}
+	second, err := b.AcquireLock("lock", "owner2", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Fence <= first.Fence || !second.Expires.IsZero() {
+		t.Errorf("got:%+v after %+v, want a greater fence without expiry", second, first)
 	}
+	if released, _ := b.ReleaseLock("lock", "owner1"); released {
+		t.Error("Expected the lock not to be released by its previous owner")
+	}
+	if released, err := b.ReleaseLock("lock", "owner2"); !released || err != nil {
+		t.Errorf("got:%v, %v, want the lock released", released, err)
+	}
+	if released, err := b.ReleaseLock("lock", "owner2"); released || err != nil {
+		t.Errorf("got:%v, %v, want nothing to release", released, err)
+	}
+
+	// a plain key holds the lock of its name
+	b.Put("key", "value")
+	if _, err := b.AcquireLock("key", "owner1", time.Second); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("got:%v, want:%v", err, ErrLockHeld)
+	}
+}
+
+func TestMaxOpenFiles(t *testing.T) {
+	clock := &testClock{now: time.UnixMicro(1000)}
+	for i := 0; i < 3; i++ {
+		b, _ := Open(testBitcaskPath, ReadWrite, WithClock(clock))
+		b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+		b.Close()
+	}
+
+	b, _ := Open(testBitcaskPath, ReadWrite, WithClock(clock), WithMaxOpenFiles(1))
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 3; i++ {
+			value, err := b.Get(fmt.Sprintf("key%d", i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertString(t, value, fmt.Sprintf("value%d", i))
+		}
+
+		// the merge deletes the cached files, the reads must use the merged ones
+		err := b.Merge()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestGetManyConsistent(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	b.Put("object", "v0")
+	b.Put("index", "v0")
+	b.Put("deleted", "value")
+	b.Delete("deleted")
+
+	got, err := b.GetManyConsistent([]string{"object", "index", "deleted", "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"object": "v0", "index": "v0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got:%v, want:%v", got, want)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= 200; i++ {
+			batch := b.WriteBatch()
+			batch.Put("object", fmt.Sprintf("v%d", i))
+			batch.Put("index", fmt.Sprintf("v%d", i))
+			if err := batch.Commit(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		got, err := b.GetManyConsistent([]string{"object", "index"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got["object"] != got["index"] {
+			t.Fatalf("torn read: object=%s index=%s", got["object"], got["index"])
+		}
+	}
+	<-done
+
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
 }
 
+func TestValueTooLarge(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	b.Put("key", "value")
+
+	// the size of a larger value would spill into the flags of the record
+	large := strings.Repeat("a", MaxValueSize+1)
+	if err := b.Put("large", large); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("put: got:%v, want:%v", err, ErrValueTooLarge)
+	}
+	if err := b.PutWithMeta("large", large[:MaxValueSize], map[string]string{"k": "v"}); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("put with meta: got:%v, want:%v", err, ErrValueTooLarge)
+	}
+	if _, err := b.AppendValue("key", large[:MaxValueSize]); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("append: got:%v, want:%v", err, ErrValueTooLarge)
+	}
+	batch := b.WriteBatch()
+	batch.Put("large", large)
+	if err := batch.Commit(); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("batch: got:%v, want:%v", err, ErrValueTooLarge)
+	}
+	large = ""
+	b.Close()
+
+	b, err := Open(testBitcaskPath, ReadOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	value, _ := b.Get("key")
+	assertString(t, value, "value")
+	if b.Has("large") {
+		t.Error("Expected the large value not to be stored")
+	}
+}
+
+func TestSyncInterval(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	b, err := Open(testBitcaskPath, ReadWrite, WithSyncInterval(time.Millisecond), WithMaxFileSize(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the active file rotates while the syncer flushes it
+	for i := 0; i < 200; i++ {
+		err := b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i%50 == 0 {
+			time.Sleep(2 * time.Millisecond)
+		}
+	}
+
+	syncDone := b.syncDone
+	b.Close()
+	select {
+	case <-syncDone:
+	default:
+		t.Fatal("Expected Close to stop the syncer")
+	}
+
+	b, _ = Open(testBitcaskPath, ReadOnly)
+	defer b.Close()
+	for i := 0; i < 200; i++ {
+		value, _ := b.Get(fmt.Sprintf("key%d", i))
+		assertString(t, value, fmt.Sprintf("value%d", i))
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	m, err := Open(t.TempDir(), ReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	b, err := Open(testBitcaskPath, ReadWrite,
+		WithSyncInterval(time.Millisecond),
+		WithMaxRecordAge(time.Hour), WithRetentionSweep(time.Millisecond),
+		WithAutoMerge(0.5, 0),
+		WithMergeLatencyTarget(time.Millisecond),
+		WithWriteMirror(m, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.PutAsync("key", "value", nil)
+
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the background goroutines are stopped by the first Close,
+	// the second one only fails on the closed files
+	if err := b.Close(); err == nil {
+		t.Error("Expected the second Close to fail on the closed files")
+	}
+}
+
+func TestAutoMerge(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite, WithAutoMerge(0.5, 0))
+	merges, cancel := b.Subscribe(1, MergeEvent)
+	defer cancel()
+
+	// overwriting the same keys fills the old files with dead records
+	for i := 0; i < 400; i++ {
+		err := b.Put(fmt.Sprintf("key%d", i%10), fmt.Sprintf("value%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case e := <-merges:
+		if e.Err != nil {
+			t.Fatal(e.Err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no automatic merge")
+	}
+
+	for i := 390; i < 400; i++ {
+		value, err := b.Get(fmt.Sprintf("key%d", i%10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertString(t, value, fmt.Sprintf("value%d", i))
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestPlanMerge(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	for i := 0; i < 1000; i++ {
+		b.Put(fmt.Sprintf("key%d", i%10), fmt.Sprintf("value%d", i))
+	}
+	// a key left in an old file must be rewritten
+	b.Put("cold", "value")
+	for i := 0; i < 500; i++ {
+		b.Put(fmt.Sprintf("key%d", i%10), fmt.Sprintf("value%d", i))
+	}
+
+	plan := b.PlanMerge()
+	if len(plan.Files) == 0 || plan.KeysWritten == 0 {
+		t.Fatalf("got:%+v, want files to compact", plan)
+	}
+	if plan.ReclaimedBytes != plan.ReadBytes-plan.WriteBytes || plan.ReclaimedBytes <= 0 {
+		t.Errorf("got:%+v, want reclaimed bytes", plan)
+	}
+	if again := b.PlanMerge(); !reflect.DeepEqual(again, plan) {
+		t.Errorf("got:%+v, want the dry run to change nothing:%+v", again, plan)
+	}
+
+	res, err := b.merge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.KeysWritten != plan.KeysWritten || res.BytesWritten != plan.WriteBytes {
+		t.Errorf("got:%+v, want the planned work:%+v", res, plan)
+	}
+	if res.FilesRemoved < len(plan.Files) {
+		t.Errorf("got:%d files removed, want at least:%d", res.FilesRemoved, len(plan.Files))
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestMaxFileSize(t *testing.T) {
+	dataFiles := func() int {
+		matches, _ := filepath.Glob(path.Join(testBitcaskPath, "*.data"))
+		return len(matches)
+	}
+
+	b, _ := Open(testBitcaskPath, ReadWrite, WithMaxFileSize(1<<20))
+	for i := 0; i < 1000; i++ {
+		b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	if got := dataFiles(); got != 1 {
+		t.Errorf("got:%d data files, want:%d", got, 1)
+	}
+	b.Close()
+
+	b, _ = Open(testBitcaskPath, ReadWrite, WithMaxFileSize(1024))
+	for i := 0; i < 100; i++ {
+		b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	if got := dataFiles(); got < 3 {
+		t.Errorf("got:%d data files, want the 1KB files to rotate", got)
+	}
+	b.Merge()
+	for i := 0; i < 1000; i++ {
+		value, _ := b.Get(fmt.Sprintf("key%d", i))
+		assertString(t, value, fmt.Sprintf("value%d", i))
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestForceUnlock(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+
+	t.Run("reopen a bitcask left open", func(t *testing.T) {
+		leaked, _ := Open(testBitcaskPath, ReadWrite)
+		leaked.Put("key12", "value12")
+		leaked.Sync()
+
+		_, err := Open(testBitcaskPath, ReadWrite)
+		if err == nil {
+			t.Fatal("got no error, want the datastore to be locked")
+		}
+
+		b, err := Reopen(testBitcaskPath, ReadWrite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, _ := b.Get("key12")
+		assertString(t, value, "value12")
+		b.Close()
+	})
+
+	t.Run("garbage collected bitcask releases the lock", func(t *testing.T) {
+		func() {
+			leaked, _ := Open(testBitcaskPath, ReadWrite)
+			leaked.Put("key13", "value13")
+			leaked.Sync()
+		}()
+
+		var b *Bitcask
+		var err error
+		for i := 0; i < 50; i++ {
+			runtime.GC()
+			b, err = Open(testBitcaskPath, ReadWrite)
+			if err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("the lock was not released: %v", err)
+		}
+		value, _ := b.Get("key13")
+		assertString(t, value, "value13")
+		b.Close()
+	})
+}
+
+func TestFunctionalOptions(t *testing.T) {
+	b, err := Open(testBitcaskPath, WithReadWrite(), WithSyncOnPut(), WithMaxFileSize(1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = b.Put("key12", "value12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+
+	b, _ = Open(testBitcaskPath, WithReadOnly())
+	value, _ := b.Get("key12")
+	assertString(t, value, "value12")
+	assertError(t, b.Put("key13", "value13"), "Put: "+ErrReadOnly.Error())
+	b.Close()
+
+	// the constants keep their meaning, ReadOnly never overrides ReadWrite
+	b, _ = Open(testBitcaskPath, ReadWrite, ReadOnly)
+	err = b.Put("key13", "value13")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestSentinelErrors(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	if _, err := b.Get("missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("got:%v, want:%v", err, ErrKeyNotFound)
+	}
+	if err := b.Delete("missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("got:%v, want:%v", err, ErrKeyNotFound)
+	}
+	if _, err := Open(testBitcaskPath, ReadWrite); !errors.Is(err, ErrLocked) {
+		t.Errorf("got:%v, want:%v", err, ErrLocked)
+	}
+	b.Close()
+
+	b, _ = Open(testBitcaskPath)
+	for name, err := range map[string]error{
+		"put":    b.Put("key12", "value12"),
+		"delete": b.Delete("key12"),
+		"merge":  b.Merge(),
+		"sync":   b.Sync(),
+		"commit": b.WriteBatch().Commit(),
+	} {
+		if !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s: got:%v, want:%v", name, err, ErrReadOnly)
+		}
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestOpenSnapshot(t *testing.T) {
+	backupPath := testBitcaskPath + "_backup"
+	defer os.RemoveAll(testBitcaskPath)
+	defer os.RemoveAll(backupPath)
+
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	b.Put("key12", "value12")
+	b.Put("key13", "value13")
+	_, err := b.Backup(backupPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Sync()
+
+	// the writer still holds the lock of the datastore
+	if _, err := Open(testBitcaskPath); !errors.Is(err, ErrLocked) {
+		t.Fatalf("got:%v, want:%v", err, ErrLocked)
+	}
+
+	for _, dir := range []string{testBitcaskPath, backupPath} {
+		before, _ := os.ReadDir(dir)
+		snap, err := OpenSnapshot(dir, ReadWrite)
+		if err != nil {
+			t.Fatalf("%s: %v", dir, err)
+		}
+		value, _ := snap.Get("key12")
+		assertString(t, value, "value12")
+		if err := snap.Put("key14", "value14"); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("%s: got:%v, want:%v", dir, err, ErrReadOnly)
+		}
+		err = snap.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		after, _ := os.ReadDir(dir)
+		if len(after) != len(before) {
+			t.Errorf("%s: got %d entries, want the snapshot left unchanged with %d", dir, len(after), len(before))
+		}
+	}
+	b.Close()
+
+	if _, err := OpenSnapshot(path.Join(testBitcaskPath, "missing")); err == nil {
+		t.Error("got no error for a missing directory")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	backupPath := testBitcaskPath + "_backup"
+	defer os.RemoveAll(testBitcaskPath)
+	defer os.RemoveAll(backupPath)
+
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	defer b.Close()
+	for _, key := range []string{"same", "rewritten", "updated", "deleted", "readded"} {
+		b.Put(key, "value")
+	}
+	b.Delete("readded")
+	_, err := b.Backup(backupPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.Put("rewritten", "value")
+	b.Put("updated", "new value")
+	b.Delete("deleted")
+	b.Put("readded", "value")
+	b.Put("added", "value")
+	b.Put("gone", "value")
+	b.Delete("gone")
+
+	snap, err := OpenSnapshot(backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	got, err := Diff(snap, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := KeyDiff{Added: []string{"added", "readded"}, Updated: []string{"updated"}, Deleted: []string{"deleted"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:%+v, want:%+v", got, want)
+	}
+
+	got, _ = Diff(b, snap)
+	want = KeyDiff{Added: []string{"deleted"}, Updated: []string{"updated"}, Deleted: []string{"added", "readded"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:%+v, want:%+v", got, want)
+	}
+
+	if got, _ := Diff(b, b); !reflect.DeepEqual(got, KeyDiff{}) {
+		t.Errorf("got:%+v, want no change", got)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite, WithMaxFileSize(1024))
+	for i := 0; i < 200; i++ {
+		b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	b.Sync()
+
+	res, err := b.Check(CheckOptions{Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Files < 2 || res.Records != 200 || len(res.Corruptions) != 0 {
+		t.Fatalf("got:%+v, want 200 valid records over several files", res)
+	}
+
+	rec := keyDirRec(b, "key7")
+	f, _ := os.OpenFile(path.Join(testBitcaskPath, rec.FileId), os.O_RDWR, 0666)
+	f.WriteAt([]byte{'X'}, int64(rec.ValuePos)+int64(recfmt.DataFileRecHdr)+int64(len("key7")))
+	f.Close()
+
+	start := time.Now()
+	res, err = b.Check(CheckOptions{Workers: 2, BytesPerSecond: 40 << 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Corruptions) != 1 || res.Corruptions[0].File != rec.FileId || res.Corruptions[0].Offset != int64(rec.ValuePos) {
+		t.Errorf("got:%+v, want the corruption of key7 at %s:%d", res.Corruptions, rec.FileId, rec.ValuePos)
+	}
+	if took, want := time.Since(start), time.Duration(float64(res.Bytes)/(40<<10)*float64(time.Second))*9/10; took < want {
+		t.Errorf("got:%v for %d bytes, want the throttle to take at least %v", took, res.Bytes, want)
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestDedup(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	blob := strings.Repeat("blob", 250)
+
+	b, _ := Open(testBitcaskPath, ReadWrite, WithDedup(64), WithMaxFileSize(4096))
+	b.Put("orig", blob)
+	for i := 0; i < 5; i++ {
+		b.Put(fmt.Sprintf("filler%d", i), strings.Repeat(fmt.Sprint(i), 1000))
+	}
+	for i := 0; i < 5; i++ {
+		b.Put(fmt.Sprintf("dup%d", i), blob)
+	}
+	b.Put("small", "value12")
+	b.Put("small2", "value12")
+
+	if size := keyDirRec(b, "dup0").ValueSize; size >= 100 {
+		t.Errorf("Expected the duplicate to be stored as a reference, got a value of %d bytes", size)
+	}
+	if size := keyDirRec(b, "small2").ValueSize; size != 7 {
+		t.Errorf("Expected the small value to be stored whole, got a value of %d bytes", size)
+	}
+
+	// the value stays readable once the key storing it is overwritten
+	b.Put("orig", "other")
+	for i := 0; i < 5; i++ {
+		value, err := b.Get(fmt.Sprintf("dup%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertString(t, value, blob)
+	}
+
+	res, err := b.merge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ValuesShared != 4 {
+		t.Errorf("got:%d shared values, want:%d", res.ValuesShared, 4)
+	}
+	b.Put("dup5", blob)
+	if size := keyDirRec(b, "dup5").ValueSize; size >= 100 {
+		t.Errorf("Expected the merged value to be shared, got a value of %d bytes", size)
+	}
+	b.Close()
+
+	// the references are read without the option
+	b, _ = Open(testBitcaskPath, ReadWrite)
+	for i := 0; i < 6; i++ {
+		value, err := b.Get(fmt.Sprintf("dup%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertString(t, value, blob)
+	}
+	value, _ := b.Get("orig")
+	assertString(t, value, "other")
+
+	if err := b.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		value, _ := b.Get(fmt.Sprintf("dup%d", i))
+		assertString(t, value, blob)
+	}
+	if size := keyDirRec(b, "dup5").ValueSize; size != uint32(len(blob)) {
+		t.Errorf("Expected the merge without the option to store the value whole, got a value of %d bytes", size)
+	}
+	b.Close()
+}
+
+func TestImmutable(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	b, _ := Open(testBitcaskPath, ReadWrite)
+
+	if err := b.PutImmutable("config", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if immutable, _ := b.IsImmutable("config"); !immutable {
+		t.Errorf("Expected the key to be immutable")
+	}
+
+	writes := map[string]func() error{
+		"put":           func() error { return b.Put("config", "v2") },
+		"delete":        func() error { return b.Delete("config") },
+		"put immutable": func() error { return b.PutImmutable("config", "v2") },
+		"append": func() error {
+			_, err := b.AppendValue("config", "2")
+			return err
+		},
+		"delete if": func() error {
+			_, err := b.DeleteIfValue("config", "v1")
+			return err
+		},
+		"batch": func() error {
+			bt := b.WriteBatch()
+			bt.Put("other", "value")
+			bt.Put("config", "v2")
+			return bt.Commit()
+		},
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, ErrImmutableKey) {
+			t.Errorf("%s: got:%v, want:%v", name, err, ErrImmutableKey)
+		}
+	}
+	value, _ := b.Get("config")
+	assertString(t, value, "v1")
+	if _, err := b.Get("other"); err == nil {
+		t.Errorf("Expected the rejected batch not to be written")
+	}
+
+	// the flag survives merges and reopening
+	for i := 0; i < 500; i++ {
+		b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	if err := b.Merge(); err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+	b, _ = Open(testBitcaskPath, ReadWrite)
+	if err := b.Put("config", "v2"); !errors.Is(err, ErrImmutableKey) {
+		t.Errorf("got:%v, want:%v", err, ErrImmutableKey)
+	}
+
+	if err := b.ClearImmutable("config"); err != nil {
+		t.Fatal(err)
+	}
+	if immutable, _ := b.IsImmutable("config"); immutable {
+		t.Errorf("Expected the key to be writable")
+	}
+	value, _ = b.Get("config")
+	assertString(t, value, "v1")
+	if err := b.Put("config", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.ClearImmutable("missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("got:%v, want:%v", err, ErrKeyNotFound)
+	}
+	b.Close()
+}
+
+func TestMergePrefix(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	opts := []Option{WithReadWrite(), WithPrefixes("tenant1:", "tenant2:")}
+
+	b, _ := Open(testBitcaskPath, opts...)
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 100; i++ {
+			b.Put(fmt.Sprintf("tenant1:%d", i), fmt.Sprintf("value%d_%d", i, round))
+			b.Put(fmt.Sprintf("tenant2:%d", i), fmt.Sprintf("value%d_%d", i, round))
+		}
+	}
+	b.Put("other", "value")
+	b.Delete("tenant1:0")
+
+	stats := b.PrefixStats()
+	if len(stats) != 3 || stats[0].Prefix != "" || stats[0].Keys != 1 || stats[1].Keys != 100 {
+		t.Fatalf("got:%+v", stats)
+	}
+	if stats[1].DeadBytes == 0 || stats[2].DeadBytes == 0 || stats[0].DeadBytes != 0 {
+		t.Errorf("Expected the overwritten records to be dead, got:%+v", stats)
+	}
+	b.Close()
+
+	// the usage loaded from the files matches the usage tracked by the writes
+	b, _ = Open(testBitcaskPath, opts...)
+	if got := b.PrefixStats(); !reflect.DeepEqual(got, stats) {
+		t.Errorf("got:%+v, want:%+v", got, stats)
+	}
+
+	res, err := b.MergePrefix("tenant1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.KeysWritten != 100 {
+		t.Errorf("got:%+v", res)
+	}
+	stats = b.PrefixStats()
+	if stats[1].Keys != 100 || stats[2].DeadBytes == 0 {
+		t.Errorf("got:%+v", stats)
+	}
+
+	// the files are removed once the other tenant no longer references them
+	b.MergePrefix("tenant2:")
+	res, err = b.MergePrefix("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.FilesRemoved == 0 {
+		t.Errorf("Expected the unreferenced files to be removed, got:%+v", res)
+	}
+	for _, stat := range b.PrefixStats() {
+		if stat.DeadBytes != 0 {
+			t.Errorf("got:%+v", stat)
+		}
+	}
+	b.Close()
+
+	b, _ = Open(testBitcaskPath, opts...)
+	for i := 1; i < 100; i++ {
+		value, _ := b.Get(fmt.Sprintf("tenant2:%d", i))
+		assertString(t, value, fmt.Sprintf("value%d_2", i))
+		value, _ = b.Get(fmt.Sprintf("tenant1:%d", i))
+		assertString(t, value, fmt.Sprintf("value%d_2", i))
+	}
+	if _, err := b.Get("tenant1:0"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected the deleted key to stay deleted, got:%v", err)
+	}
+	b.Close()
+}
+
+func TestPartitioned(t *testing.T) {
+	paths := []string{path.Join(testBitcaskPath, "p0"), path.Join(testBitcaskPath, "p1")}
+
+	t.Run("keys are spread over partitions", func(t *testing.T) {
+		p, _ := OpenPartitioned(paths, ReadWrite)
+		for i := 0; i < 100; i++ {
+			p.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+		}
+		p.Merge()
+
+		got, _ := p.Get("key50")
+		assertString(t, got, "value50")
+		if len(p.ListKeys()) != 100 {
+			t.Errorf("got:%d keys, want:%d", len(p.ListKeys()), 100)
+		}
+		for i, part := range p.parts {
+			if len(part.ListKeys()) == 0 {
+				t.Errorf("partition %d is empty", i)
+			}
+		}
+		p.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("merge partitions in parallel", func(t *testing.T) {
+		p, _ := OpenPartitioned(paths, ReadWrite, WithMergeWorkers(2))
+		for i := 0; i < 1000; i++ {
+			p.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+		}
+		p.Close()
+
+		p, _ = OpenPartitioned(paths, ReadWrite, WithMergeWorkers(2))
+		res, err := p.Merge()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.KeysWritten != 1000 {
+			t.Errorf("got:%d keys written, want:%d", res.KeysWritten, 1000)
+		}
+		got, _ := p.Get("key500")
+		assertString(t, got, "value500")
+		p.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("expire keys of every partition", func(t *testing.T) {
+		clock := &testClock{now: time.UnixMicro(1000)}
+		p, _ := OpenPartitioned(paths, ReadWrite, WithClock(clock), WithMaxRecordAge(time.Hour))
+		for i := 0; i < 100; i++ {
+			p.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+		}
+		p.Close()
+
+		clock.now = clock.now.Add(2 * time.Hour)
+		p, _ = OpenPartitioned(paths, ReadWrite, WithClock(clock), WithMaxRecordAge(time.Hour))
+		res, err := p.Merge()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.KeysExpired != 100 || res.KeysWritten != 0 {
+			t.Errorf("got:%+v, want 100 expired keys", res)
+		}
+		p.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("custom partitioner", func(t *testing.T) {
+		p, _ := OpenPartitioned(paths, ReadWrite, WithPartitioner(func(key string, n int) int {
+			return 1
+		}))
+		p.Put("key12", "value12345")
+
+		if len(p.parts[0].ListKeys()) != 0 || len(p.parts[1].ListKeys()) != 1 {
+			t.Errorf("key was not routed by the custom partitioner")
+		}
+		p.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("partitioner out of range", func(t *testing.T) {
+		p, _ := OpenPartitioned(paths, ReadWrite, WithPartitioner(func(key string, n int) int {
+			return n
+		}))
+
+		err := p.Put("key12", "value12345")
+		if !errors.Is(err, ErrInvalidPartition) {
+			t.Errorf("got:%v, want:%v", err, ErrInvalidPartition)
+		}
+		if _, err := p.Get("key12"); !errors.Is(err, ErrInvalidPartition) {
+			t.Errorf("got:%v, want:%v", err, ErrInvalidPartition)
+		}
+		p.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("reopen with a different layout", func(t *testing.T) {
+		p, _ := OpenPartitioned(paths, ReadWrite)
+		p.Close()
+
+		_, err := OpenPartitioned([]string{paths[1], paths[0]}, ReadWrite)
+		if !errors.Is(err, errPartitionMismatch) {
+			t.Errorf("got:%v, want:%v", err, errPartitionMismatch)
+		}
+		os.RemoveAll(testBitcaskPath)
+	})
+}
+
+func TestVerify(t *testing.T) {
+	// corrupt flips the last byte of the value of the given key on disk.
+	corrupt := func(b *Bitcask, key string) {
+		rec := keyDirRec(b, key)
+		f, _ := os.OpenFile(path.Join(testBitcaskPath, rec.FileId), os.O_RDWR, 0666)
+		pos := int64(rec.ValuePos) + 18 + int64(len(key)) + int64(rec.ValueSize) - 1
+		f.WriteAt([]byte{'X'}, pos)
+		f.Close()
+	}
+
+	t.Run("always verify detects corruption", func(t *testing.T) {
+		var handled []string
+		b, _ := Open(testBitcaskPath, ReadWrite, SyncOnPut, WithCorruptionHandler(func(key string, err error) {
+			handled = append(handled, key)
+		}))
+		b.Put("key12", "value12345")
+		corrupt(b, "key12")
+
+		_, err := b.Get("key12")
+		var corruption *CorruptionError
+		if !errors.As(err, &corruption) || !errors.Is(err, ErrCorruption) {
+			t.Fatalf("got:%v, want a CorruptionError", err)
+		}
+		want := CorruptionError{File: keyDirRec(b, "key12").FileId, Offset: 0, Key: "key12"}
+		if *corruption != want {
+			t.Errorf("got:%+v, want:%+v", *corruption, want)
+		}
+		if b.Corruptions() != 1 || !reflect.DeepEqual(handled, []string{"key12"}) {
+			t.Errorf("got:%d corruptions handled for %v, want:1 for key12", b.Corruptions(), handled)
+		}
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("open locates corrupted record", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite, SyncOnPut)
+		b.Put("key12", "value12345")
+		b.Put("key13", "value13")
+		rec := keyDirRec(b, "key12")
+		corrupt(b, "key12")
+		b.Close()
+
+		_, err := Open(testBitcaskPath)
+		var corruption *CorruptionError
+		if !errors.As(err, &corruption) || corruption.File != rec.FileId || corruption.Offset != int64(rec.ValuePos) {
+			t.Errorf("got:%v, want a CorruptionError at %s offset %d", err, rec.FileId, rec.ValuePos)
+		}
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("no verify skips validation", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite, SyncOnPut, WithVerify(NoVerify))
+		b.Put("key12", "value12345")
+		corrupt(b, "key12")
+
+		got, _ := b.Get("key12")
+		assertString(t, got, "value1234X")
+		if b.Corruptions() != 0 {
+			t.Errorf("got:%d corruptions, want:0", b.Corruptions())
+		}
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("sampled verify validates some reads", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite, SyncOnPut, WithVerify(VerifySampled))
+		b.Put("key12", "value12345")
+		corrupt(b, "key12")
+
+		for i := 0; i < verifySampleRate; i++ {
+			b.Get("key12")
+		}
+		if b.Corruptions() != 1 {
+			t.Errorf("got:%d corruptions, want:1", b.Corruptions())
+		}
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+}
+
+func TestKeys(t *testing.T) {
+	t.Run("binary keys round trip", func(t *testing.T) {
+		keys := []string{"a/b", "../etc/passwd", "nul\x00key", "new\nline", "\xff\xfe", strings.Repeat("k", datastore.MaxKeySize)}
+
+		b, _ := Open(testBitcaskPath, ReadWrite)
+		for i, key := range keys {
+			err := b.Put(key, fmt.Sprint(i))
+			if err != nil {
+				t.Fatalf("put %q: %v", datastore.PrintableKey(key), err)
+			}
+		}
+		b.Merge()
+		b.Close()
+
+		b, _ = Open(testBitcaskPath, ReadWrite)
+		for i, key := range keys {
+			got, _ := b.Get(key)
+			assertString(t, got, fmt.Sprint(i))
+		}
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("binary keys survive the keydir file and rebuilt hints", func(t *testing.T) {
+		keys := []string{"nul\x00key", "new\nline", "\r\n", "\xff\xfe", "\x00", strings.Repeat("\xff", datastore.MaxKeySize)}
+		defer os.RemoveAll(testBitcaskPath)
+		wantKeys := func(b *Bitcask, stage string) {
+			t.Helper()
+			got := b.ListKeys()
+			sort.Strings(got)
+			want := append([]string(nil), keys...)
+			sort.Strings(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s: got %d keys, want the %d binary keys unchanged", stage, len(got), len(want))
+			}
+			for i, key := range keys {
+				value, err := b.Get(key)
+				if err != nil {
+					t.Fatalf("%s: get %s: %v", stage, datastore.PrintableKey(key), err)
+				}
+				assertString(t, value, fmt.Sprint(i))
+			}
+		}
+
+		b, _ := Open(testBitcaskPath, ReadWrite)
+		batch := b.WriteBatch()
+		for i, key := range keys {
+			batch.Put(key, fmt.Sprint(i))
+		}
+		err := batch.Commit()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Merge()
+		err = b.Handoff()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, _ = Open(testBitcaskPath, ReadWrite)
+		if !b.OpenInfo().KeyDirFile {
+			t.Fatal("the keydir was not loaded from the keydir file")
+		}
+		wantKeys(b, "keydir file")
+		b.Close()
+
+		hints, _ := filepath.Glob(path.Join(testBitcaskPath, "*.hint"))
+		for _, hint := range hints {
+			os.Remove(hint)
+		}
+		_, err = RebuildHints(testBitcaskPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the keydir file written by the rebuild would be used instead of the hints
+		os.Remove(path.Join(testBitcaskPath, "keydir"))
+		b, _ = Open(testBitcaskPath, ReadWrite)
+		if len(b.OpenInfo().HintFilesUsed) == 0 {
+			t.Fatal("the rebuilt hint files were not used")
+		}
+		wantKeys(b, "rebuilt hints")
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("reject keys that do not fit", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite)
+
+		for _, key := range []string{"", strings.Repeat("k", datastore.MaxKeySize+1)} {
+			err := b.Put(key, "value")
+			if !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("got:%v, want:%v", err, ErrInvalidKey)
+			}
+		}
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("strict validator", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite, WithKeyValidator(ValidateStrictKey))
+
+		for _, key := range []string{"a/b", "a\\b", "nul\x00key", "new\nline"} {
+			err := b.Put(key, "value")
+			if !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("got:%v, want:%v", err, ErrInvalidKey)
+			}
+		}
+		assertError(t, b.Put("new\nline", "value"), `Put: invalid key: "new\nline" contains a control character`)
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("custom validator keeps the size limit", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite, WithKeyValidator(func(string) error { return nil }))
+
+		for _, key := range []string{"", strings.Repeat("k", datastore.MaxKeySize+1)} {
+			if err := b.Put(key, "value"); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("key of %d bytes got:%v, want:%v", len(key), err, ErrInvalidKey)
+			}
+		}
+		if err := b.Put(strings.Repeat("k", datastore.MaxKeySize), "value"); err != nil {
+			t.Error(err)
+		}
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("escaped keys in errors", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite)
+
+		_, err := b.Get("new\nline")
+		assertError(t, err, `"new\nline": key does not exist`)
+		_, err = b.Get(strings.Repeat("k", 200))
+		assertError(t, err, strings.Repeat("k", 128)+"...: key does not exist")
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+}
+
+func TestClock(t *testing.T) {
+	clock := &testClock{now: time.UnixMicro(1000)}
+	b, _ := Open(testBitcaskPath, ReadWrite, WithClock(clock))
+	b.Put("key12", "value12345")
+	b.Put("key13", "value13")
+
+	assertString(t, b.activeFile.Name(), "1002.data")
+	if got := keyDirRec(b, "key12").Tstamp; got != 1001 {
+		t.Errorf("got:%d, want:%d", got, 1001)
+	}
+	if got := keyDirRec(b, "key13").Tstamp; got != 1003 {
+		t.Errorf("got:%d, want:%d", got, 1003)
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestIOErrors(t *testing.T) {
+	t.Run("get from truncated data file", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite, SyncOnPut)
+		b.Put("key12", "value12345")
+		os.Truncate(path.Join(testBitcaskPath, b.activeFile.Name()), 10)
+
+		_, err := b.Get("key12")
+		assertError(t, err, "unexpected EOF")
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("delete surfaces write failure", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite)
+		b.Put("key12", "value12345")
+		b.activeFile.Close()
+
+		err := b.Delete("key12")
+		if err == nil {
+			t.Errorf("Expected delete to fail on a closed active file")
+		}
+		b.dataStore.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("merge surfaces missing data file", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite)
+		b.Put("key12", "value12345")
+		old := b.activeFile.Name()
+		b.activeFile = datastore.NewAppendFile(testBitcaskPath, b.fileFlags, datastore.Active, b.usrOpts.clock.Now, b.usrOpts.maxFileSize)
+		b.Put("key13", "value13")
+		os.Remove(path.Join(testBitcaskPath, old))
+
+		err := b.Merge()
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got:%v, want:%v", err, fs.ErrNotExist)
+		}
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+}
+
+func TestFreeze(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	b.Put("key12", "value12345")
+
+	b.Freeze()
+	if !b.Frozen() {
+		t.Errorf("Expected datastore to be frozen")
+	}
+	err := b.Put("key13", "value13")
+	if !errors.Is(err, ErrFrozen) {
+		t.Errorf("got:%v, want:%v", err, ErrFrozen)
+	}
+	assertError(t, b.Delete("key12"), "Delete: datastore is frozen")
+	_, err = b.merge()
+	if !errors.Is(err, ErrFrozen) {
+		t.Errorf("got:%v, want:%v", err, ErrFrozen)
+	}
+	value, _ := b.Get("key12")
+	assertString(t, value, "value12345")
+
+	b.Unfreeze()
+	err = b.Put("key13", "value13")
+	if err != nil {
+		t.Errorf("Expected no error after unfreeze, got:%v", err)
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestWriteMirror(t *testing.T) {
+	for _, queueSize := range []int{0, 4} {
+		t.Run(fmt.Sprintf("queue of %d writes", queueSize), func(t *testing.T) {
+			mirrorPath := t.TempDir()
+			m, _ := Open(mirrorPath, ReadWrite)
+			b, _ := Open(testBitcaskPath, ReadWrite, WithWriteMirror(m, queueSize))
+
+			for i := 0; i < 10; i++ {
+				b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+			}
+			b.Delete("key3")
+			b.Close()
+
+			for i := 0; i < 10; i++ {
+				value, err := m.Get(fmt.Sprintf("key%d", i))
+				if i == 3 {
+					if !errors.Is(err, datastore.ErrKeyNotExist) {
+						t.Errorf("got:%v, want:%v", err, datastore.ErrKeyNotExist)
+					}
+					continue
+				}
+				assertString(t, value, fmt.Sprintf("value%d", i))
+			}
+			m.Close()
+			os.RemoveAll(testBitcaskPath)
+		})
+	}
+
+	t.Run("synchronous mirror failure", func(t *testing.T) {
+		m, _ := Open(t.TempDir(), ReadOnly)
+		b, _ := Open(testBitcaskPath, ReadWrite, WithWriteMirror(m, 0))
+
+		assertError(t, b.Put("key12", "value12345"), "mirror: Put: require write permission")
+		value, _ := b.Get("key12")
+		assertString(t, value, "value12345")
+		b.Close()
+		m.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+	t.Run("busy asynchronous mirror", func(t *testing.T) {
+		m, _ := Open(t.TempDir(), ReadWrite)
+		b, _ := Open(testBitcaskPath, ReadWrite, WithWriteMirror(m, 1), WithBusyTimeout(50*time.Millisecond))
+
+		// the mirror is stalled while the test holds its lock
+		m.accessMu.Lock()
+		b.Put("key10", "value10")
+		b.Put("key11", "value11")
+		err := b.Put("key12", "value12")
+		if !errors.Is(err, ErrBusy) {
+			t.Errorf("got:%v, want:%v", err, ErrBusy)
+		}
+		if _, err := b.Get("key12"); err == nil {
+			t.Errorf("Expected the rejected write not to be applied")
+		}
+		m.accessMu.Unlock()
+
+		b.Close()
+		value, _ := m.Get("key11")
+		assertString(t, value, "value11")
+		m.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+}
+
+func TestRebuildHints(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	for i := 0; i < 500; i++ {
+		b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	active := b.activeFile.Name()
+	b.Close()
+
+	res, err := RebuildHints(testBitcaskPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.HintsChecked < 2 || res.HintsRebuilt != res.HintsChecked {
+		t.Errorf("got:%+v, want every hint file to be rebuilt", res)
+	}
+
+	res, _ = RebuildHints(testBitcaskPath)
+	if res.HintsRebuilt != 0 {
+		t.Errorf("got:%d hint files rebuilt, want:%d", res.HintsRebuilt, 0)
+	}
+
+	hint := strings.TrimSuffix(active, ".data") + ".hint"
+	os.Truncate(path.Join(testBitcaskPath, hint), 7)
+	f, _ := os.OpenFile(path.Join(testBitcaskPath, active), os.O_APPEND|os.O_WRONLY, 0666)
+	f.Write([]byte("garbage"))
+	f.Close()
+	os.WriteFile(path.Join(testBitcaskPath, "1.hint"), []byte("orphan"), 0666)
+
+	res, _ = RebuildHints(testBitcaskPath)
+	if res.HintsRebuilt != 1 || res.HintsRemoved != 1 || len(res.DamagedFiles) != 1 || res.DamagedFiles[0] != active {
+		t.Errorf("got:%+v", res)
+	}
+
+	b, _ = Open(testBitcaskPath)
+	for i := 0; i < 500; i++ {
+		value, _ := b.Get(fmt.Sprintf("key%d", i))
+		assertString(t, value, fmt.Sprintf("value%d", i))
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestAnalyzeFragmentation(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	for i := 0; i < 3; i++ {
+		b.Put("key12", fmt.Sprintf("value%d", i))
+	}
+	b.Put("key13", "value13")
+	b.Delete("key13")
+
+	files, err := b.AnalyzeFragmentation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("got:%d files, want:%d", len(files), 1)
+	}
+	f := files[0]
+	if f.LiveRecords != 1 || f.DeadRecords != 4 {
+		t.Errorf("got:%d live and %d dead records, want:1 live and 4 dead", f.LiveRecords, f.DeadRecords)
+	}
+	if len(f.HotKeys) != 2 || f.HotKeys[0] != (HotKey{Key: "key12", Writes: 3}) {
+		t.Errorf("got:%v", f.HotKeys)
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestAudit(t *testing.T) {
+	clock := &testClock{now: time.UnixMicro(1000)}
+	b, _ := Open(testBitcaskPath, ReadWrite, WithClock(clock), WithAudit("test"))
+	b.Put("key12", "value12345")
+	b.Merge()
+	b.Close()
+	b, _ = Open(testBitcaskPath)
+	b.Close()
+
+	events, err := ReadAuditLog(testBitcaskPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("got:%d events, want:%d", len(events), 3)
+	}
+	for i, want := range []string{"open", "merge", "close"} {
+		if events[i].Event != want || events[i].Label != "test" || events[i].Outcome != "ok" {
+			t.Errorf("got:%+v, want a successful %s event", events[i], want)
+		}
+	}
+	assertString(t, events[0].Detail, "permission=read-write")
+	if !events[1].Time.After(events[0].Time) {
+		t.Errorf("got:%v before %v", events[1].Time, events[0].Time)
+	}
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestIncr(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				b.Incr("counter", 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, _ := b.Get("counter")
+	assertString(t, value, "500")
+
+	b.Put("key12", "value12345")
+	_, err := b.Incr("key12", 1)
+	if !errors.Is(err, ErrNotInteger) {
+		t.Errorf("got:%v, want:%v", err, ErrNotInteger)
+	}
+
+	b.Put("max", fmt.Sprint(math.MaxInt64))
+	_, err = b.Incr("max", 1)
+	if !errors.Is(err, ErrOverflow) {
+		t.Errorf("got:%v, want:%v", err, ErrOverflow)
+	}
+
+	b.Delete("counter")
+	got, _ := b.Incr("counter", -2)
+	if got != -2 {
+		t.Errorf("got:%d, want:%d", got, -2)
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestAppendValue(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+
+	n, _ := b.AppendValue("log", "line1\n")
+	if n != 6 {
+		t.Errorf("got:%d, want:%d", n, 6)
+	}
+	n, _ = b.AppendValue("log", "line2\n")
+	if n != 12 {
+		t.Errorf("got:%d, want:%d", n, 12)
+	}
+	value, _ := b.Get("log")
+	assertString(t, value, "line1\nline2\n")
+
+	b.Delete("log")
+	b.AppendValue("log", "line3\n")
+	b.Close()
+
+	b, _ = Open(testBitcaskPath)
+	value, _ = b.Get("log")
+	assertString(t, value, "line3\n")
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestAccessTracking(t *testing.T) {
+	clock := &testClock{now: time.Unix(1000, 0)}
+	b, _ := Open(testBitcaskPath, ReadWrite, WithClock(clock), WithAccessTracking())
+	b.Put("key12", "value12345")
+	b.Put("key12", "value12")
+	b.Put("key13", "value13")
+	clock.now = time.Unix(2000, 0)
+	b.Get("key12")
+
+	access, _ := b.KeyAccess("key12")
+	if access.Writes != 2 || access.LastAccess.Unix() != 2000 {
+		t.Errorf("got:%+v, want 2 writes and last access at 2000", access)
+	}
+
+	b.Delete("key13")
+	_, err := b.KeyAccess("key13")
+	if !errors.Is(err, datastore.ErrKeyNotExist) {
+		t.Errorf("got:%v, want:%v", err, datastore.ErrKeyNotExist)
+	}
+	b.Close()
+
+	b, _ = Open(testBitcaskPath, WithAccessTracking())
+	access, _ = b.KeyAccess("key12")
+	if access.Writes != 0 || access.LastAccess.Unix() != 1000 {
+		t.Errorf("got:%+v, want no writes and last access at the last write", access)
+	}
+	b.Close()
+
+	b, _ = Open(testBitcaskPath)
+	_, err = b.KeyAccess("key12")
+	assertError(t, err, "access tracking is not enabled")
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestMaxMemory(t *testing.T) {
+	entry := func(key string) int64 { return keyDirEntrySize + int64(len(key)) }
+
+	t.Run("noeviction", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite, WithMaxMemory(2*entry("key10"), NoEviction))
+		b.Put("key10", "value10")
+		b.Put("key11", "value11")
+
+		err := b.Put("key12", "value12")
+		if !errors.Is(err, ErrOutOfMemory) {
+			t.Errorf("got:%v, want:%v", err, ErrOutOfMemory)
+		}
+		if err := b.Put("key11", "value"); err != nil {
+			t.Errorf("Expected overwrites to be allowed, got:%v", err)
+		}
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("allkeys-lru", func(t *testing.T) {
+		clock := &testClock{now: time.Unix(1000, 0)}
+		b, _ := Open(testBitcaskPath, ReadWrite, WithClock(clock), WithMaxMemory(3*entry("key10"), AllKeysLRU))
+		for i := 0; i < 3; i++ {
+			clock.now = time.Unix(int64(1000+i), 0)
+			b.Put(fmt.Sprintf("key1%d", i), "value")
+		}
+		clock.now = time.Unix(2000, 0)
+		b.Get("key10")
+		b.Put("key13", "value")
+
+		if b.Evictions() != 1 {
+			t.Errorf("got:%d evictions, want:%d", b.Evictions(), 1)
+		}
+		if _, err := b.Get("key11"); !errors.Is(err, datastore.ErrKeyNotExist) {
+			t.Errorf("Expected the least recently used key to be evicted, got:%v", err)
+		}
+		b.Close()
+
+		b, _ = Open(testBitcaskPath)
+		value, err := b.Get("key11")
+		if err == nil {
+			t.Errorf("Expected evicted key to stay deleted after reopen, got:%q", value)
+		}
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("set at runtime", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite)
+		for i := 0; i < 10; i++ {
+			b.Put(fmt.Sprintf("key1%d", i), "value")
+		}
+		b.SetMaxMemory(5*entry("key10"), AllKeysRandom)
+		b.Put("key20", "value")
+
+		if b.Evictions() != 6 || b.MemoryUsage().KeyDir > 5*entry("key10") {
+			t.Errorf("got:%d evictions and %d bytes", b.Evictions(), b.MemoryUsage().KeyDir)
+		}
+		value, _ := b.Get("key20")
+		assertString(t, value, "value")
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("allkeys-random ordered", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite, WithKeyDir(OrderedKeyDir), WithMaxMemory(5*entry("key10"), AllKeysRandom))
+		for i := 0; i < 20; i++ {
+			b.Put(fmt.Sprintf("key%d", 10+i), "value")
+		}
+
+		keys := b.ListKeys()
+		if b.Evictions() != 15 || len(keys) != 5 {
+			t.Fatalf("got:%d evictions and %d keys", b.Evictions(), len(keys))
+		}
+		if reflect.DeepEqual(keys, []string{"key25", "key26", "key27", "key28", "key29"}) {
+			t.Errorf("Expected random victims, got the smallest keys evicted every time")
+		}
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("set while reading", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite)
+		b.Put("key10", "value")
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 1000; i++ {
+				b.Get("key10")
+				b.KeyAccess("key10")
+			}
+		}()
+		b.SetMaxMemory(10*entry("key10"), AllKeysLRU)
+		<-done
+
+		if _, err := b.KeyAccess("key10"); err != nil {
+			t.Errorf("Expected access tracking after SetMaxMemory, got:%v", err)
+		}
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+}
+
+func TestKeyDirFile(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	for i := 0; i < 500; i++ {
+		b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	b.Close()
+
+	b, _ = Open(testBitcaskPath)
+	want := b.keyDir
+	b.Close()
+
+	data, err := os.ReadFile(path.Join(testBitcaskPath, "keydir"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, got, err := recfmt.ExtractKeyDirFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keydir.Map(got), want) {
+		t.Errorf("Expected the keydir file to hold the exact keydir with its file ids")
+	}
+	entries, _ := os.ReadDir(testBitcaskPath)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".keydir") {
+			t.Errorf("Expected the temporary keydir file %s to be renamed", entry.Name())
+		}
+	}
+
+	t.Run("keydir file with a wrong record count is rejected", func(t *testing.T) {
+		bad := append([]byte{}, data...)
+		end := len(bad) - 8
+		binary.LittleEndian.PutUint32(bad[end:], uint32(want.Len()+1))
+		binary.LittleEndian.PutUint32(bad[end+4:], crc32.ChecksumIEEE(bad[:end+4]))
+		if _, _, err := recfmt.ExtractKeyDirFile(bad); !errors.Is(err, recfmt.ErrKeyDirCorruption) {
+			t.Errorf("got:%v, want:%v", err, recfmt.ErrKeyDirCorruption)
+		}
+	})
+
+	t.Run("corrupted keydir file is ignored", func(t *testing.T) {
+		data[len(data)/2] ^= 0xff
+		os.WriteFile(path.Join(testBitcaskPath, "keydir"), data, 0666)
+
+		b, _ := Open(testBitcaskPath)
+		value, _ := b.Get("key123")
+		assertString(t, value, "value123")
+		b.Close()
+	})
+
+	t.Run("keydir file is ignored after a data file changes", func(t *testing.T) {
+		b, _ := Open(testBitcaskPath, ReadWrite)
+		b.Put("key123", "new value")
+		b.Close()
+
+		b, _ = Open(testBitcaskPath)
+		value, _ := b.Get("key123")
+		assertString(t, value, "new value")
+		b.Close()
+	})
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestHintFileIds(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	b.Put("key12", "value12345")
+	b.Close()
+	b, _ = Open(testBitcaskPath, ReadWrite)
+	b.Merge()
+	b.Close()
+
+	// ids ending with characters of the extensions used to be cut by strings.Trim
+	entries, _ := os.ReadDir(testBitcaskPath)
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := path.Ext(name)
+		if ext == ".data" || ext == ".hint" {
+			os.Rename(path.Join(testBitcaskPath, name), path.Join(testBitcaskPath, "1t"+ext))
+		}
+	}
+	os.WriteFile(path.Join(testBitcaskPath, "2.hint"), []byte{}, 0666)
+	os.Remove(path.Join(testBitcaskPath, "keydir"))
+
+	b, _ = Open(testBitcaskPath)
+	value, err := b.Get("key12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertString(t, value, "value12345")
+	assertString(t, keyDirRec(b, "key12").FileId, "1t.data")
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestMergeWaitsForReads(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	b.Put("key12", "value12345")
+	old := b.activeFile.Name()
+	b.activeFile = datastore.NewAppendFile(testBitcaskPath, b.fileFlags, datastore.Active, b.usrOpts.clock.Now, b.usrOpts.maxFileSize)
+	b.Put("key13", "value13")
+
+	// a read in flight that looked up key12 before the merge,
+	// sharing the access lock with another reader
+	b.readMu.RLock()
+	rec := keyDirRec(b, "key12")
+
+	done := make(chan error)
+	go func() { done <- b.Merge() }()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Expected merge to wait for the read, got:%v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if rec.FileId != old {
+		t.Fatalf("got:%s, want:%s", rec.FileId, old)
+	}
+	value, err := b.readValue("key12", rec, true)
+	if err != nil {
+		t.Errorf("Expected the old file to be readable, got:%v", err)
+	}
+	assertString(t, value, "value12345")
+	b.readMu.RUnlock()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path.Join(testBitcaskPath, old)); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed after the read, got:%v", old, err)
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+
+	t.Run("readers run in parallel", func(t *testing.T) {
+		if err := b.Put("key", "value"); err != nil {
+			t.Fatal(err)
+		}
+
+		// a read in progress does not block the other readers
+		b.startRead()
+		done := make(chan error)
+		go func() {
+			_, err := b.Get("key")
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("got:%v", err)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Expected the get to run alongside the other read")
+		}
+		b.endRead()
+	})
+
+	t.Run("one handle shared by many goroutines", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			w := w
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					key := fmt.Sprintf("key%d_%d", w, i)
+					if err := b.Put(key, fmt.Sprintf("value%d", i)); err != nil {
+						t.Errorf("got:%v", err)
+						return
+					}
+					value, err := b.Get(key)
+					if err != nil {
+						t.Errorf("got:%v", err)
+						return
+					}
+					assertString(t, value, fmt.Sprintf("value%d", i))
+					_ = b.ListKeys()
+					if i%10 == 0 {
+						b.Fold(func(_, _ string, acc any) any { return acc }, nil)
+					}
+					if w == 0 && i%25 == 0 {
+						if err := b.Merge(); err != nil {
+							t.Errorf("got:%v", err)
+							return
+						}
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		for w := 0; w < 8; w++ {
+			for i := 0; i < 50; i++ {
+				value, err := b.Get(fmt.Sprintf("key%d_%d", w, i))
+				if err != nil {
+					t.Fatal(err)
+				}
+				assertString(t, value, fmt.Sprintf("value%d", i))
+			}
+		}
+	})
+
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestPutAsync(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite, SyncOnPut)
+
+	var mu sync.Mutex
+	var order []int
+	for i := 0; i < 100; i++ {
+		i := i
+		b.PutAsync(fmt.Sprintf("key%d", i%10), fmt.Sprintf("value%d", i), func(err error) {
+			if err != nil {
+				t.Errorf("got:%v", err)
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+		})
+	}
+	b.Close()
+
+	if len(order) != 100 || !sort.IntsAreSorted(order) {
+		t.Errorf("Expected all callbacks to be called in order before close returns, got:%v", order)
+	}
+
+	var closedErr error
+	b.PutAsync("key0", "value", func(err error) { closedErr = err })
+	assertError(t, closedErr, "bitcask is closed")
+
+	b, _ = Open(testBitcaskPath)
+	value, _ := b.Get("key3")
+	assertString(t, value, "value93")
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestFlight(t *testing.T) {
+	var f flight
+	var calls int32
+	release := make(chan struct{})
+	key := flightKey{fileId: "1.data", pos: 10}
+
+	var wg sync.WaitGroup
+	values := make([]string, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			values[i], _ = f.do(key, func() (string, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "value", nil
+			})
+		}(i)
+	}
+
+	// let the callers join the first read before it completes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("got:%d reads, want:%d", calls, 1)
+	}
+	for _, value := range values {
+		assertString(t, value, "value")
+	}
+
+	value, _ := f.do(key, func() (string, error) { return "new value", nil })
+	assertString(t, value, "new value")
+}
+
+func TestBackup(t *testing.T) {
+	key := []byte("secret")
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	for i := 0; i < 500; i++ {
+		b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+
+	backupDir := path.Join(t.TempDir(), "backup")
+	manifest, err := b.Backup(backupDir, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Keys != 500 || manifest.FileCount < 2 || manifest.Signature == "" {
+		t.Errorf("got:%+v", manifest)
+	}
+	if err := b.Put("key500", "value500"); err != nil {
+		t.Errorf("Expected writes to be accepted after the backup, got:%v", err)
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+
+	t.Run("restore verified backup", func(t *testing.T) {
+		_, err := Restore(backupDir, testBitcaskPath, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := Open(testBitcaskPath)
+		value, _ := b.Get("key499")
+		assertString(t, value, "value499")
+		if _, err := b.Get("key500"); err == nil {
+			t.Errorf("Expected writes after the backup not to be restored")
+		}
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	})
+
+	t.Run("wrong signing key", func(t *testing.T) {
+		_, err := VerifyBackup(backupDir, []byte("other"))
+		if !errors.Is(err, ErrBackupInvalid) {
+			t.Errorf("got:%v, want:%v", err, ErrBackupInvalid)
+		}
+	})
+
+	t.Run("truncated file", func(t *testing.T) {
+		name := path.Join(backupDir, manifest.Files[0].Name)
+		os.Truncate(name, manifest.Files[0].Size-1)
+
+		_, err := Restore(backupDir, testBitcaskPath, nil)
+		if !errors.Is(err, ErrBackupInvalid) {
+			t.Errorf("got:%v, want:%v", err, ErrBackupInvalid)
+		}
+		if _, err := os.Stat(testBitcaskPath); !os.IsNotExist(err) {
+			t.Errorf("Expected nothing to be restored from an invalid backup")
+		}
+	})
+}
+
+func TestBackupIncremental(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	key := []byte("secret")
+	dir := t.TempDir()
+	fullDir, incDir, chainDir := path.Join(dir, "full"), path.Join(dir, "inc"), path.Join(dir, "chain")
+
+	b, _ := Open(testBitcaskPath, ReadWrite, WithMaxFileSize(1024))
+	for i := 0; i < 200; i++ {
+		b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	full, err := b.Backup(fullDir, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 200; i < 250; i++ {
+		b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	inc, err := b.BackupIncremental(incDir, fullDir, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inc.Base != "../full" || len(inc.Inherited) == 0 || inc.FileCount+len(inc.Inherited) <= full.FileCount {
+		t.Errorf("got:%+v", inc)
+	}
+
+	// a backup based on an incremental backup inherits from the whole chain
+	b.Put("key250", "value250")
+	chain, err := b.BackupIncremental(chainDir, incDir, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.FileCount != 1 {
+		t.Errorf("Expected only the active file to be copied, got:%+v", chain)
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+
+	_, err = Restore(chainDir, testBitcaskPath, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = Open(testBitcaskPath)
+	for i := 0; i <= 250; i++ {
+		value, _ := b.Get(fmt.Sprintf("key%d", i))
+		assertString(t, value, fmt.Sprintf("value%d", i))
+	}
+	b.Close()
+
+	if _, err := VerifyBackup(chainDir, key); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(path.Join(fullDir, inc.Inherited[0].Name))
+	if _, err := VerifyBackup(chainDir, key); !errors.Is(err, ErrBackupInvalid) {
+		t.Errorf("got:%v, want:%v", err, ErrBackupInvalid)
+	}
+}
+
+func TestMergeConcurrentWrites(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	clock := &hookClock{testClock: testClock{now: time.UnixMicro(1000)}}
+	b, _ := Open(testBitcaskPath, ReadWrite, WithClock(clock), WithMaxFileSize(1024))
+	for i := 0; i < 100; i++ {
+		b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+
+	// the merge reads the clock to name its first merge file while copying a record,
+	// it is stalled there as long as the bitcask is not locked
+	inMerge := make(chan struct{})
+	release := make(chan struct{})
+	stalled := false
+	clock.hook = func() {
+		if !stalled && b.accessMu.TryLock() {
+			b.accessMu.Unlock()
+			stalled = true
+			close(inMerge)
+			<-release
+		}
+	}
+	done := make(chan error)
+	go func() {
+		done <- b.Merge()
+	}()
+	<-inMerge
+
+	written := make(chan struct{})
+	go func() {
+		value, _ := b.Get("key0")
+		assertString(t, value, "value0")
+		b.Put("key5", "new")
+		b.Put("added", "new")
+		b.Delete("key50")
+		close(written)
+	}()
+	select {
+	case <-written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the reads and writes to go on during the merge")
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	clock.hook = nil
+
+	check := func(t *testing.T, b *Bitcask) {
+		for i := 0; i < 100; i++ {
+			want := fmt.Sprintf("value%d", i)
+			if i == 5 {
+				want = "new"
+			}
+			value, _ := b.Get(fmt.Sprintf("key%d", i))
+			if i != 50 {
+				assertString(t, value, want)
+			}
+		}
+		if _, err := b.Get("key50"); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("got:%v, want:%v", err, ErrKeyNotFound)
+		}
+		value, _ := b.Get("added")
+		assertString(t, value, "new")
+	}
+	check(t, b)
+
+	// the rewritten records keep their timestamps, so the writes made during the merge still win
+	b.Close()
+	b, _ = Open(testBitcaskPath, ReadWrite)
+	defer b.Close()
+	check(t, b)
+}
+
+func TestConcurrentMerges(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	b, _ := Open(testBitcaskPath, ReadWrite, WithMaxFileSize(1024))
+	defer b.Close()
+
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 100; i++ {
+			b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d-%d", i, round))
+		}
+
+		// the merges run one after the other, none deletes the files of another
+		errs := make(chan error, 3)
+		for i := 0; i < 3; i++ {
+			go func() {
+				errs <- b.Merge()
+			}()
+		}
+		for i := 0; i < 3; i++ {
+			if err := <-errs; err != nil {
+				t.Fatalf("round %d: %v", round, err)
+			}
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		value, _ := b.Get(fmt.Sprintf("key%d", i))
+		assertString(t, value, fmt.Sprintf("value%d-4", i))
+	}
+}
+
+func TestPauseMerge(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	clock := &hookClock{testClock: testClock{now: time.UnixMicro(1000)}}
+	b, _ := Open(testBitcaskPath, ReadWrite, WithClock(clock), WithMaxFileSize(1024), WithMaxRecordAge(time.Hour))
+	defer b.Close()
+	for i := 0; i < 100; i++ {
+		b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+
+	t.Run("pause in progress", func(t *testing.T) {
+		// the merge reads the clock to check the age of every old record, it is paused at the tenth key
+		calls := 0
+		clock.hook = func() {
+			if calls++; calls == 10 {
+				b.mergePaused = true
+				b.mergeResumed = make(chan struct{})
+			}
+		}
+		done := make(chan error)
+		go func() {
+			done <- b.Merge()
+		}()
+		for !b.MergePaused() {
+			runtime.Gosched()
+		}
+		clock.hook = nil
+
+		// the bitcask is released while the merge is paused
+		value, _ := b.Get("key0")
+		assertString(t, value, "value0")
+		b.Put("key5", "new")
+		b.Put("key95", "new")
+		b.Put("added", "new")
+		b.Delete("key50")
+
+		b.ResumeMerge()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			want := fmt.Sprintf("value%d", i)
+			if i == 5 || i == 95 {
+				want = "new"
+			}
+			value, _ := b.Get(fmt.Sprintf("key%d", i))
+			if i != 50 {
+				assertString(t, value, want)
+			}
+		}
+		if _, err := b.Get("key50"); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("got:%v, want:%v", err, ErrKeyNotFound)
+		}
+		value, _ = b.Get("added")
+		assertString(t, value, "new")
+	})
+
+	t.Run("pause before start", func(t *testing.T) {
+		b.PauseMerge()
+		done := make(chan error)
+		go func() {
+			done <- b.Merge()
+		}()
+		select {
+		case <-done:
+			t.Fatal("Expected the merge to wait for ResumeMerge")
+		case <-time.After(50 * time.Millisecond):
+		}
+		b.ResumeMerge()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("frozen when resumed", func(t *testing.T) {
+		b.PauseMerge()
+		done := make(chan error)
+		go func() {
+			done <- b.Merge()
+		}()
+		b.Freeze()
+		b.ResumeMerge()
+		if err := <-done; !errors.Is(err, ErrFrozen) {
+			t.Errorf("got:%v, want:%v", err, ErrFrozen)
+		}
+		b.Unfreeze()
+	})
+}
+
+func TestMergeLatencyTarget(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	b, _ := Open(testBitcaskPath, ReadWrite, WithMaxFileSize(1024))
+	defer b.Close()
+	for i := 0; i < 100; i++ {
+		b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	// the controller is driven by hand instead of every latencyWindow
+	b.latency = newLatencyMonitor(time.Second)
+
+	for i := 0; i < 100; i++ {
+		b.latency.observe(2 * time.Second)
+	}
+	b.controlMerges()
+	if !b.MergePaused() {
+		t.Fatal("Expected the merges to be paused over the latency target")
+	}
+	done := make(chan error)
+	go func() {
+		done <- b.Merge()
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Expected the merge to wait, got:%v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// a manual pause outlives the load
+	b.PauseMerge()
+	for i := 0; i < 100; i++ {
+		if _, err := b.Get(fmt.Sprintf("key%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.controlMerges()
+	if !b.MergePaused() {
+		t.Fatal("Expected the merges to stay paused by PauseMerge")
+	}
+
+	b.ResumeMerge()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if b.MergePaused() {
+		t.Error("Expected the merges to be resumed")
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	transient := []error{syscall.EINTR, fmt.Errorf("read: %w", syscall.EAGAIN), ErrReadTimeout}
+	for _, err := range transient {
+		if !IsTransient(err) {
+			t.Errorf("Expected %v to be transient", err)
+		}
+	}
+
+	permanent := []error{fs.ErrNotExist, ErrCorruption, datastore.ErrKeyNotExist, syscall.EBADF}
+	for _, err := range permanent {
+		if IsTransient(err) {
+			t.Errorf("Expected %v not to be transient", err)
+		}
+	}
+}
+
+func TestPrecreateActiveFile(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite, WithPrecreateActiveFile())
+	name := b.activeFile.Name()
+	if _, err := os.Stat(path.Join(testBitcaskPath, name)); err != nil {
+		t.Fatalf("Expected the active file to exist after open, got:%v", err)
+	}
+
+	b.Put("key12", "value12345")
+	assertString(t, keyDirRec(b, "key12").FileId, name)
+	b.Close()
+
+	b, _ = Open(testBitcaskPath, ReadWrite)
+	if b.activeFile.Name() != "" {
+		t.Errorf("Expected the active file to be created by the first write by default")
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestClockSkew(t *testing.T) {
+	clock := &testClock{now: time.UnixMicro(1000)}
+	b, _ := Open(testBitcaskPath, ReadWrite, WithClock(clock))
+	b.Put("key12", "value12345")
+	b.Close()
+
+	clock.now = time.UnixMicro(500)
+	b, _ = Open(testBitcaskPath, ReadWrite, WithClock(clock))
+	b.Put("key12", "value12")
+	b.Put("key13", "value13")
+	if got := keyDirRec(b, "key12").Tstamp; got != 1002 {
+		t.Errorf("got:%d, want:%d", got, 1002)
+	}
+	if got := b.ClockSkews(); got != 2 {
+		t.Errorf("got:%d skews, want:%d", got, 2)
+	}
+	b.Close()
+
+	b, _ = Open(testBitcaskPath)
+	value, _ := b.Get("key12")
+	assertString(t, value, "value12")
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestConcurrentWritesNoClockSkew(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	defer b.Close()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				if err := b.Put(fmt.Sprintf("key%d_%d", g, i), "value"); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	// the writers waiting for the lock are not taken for the clock going backwards
+	if got := b.ClockSkews(); got != 0 {
+		t.Errorf("got:%d skews, want:0", got)
+	}
+}
+
+func TestKeyDirSnapshot(t *testing.T) {
+	clock := &testClock{now: time.UnixMicro(1000)}
+	b, _ := Open(testBitcaskPath, ReadWrite, WithClock(clock))
+	b.Put("key12", "value12345")
+	b.Put("key13", "value13")
+
+	meta, err := b.KeyMeta("key13")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := KeyMeta{
+		File:      b.activeFile.Name(),
+		Offset:    int64(keyDirRec(b, "key13").ValuePos),
+		ValueSize: 7,
+		Tstamp:    time.UnixMicro(1003),
+	}
+	if meta != want {
+		t.Errorf("got:%+v, want:%+v", meta, want)
+	}
+
+	_, err = b.KeyMeta("key14")
+	assertError(t, err, "key14: key does not exist")
+
+	snapshot := b.KeyDirSnapshot()
+	b.Put("key14", "value14")
+	if len(snapshot) != 2 || snapshot["key13"] != want {
+		t.Errorf("got:%+v, want a snapshot of 2 keys", snapshot)
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestKeyDirKinds(t *testing.T) {
+	kinds := map[string]KeyDirKind{
+		"map": MapKeyDir, "sharded": ShardedKeyDir, "ordered": OrderedKeyDir, "compact": CompactKeyDir,
+	}
+	for name, kind := range kinds {
+		t.Run(name, func(t *testing.T) {
+			b, _ := Open(testBitcaskPath, ReadWrite, WithKeyDir(kind))
+			for i := 0; i < 300; i++ {
+				b.Put(fmt.Sprintf("key%03d", (i*7)%300), fmt.Sprintf("value%d", i))
+			}
+			b.Put("key000", "value")
+			b.Merge()
+			b.Put("key001", "value1")
+			if got := b.keyDir.Len(); got != 300 {
+				t.Errorf("got:%d keys, want:%d", got, 300)
+			}
+			b.Close()
+
+			b, _ = Open(testBitcaskPath, WithKeyDir(kind))
+			value, _ := b.Get("key000")
+			assertString(t, value, "value")
+			value, _ = b.Get("key001")
+			assertString(t, value, "value1")
+			_, err := b.Get("key300")
+			assertError(t, err, "key300: key does not exist")
+
+			keys := b.ListKeys()
+			if len(keys) != 300 {
+				t.Errorf("got:%d keys, want:%d", len(keys), 300)
+			}
+			if kind == OrderedKeyDir && !sort.StringsAreSorted(keys) {
+				t.Errorf("Expected the ordered keydir to list the keys in order")
+			}
+
+			b.keyDir.Delete("key150")
+			b.keyDir.Delete("key150")
+			if _, isExist := b.keyDir.Get("key150"); isExist || b.keyDir.Len() != 299 {
+				t.Errorf("Expected key150 to be deleted from the keydir")
+			}
+
+			picked := make(map[string]bool)
+			for i := 0; i < 100; i++ {
+				key, rec, isExist := b.keyDir.RandomKey()
+				if got, _ := b.keyDir.Get(key); !isExist || got != rec {
+					t.Fatalf("got:%q %+v, want a key of the keydir", key, rec)
+				}
+				picked[key] = true
+			}
+			if len(picked) < 10 {
+				t.Errorf("got:%d distinct random keys, want at least %d", len(picked), 10)
+			}
+			b.Close()
+			os.RemoveAll(testBitcaskPath)
+		})
+	}
+}
+
+func TestListKeysPage(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+
+	for _, kind := range []KeyDirKind{MapKeyDir, OrderedKeyDir} {
+		b, _ := Open(testBitcaskPath, ReadWrite, WithKeyDir(kind))
+		for i := 0; i < 25; i++ {
+			b.Put(fmt.Sprintf("key%02d", 24-i), "value")
+		}
+		b.Put("deleted", "value")
+		if err := b.Delete("deleted"); err != nil {
+			t.Fatal(err)
+		}
+
+		keys, next := b.ListKeysPage("", 10)
+		assertString(t, next, "key09")
+		if len(keys) != 10 || keys[0] != "key00" {
+			t.Errorf("kind %d got:%v", kind, keys)
+		}
+		b.Put("key05a", "value")
+		if err := b.Delete("key20"); err != nil {
+			t.Fatal(err)
+		}
+		keys, next = b.ListKeysPage(next, 20)
+		assertString(t, next, "")
+		if len(keys) != 14 || keys[0] != "key10" {
+			t.Errorf("kind %d got:%v", kind, keys)
+		}
+
+		var streamed []string
+		for key := range b.StreamKeys(nil) {
+			streamed = append(streamed, key)
+		}
+		if len(streamed) != 25 || !sort.StringsAreSorted(streamed) || streamed[0] != "key00" {
+			t.Errorf("kind %d got:%v", kind, streamed)
+		}
+
+		done := make(chan struct{})
+		keysCh := b.StreamKeys(done)
+		<-keysCh
+		close(done)
+		for range keysCh {
+		}
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	}
+}
+
+func TestIterators(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	for i := 0; i < 2500; i++ {
+		b.Put(fmt.Sprintf("key%04d", i), fmt.Sprintf("value%d", i))
+	}
+	b.Delete("key0005")
+
+	it := b.Items()
+	defer it.Close()
+	for i := 0; i < 3; i++ {
+		if !it.Next() {
+			t.Fatalf("Expected more keys, got:%v", it.Err())
+		}
+	}
+	assertString(t, it.Key(), "key0002")
+
+	merged := make(chan error)
+	go func() { merged <- b.Merge() }()
+
+	// the writes made after the creation of the iterator are not seen
+	b.Put("key0010", "changed")
+	b.Delete("key0020")
+	b.Put("key9999", "new")
+
+	count := 3
+	prev := it.Key()
+	for it.Next() {
+		if it.Key() <= prev {
+			t.Fatalf("Expected ascending keys, got:%s after %s", it.Key(), prev)
+		}
+		prev = it.Key()
+		count++
+		var i int
+		fmt.Sscanf(it.Key(), "key%04d", &i)
+		assertString(t, it.Value(), fmt.Sprintf("value%d", i))
+	}
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+	if count != 2499 {
+		t.Errorf("got:%d keys, want:%d", count, 2499)
+	}
+	if err := <-merged; err != nil {
+		t.Fatal(err)
+	}
+
+	keys := b.Keys()
+	count = 0
+	for keys.Next() {
+		if keys.Key() == "key0005" || keys.Key() == "key0020" || keys.Value() != "" {
+			t.Errorf("got:%q=%q", keys.Key(), keys.Value())
+		}
+		count++
+	}
+	keys.Close()
+	if count != 2499 {
+		t.Errorf("got:%d keys, want:%d", count, 2499)
+	}
+
+	t.Run("merge waits for the open iterators", func(t *testing.T) {
+		b.Put("key0010", "again")
+		it := b.Keys()
+		it.Next()
+
+		go func() { merged <- b.Merge() }()
+		select {
+		case err := <-merged:
+			t.Fatalf("Expected merge to wait for the iterator, got:%v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		it.Close()
+		if err := <-merged; err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	b.Close()
+}
+
+func TestScan(t *testing.T) {
+	defer os.RemoveAll(testBitcaskPath)
+
+	for _, kind := range []KeyDirKind{MapKeyDir, OrderedKeyDir} {
+		b, _ := Open(testBitcaskPath, ReadWrite, WithKeyDir(kind))
+		for _, key := range []string{"user:1:profile", "user:1:posts", "user:2:profile", "user", "users", "a"} {
+			b.Put(key, "value of "+key)
+		}
+		for i := 0; i < 1500; i++ {
+			b.Put(fmt.Sprintf("log:%04d", i), fmt.Sprintf("entry%d", i))
+		}
+		b.Delete("log:0007")
+
+		scan := func(prefix string) []string {
+			var keys []string
+			it := b.Scan(prefix)
+			defer it.Close()
+			for it.Next() {
+				if !strings.HasPrefix(it.Key(), prefix) {
+					t.Errorf("got:%s, want a key starting with %s", it.Key(), prefix)
+				}
+				keys = append(keys, it.Key())
+			}
+			if it.Err() != nil {
+				t.Fatal(it.Err())
+			}
+			return keys
+		}
+
+		got := scan("user:")
+		if !reflect.DeepEqual(got, []string{"user:1:posts", "user:1:profile", "user:2:profile"}) {
+			t.Errorf("kind %d got:%v", kind, got)
+		}
+
+		it := b.Scan("user:1:")
+		it.Next()
+		assertString(t, it.Value(), "value of user:1:posts")
+		b.Put("user:1:settings", "new")
+		b.Put("user:1:profile", "changed")
+		it.Next()
+		assertString(t, it.Value(), "value of user:1:profile")
+		if it.Next() {
+			t.Errorf("Expected the new key to be skipped, got:%s", it.Key())
+		}
+		it.Close()
+
+		logs := scan("log:")
+		if len(logs) != 1499 || !sort.StringsAreSorted(logs) {
+			t.Errorf("kind %d got:%d sorted:%v", kind, len(logs), sort.StringsAreSorted(logs))
+		}
+		if got := scan(""); len(got) != 1499+7 {
+			t.Errorf("kind %d got:%d keys, want:%d", kind, len(got), 1499+7)
+		}
+		if got := scan("nothing"); len(got) != 0 {
+			t.Errorf("kind %d got:%v", kind, got)
+		}
+
+		b.Close()
+		os.RemoveAll(testBitcaskPath)
+	}
+}
+
+func TestHintMismatch(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	for i := 0; i < 100; i++ {
+		b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+	b.Close()
+	b, _ = Open(testBitcaskPath, ReadWrite)
+	b.Merge()
+	b.Close()
+	hints, _ := filepath.Glob(path.Join(testBitcaskPath, "*.hint"))
+	if len(hints) != 1 {
+		t.Fatalf("got:%v, want a single hint file", hints)
+	}
+	hint := hints[0]
+
+	reopen := func(t *testing.T) {
+		t.Helper()
+		os.Remove(path.Join(testBitcaskPath, "keydir"))
+		b, err := Open(testBitcaskPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			value, _ := b.Get(fmt.Sprintf("key%d", i))
+			assertString(t, value, fmt.Sprintf("value%d", i))
+		}
+		if _, err := b.Get("ghost"); err == nil {
+			t.Errorf("Expected the hint entry past the data file to be ignored")
+		}
+		b.Close()
+	}
+
+	original, _ := os.ReadFile(hint)
+	t.Run("hint entry past the end of the data file", func(t *testing.T) {
+		ghost := recfmt.CompressHintFileRec("ghost", recfmt.KeyDirRec{ValuePos: 1 << 20, ValueSize: 5, Tstamp: math.MaxInt64})
+		os.WriteFile(hint, append(original, ghost...), 0666)
+		reopen(t)
+	})
+
+	t.Run("truncated hint entry", func(t *testing.T) {
+		os.WriteFile(hint, append(original, "garbage"...), 0666)
+		reopen(t)
+	})
+	os.RemoveAll(testBitcaskPath)
+}
+
+func TestKeyDirFileRemovedOnWrite(t *testing.T) {
+	keyDirPath := path.Join(testBitcaskPath, "keydir")
+	b, _ := Open(testBitcaskPath, ReadWrite)
+	b.Put("key12", "value12345")
+	b.Close()
+	b, _ = Open(testBitcaskPath)
+	b.Close()
+
+	b, _ = Open(testBitcaskPath, ReadWrite)
+	if _, err := os.Stat(keyDirPath); err != nil {
+		t.Fatalf("Expected the keydir file to be kept until the first write, got:%v", err)
+	}
+	b.Put("key13", "value13")
+	if _, err := os.Stat(keyDirPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the keydir file to be removed by the first write, got:%v", err)
+	}
+	b.Close()
+
+	b, _ = Open(testBitcaskPath)
+	value, _ := b.Get("key13")
+	assertString(t, value, "value13")
+	b.Close()
+	if _, err := os.Stat(keyDirPath); err != nil {
+		t.Errorf("Expected the keydir file to be shared again by the next reader, got:%v", err)
+	}
+	os.RemoveAll(testBitcaskPath)
+}
+
+// TestNoIgnoredErrors is an errcheck-style guard over the core packages,
+// it fails whenever a call known to return an I/O error is used as a bare statement.
+func TestNoIgnoredErrors(t *testing.T) {
+	mustCheck := map[string]bool{
+		"Put": true, "Delete": true, "Merge": true, "Sync": true,
+		"WriteData": true, "WriteHint": true, "Write": true, "ReadAt": true,
+		"share": true, "deleteOldFiles": true, "Remove": true, "Truncate": true,
+	}
+	dirs := []string{".", "../../internal/datastore", "../../internal/keydir", "../../internal/sio"}
+
+	for _, dir := range dirs {
+		fset := token.NewFileSet()
+		pkgs, err := parser.ParseDir(fset, dir, func(fi fs.FileInfo) bool {
+			return !strings.HasSuffix(fi.Name(), "_test.go")
+		}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, pkg := range pkgs {
+			ast.Inspect(pkg, func(n ast.Node) bool {
+				stmt, ok := n.(*ast.ExprStmt)
+				if !ok {
+					return true
+				}
+				call, ok := stmt.X.(*ast.CallExpr)
+				if !ok {
+					return true
+				}
+				sel, ok := call.Fun.(*ast.SelectorExpr)
+				if !ok || !mustCheck[sel.Sel.Name] {
+					return true
+				}
+				// the keydir methods work in memory and return no error
+				if recv, ok := sel.X.(*ast.SelectorExpr); ok && recv.Sel.Name == "keyDir" {
+					return true
+				}
+				t.Errorf("%s: result of %s is ignored", fset.Position(call.Pos()), sel.Sel.Name)
+				return true
+			})
+		}
+	}
+}
+
+// testClock is a deterministic clock advancing one microsecond per reading.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.now = c.now.Add(time.Microsecond)
+	return c.now
+}
+
+// hookClock is a test clock calling hook, when set, on every reading.
+type hookClock struct {
+	testClock
+	hook func()
+}
+
+func (c *hookClock) Now() time.Time {
+	if c.hook != nil {
+		c.hook()
+	}
+	return c.testClock.Now()
+}
+
+func keyDirRec(b *Bitcask, key string) recfmt.KeyDirRec {
+	rec, _ := b.keyDir.Get(key)
+	return rec
+}
+
+func assertError(t testing.TB, err error, want string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("Expected Error %q", want)
+	}
+	assertString(t, err.Error(), want)
+}
+
+func assertString(t testing.TB, got, want string) {
+	t.Helper()
+	if got != want {
+		t.Errorf("got:\n%q\nwant:\n%q", got, want)
+	}
+}
@@ -0,0 +1,31 @@
+package bitcask
+
+// The byte-slice variants convert from and to the strings of Get, Put and Delete,
+// so they copy the key and the value once more than the string API does.
+// They spare the conversions to the callers holding binary keys and values,
+// not the copies.
+
+// GetBytes retrieves the value by key as a byte slice owned by the caller.
+// Values are stored as raw bytes, so any binary payload reads back unchanged.
+// Return an error if key does not exist in the bitcask datastore.
+func (b *Bitcask) GetBytes(key []byte) ([]byte, error) {
+	value, err := b.Get(string(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(value), nil
+}
+
+// PutBytes stores a value by key in a bitcask datastore,
+// key and value may be modified by the caller once it returns.
+// Return an error on any system failure when writing the data.
+func (b *Bitcask) PutBytes(key, value []byte) error {
+	return b.Put(string(key), string(value))
+}
+
+// DeleteBytes removes a key from a bitcask datastore.
+// Return an error if key does not exist in the bitcask datastore.
+func (b *Bitcask) DeleteBytes(key []byte) error {
+	return b.Delete(string(key))
+}
@@ -0,0 +1,94 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+)
+
+// GetVersion returns the value stored by key along with its version, the timestamp
+// of its record in microseconds, to be passed to CompareAndSwap.
+// Return an error if key does not exist in the bitcask datastore.
+func (b *Bitcask) GetVersion(key string) (string, int64, error) {
+	b.startRead()
+	defer b.endRead()
+
+	rec, isExist := b.keyDir.Get(key)
+	if !isExist || b.expired(rec) {
+		return "", 0, datastore.KeyError(key, datastore.ErrKeyNotExist)
+	}
+	value, err := b.readValue(key, rec, b.shouldVerify())
+	if err != nil {
+		return "", 0, err
+	}
+
+	return value, rec.Tstamp, nil
+}
+
+// CompareAndSwap stores value by key only if the version of the key is still version,
+// as returned by GetVersion, or if the key does not exist and version is 0.
+// The metadata of the previous value is kept. The version is checked and the value written
+// under the write lock, so of concurrent swaps from the same version only one succeeds.
+// Return whether the value was stored, or an error on any system failure when writing the data.
+func (b *Bitcask) CompareAndSwap(key, value string, version int64) (bool, error) {
+	if b.usrOpts.accessPermission == ReadOnly {
+		return false, fmt.Errorf("CompareAndSwap: %w", ErrReadOnly)
+	}
+
+	err := b.usrOpts.keyValidator(key)
+	if err != nil {
+		return false, fmt.Errorf("CompareAndSwap: %w", err)
+	}
+
+	b.accessMu.Lock()
+	defer b.accessMu.Unlock()
+	tstamp := b.usrOpts.clock.Now().UnixMicro()
+
+	if b.frozen {
+		return false, fmt.Errorf("CompareAndSwap: %w", ErrFrozen)
+	}
+
+	cur := int64(0)
+	var meta map[string]string
+	if rec, isExist := b.keyDir.Get(key); isExist && !b.expired(rec) {
+		data, err := b.readRecord(key, rec, b.shouldVerify())
+		if err != nil && !errors.Is(err, datastore.ErrKeyNotExist) {
+			return false, err
+		}
+		if err == nil {
+			cur = rec.Tstamp
+			meta = data.Meta
+		}
+	}
+	if cur != version {
+		return false, nil
+	}
+
+	err = b.store(key, value, meta, tstamp)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// GetVersion returns the value and version of key from the partition owning the key.
+func (p *Partitioned) GetVersion(key string) (string, int64, error) {
+	b, err := p.partition(key)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return b.GetVersion(key)
+}
+
+// CompareAndSwap swaps the value of key in the partition owning the key.
+func (p *Partitioned) CompareAndSwap(key, value string, version int64) (bool, error) {
+	b, err := p.partition(key)
+	if err != nil {
+		return false, err
+	}
+
+	return b.CompareAndSwap(key, value, version)
+}
@@ -0,0 +1,171 @@
+package bitcask
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+// checkChunk is the size of the reads of Check, the throttle waits between them.
+const checkChunk = 1 << 20
+
+type (
+	// CheckOptions tunes the work of Check.
+	CheckOptions struct {
+		// Workers is the number of data files checked in parallel, it defaults to the number of CPUs.
+		Workers int
+		// BytesPerSecond bounds the rate the data files are read at, all workers included,
+		// so that a check does not starve the other users of the disk. 0 means no limit.
+		BytesPerSecond int64
+	}
+
+	// CheckResult reports the records validated by Check and the corruptions it found.
+	CheckResult struct {
+		// Files is the number of data files checked.
+		Files int
+		// Records is the number of records whose checksum was validated.
+		Records int
+		// Bytes is the size in bytes of the data files checked.
+		Bytes int64
+		// Corruptions locates the first corrupted record of every corrupted data file,
+		// ordered by file name. The records after it cannot be located reliably.
+		Corruptions []*CorruptionError
+	}
+
+	// throttle bounds the rate of the reads shared by several workers.
+	throttle struct {
+		mu    sync.Mutex
+		rate  int64
+		start time.Time
+		bytes int64
+	}
+)
+
+// Check validates the checksum of every record of every data file, without the keydir,
+// checking several files in parallel as set by opts.
+// It runs alongside the other operations, the files removed by a concurrent merge are skipped.
+// Return the corruptions found in the result, and an error on system failures.
+func (b *Bitcask) Check(opts CheckOptions) (CheckResult, error) {
+	var res CheckResult
+
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	entries, err := os.ReadDir(b.dataStore.Path())
+	if err != nil {
+		return res, err
+	}
+	files := make(chan string)
+	go func() {
+		defer close(files)
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), ".data") {
+				files <- entry.Name()
+			}
+		}
+	}()
+
+	active := ""
+	if b.activeFile != nil {
+		b.accessMu.Lock()
+		active = b.activeFile.Name()
+		b.accessMu.Unlock()
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	t := &throttle{rate: opts.BytesPerSecond, start: time.Now()}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range files {
+				records, size, corruption, checkErr := b.checkFile(name, name == active, t)
+				mu.Lock()
+				if checkErr != nil && err == nil {
+					err = checkErr
+				}
+				if checkErr == nil {
+					res.Files++
+					res.Records += records
+					res.Bytes += size
+					if corruption != nil {
+						res.Corruptions = append(res.Corruptions, corruption)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if err != nil {
+		return res, err
+	}
+
+	sort.Slice(res.Corruptions, func(i, j int) bool { return res.Corruptions[i].File < res.Corruptions[j].File })
+
+	return res, nil
+}
+
+// checkFile validates the records of a single data file.
+// A record cut at the end of the active file is being written, it is not a corruption.
+// Return the number of valid records, the size of the file and the first corruption, if any.
+func (b *Bitcask) checkFile(name string, active bool, t *throttle) (int, int64, *CorruptionError, error) {
+	f, err := os.Open(path.Join(b.dataStore.Path(), name))
+	if os.IsNotExist(err) {
+		// the file was removed by a merge since the directory was listed
+		return 0, 0, nil, nil
+	}
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, 0)
+	chunk := make([]byte, checkChunk)
+	for {
+		n, err := f.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+		t.wait(int64(n))
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, nil, err
+		}
+	}
+
+	records := 0
+	offset, err := recfmt.ScanDataFile(buf, func(*recfmt.DataRec, uint32) {
+		records++
+	})
+	if err == nil || (active && errors.Is(err, io.ErrUnexpectedEOF)) {
+		return records, int64(len(buf)), nil, nil
+	}
+
+	return records, int64(len(buf)), &CorruptionError{File: name, Offset: int64(offset)}, nil
+}
+
+// wait blocks until reading n more bytes keeps the reads under the rate of the throttle.
+func (t *throttle) wait(n int64) {
+	if t.rate <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	t.bytes += n
+	due := t.start.Add(time.Duration(float64(t.bytes) / float64(t.rate) * float64(time.Second)))
+	t.mu.Unlock()
+
+	time.Sleep(time.Until(due))
+}
@@ -0,0 +1,57 @@
+package bitcask
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/keydir"
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+// nextTstamp returns the timestamp of the next written record.
+// The timestamps are kept strictly increasing, writes in the same microsecond
+// would tie when the keydir is rebuilt and a clock that goes backwards would make
+// new records lose to stale ones, so such timestamps are bumped past the last one.
+// The clock going backwards is logged once per jump and counted in ClockSkews.
+// It is called with the write lock held, the writers read the clock once they hold it
+// so that a write waiting for the lock is not taken for the clock going backwards.
+func (b *Bitcask) nextTstamp(tstamp int64) int64 {
+	if tstamp < b.lastClock {
+		if !b.skewed {
+			log.Printf("bitcask: clock went backwards by %v, timestamps are bumped past the last record",
+				time.Duration(b.lastClock-tstamp)*time.Microsecond)
+		}
+		b.skewed = true
+		atomic.AddUint64(&b.clockSkews, 1)
+	} else {
+		b.skewed = false
+		b.lastClock = tstamp
+	}
+
+	if tstamp <= b.lastTstamp {
+		tstamp = b.lastTstamp + 1
+	}
+	b.lastTstamp = tstamp
+
+	return tstamp
+}
+
+// ClockSkews returns the number of writes since the bitcask was opened
+// whose timestamp had to be bumped because the clock went backwards.
+func (b *Bitcask) ClockSkews() uint64 {
+	return atomic.LoadUint64(&b.clockSkews)
+}
+
+// latestTstamp returns the timestamp of the newest record in the keydir.
+func latestTstamp(keyDir keydir.KeyDir) int64 {
+	var latest int64
+	keyDir.Iterate(func(_ string, rec recfmt.KeyDirRec) bool {
+		if rec.Tstamp > latest {
+			latest = rec.Tstamp
+		}
+		return true
+	})
+
+	return latest
+}
@@ -0,0 +1,86 @@
+package bitcask
+
+import (
+	"crypto/sha256"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+// WithDedup makes the bitcask store identical values of at least minSize bytes once.
+// A value whose SHA-256 hash matches a value written since the bitcask was opened
+// or merged is written as a reference to the record storing it, about 40 bytes
+// along with the key. Merge counts the references of every value it rewrites:
+// it stores each value still referenced by a live key once, shares the values
+// stored before the bitcask was opened, and drops the values no key references anymore.
+// The values written with metadata, in a batch or by PutImmutable are always stored whole.
+func WithDedup(minSize int) Option {
+	return optionFunc(func(o *options) {
+		o.dedup = true
+		o.dedupMinSize = minSize
+	})
+}
+
+// dedupable reports whether the value is shared with an identical value under WithDedup.
+func (b *Bitcask) dedupable(value string, meta map[string]string) bool {
+	return b.usrOpts.dedup && len(meta) == 0 && len(value) >= b.usrOpts.dedupMinSize
+}
+
+// writeValue appends the record of the key to the file. A dedupable value found in shared
+// is written as a reference to the record storing it, otherwise the value is stored
+// and recorded in shared. shared is nil when the values are not deduplicated.
+// The values of immutable records are always stored whole, tombstones have no value.
+// Return the position of the record, the size of its value as stored and whether it is a reference.
+func (b *Bitcask) writeValue(f *datastore.AppendFile, shared map[[sha256.Size]byte]recfmt.ValueRef,
+	key, value string, meta map[string]string, kind recordKind, tstamp int64) (int, uint32, bool, error) {
+	switch kind {
+	case tombstoneRecord:
+		n, err := f.WriteTombstone(key, tstamp)
+		return n, 0, false, err
+	case immutableRecord:
+		n, err := f.WriteImmutable(key, value, meta, tstamp)
+		return n, recfmt.StoredValueSize(value, meta), false, err
+	}
+	if shared == nil || !b.dedupable(value, meta) {
+		n, err := f.WriteData(key, value, meta, tstamp)
+		return n, recfmt.StoredValueSize(value, meta), false, err
+	}
+
+	sum := sha256.Sum256([]byte(value))
+	if ref, isExist := shared[sum]; isExist {
+		n, err := f.WriteRef(key, ref, tstamp)
+		return n, recfmt.RefSize(ref), true, err
+	}
+
+	n, err := f.WriteData(key, value, nil, tstamp)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	shared[sum] = recfmt.ValueRef{FileId: f.Name(), Key: key, ValuePos: uint32(n), ValueSize: uint32(len(value))}
+
+	return n, uint32(len(value)), false, nil
+}
+
+// sharesOldValue reports whether the record of a key of the active file references
+// a value stored in another file, which a merge may remove.
+// It is called with the access lock held.
+func (b *Bitcask) sharesOldValue(key string, rec recfmt.KeyDirRec) bool {
+	if !b.usrOpts.dedup {
+		return false
+	}
+
+	data, err := b.dataStore.ReadRecordFromFile(rec.FileId, key, rec.ValuePos, rec.ValueSize, false)
+
+	return err == nil && data.Ref != nil && data.Ref.FileId != b.activeFile.Name()
+}
+
+// keepActiveShared adds the values of the bitcask stored in the active file to shared,
+// the merge in progress may remove the files of the other values.
+// It is called with the access lock held.
+func (b *Bitcask) keepActiveShared(shared map[[sha256.Size]byte]recfmt.ValueRef) {
+	for sum, ref := range b.shared {
+		if _, isExist := shared[sum]; !isExist && ref.FileId == b.activeFile.Name() {
+			shared[sum] = ref
+		}
+	}
+}
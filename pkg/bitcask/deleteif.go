@@ -0,0 +1,70 @@
+package bitcask
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+)
+
+// DeleteIf removes key if cond holds for its current value and keydir metadata.
+// The key is read, checked and removed under the write lock, so no concurrent write
+// can change it in between. cond must not call the methods of the bitcask.
+// Return whether the key was removed, or an error if key does not exist
+// in the bitcask datastore or on any system failure.
+func (b *Bitcask) DeleteIf(key string, cond func(value string, meta KeyMeta) bool) (bool, error) {
+	if b.usrOpts.accessPermission == ReadOnly {
+		return false, fmt.Errorf("DeleteIf: %w", ErrReadOnly)
+	}
+
+	b.accessMu.Lock()
+	defer b.accessMu.Unlock()
+	tstamp := b.usrOpts.clock.Now().UnixMicro()
+
+	if b.frozen {
+		return false, fmt.Errorf("DeleteIf: %w", ErrFrozen)
+	}
+
+	rec, isExist := b.keyDir.Get(key)
+	if !isExist || b.expired(rec) {
+		return false, datastore.KeyError(key, datastore.ErrKeyNotExist)
+	}
+	value, err := b.readValue(key, rec, b.shouldVerify())
+	if err != nil {
+		return false, err
+	}
+	if !cond(value, newKeyMeta(rec)) {
+		return false, nil
+	}
+
+	err = b.storeTombstone(key, tstamp)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// DeleteIfValue removes key if its current value is expected.
+func (b *Bitcask) DeleteIfValue(key, expected string) (bool, error) {
+	return b.DeleteIf(key, func(value string, _ KeyMeta) bool {
+		return value == expected
+	})
+}
+
+// DeleteIfOlderThan removes key if its current value was written before t.
+func (b *Bitcask) DeleteIfOlderThan(key string, t time.Time) (bool, error) {
+	return b.DeleteIf(key, func(_ string, meta KeyMeta) bool {
+		return meta.Tstamp.Before(t)
+	})
+}
+
+// DeleteIf removes key from the partition owning the key if cond holds.
+func (p *Partitioned) DeleteIf(key string, cond func(value string, meta KeyMeta) bool) (bool, error) {
+	b, err := p.partition(key)
+	if err != nil {
+		return false, err
+	}
+
+	return b.DeleteIf(key, cond)
+}
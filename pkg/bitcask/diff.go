@@ -0,0 +1,112 @@
+package bitcask
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+// KeyDiff lists the keys changed between two datastores, every list in ascending order.
+type KeyDiff struct {
+	// Added are the keys missing from the first datastore.
+	Added []string
+	// Updated are the keys whose value or metadata changed.
+	Updated []string
+	// Deleted are the keys missing from the second datastore.
+	Deleted []string
+}
+
+// Diff lists the keys added, updated and deleted from the datastore from to the datastore to,
+// such as a snapshot opened by OpenSnapshot and the current bitcask, to copy only the changes
+// to a backup or a replica. The deleted and expired keys count as missing. The keydirs of both
+// datastores are copied at once, then the records that differ are read and compared by value
+// and metadata: a key written again with the same value is not reported.
+// Return an error on system failures when reading the records.
+func Diff(from, to *Bitcask) (KeyDiff, error) {
+	var res KeyDiff
+
+	fromSnap, fromEntries := from.copyKeyDir()
+	defer from.closeSnapshot(fromSnap)
+	toSnap, toEntries := to.copyKeyDir()
+	defer to.closeSnapshot(toSnap)
+
+	toRecs := make(map[string]recfmt.KeyDirRec, len(toEntries))
+	for _, entry := range toEntries {
+		toRecs[entry.key] = entry.rec
+	}
+
+	for _, entry := range fromEntries {
+		toRec, inTo := toRecs[entry.key]
+		delete(toRecs, entry.key)
+		if inTo && toRec == entry.rec {
+			continue
+		}
+
+		fromData, err := from.liveRecord(entry.key, entry.rec)
+		if err != nil {
+			return KeyDiff{}, err
+		}
+		var toData *recfmt.DataRec
+		if inTo {
+			toData, err = to.liveRecord(entry.key, toRec)
+			if err != nil {
+				return KeyDiff{}, err
+			}
+		}
+
+		switch {
+		case fromData == nil && toData != nil:
+			res.Added = append(res.Added, entry.key)
+		case fromData != nil && toData == nil:
+			res.Deleted = append(res.Deleted, entry.key)
+		case fromData != nil && !sameValue(fromData, toData):
+			res.Updated = append(res.Updated, entry.key)
+		}
+	}
+
+	for key, rec := range toRecs {
+		data, err := to.liveRecord(key, rec)
+		if err != nil {
+			return KeyDiff{}, err
+		}
+		if data != nil {
+			res.Added = append(res.Added, key)
+		}
+	}
+
+	sort.Strings(res.Added)
+	sort.Strings(res.Updated)
+	sort.Strings(res.Deleted)
+
+	return res, nil
+}
+
+// liveRecord reads the record of the key, nil if the key is deleted or expired.
+func (b *Bitcask) liveRecord(key string, rec recfmt.KeyDirRec) (*recfmt.DataRec, error) {
+	if b.expired(rec) {
+		return nil, nil
+	}
+
+	data, err := b.readRecord(key, rec, b.shouldVerify())
+	if errors.Is(err, datastore.ErrKeyNotExist) {
+		return nil, nil
+	}
+
+	return data, err
+}
+
+// sameValue reports whether both records hold the same value and metadata.
+func sameValue(a, b *recfmt.DataRec) bool {
+	if a.Value != b.Value || len(a.Meta) != len(b.Meta) {
+		return false
+	}
+	for name, value := range a.Meta {
+		if other, isExist := b.Meta[name]; !isExist || other != value {
+			return false
+		}
+	}
+
+	return true
+}
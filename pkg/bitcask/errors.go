@@ -0,0 +1,25 @@
+package bitcask
+
+import (
+	"errors"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+// The errors returned by the bitcask wrap these sentinel errors,
+// they are meant to be checked with errors.Is rather than by their message.
+var (
+	// ErrKeyNotFound happens whenever the requested key does not exist or was deleted.
+	ErrKeyNotFound = datastore.ErrKeyNotExist
+
+	// ErrReadOnly happens whenever a bitcask opened without write permission is written.
+	ErrReadOnly = errors.New("require write permission")
+
+	// ErrLocked happens whenever Open finds the datastore locked by another bitcask,
+	// a writer excludes any other bitcask while readers only exclude writers.
+	ErrLocked = datastore.ErrLocked
+
+	// ErrValueTooLarge happens whenever a value along with its metadata exceeds MaxValueSize.
+	ErrValueTooLarge = recfmt.ErrValueTooLarge
+)
@@ -0,0 +1,49 @@
+package bitcask
+
+import (
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/events"
+)
+
+const (
+	// RotationEvent is published whenever a new active data file is created,
+	// with the name of the file.
+	RotationEvent = events.Rotation
+	// MergeEvent is published whenever a merge finishes, with its error if it failed.
+	MergeEvent = events.Merge
+	// CorruptionEvent is published whenever a read detects a corrupted record,
+	// with its key and the CorruptionError.
+	CorruptionEvent = events.Corruption
+	// EvictionEvent is published whenever a key is evicted by the memory limit, with the key.
+	EvictionEvent = events.Eviction
+)
+
+type (
+	// Event represents an activity of the datastore.
+	Event = events.Event
+
+	// EventKind represents the type of an event.
+	EventKind = events.Kind
+)
+
+// Subscribe returns a channel receiving the events of the given kinds, or of every kind
+// if none is given, buffered to hold buffer events.
+// The events are published without blocking the datastore, so the events arriving
+// while the channel is full are dropped and counted in DroppedEvents.
+// The returned function cancels the subscription and closes the channel.
+func (b *Bitcask) Subscribe(buffer int, kinds ...EventKind) (<-chan Event, func()) {
+	return b.events.Subscribe(buffer, kinds...)
+}
+
+// DroppedEvents returns the number of events not delivered to a subscriber with a full channel.
+func (b *Bitcask) DroppedEvents() uint64 {
+	return b.events.Dropped()
+}
+
+// publish stamps the event with the current time and publishes it.
+// The time is read from the system clock, so publishing does not advance the clock of WithClock.
+func (b *Bitcask) publish(e Event) {
+	e.Time = time.Now()
+	b.events.Publish(e)
+}
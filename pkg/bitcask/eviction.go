@@ -0,0 +1,217 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+const (
+	// NoEviction rejects the writes of new keys with ErrOutOfMemory once the limit is reached.
+	NoEviction EvictionPolicy = 0
+	// AllKeysLRU evicts the least recently accessed keys.
+	AllKeysLRU EvictionPolicy = 1
+	// AllKeysLFU evicts the least frequently written keys.
+	AllKeysLFU EvictionPolicy = 2
+	// AllKeysRandom evicts random keys.
+	AllKeysRandom EvictionPolicy = 3
+
+	// evictionSamples is the number of keys sampled to pick each evicted key,
+	// the LRU and LFU policies are approximated the same way redis does.
+	evictionSamples = 5
+)
+
+// ErrOutOfMemory happens whenever a new key is written past the memory limit under NoEviction.
+var ErrOutOfMemory = errors.New("keydir exceeds the memory limit")
+
+// EvictionPolicy specifies which keys are evicted when the memory limit is reached.
+type EvictionPolicy int
+
+// evictionPolicies holds the eviction policies by their redis names.
+var evictionPolicies = map[string]EvictionPolicy{
+	"noeviction":     NoEviction,
+	"allkeys-lru":    AllKeysLRU,
+	"allkeys-lfu":    AllKeysLFU,
+	"allkeys-random": AllKeysRandom,
+}
+
+// WithMaxMemory limits the memory used by the keydir, as estimated by MemoryUsage, to limit bytes.
+// Once the limit is reached the writes of new keys are either rejected or make room
+// by deleting other keys according to the policy.
+// The LRU and LFU policies enable the access tracking of WithAccessTracking.
+// A limit of zero, the default, disables the limit.
+func WithMaxMemory(limit int64, policy EvictionPolicy) Option {
+	return optionFunc(func(o *options) {
+		o.maxMemory = limit
+		o.evictionPolicy = policy
+	})
+}
+
+// ParseEvictionPolicy returns the eviction policy with the given redis name,
+// one of noeviction, allkeys-lru, allkeys-lfu and allkeys-random.
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	policy, isExist := evictionPolicies[name]
+	if !isExist {
+		return 0, fmt.Errorf("unsupported eviction policy %q", name)
+	}
+
+	return policy, nil
+}
+
+// String returns the redis name of the eviction policy.
+func (p EvictionPolicy) String() string {
+	for name, policy := range evictionPolicies {
+		if policy == p {
+			return name
+		}
+	}
+
+	return fmt.Sprintf("EvictionPolicy(%d)", int(p))
+}
+
+// SetMaxMemory changes the memory limit and the eviction policy of an open bitcask,
+// keys are evicted on the next write if the new limit is already exceeded.
+func (b *Bitcask) SetMaxMemory(limit int64, policy EvictionPolicy) {
+	b.accessMu.Lock()
+	defer b.accessMu.Unlock()
+
+	b.usrOpts.maxMemory = limit
+	b.usrOpts.evictionPolicy = policy
+	if (policy == AllKeysLRU || policy == AllKeysLFU) && b.access.Load() == nil {
+		b.access.Store(newAccessTracker())
+	}
+}
+
+// MaxMemory returns the memory limit and the eviction policy.
+func (b *Bitcask) MaxMemory() (int64, EvictionPolicy) {
+	b.startRead()
+	defer b.endRead()
+
+	return b.usrOpts.maxMemory, b.usrOpts.evictionPolicy
+}
+
+// checkMemory rejects the write of a new key that does not fit under NoEviction.
+// It is called with the access lock held.
+func (b *Bitcask) checkMemory(key string) error {
+	if b.usrOpts.maxMemory <= 0 || b.usrOpts.evictionPolicy != NoEviction {
+		return nil
+	}
+
+	if _, isExist := b.keyDir.Get(key); isExist {
+		return nil
+	}
+	if b.keyDirBytes+keyDirEntrySize+int64(len(key)) > b.usrOpts.maxMemory {
+		return datastore.KeyError(key, ErrOutOfMemory)
+	}
+
+	return nil
+}
+
+// evict deletes keys other than the given one until the keydir fits in the memory limit.
+// It is called with the access lock held.
+func (b *Bitcask) evict(key string, tstamp int64) error {
+	if b.usrOpts.maxMemory <= 0 || b.usrOpts.evictionPolicy == NoEviction {
+		return nil
+	}
+
+	for b.keyDirBytes > b.usrOpts.maxMemory && b.keyDir.Len() > 1 {
+		victim := b.evictionVictim(key)
+
+		err := b.put(victim, "", nil, tombstoneRecord, tstamp)
+		if err != nil {
+			return err
+		}
+		if b.prefixUsage != nil {
+			rec, _ := b.keyDir.Get(victim)
+			b.prefixUsage.remove(victim, rec)
+		}
+		b.keyDir.Delete(victim)
+		delete(b.deleted, victim)
+		b.keyDirBytes -= keyDirEntrySize + int64(len(victim))
+		atomic.AddUint64(&b.evictions, 1)
+		b.publish(Event{Kind: EvictionEvent, Key: victim})
+	}
+
+	return nil
+}
+
+// evictionVictim samples a few random keys other than the given one
+// and picks the one to evict according to the policy.
+func (b *Bitcask) evictionVictim(key string) string {
+	samples := evictionSamples
+	if b.usrOpts.evictionPolicy == AllKeysRandom {
+		samples = 1
+	}
+
+	victim := ""
+	var victimScore int64
+	pick := func(candidate string, rec recfmt.KeyDirRec) {
+		score := b.evictionScore(candidate, rec.Tstamp)
+		if victim == "" || score < victimScore {
+			victim = candidate
+			victimScore = score
+		}
+	}
+
+	// the keydir is not larger than the sample, every key is compared.
+	if b.keyDir.Len() <= samples+1 && samples > 1 {
+		b.keyDir.Iterate(func(candidate string, rec recfmt.KeyDirRec) bool {
+			if candidate != key {
+				pick(candidate, rec)
+			}
+			return true
+		})
+		return victim
+	}
+
+	for tries := 0; samples > 0 && tries < 2*evictionSamples; tries++ {
+		candidate, rec, isExist := b.keyDir.RandomKey()
+		if !isExist || candidate == key {
+			continue
+		}
+
+		pick(candidate, rec)
+		samples--
+	}
+	if victim != "" {
+		return victim
+	}
+
+	// the random picks kept hitting the given key, any other key will do.
+	b.keyDir.Iterate(func(candidate string, rec recfmt.KeyDirRec) bool {
+		victim = candidate
+		return candidate == key
+	})
+
+	return victim
+}
+
+// evictionScore ranks the keys for eviction, the key with the lowest score is evicted first.
+func (b *Bitcask) evictionScore(key string, tstamp int64) int64 {
+	tracker := b.access.Load()
+	if tracker == nil {
+		return 0
+	}
+
+	access, isExist := tracker.get(key)
+	switch b.usrOpts.evictionPolicy {
+	case AllKeysLRU:
+		if !isExist {
+			return time.UnixMicro(tstamp).Unix()
+		}
+		return access.lastAccess
+	case AllKeysLFU:
+		return int64(access.writes)
+	default:
+		return 0
+	}
+}
+
+// Evictions returns the number of keys evicted since the bitcask was opened.
+func (b *Bitcask) Evictions() uint64 {
+	return atomic.LoadUint64(&b.evictions)
+}
@@ -0,0 +1,53 @@
+package bitcask
+
+import "sync"
+
+type (
+	// flight coalesces concurrent reads of the same record into a single disk read.
+	flight struct {
+		mu    sync.Mutex
+		calls map[flightKey]*flightCall
+	}
+
+	// flightKey identifies a record by its position, a rewritten key
+	// gets a new position, so waiters never receive a value older than their lookup.
+	flightKey struct {
+		fileId string
+		pos    uint32
+	}
+
+	// flightCall is a read in progress shared by its waiters.
+	flightCall struct {
+		wg    sync.WaitGroup
+		value string
+		err   error
+	}
+)
+
+// do calls fn for the record once for all the concurrent callers with the same key
+// and returns its result to all of them.
+func (f *flight) do(key flightKey, fn func() (string, error)) (string, error) {
+	f.mu.Lock()
+	if f.calls == nil {
+		f.calls = make(map[flightKey]*flightCall)
+	}
+	if call, isExist := f.calls[key]; isExist {
+		f.mu.Unlock()
+		call.wg.Wait()
+		return call.value, call.err
+	}
+
+	call := &flightCall{}
+	call.wg.Add(1)
+	f.calls[key] = call
+	f.mu.Unlock()
+
+	call.value, call.err = fn()
+	call.wg.Done()
+
+	f.mu.Lock()
+	delete(f.calls, key)
+	f.mu.Unlock()
+
+	return call.value, call.err
+}
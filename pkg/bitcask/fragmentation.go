@@ -0,0 +1,125 @@
+package bitcask
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+// fragmentationHotKeys is the number of most overwritten keys reported per data file.
+const fragmentationHotKeys = 3
+
+type (
+	// FileFragmentation reports how much of a data file is still in use.
+	FileFragmentation struct {
+		// File is the name of the data file.
+		File string
+		// LiveRecords is the number of records still referenced by the keydir.
+		LiveRecords int
+		// DeadRecords is the number of overwritten or deleted records and tombstones.
+		DeadRecords int
+		// LiveBytes is the size in bytes of the live records.
+		LiveBytes int64
+		// DeadBytes is the size in bytes of the dead records, reclaimed by a merge.
+		DeadBytes int64
+		// HotKeys are the keys written the most times to the file, ignoring keys written once.
+		HotKeys []HotKey
+	}
+
+	// HotKey represents a key written several times.
+	HotKey struct {
+		Key    string
+		Writes int
+	}
+)
+
+// AnalyzeFragmentation reports the live and dead records of every data file,
+// ordered by file name, without rewriting anything.
+// It helps deciding whether a merge is worth it.
+// Return an error on system failures.
+func (b *Bitcask) AnalyzeFragmentation() ([]FileFragmentation, error) {
+	entries, err := os.ReadDir(b.dataStore.Path())
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]FileFragmentation, 0)
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".data") {
+			continue
+		}
+
+		frag, err := b.analyzeFile(entry.Name())
+		if os.IsNotExist(err) {
+			// the file was removed by a merge since the directory was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, frag)
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].File < res[j].File })
+
+	return res, nil
+}
+
+// analyzeFile reports the fragmentation of a single data file.
+// A partially written record at the end of the file is ignored.
+func (b *Bitcask) analyzeFile(name string) (FileFragmentation, error) {
+	frag := FileFragmentation{File: name}
+
+	data, err := os.ReadFile(path.Join(b.dataStore.Path(), name))
+	if err != nil {
+		return frag, err
+	}
+
+	writes := make(map[string]int)
+
+	b.startRead()
+	i := 0
+	for i < len(data) {
+		recLen, err := recfmt.DataFileRecLen(data[i:])
+		if err != nil {
+			break
+		}
+		rec, _, err := recfmt.ParseDataFileRec(data[i : i+int(recLen)])
+		if err != nil {
+			break
+		}
+
+		cur, isExist := b.keyDir.Get(rec.Key)
+		live := isExist && cur.FileId == name && cur.ValuePos == uint32(i) && !rec.Tombstone
+		if live {
+			frag.LiveRecords++
+			frag.LiveBytes += int64(recLen)
+		} else {
+			frag.DeadRecords++
+			frag.DeadBytes += int64(recLen)
+		}
+		writes[rec.Key]++
+		i += int(recLen)
+	}
+	b.endRead()
+
+	for key, n := range writes {
+		if n > 1 {
+			frag.HotKeys = append(frag.HotKeys, HotKey{Key: key, Writes: n})
+		}
+	}
+	sort.Slice(frag.HotKeys, func(i, j int) bool {
+		if frag.HotKeys[i].Writes != frag.HotKeys[j].Writes {
+			return frag.HotKeys[i].Writes > frag.HotKeys[j].Writes
+		}
+		return frag.HotKeys[i].Key < frag.HotKeys[j].Key
+	})
+	if len(frag.HotKeys) > fragmentationHotKeys {
+		frag.HotKeys = frag.HotKeys[:fragmentationHotKeys]
+	}
+
+	return frag, nil
+}
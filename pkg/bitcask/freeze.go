@@ -0,0 +1,44 @@
+package bitcask
+
+import "errors"
+
+// ErrFrozen happens whenever a write is attempted while the datastore is frozen.
+var ErrFrozen = errors.New("datastore is frozen")
+
+// Freeze rejects the writes with ErrFrozen until Unfreeze is called, reads are still served.
+// It waits for the writes in progress to finish, so once it returns the datastore
+// files are not modified anymore, which makes it suitable to take backups or hand over the datastore.
+func (b *Bitcask) Freeze() {
+	b.accessMu.Lock()
+	b.frozen = true
+	b.accessMu.Unlock()
+}
+
+// Unfreeze accepts the writes again after a Freeze.
+func (b *Bitcask) Unfreeze() {
+	b.accessMu.Lock()
+	b.frozen = false
+	b.accessMu.Unlock()
+}
+
+// Frozen reports whether the datastore is frozen.
+func (b *Bitcask) Frozen() bool {
+	b.startRead()
+	defer b.endRead()
+
+	return b.frozen
+}
+
+// Freeze freezes all partitions.
+func (p *Partitioned) Freeze() {
+	for _, b := range p.parts {
+		b.Freeze()
+	}
+}
+
+// Unfreeze unfreezes all partitions.
+func (p *Partitioned) Unfreeze() {
+	for _, b := range p.parts {
+		b.Unfreeze()
+	}
+}
@@ -0,0 +1,49 @@
+package bitcask
+
+import (
+	"errors"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+)
+
+// GetManyConsistent reads the values of the given keys from a single consistent view
+// of the datastore: no write, batch or merge is applied in the middle of the reads,
+// so related keys written together by a batch are seen either all old or all new.
+// The missing keys are left out of the returned map.
+// Return an error on any system failure when reading the data.
+func (b *Bitcask) GetManyConsistent(keys []string) (map[string]string, error) {
+	res := make(map[string]string, len(keys))
+	var err error
+
+	b.startRead()
+	for _, key := range keys {
+		rec, isExist := b.keyDir.Get(key)
+		if !isExist || b.expired(rec) {
+			continue
+		}
+
+		var value string
+		value, err = b.readValue(key, rec, b.shouldVerify())
+		if errors.Is(err, datastore.ErrKeyNotExist) {
+			err = nil
+			continue
+		}
+		if err != nil {
+			break
+		}
+		res[key] = value
+	}
+	b.endRead()
+
+	if err != nil {
+		return nil, err
+	}
+	if access := b.access.Load(); access != nil {
+		now := b.usrOpts.clock.Now()
+		for key := range res {
+			access.read(key, now)
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,20 @@
+package bitcask
+
+import "fmt"
+
+// Handoff hands the datastore over to the next writer process.
+// It waits for the writes in progress, flushes them, writes the keydir to the keydir file
+// and closes the bitcask, releasing the datastore lock, so the next writer opens
+// the datastore without parsing its files.
+// After Handoff the bitcask object cannot be used anymore, as after Close.
+// Return an error if the bitcask is not a writer, or on system failures,
+// the datastore lock is released even if flushing fails.
+func (b *Bitcask) Handoff() error {
+	if b.usrOpts.accessPermission != ReadWrite {
+		return fmt.Errorf("Handoff: %w", ErrReadOnly)
+	}
+
+	b.Freeze()
+
+	return b.close("handoff", true)
+}
@@ -0,0 +1,62 @@
+package bitcask
+
+import (
+	"errors"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+// Has reports whether the key exists, without reading its value.
+// It answers from the keydir, only an empty record or a record as large as a legacy
+// tombstone is read from its data file to tell whether the key was deleted.
+func (b *Bitcask) Has(key string) bool {
+	b.startRead()
+	defer b.endRead()
+
+	rec, isExist := b.keyDir.Get(key)
+
+	return isExist && b.live(key, rec)
+}
+
+// live reports whether the key of the given keydir record is neither expired nor deleted,
+// reading the record only if it may be a tombstone. It is called with the read lock held.
+func (b *Bitcask) live(key string, rec recfmt.KeyDirRec) bool {
+	if b.expired(rec) {
+		return false
+	}
+	if !recfmt.MayBeTombstone(rec.ValueSize) {
+		return true
+	}
+
+	_, err := b.readRecord(key, rec, false)
+
+	return !errors.Is(err, datastore.ErrKeyNotExist)
+}
+
+// Len returns the number of keys which are not deleted, without touching the disk.
+// Like ListKeys, it counts the expired keys until a merge removes them.
+func (b *Bitcask) Len() int {
+	b.startRead()
+	defer b.endRead()
+
+	return b.keyDir.Len() - len(b.deleted)
+}
+
+// deletedKeys returns the keys of the keydir whose record is a tombstone,
+// only the records that may be tombstones are read.
+func (b *Bitcask) deletedKeys() map[string]struct{} {
+	deleted := make(map[string]struct{})
+	b.keyDir.Iterate(func(key string, rec recfmt.KeyDirRec) bool {
+		if !recfmt.MayBeTombstone(rec.ValueSize) {
+			return true
+		}
+		_, err := b.readRecord(key, rec, false)
+		if errors.Is(err, datastore.ErrKeyNotExist) {
+			deleted[key] = struct{}{}
+		}
+		return true
+	})
+
+	return deleted
+}
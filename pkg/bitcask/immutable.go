@@ -0,0 +1,109 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+)
+
+// ErrImmutableKey happens whenever a key written by PutImmutable is written or deleted.
+var ErrImmutableKey = errors.New("key is immutable")
+
+// PutImmutable stores a value by key and flags its record as immutable, the following
+// writes and deletes of the key fail with ErrImmutableKey until ClearImmutable is called.
+// The flag is kept by merges. Eviction and WithMaxRecordAge still drop immutable keys.
+// Return an error if the key is already immutable or on any system failure when writing the data.
+func (b *Bitcask) PutImmutable(key, value string) error {
+	if b.usrOpts.accessPermission == ReadOnly {
+		return fmt.Errorf("PutImmutable: %w", ErrReadOnly)
+	}
+
+	err := b.usrOpts.keyValidator(key)
+	if err != nil {
+		return fmt.Errorf("PutImmutable: %w", err)
+	}
+
+	b.accessMu.Lock()
+	defer b.accessMu.Unlock()
+	tstamp := b.usrOpts.clock.Now().UnixMicro()
+
+	if b.frozen {
+		return fmt.Errorf("PutImmutable: %w", ErrFrozen)
+	}
+	err = b.checkImmutable(key)
+	if err != nil {
+		return fmt.Errorf("PutImmutable: %w", err)
+	}
+
+	return b.storeValue(key, value, nil, immutableRecord, tstamp)
+}
+
+// ClearImmutable makes an immutable key writable again, keeping its value and metadata.
+// It is the administrative counterpart of PutImmutable, a key that is not immutable is left as is.
+// Return an error if key does not exist or on any system failure when writing the data.
+func (b *Bitcask) ClearImmutable(key string) error {
+	if b.usrOpts.accessPermission == ReadOnly {
+		return fmt.Errorf("ClearImmutable: %w", ErrReadOnly)
+	}
+
+	b.accessMu.Lock()
+	defer b.accessMu.Unlock()
+	tstamp := b.usrOpts.clock.Now().UnixMicro()
+
+	if b.frozen {
+		return fmt.Errorf("ClearImmutable: %w", ErrFrozen)
+	}
+
+	rec, isExist := b.keyDir.Get(key)
+	if !isExist || b.expired(rec) {
+		return datastore.KeyError(key, datastore.ErrKeyNotExist)
+	}
+	data, err := b.readRecord(key, rec, b.shouldVerify())
+	if err != nil {
+		return err
+	}
+	if !data.Immutable {
+		return nil
+	}
+
+	return b.storeValue(key, data.Value, data.Meta, valueRecord, tstamp)
+}
+
+// IsImmutable reports whether the key was written by PutImmutable and not cleared since.
+// Return an error if key does not exist or on system failures.
+func (b *Bitcask) IsImmutable(key string) (bool, error) {
+	b.startRead()
+	defer b.endRead()
+
+	rec, isExist := b.keyDir.Get(key)
+	if !isExist || b.expired(rec) {
+		return false, datastore.KeyError(key, datastore.ErrKeyNotExist)
+	}
+	data, err := b.readRecord(key, rec, b.shouldVerify())
+	if err != nil {
+		return false, err
+	}
+
+	return data.Immutable, nil
+}
+
+// checkImmutable rejects the write of an immutable key,
+// only the header of the current record of the key is read.
+// It is called with the access lock held.
+func (b *Bitcask) checkImmutable(key string) error {
+	rec, isExist := b.keyDir.Get(key)
+	if !isExist {
+		return nil
+	}
+
+	immutable, err := b.dataStore.ReadImmutable(rec.FileId, rec.ValuePos)
+	if err != nil {
+		return err
+	}
+	if immutable {
+		return datastore.KeyError(key, ErrImmutableKey)
+	}
+
+	return nil
+}
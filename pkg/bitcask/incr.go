@@ -0,0 +1,79 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+)
+
+var (
+	// ErrNotInteger happens whenever Incr is applied to a value that is not a base 10 int64.
+	ErrNotInteger = errors.New("value is not an integer")
+
+	// ErrOverflow happens whenever Incr would overflow the int64 range.
+	ErrOverflow = errors.New("increment or decrement would overflow")
+)
+
+// Incr adds delta to the integer stored by key and stores the result, a missing key counts as 0.
+// The value is read and written under the write lock, so concurrent increments are not lost.
+// Return the new value, or an error if the stored value is not an integer, the result
+// overflows or on any system failure.
+func (b *Bitcask) Incr(key string, delta int64) (int64, error) {
+	if b.usrOpts.accessPermission == ReadOnly {
+		return 0, fmt.Errorf("Incr: %w", ErrReadOnly)
+	}
+
+	err := b.usrOpts.keyValidator(key)
+	if err != nil {
+		return 0, fmt.Errorf("Incr: %w", err)
+	}
+
+	b.accessMu.Lock()
+	defer b.accessMu.Unlock()
+	tstamp := b.usrOpts.clock.Now().UnixMicro()
+
+	if b.frozen {
+		return 0, fmt.Errorf("Incr: %w", ErrFrozen)
+	}
+
+	var cur int64
+	var meta map[string]string
+	if rec, isExist := b.keyDir.Get(key); isExist {
+		data, err := b.readRecord(key, rec, b.shouldVerify())
+		if err != nil && !errors.Is(err, datastore.ErrKeyNotExist) {
+			return 0, err
+		}
+		if err == nil {
+			meta = data.Meta
+			cur, err = strconv.ParseInt(data.Value, 10, 64)
+			if err != nil {
+				return 0, datastore.KeyError(key, ErrNotInteger)
+			}
+		}
+	}
+
+	if (delta > 0 && cur > math.MaxInt64-delta) || (delta < 0 && cur < math.MinInt64-delta) {
+		return 0, datastore.KeyError(key, ErrOverflow)
+	}
+	cur += delta
+
+	err = b.store(key, strconv.FormatInt(cur, 10), meta, tstamp)
+	if err != nil {
+		return 0, err
+	}
+
+	return cur, nil
+}
+
+// Incr adds delta to the integer stored by key in the partition owning the key.
+func (p *Partitioned) Incr(key string, delta int64) (int64, error) {
+	b, err := p.partition(key)
+	if err != nil {
+		return 0, err
+	}
+
+	return b.Incr(key, delta)
+}
@@ -0,0 +1,319 @@
+package bitcask
+
+import (
+	"container/heap"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+	"github.com/zaher1307/bitcask/internal/keydir"
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+type (
+	// Iterator streams the keys of the bitcask in ascending order, as they were when
+	// the iterator was created, along with their values for the iterators of Items.
+	// The keys are read from the keydir in pages and the values as the iterator advances,
+	// the writes made meanwhile are not seen by the iterator and are not held back by it.
+	// An iterator is not safe for concurrent use, it must be closed once done,
+	// Merge waits for the open iterators before removing the old files.
+	//
+	//	it := b.Items()
+	//	defer it.Close()
+	//	for it.Next() {
+	//		fmt.Println(it.Key(), it.Value())
+	//	}
+	//	if err := it.Err(); err != nil {
+	//		...
+	//	}
+	Iterator struct {
+		b      *Bitcask
+		snap   *keySnapshot
+		values bool
+		prefix string
+		page   []snapshotEntry
+		cursor string
+		last   bool
+		key    string
+		value  string
+		err    error
+	}
+
+	// keySnapshot holds the records that the keys changed since the creation of
+	// an iterator had at that time, a nil record for the keys that did not exist.
+	// The snapshot of Fold has no records, it copies the keydir and only holds back the merges.
+	// It is updated with the access lock held.
+	keySnapshot struct {
+		before map[string]*recfmt.KeyDirRec
+	}
+
+	// snapshotEntry is a key of a snapshot along with its record.
+	snapshotEntry struct {
+		key string
+		rec recfmt.KeyDirRec
+	}
+
+	// entryHeap is a max heap of snapshot entries by key.
+	entryHeap []snapshotEntry
+)
+
+// Keys returns an iterator over the keys of the bitcask, without reading their values.
+func (b *Bitcask) Keys() *Iterator {
+	return b.newIterator(false, "")
+}
+
+// Items returns an iterator over the keys of the bitcask along with their values.
+func (b *Bitcask) Items() *Iterator {
+	return b.newIterator(true, "")
+}
+
+// Scan returns an iterator over the keys starting with prefix along with their values.
+// With WithKeyDir(OrderedKeyDir) the scan visits only the matching keys,
+// the other keydirs are scanned in full for every page of keys.
+func (b *Bitcask) Scan(prefix string) *Iterator {
+	return b.newIterator(true, prefix)
+}
+
+// newIterator registers the snapshot of a new iterator over the keys starting with prefix.
+func (b *Bitcask) newIterator(values bool, prefix string) *Iterator {
+	it := &Iterator{
+		b:      b,
+		snap:   &keySnapshot{before: make(map[string]*recfmt.KeyDirRec)},
+		values: values,
+		prefix: prefix,
+	}
+
+	b.openSnapshot(it.snap)
+
+	return it
+}
+
+// openSnapshot registers a snapshot, Merge waits for it to be closed before removing the old files.
+func (b *Bitcask) openSnapshot(snap *keySnapshot) {
+	b.accessMu.Lock()
+	if len(b.snapshots) == 0 {
+		b.snapshotsClosed = make(chan struct{})
+	}
+	b.snapshots = append(b.snapshots, snap)
+	b.accessMu.Unlock()
+}
+
+// copyKeyDir copies the records of the keydir at once, along with a snapshot holding
+// back the merges until the copied records are read. The snapshot must be closed once done.
+func (b *Bitcask) copyKeyDir() (*keySnapshot, []snapshotEntry) {
+	snap := &keySnapshot{}
+	b.openSnapshot(snap)
+
+	b.startRead()
+	entries := make([]snapshotEntry, 0, b.keyDir.Len())
+	b.keyDir.Iterate(func(key string, rec recfmt.KeyDirRec) bool {
+		entries = append(entries, snapshotEntry{key: key, rec: rec})
+		return true
+	})
+	b.endRead()
+
+	return snap, entries
+}
+
+// closeSnapshot unregisters a snapshot.
+func (b *Bitcask) closeSnapshot(snap *keySnapshot) {
+	b.accessMu.Lock()
+	for i, s := range b.snapshots {
+		if s == snap {
+			b.snapshots = append(b.snapshots[:i], b.snapshots[i+1:]...)
+			break
+		}
+	}
+	if len(b.snapshots) == 0 {
+		close(b.snapshotsClosed)
+	}
+	b.accessMu.Unlock()
+}
+
+// Next advances the iterator to the next key, skipping the deleted and expired keys.
+// Return false once all the keys are visited or on failure, the iterator is then closed.
+func (it *Iterator) Next() bool {
+	for it.snap != nil {
+		if len(it.page) == 0 {
+			if it.last {
+				it.Close()
+				return false
+			}
+			it.nextPage()
+			continue
+		}
+
+		entry := it.page[0]
+		it.page = it.page[1:]
+		it.cursor = entry.key
+		if it.b.expired(entry.rec) {
+			continue
+		}
+
+		value, err := it.read(entry)
+		if errors.Is(err, datastore.ErrKeyNotExist) {
+			continue
+		}
+		if err != nil {
+			it.err = err
+			it.Close()
+			return false
+		}
+		it.key, it.value = entry.key, value
+
+		return true
+	}
+
+	return false
+}
+
+// Key returns the key the iterator is at.
+func (it *Iterator) Key() string {
+	return it.key
+}
+
+// Value returns the value of the key the iterator is at, it is empty for the iterators of Keys.
+func (it *Iterator) Value() string {
+	return it.value
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Close releases the snapshot of the iterator, it can be called several times.
+func (it *Iterator) Close() {
+	if it.snap == nil {
+		return
+	}
+
+	it.b.closeSnapshot(it.snap)
+	it.snap = nil
+	it.page = nil
+}
+
+// nextPage reads the next keys after the cursor, taking the records of the keys
+// changed since the creation of the iterator from its snapshot.
+// An ordered keydir is read from the cursor up to the end of the page.
+func (it *Iterator) nextPage() {
+	h := make(entryHeap, 0, streamPageSize)
+	more := false
+	visit := func(key string, rec recfmt.KeyDirRec) {
+		if key <= it.cursor || !strings.HasPrefix(key, it.prefix) {
+			return
+		}
+		if len(h) < streamPageSize {
+			heap.Push(&h, snapshotEntry{key: key, rec: rec})
+			return
+		}
+		more = true
+		if key < h[0].key {
+			h[0] = snapshotEntry{key: key, rec: rec}
+			heap.Fix(&h, 0)
+		}
+	}
+	visitLive := func(key string, rec recfmt.KeyDirRec) bool {
+		if _, changed := it.snap.before[key]; !changed {
+			visit(key, rec)
+		}
+		return true
+	}
+
+	it.b.startRead()
+	if ordered, isOrdered := it.b.keyDir.(keydir.Ordered); isOrdered {
+		start := it.prefix
+		if it.cursor > start {
+			start = it.cursor
+		}
+		ordered.IterateFrom(start, func(key string, rec recfmt.KeyDirRec) bool {
+			// the keys past the prefix or past a full page are not needed
+			if !strings.HasPrefix(key, it.prefix) || (len(h) == streamPageSize && key > h[0].key) {
+				more = more || strings.HasPrefix(key, it.prefix)
+				return false
+			}
+			return visitLive(key, rec)
+		})
+	} else {
+		it.b.keyDir.Iterate(visitLive)
+	}
+	for key, rec := range it.snap.before {
+		if rec != nil {
+			visit(key, *rec)
+		}
+	}
+	it.b.endRead()
+
+	sort.Slice(h, func(i, j int) bool { return h[i].key < h[j].key })
+	it.page = h
+	it.last = !more
+}
+
+// read returns the value of the entry for the iterators of Items.
+// The iterators of Keys only read the records that may be tombstones.
+func (it *Iterator) read(entry snapshotEntry) (string, error) {
+	if !it.values && !recfmt.MayBeTombstone(entry.rec.ValueSize) {
+		return "", nil
+	}
+
+	data, err := it.b.readRecord(entry.key, entry.rec, it.b.shouldVerify())
+	if err != nil {
+		return "", err
+	}
+	if !it.values {
+		return "", nil
+	}
+
+	return data.Value, nil
+}
+
+// saveSnapshots records the current record of the key in the snapshots of the open
+// iterators before it changes, unless it changed already since their creation.
+// It is called with the access lock held.
+func (b *Bitcask) saveSnapshots(key string) {
+	for _, snap := range b.snapshots {
+		if snap.before == nil {
+			continue
+		}
+		if _, changed := snap.before[key]; changed {
+			continue
+		}
+		if rec, isExist := b.keyDir.Get(key); isExist {
+			snap.before[key] = &rec
+		} else {
+			snap.before[key] = nil
+		}
+	}
+}
+
+// waitIterators waits for the open iterators to be closed,
+// they may still read the records of the files removed by a merge.
+func (b *Bitcask) waitIterators() {
+	for {
+		b.accessMu.Lock()
+		if len(b.snapshots) == 0 {
+			b.accessMu.Unlock()
+			return
+		}
+		closed := b.snapshotsClosed
+		b.accessMu.Unlock()
+		<-closed
+	}
+}
+
+func (h entryHeap) Len() int           { return len(h) }
+func (h entryHeap) Less(i, j int) bool { return h[i].key > h[j].key }
+func (h entryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *entryHeap) Push(x any) {
+	*h = append(*h, x.(snapshotEntry))
+}
+
+func (h *entryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
@@ -0,0 +1,59 @@
+package bitcask
+
+import (
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+// KeyMeta represents the keydir metadata of a single key.
+// Deleted keys keep their metadata until the next merge, as they do in ListKeys.
+type KeyMeta struct {
+	// File is the name of the data file that holds the current record of the key.
+	File string
+	// Offset is the position of the record in its data file.
+	Offset int64
+	// ValueSize is the size of the value in bytes.
+	ValueSize int64
+	// Tstamp is the time the record was written.
+	Tstamp time.Time
+}
+
+// KeyMeta returns the keydir metadata of the given key without reading its value.
+// Return an error if key does not exist in the bitcask datastore.
+func (b *Bitcask) KeyMeta(key string) (KeyMeta, error) {
+	b.startRead()
+	rec, isExist := b.keyDir.Get(key)
+	b.endRead()
+
+	if !isExist {
+		return KeyMeta{}, datastore.KeyError(key, datastore.ErrKeyNotExist)
+	}
+
+	return newKeyMeta(rec), nil
+}
+
+// KeyDirSnapshot returns a copy of the keydir metadata of all the keys.
+// The snapshot is not updated by later writes and can be kept and modified freely.
+func (b *Bitcask) KeyDirSnapshot() map[string]KeyMeta {
+	b.startRead()
+	res := make(map[string]KeyMeta, b.keyDir.Len())
+	b.keyDir.Iterate(func(key string, rec recfmt.KeyDirRec) bool {
+		res[key] = newKeyMeta(rec)
+		return true
+	})
+	b.endRead()
+
+	return res
+}
+
+// newKeyMeta converts a keydir record to its exported form.
+func newKeyMeta(rec recfmt.KeyDirRec) KeyMeta {
+	return KeyMeta{
+		File:      rec.FileId,
+		Offset:    int64(rec.ValuePos),
+		ValueSize: int64(rec.ValueSize),
+		Tstamp:    time.UnixMicro(rec.Tstamp),
+	}
+}
@@ -0,0 +1,64 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+)
+
+// ErrInvalidKey happens whenever a key is rejected by the key validator.
+var ErrInvalidKey = errors.New("invalid key")
+
+// WithKeyValidator replaces the validator run on the keys of every write,
+// the default validator is ValidateKey.
+// A key rejected by the validator makes the write fail without touching the datastore.
+// The keys rejected by ValidateKey are always rejected before the validator runs:
+// the empty key is reserved for the batch headers and the longer keys do not fit in the records.
+func WithKeyValidator(validator func(key string) error) Option {
+	return optionFunc(func(o *options) {
+		o.keyValidator = func(key string) error {
+			err := ValidateKey(key)
+			if err != nil {
+				return err
+			}
+			return validator(key)
+		}
+	})
+}
+
+// ValidateKey is the default key validator.
+// It accepts any non empty key that fits in the record format, including
+// binary keys with path separators or control bytes.
+func ValidateKey(key string) error {
+	if len(key) == 0 {
+		return fmt.Errorf("%w: empty key", ErrInvalidKey)
+	}
+	if len(key) > datastore.MaxKeySize {
+		return fmt.Errorf("%w: key of %d bytes exceeds the maximum of %d bytes",
+			ErrInvalidKey, len(key), datastore.MaxKeySize)
+	}
+
+	return nil
+}
+
+// ValidateStrictKey is a stricter key validator for keys that may end up in
+// file names, logs or line based protocols.
+// On top of ValidateKey it rejects path separators and control bytes.
+func ValidateStrictKey(key string) error {
+	err := ValidateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if strings.ContainsAny(key, `/\`) {
+		return fmt.Errorf("%w: %s contains a path separator", ErrInvalidKey, datastore.PrintableKey(key))
+	}
+	if strings.IndexFunc(key, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%w: %s contains a control character", ErrInvalidKey, datastore.PrintableKey(key))
+	}
+
+	return nil
+}
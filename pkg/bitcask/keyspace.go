@@ -0,0 +1,73 @@
+package bitcask
+
+import (
+	"math/bits"
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+type (
+	// KeyspaceStats summarizes the keys of the datastore.
+	KeyspaceStats struct {
+		// Keys is the number of keys in the keydir.
+		Keys int
+		// KeyBytes is the total length in bytes of the keys.
+		KeyBytes int64
+		// ValueBytes is the total size in bytes of the values.
+		ValueBytes int64
+		// KeyLengths is the distribution of the key lengths in bytes.
+		KeyLengths Histogram
+		// ValueSizes is the distribution of the value sizes in bytes.
+		ValueSizes Histogram
+		// Ages is the distribution of the time in seconds since the keys were last written.
+		Ages Histogram
+	}
+
+	// Histogram counts values in power of two buckets, ordered by their bound.
+	// It stops at the last non empty bucket.
+	Histogram []HistogramBucket
+
+	// HistogramBucket counts the values greater than the bound
+	// of the previous bucket and less than or equal to Max.
+	HistogramBucket struct {
+		Max   int64
+		Count int
+	}
+)
+
+// KeyspaceStats computes the distribution of the key lengths, value sizes and
+// ages of all the keys.
+// It only uses the keydir metadata and does not read the data files,
+// but it walks the whole keydir on every call.
+func (b *Bitcask) KeyspaceStats() KeyspaceStats {
+	var stats KeyspaceStats
+	now := b.usrOpts.clock.Now().UnixMicro()
+
+	b.startRead()
+	b.keyDir.Iterate(func(key string, rec recfmt.KeyDirRec) bool {
+		stats.Keys++
+		stats.KeyBytes += int64(len(key))
+		stats.ValueBytes += int64(rec.ValueSize)
+		stats.KeyLengths.add(int64(len(key)))
+		stats.ValueSizes.add(int64(rec.ValueSize))
+		stats.Ages.add((now - rec.Tstamp) / int64(time.Second/time.Microsecond))
+		return true
+	})
+	b.endRead()
+
+	return stats
+}
+
+// add counts v in the bucket of the smallest power of two minus one bounding it,
+// negative values are counted in the first bucket.
+func (h *Histogram) add(v int64) {
+	i := 0
+	if v > 0 {
+		i = bits.Len64(uint64(v))
+	}
+	for len(*h) <= i {
+		*h = append(*h, HistogramBucket{Max: int64(1)<<len(*h) - 1})
+	}
+	(*h)[i].Count++
+}
@@ -0,0 +1,129 @@
+package bitcask
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// latencyWindow is the period over which the p99 latency of Get is measured.
+	latencyWindow = time.Second
+	// latencySamples is the maximum number of Get latencies kept per window,
+	// the latest ones replace the oldest.
+	latencySamples = 4096
+)
+
+// latencyMonitor collects the latencies of Get for WithMergeLatencyTarget.
+// It has its own lock since reads update it while sharing the access lock.
+type latencyMonitor struct {
+	target time.Duration
+
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+// WithMergeLatencyTarget makes a writer pause the merges while the p99 latency of Get
+// over the last second exceeds target, and resume them once it is back under target
+// or the reads stop. Merges in progress, automatic ones included, stop between two keys
+// as with PauseMerge. The pause of the latency target and the one of PauseMerge are
+// independent, the merges go on once both are lifted.
+func WithMergeLatencyTarget(target time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.mergeLatencyTarget = target
+	})
+}
+
+// newLatencyMonitor creates a monitor comparing the p99 latency against target.
+func newLatencyMonitor(target time.Duration) *latencyMonitor {
+	return &latencyMonitor{target: target, samples: make([]time.Duration, 0, latencySamples)}
+}
+
+// observe records the latency of a Get.
+func (m *latencyMonitor) observe(d time.Duration) {
+	m.mu.Lock()
+	if len(m.samples) < latencySamples {
+		m.samples = append(m.samples, d)
+	} else {
+		m.samples[m.next] = d
+		m.next = (m.next + 1) % latencySamples
+	}
+	m.mu.Unlock()
+}
+
+// collect returns the p99 latency of the recorded samples and their number,
+// then starts a new window.
+func (m *latencyMonitor) collect() (time.Duration, int) {
+	m.mu.Lock()
+	samples := m.samples
+	m.samples = make([]time.Duration, 0, latencySamples)
+	m.next = 0
+	m.mu.Unlock()
+
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	return samples[len(samples)*99/100], len(samples)
+}
+
+// controlMerges pauses the merges if the p99 latency of the window exceeds the target,
+// and resumes them otherwise.
+func (b *Bitcask) controlMerges() {
+	p99, n := b.latency.collect()
+	throttle := n > 0 && p99 > b.latency.target
+
+	b.accessMu.Lock()
+	defer b.accessMu.Unlock()
+	if throttle == b.mergeThrottled {
+		return
+	}
+	if throttle {
+		log.Printf("bitcask: p99 Get latency of %s is %v over the %v target, merges are paused",
+			b.dataStore.Path(), p99, b.latency.target)
+	} else {
+		log.Printf("bitcask: p99 Get latency of %s is back under the %v target, merges are resumed",
+			b.dataStore.Path(), b.latency.target)
+	}
+	b.setMergePause(b.mergePaused, throttle)
+}
+
+// startMergeController checks the latency of Get every latencyWindow
+// until stopMergeController is called.
+func (b *Bitcask) startMergeController() {
+	b.controllerStop = make(chan struct{})
+	b.controllerDone = make(chan struct{})
+
+	go func() {
+		defer close(b.controllerDone)
+
+		ticker := time.NewTicker(latencyWindow)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.controllerStop:
+				return
+			case <-ticker.C:
+				b.controlMerges()
+			}
+		}
+	}()
+}
+
+// stopMergeController stops the controller and lifts the pause it set, if any.
+// The controller is stopped once, the later calls do nothing.
+func (b *Bitcask) stopMergeController() {
+	if b.controllerStop == nil {
+		return
+	}
+
+	close(b.controllerStop)
+	<-b.controllerDone
+	b.controllerStop, b.controllerDone = nil, nil
+	b.accessMu.Lock()
+	b.setMergePause(b.mergePaused, false)
+	b.accessMu.Unlock()
+}
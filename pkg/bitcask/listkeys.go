@@ -0,0 +1,144 @@
+package bitcask
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/zaher1307/bitcask/internal/keydir"
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+// streamPageSize is the number of keys StreamKeys and the iterators read from the keydir at once.
+const streamPageSize = 1000
+
+// keyHeap is a max heap of keys.
+type keyHeap []string
+
+// ListKeysPage lists up to limit keys in ascending order, starting after the cursor key.
+// The empty cursor starts from the first key. next is the cursor of the following page,
+// it is empty once all the keys are listed. The deleted and expired keys are skipped.
+// With WithKeyDir(OrderedKeyDir) a page seeks to the cursor, the other keydirs are scanned
+// in full for every page without being copied, so keys added or deleted between the pages
+// may or may not be listed, but a key present all along is listed exactly once.
+func (b *Bitcask) ListKeysPage(cursor string, limit int) (keys []string, next string) {
+	if limit <= 0 {
+		return []string{}, ""
+	}
+
+	more := false
+
+	b.startRead()
+	if ordered, isOrdered := b.keyDir.(keydir.Ordered); isOrdered {
+		keys = make([]string, 0, limit)
+		ordered.IterateFrom(cursor, func(key string, rec recfmt.KeyDirRec) bool {
+			if key <= cursor || !b.live(key, rec) {
+				return true
+			}
+			if len(keys) == limit {
+				more = true
+				return false
+			}
+			keys = append(keys, key)
+			return true
+		})
+	} else {
+		h := make(keyHeap, 0, limit)
+		b.keyDir.Iterate(func(key string, rec recfmt.KeyDirRec) bool {
+			if key <= cursor || !b.live(key, rec) {
+				return true
+			}
+			if len(h) < limit {
+				heap.Push(&h, key)
+				return true
+			}
+			more = true
+			if key < h[0] {
+				h[0] = key
+				heap.Fix(&h, 0)
+			}
+			return true
+		})
+		keys = []string(h)
+		sort.Strings(keys)
+	}
+	b.endRead()
+
+	if more {
+		next = keys[len(keys)-1]
+	}
+
+	return keys, next
+}
+
+// StreamKeys sends all the keys in ascending order on the returned channel
+// and closes it once done or once the done channel is closed. The deleted and expired
+// keys are skipped. With WithKeyDir(OrderedKeyDir) the keys are read in pages,
+// the other keydirs are copied and sorted once, so a slow receiver does not hold back the writes.
+func (b *Bitcask) StreamKeys(done <-chan struct{}) <-chan string {
+	keys := make(chan string)
+
+	go func() {
+		defer close(keys)
+
+		send := func(page []string) bool {
+			for _, key := range page {
+				select {
+				case keys <- key:
+				case <-done:
+					return false
+				}
+			}
+			return true
+		}
+
+		if _, isOrdered := b.keyDir.(keydir.Ordered); !isOrdered {
+			send(b.sortedKeys())
+			return
+		}
+
+		cursor := ""
+		for {
+			page, next := b.ListKeysPage(cursor, streamPageSize)
+			if !send(page) || next == "" {
+				return
+			}
+			cursor = next
+		}
+	}()
+
+	return keys
+}
+
+// sortedKeys returns the keys which are neither deleted nor expired in ascending order.
+func (b *Bitcask) sortedKeys() []string {
+	var keys []string
+
+	b.startRead()
+	b.keyDir.Iterate(func(key string, rec recfmt.KeyDirRec) bool {
+		if b.live(key, rec) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	b.endRead()
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (h keyHeap) Len() int           { return len(h) }
+func (h keyHeap) Less(i, j int) bool { return h[i] > h[j] }
+func (h keyHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *keyHeap) Push(x any) {
+	*h = append(*h, x.(string))
+}
+
+func (h *keyHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
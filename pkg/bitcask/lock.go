@@ -0,0 +1,158 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+)
+
+// lockExpiresMeta is the metadata of the lock records holding their expiry time,
+// in microseconds since the epoch.
+const lockExpiresMeta = "lock-expires"
+
+// ErrLockHeld happens whenever AcquireLock finds the lock held by another owner.
+var ErrLockHeld = errors.New("lock is held")
+
+// Lock is a lock acquired by AcquireLock, stored as the key of its name
+// holding the token of its owner.
+type Lock struct {
+	// Name is the key of the lock.
+	Name string
+	// Token identifies the owner of the lock, only its owner can release it.
+	Token string
+	// Fence is the timestamp of the lock record in microseconds, the timestamps only grow
+	// so every lock acquired later in the datastore gets a greater fence. The resources
+	// guarded by the lock should reject the requests carrying a fence lower than
+	// the greatest fence they saw, which stops an owner whose lock expired meanwhile.
+	Fence int64
+	// Expires is when the lock is released on its own, it is zero for a lock without ttl.
+	Expires time.Time
+}
+
+// AcquireLock acquires the lock of the given name for the owner identified by token,
+// the lock expires after ttl unless ttl is 0. A key which is not an expired lock holds the lock,
+// as SET NX would find it. The lock is checked and written under the write lock, so only one
+// of concurrent callers acquires it.
+// Return ErrLockHeld if the lock is held, or an error on any system failure when writing the data.
+func (b *Bitcask) AcquireLock(name, token string, ttl time.Duration) (Lock, error) {
+	if b.usrOpts.accessPermission == ReadOnly {
+		return Lock{}, fmt.Errorf("AcquireLock: %w", ErrReadOnly)
+	}
+
+	err := b.usrOpts.keyValidator(name)
+	if err != nil {
+		return Lock{}, fmt.Errorf("AcquireLock: %w", err)
+	}
+
+	b.accessMu.Lock()
+	defer b.accessMu.Unlock()
+	now := b.usrOpts.clock.Now()
+
+	if b.frozen {
+		return Lock{}, fmt.Errorf("AcquireLock: %w", ErrFrozen)
+	}
+
+	rec, isExist := b.keyDir.Get(name)
+	if isExist && !b.expired(rec) {
+		data, err := b.readRecord(name, rec, b.shouldVerify())
+		if err != nil && !errors.Is(err, datastore.ErrKeyNotExist) {
+			return Lock{}, err
+		}
+		if err == nil && !lockExpired(data.Meta, now) {
+			return Lock{}, fmt.Errorf("AcquireLock: %s: %w", datastore.PrintableKey(name), ErrLockHeld)
+		}
+	}
+
+	var meta map[string]string
+	var expires time.Time
+	if ttl > 0 {
+		expires = now.Add(ttl)
+		meta = map[string]string{lockExpiresMeta: strconv.FormatInt(expires.UnixMicro(), 10)}
+	}
+	err = b.store(name, token, meta, now.UnixMicro())
+	if err != nil {
+		return Lock{}, err
+	}
+	rec, _ = b.keyDir.Get(name)
+
+	return Lock{Name: name, Token: token, Fence: rec.Tstamp, Expires: expires}, nil
+}
+
+// ReleaseLock releases the lock of the given name if it is held by the owner identified by token.
+// Return whether the lock was released, or an error on any system failure when writing the data.
+func (b *Bitcask) ReleaseLock(name, token string) (bool, error) {
+	released, err := b.DeleteIfValue(name, token)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+
+	return released, err
+}
+
+// LockHeld reports whether the lock is still held by its owner, that is the lock was neither
+// released, expired nor acquired again since, even by the same owner.
+// Return an error on any system failure when reading the data.
+func (b *Bitcask) LockHeld(lock Lock) (bool, error) {
+	now := b.usrOpts.clock.Now()
+
+	b.startRead()
+	defer b.endRead()
+
+	rec, isExist := b.keyDir.Get(lock.Name)
+	if !isExist || b.expired(rec) || rec.Tstamp != lock.Fence {
+		return false, nil
+	}
+	data, err := b.readRecord(lock.Name, rec, b.shouldVerify())
+	if errors.Is(err, datastore.ErrKeyNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return data.Value == lock.Token && !lockExpired(data.Meta, now), nil
+}
+
+// lockExpired reports whether the lock record holding the given metadata expired at now,
+// the records without expiry never expire.
+func lockExpired(meta map[string]string, now time.Time) bool {
+	expires, err := strconv.ParseInt(meta[lockExpiresMeta], 10, 64)
+	if err != nil {
+		return false
+	}
+
+	return now.UnixMicro() >= expires
+}
+
+// AcquireLock acquires the lock in the partition owning its name.
+func (p *Partitioned) AcquireLock(name, token string, ttl time.Duration) (Lock, error) {
+	b, err := p.partition(name)
+	if err != nil {
+		return Lock{}, err
+	}
+
+	return b.AcquireLock(name, token, ttl)
+}
+
+// ReleaseLock releases the lock in the partition owning its name.
+func (p *Partitioned) ReleaseLock(name, token string) (bool, error) {
+	b, err := p.partition(name)
+	if err != nil {
+		return false, err
+	}
+
+	return b.ReleaseLock(name, token)
+}
+
+// LockHeld reports whether the lock is held in the partition owning its name.
+func (p *Partitioned) LockHeld(lock Lock) (bool, error) {
+	b, err := p.partition(lock.Name)
+	if err != nil {
+		return false, err
+	}
+
+	return b.LockHeld(lock)
+}
@@ -0,0 +1,64 @@
+package bitcask
+
+import (
+	"unsafe"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+// keyDirEntrySize estimates the bytes the keydir map spends on each entry
+// besides the key content: the key header, the record and the bucket tophash,
+// assuming the map buckets are kept at their average load of 6.5 of 8 slots.
+var keyDirEntrySize = int64(unsafe.Sizeof("")+unsafe.Sizeof(recfmt.KeyDirRec{})+1) * 16 / 13
+
+// MemoryStats represents an approximation of the memory used by a bitcask object.
+type MemoryStats struct {
+	// KeyDir is the estimated size of the keydir in bytes.
+	KeyDir int64
+	// Total is the sum of all the estimated sizes in bytes.
+	Total int64
+}
+
+// KeyUsage represents the space used by a single key.
+type KeyUsage struct {
+	// Record is the size in bytes of the key's current record in its data file.
+	Record int64
+	// KeyDir is the estimated size in bytes of the key's keydir entry.
+	KeyDir int64
+}
+
+// MemoryUsage estimates the memory used by the bitcask object.
+// The estimation is an approximation meant to help sizing the instances
+// and does not account for Go runtime overhead.
+func (b *Bitcask) MemoryUsage() MemoryStats {
+	var stats MemoryStats
+
+	b.startRead()
+	b.keyDir.Iterate(func(key string, _ recfmt.KeyDirRec) bool {
+		stats.KeyDir += keyDirEntrySize + int64(len(key))
+		return true
+	})
+	b.endRead()
+
+	stats.Total = stats.KeyDir
+
+	return stats
+}
+
+// KeySize reports the on-disk record size and the keydir overhead of the given key.
+// Return an error if key does not exist in the bitcask datastore.
+func (b *Bitcask) KeySize(key string) (KeyUsage, error) {
+	b.startRead()
+	rec, isExist := b.keyDir.Get(key)
+	b.endRead()
+
+	if !isExist {
+		return KeyUsage{}, datastore.KeyError(key, datastore.ErrKeyNotExist)
+	}
+
+	return KeyUsage{
+		Record: int64(recfmt.DataFileRecHdr + len(key) + int(rec.ValueSize)),
+		KeyDir: keyDirEntrySize + int64(len(key)),
+	}, nil
+}
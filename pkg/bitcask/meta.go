@@ -0,0 +1,97 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+const (
+	// MaxMetaSize is the maximum size in bytes of the metadata of a key,
+	// the sum of the lengths of its names and values.
+	MaxMetaSize = 64 << 10
+
+	// MaxValueSize is the maximum size in bytes of a value along with its metadata,
+	// the larger values are rejected with ErrValueTooLarge.
+	MaxValueSize = recfmt.MaxValueSize
+)
+
+// ErrMetaTooLarge happens whenever the metadata given to PutWithMeta exceeds MaxMetaSize,
+// or one of its names or values is longer than 65535 bytes.
+var ErrMetaTooLarge = errors.New("metadata is too large")
+
+// PutWithMeta stores a value by key along with the given metadata, such as a content type
+// or the origin of the value. The metadata is kept with the value until the key is written again,
+// AppendValue and Incr preserve it.
+// Return an error if the metadata is too large or on any system failure when writing the data.
+func (b *Bitcask) PutWithMeta(key, value string, meta map[string]string) error {
+	if b.usrOpts.accessPermission == ReadOnly {
+		return fmt.Errorf("PutWithMeta: %w", ErrReadOnly)
+	}
+
+	err := b.usrOpts.keyValidator(key)
+	if err != nil {
+		return fmt.Errorf("PutWithMeta: %w", err)
+	}
+	err = checkMeta(meta)
+	if err != nil {
+		return fmt.Errorf("PutWithMeta: %w", err)
+	}
+
+	b.accessMu.Lock()
+	defer b.accessMu.Unlock()
+	tstamp := b.usrOpts.clock.Now().UnixMicro()
+
+	if b.frozen {
+		return fmt.Errorf("PutWithMeta: %w", ErrFrozen)
+	}
+
+	return b.store(key, value, meta, tstamp)
+}
+
+// GetWithMeta retrieves the value by key along with the metadata it was stored with,
+// the metadata is nil for the values stored by Put.
+// Return an error if key does not exist in the bitcask datastore.
+func (b *Bitcask) GetWithMeta(key string) (string, map[string]string, error) {
+	var data *recfmt.DataRec
+	var err error
+
+	b.startRead()
+
+	rec, isExist := b.keyDir.Get(key)
+	if !isExist || b.expired(rec) {
+		err = datastore.KeyError(key, datastore.ErrKeyNotExist)
+	} else {
+		data, err = b.readRecord(key, rec, b.shouldVerify())
+	}
+
+	b.endRead()
+
+	if err != nil {
+		return "", nil, err
+	}
+	if access := b.access.Load(); access != nil {
+		access.read(key, b.usrOpts.clock.Now())
+	}
+
+	return data.Value, data.Meta, nil
+}
+
+// checkMeta verifies that the metadata fits in a record.
+func checkMeta(meta map[string]string) error {
+	size := 0
+	for name, value := range meta {
+		if len(name) > math.MaxUint16 || len(value) > math.MaxUint16 {
+			return ErrMetaTooLarge
+		}
+		size += len(name) + len(value)
+	}
+	if size > MaxMetaSize {
+		return ErrMetaTooLarge
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+)
+
+// ErrBusy happens whenever a write waits longer than the timeout set by WithBusyTimeout
+// for room in the queue of an asynchronous mirror.
+var ErrBusy = errors.New("write queue is full")
+
+type (
+	// mirror applies the writes of a bitcask to a secondary bitcask.
+	mirror struct {
+		db      *Bitcask
+		queue   chan mirrorWrite
+		space   chan struct{}
+		timeout time.Duration
+		wg      sync.WaitGroup
+		// closeOnce closes the queue once, Close may be called again.
+		closeOnce sync.Once
+	}
+
+	// mirrorWrite is a write waiting in the queue of an asynchronous mirror.
+	mirrorWrite struct {
+		key     string
+		value   string
+		meta    map[string]string
+		deleted bool
+	}
+)
+
+// WithWriteMirror applies every Put and Delete to the given secondary bitcask as well,
+// e.g. one opened on another disk, as a simple form of local redundancy.
+// When queueSize is zero the mirror is written synchronously and its failures are
+// returned by the write, the write is kept in the primary datastore in this case.
+// Otherwise the writes are applied in the background through a queue of queueSize writes,
+// writers block while the queue is full and the mirror failures are only logged.
+// The secondary bitcask must be opened with ReadWrite permission, it is not closed by Close.
+func WithWriteMirror(db *Bitcask, queueSize int) Option {
+	return optionFunc(func(o *options) {
+		o.mirror = db
+		o.mirrorQueueSize = queueSize
+	})
+}
+
+// WithBusyTimeout bounds how long a write waits for room in the queue of
+// an asynchronous mirror, the write fails with ErrBusy without being applied after the timeout.
+// By default the writes wait as long as the queue is full.
+func WithBusyTimeout(timeout time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.busyTimeout = timeout
+	})
+}
+
+// newMirror starts mirroring the writes to the given bitcask.
+func newMirror(db *Bitcask, queueSize int, timeout time.Duration) *mirror {
+	m := &mirror{db: db, timeout: timeout}
+	if queueSize > 0 {
+		m.queue = make(chan mirrorWrite, queueSize)
+		m.space = make(chan struct{}, 1)
+		m.wg.Add(1)
+		go m.run()
+	}
+
+	return m
+}
+
+// write applies a write to the mirror or queues it for an asynchronous mirror,
+// deleted is set for the deletes.
+// It is called with the access lock of the primary held to keep the order of the writes.
+func (m *mirror) write(key, value string, meta map[string]string, deleted bool) error {
+	w := mirrorWrite{key: key, value: value, meta: meta, deleted: deleted}
+	if m.queue != nil {
+		m.queue <- w
+		return nil
+	}
+
+	err := m.put(w)
+	if err != nil {
+		return fmt.Errorf("mirror: %w", err)
+	}
+
+	return nil
+}
+
+// reserve waits up to the busy timeout for room in the queue.
+// It is called with the access lock of the primary held, so the room
+// cannot be taken by another write before the write is queued.
+func (m *mirror) reserve() error {
+	if m.queue == nil || m.timeout <= 0 {
+		return nil
+	}
+
+	var timer *time.Timer
+	for len(m.queue) == cap(m.queue) {
+		if timer == nil {
+			timer = time.NewTimer(m.timeout)
+			defer timer.Stop()
+		}
+		select {
+		case <-m.space:
+		case <-timer.C:
+			return ErrBusy
+		}
+	}
+
+	return nil
+}
+
+// run applies the queued writes until the queue is closed.
+func (m *mirror) run() {
+	defer m.wg.Done()
+
+	for w := range m.queue {
+		select {
+		case m.space <- struct{}{}:
+		default:
+		}
+
+		err := m.put(w)
+		if err != nil {
+			log.Printf("bitcask: mirror write of %s failed: %v", datastore.PrintableKey(w.key), err)
+		}
+	}
+}
+
+// close waits for the queued writes to be applied.
+func (m *mirror) close() {
+	if m.queue != nil {
+		m.closeOnce.Do(func() { close(m.queue) })
+		m.wg.Wait()
+	}
+}
+
+// put applies the write to the mirror, the value along with its metadata, if any,
+// or the delete of the key, a key missing from the mirror is not an error then.
+func (m *mirror) put(w mirrorWrite) error {
+	if w.deleted {
+		err := m.db.Delete(w.key)
+		if errors.Is(err, datastore.ErrKeyNotExist) {
+			return nil
+		}
+		return err
+	}
+	if w.meta == nil {
+		return m.db.Put(w.key, w.value)
+	}
+
+	return m.db.PutWithMeta(w.key, w.value, w.meta)
+}
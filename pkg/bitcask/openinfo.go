@@ -0,0 +1,51 @@
+package bitcask
+
+import (
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/keydir"
+)
+
+// OpenInfo reports how Open recovered the keydir of the datastore.
+type OpenInfo struct {
+	// Duration is how long building the keydir took.
+	Duration time.Duration
+	// Keys is the number of keys loaded into the keydir.
+	Keys int
+	// KeyDirFile is set when the keydir was loaded from the keydir file
+	// instead of the data and hint files.
+	KeyDirFile bool
+	// KeyDirFileRejected is the reason an existing keydir file was ignored,
+	// it is empty when the keydir file was used or did not exist.
+	KeyDirFileRejected string
+	// DataFilesParsed are the data files parsed record by record, ordered by name.
+	DataFilesParsed []string
+	// HintFilesUsed are the hint files read instead of their data files, ordered by name.
+	HintFilesUsed []string
+	// HintFilesRejected are the hint files that did not match their data files,
+	// their data files were parsed instead, ordered by name.
+	HintFilesRejected []string
+	// TornFiles are the data files ending with a record cut by a crash, ordered by name.
+	// The torn record is left out, and a ReadWrite Open truncates the file before it.
+	TornFiles []string
+}
+
+// OpenInfo returns the report of how Open recovered the keydir,
+// useful to observe what a restart after a crash had to parse.
+func (b *Bitcask) OpenInfo() OpenInfo {
+	return b.openInfo
+}
+
+// newOpenInfo converts the keydir build report to its exported form.
+func newOpenInfo(report keydir.Report, keys int, took time.Duration) OpenInfo {
+	return OpenInfo{
+		Duration:           took,
+		Keys:               keys,
+		KeyDirFile:         report.KeyDirFile,
+		KeyDirFileRejected: report.KeyDirFileRejected,
+		DataFilesParsed:    report.DataFiles,
+		HintFilesUsed:      report.HintFiles,
+		HintFilesRejected:  report.RejectedHints,
+		TornFiles:          report.TornFiles,
+	}
+}
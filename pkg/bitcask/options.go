@@ -0,0 +1,220 @@
+package bitcask
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+	"github.com/zaher1307/bitcask/internal/keydir"
+	"github.com/zaher1307/bitcask/internal/sio"
+)
+
+// The ConfigOpt constants are kept for compatibility, they are equivalent to
+// WithReadOnly, WithReadWrite, WithSyncOnPut and WithSyncOnDemand.
+const (
+	// ReadOnly gives the bitcask process a read only permission.
+	ReadOnly ConfigOpt = 0
+	// ReadWrite gives the bitcask process read and write permissions.
+	ReadWrite ConfigOpt = 1
+	// SyncOnPut makes the bitcask flush all the writes directly to the disk.
+	SyncOnPut ConfigOpt = 2
+	// SyncOnDemand gives the user the control on whenever to do flush operation.
+	SyncOnDemand ConfigOpt = 3
+)
+
+const (
+	// MapKeyDir keeps the keydir in a plain map, it is the default.
+	MapKeyDir KeyDirKind = KeyDirKind(keydir.MapKind)
+	// ShardedKeyDir splits the keydir over several maps that grow on their own,
+	// so that large keydirs avoid long write pauses while rehashing.
+	ShardedKeyDir KeyDirKind = KeyDirKind(keydir.ShardedKind)
+	// OrderedKeyDir keeps the keys sorted so that ListKeys and Fold
+	// visit them in ascending order, at the cost of more memory and slower lookups.
+	OrderedKeyDir KeyDirKind = KeyDirKind(keydir.OrderedKind)
+	// CompactKeyDir stores the keydir entries in large byte arenas so that the
+	// garbage collector has no pointers to scan, meant for hundreds of millions of keys.
+	// The space of evicted keys is reclaimed by the next merge.
+	CompactKeyDir KeyDirKind = KeyDirKind(keydir.CompactKind)
+)
+
+type (
+	// ConfigOpt represents the config options the user can have.
+	ConfigOpt int
+
+	// KeyDirKind specifies the implementation of the in-memory keydir.
+	KeyDirKind int
+
+	// Option configures the bitcask object created by Open.
+	// ConfigOpt values and the values returned by the With* functions are options.
+	Option interface {
+		apply(*options)
+	}
+
+	// optionFunc adapts an ordinary function to an Option.
+	optionFunc func(*options)
+
+	// Clock is the source of time used by the bitcask
+	// for record timestamps and data file naming.
+	Clock interface {
+		Now() time.Time
+	}
+
+	// systemClock is the default clock, it reads the system time.
+	systemClock struct{}
+
+	// options groups the config options passed to Open.
+	options struct {
+		syncOption       ConfigOpt
+		accessPermission ConfigOpt
+		clock            Clock
+		partitioner      Partitioner
+		mergeWorkers     int
+
+		verifyMode        VerifyMode
+		corruptionHandler func(key string, err error)
+		keyValidator      func(key string) error
+
+		mirror          *Bitcask
+		mirrorQueueSize int
+		busyTimeout     time.Duration
+
+		audit      bool
+		auditLabel string
+
+		trackAccess bool
+
+		maxMemory      int64
+		evictionPolicy EvictionPolicy
+
+		readPolicy   sio.ReadPolicy
+		maxOpenFiles int
+
+		precreateActiveFile bool
+		maxFileSize         int64
+
+		keyDirKind KeyDirKind
+
+		maxRecordAge  time.Duration
+		sweepInterval time.Duration
+		syncInterval  time.Duration
+
+		autoMergeRatio     float64
+		autoMergeBytes     int64
+		mergeLatencyTarget time.Duration
+
+		dedup        bool
+		dedupMinSize int
+
+		prefixes []string
+	}
+)
+
+// WithClock makes the bitcask read the time from the given clock
+// instead of the system clock.
+// It is mainly useful for deterministic tests and simulations.
+func WithClock(clock Clock) Option {
+	return optionFunc(func(o *options) {
+		o.clock = clock
+	})
+}
+
+// WithPrecreateActiveFile makes Open create the active file right away, so that
+// a datastore that cannot be written fails to open instead of failing the first write,
+// and the first write does not pay for the file creation.
+// By default the active file is created by the first write.
+func WithPrecreateActiveFile() Option {
+	return optionFunc(func(o *options) {
+		o.precreateActiveFile = true
+	})
+}
+
+// WithMaxFileSize sets the size in bytes past which the active file and the merge files
+// rotate to a new file, it defaults to 10KB. A single record larger than the limit
+// is written to a file of its own. It only applies to the files written from now on.
+func WithMaxFileSize(bytes int64) Option {
+	return optionFunc(func(o *options) {
+		o.maxFileSize = bytes
+	})
+}
+
+// WithReadOnly opens the datastore for reading only, it is the default.
+// Several read only processes can open the same datastore.
+func WithReadOnly() Option {
+	return optionFunc(func(o *options) {
+		o.accessPermission = ReadOnly
+	})
+}
+
+// WithReadWrite opens the datastore for reading and writing, creating it if it does not exist.
+// Only one read write process can open a datastore at a time.
+func WithReadWrite() Option {
+	return optionFunc(func(o *options) {
+		o.accessPermission = ReadWrite
+	})
+}
+
+// WithSyncOnPut makes every write flushed to the disk before it returns.
+func WithSyncOnPut() Option {
+	return optionFunc(func(o *options) {
+		o.syncOption = SyncOnPut
+	})
+}
+
+// WithSyncOnDemand leaves flushing the writes to Sync and Close, it is the default.
+func WithSyncOnDemand() Option {
+	return optionFunc(func(o *options) {
+		o.syncOption = SyncOnDemand
+	})
+}
+
+// apply sets the config option on the given options as its With* equivalent does.
+// ReadOnly and SyncOnDemand are the defaults, they never override another option
+// so that the options combined by older callers keep their meaning.
+func (c ConfigOpt) apply(o *options) {
+	switch c {
+	case SyncOnPut:
+		WithSyncOnPut().apply(o)
+	case ReadWrite:
+		WithReadWrite().apply(o)
+	}
+}
+
+// WithKeyDir selects the implementation of the in-memory keydir, the default is MapKeyDir.
+// The evictions sample the keys in the keydir order, which with OrderedKeyDir
+// always favors the smallest keys.
+func WithKeyDir(kind KeyDirKind) Option {
+	return optionFunc(func(o *options) {
+		o.keyDirKind = kind
+	})
+}
+
+// apply calls the function on the given options.
+func (f optionFunc) apply(o *options) {
+	f(o)
+}
+
+// Now returns the current system time.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// parseUsrOpts fills an options struct with the passed user options.
+func parseUsrOpts(opts []Option) options {
+	usrOpts := options{
+		syncOption:       SyncOnDemand,
+		accessPermission: ReadOnly,
+		clock:            systemClock{},
+		partitioner:      hashPartitioner,
+		mergeWorkers:     runtime.NumCPU(),
+		keyValidator:     ValidateKey,
+		readPolicy:       sio.DefaultReadPolicy,
+		maxOpenFiles:     datastore.DefaultMaxOpenFiles,
+		maxFileSize:      datastore.DefaultMaxFileSize,
+	}
+
+	for _, opt := range opts {
+		opt.apply(&usrOpts)
+	}
+
+	return usrOpts
+}
@@ -0,0 +1,254 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+)
+
+// partitionFile is the name of the file recording the position of
+// a datastore inside a partitioned datastore.
+const partitionFile = ".partition"
+
+// errPartitionMismatch happens when a datastore is opened as a partition
+// different from the one it was created as.
+var errPartitionMismatch = errors.New("partition mismatch: datastore belongs to another partition layout")
+
+// ErrInvalidPartition happens when the partitioner maps a key outside of the partitions.
+var ErrInvalidPartition = errors.New("partitioner returned an invalid partition")
+
+type (
+	// Partitioner maps a key to one of n partitions.
+	// It must always map the same key to the same partition.
+	Partitioner func(key string, n int) int
+
+	// Partitioned represents one logical datastore split across several
+	// bitcask datastores by key hash.
+	// Each partition has its own directory, active file and merge,
+	// so the partitions can live on different disks.
+	Partitioned struct {
+		parts        []*Bitcask
+		partitioner  Partitioner
+		mergeWorkers int
+	}
+)
+
+// WithPartitioner makes OpenPartitioned route the keys with the given partitioner
+// instead of the default FNV-1a hash.
+// The operations on a key the partitioner maps outside of the partitions fail with ErrInvalidPartition.
+func WithPartitioner(partitioner Partitioner) Option {
+	return optionFunc(func(o *options) {
+		o.partitioner = partitioner
+	})
+}
+
+// WithMergeWorkers sets how many partitions of a partitioned datastore
+// are merged at the same time, it defaults to the number of CPUs.
+func WithMergeWorkers(n int) Option {
+	return optionFunc(func(o *options) {
+		if n > 0 {
+			o.mergeWorkers = n
+		}
+	})
+}
+
+// OpenPartitioned opens a partitioned datastore with a partition in each of the given paths.
+// It takes the same options as Open, which are applied to every partition.
+// The paths must be passed in the same order every time the datastore is opened.
+// Return an error if any of the partitions cannot be opened.
+func OpenPartitioned(dataStorePaths []string, opts ...Option) (*Partitioned, error) {
+	if len(dataStorePaths) == 0 {
+		return nil, errors.New("partitioned datastore requires at least one path")
+	}
+
+	usrOpts := parseUsrOpts(opts)
+	p := &Partitioned{
+		parts:        make([]*Bitcask, 0, len(dataStorePaths)),
+		partitioner:  usrOpts.partitioner,
+		mergeWorkers: usrOpts.mergeWorkers,
+	}
+
+	for i, dataStorePath := range dataStorePaths {
+		b, err := Open(dataStorePath, opts...)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.parts = append(p.parts, b)
+
+		err = b.checkPartition(i, len(dataStorePaths))
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// Get retrieves the value by key from the partition owning the key.
+// Return an error if key does not exist in the datastore.
+func (p *Partitioned) Get(key string) (string, error) {
+	b, err := p.partition(key)
+	if err != nil {
+		return "", err
+	}
+
+	return b.Get(key)
+}
+
+// Put stores a value by key in the partition owning the key.
+// Return an error on any system failure when writing the data.
+func (p *Partitioned) Put(key, value string) error {
+	b, err := p.partition(key)
+	if err != nil {
+		return err
+	}
+
+	return b.Put(key, value)
+}
+
+// Delete removes a key from the partition owning the key.
+// Return an error if key does not exist in the datastore.
+func (p *Partitioned) Delete(key string) error {
+	b, err := p.partition(key)
+	if err != nil {
+		return err
+	}
+
+	return b.Delete(key)
+}
+
+// ListKeys list all keys of all partitions.
+func (p *Partitioned) ListKeys() []string {
+	res := make([]string, 0)
+	for _, b := range p.parts {
+		res = append(res, b.ListKeys()...)
+	}
+
+	return res
+}
+
+// Fold folds over all key/value pairs of all partitions.
+// fun is expected to be in the form: F(K, V, Acc) -> Acc
+func (p *Partitioned) Fold(fn func(string, string, any) any, acc any) any {
+	for _, b := range p.parts {
+		acc = b.Fold(fn, acc)
+	}
+
+	return acc
+}
+
+// Merge merges the partitions in parallel, running at most
+// the number of merge workers set by WithMergeWorkers at a time.
+// Return the sum of the results of the partitions merged successfully
+// and the error of the first failed partition.
+func (p *Partitioned) Merge() (MergeResult, error) {
+	results := make([]MergeResult, len(p.parts))
+	errs := make([]error, len(p.parts))
+
+	workers := make(chan struct{}, p.mergeWorkers)
+	var wg sync.WaitGroup
+	for i, b := range p.parts {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int, b *Bitcask) {
+			defer wg.Done()
+			results[i], errs[i] = b.merge()
+			<-workers
+		}(i, b)
+	}
+	wg.Wait()
+
+	var res MergeResult
+	var err error
+	for i := range p.parts {
+		res.FilesRemoved += results[i].FilesRemoved
+		res.KeysWritten += results[i].KeysWritten
+		res.BytesWritten += results[i].BytesWritten
+		res.ValuesShared += results[i].ValuesShared
+		res.KeysExpired += results[i].KeysExpired
+		if err == nil {
+			err = errs[i]
+		}
+	}
+
+	return res, err
+}
+
+// Sync flushes the data of all partitions to the disk.
+// Return the first error encountered.
+func (p *Partitioned) Sync() error {
+	for _, b := range p.parts {
+		err := b.Sync()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close closes all the partitions.
+// Return the first error encountered, all partitions are closed anyway.
+func (p *Partitioned) Close() error {
+	var err error
+	for _, b := range p.parts {
+		closeErr := b.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// partition returns the partition owning the given key.
+// Return an error if the partitioner maps the key outside of the partitions.
+func (p *Partitioned) partition(key string) (*Bitcask, error) {
+	i := p.partitioner(key, len(p.parts))
+	if i < 0 || i >= len(p.parts) {
+		return nil, fmt.Errorf("%s: %w (got %d of %d partitions)", datastore.PrintableKey(key), ErrInvalidPartition, i, len(p.parts))
+	}
+
+	return p.parts[i], nil
+}
+
+// hashPartitioner is the default partitioner, it uses the 32-bit FNV-1a hash of the key.
+func hashPartitioner(key string, n int) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+
+	return int(h % uint32(n))
+}
+
+// checkPartition verifies that the datastore is opened as the same partition it was created as.
+// A writer records the partition layout when the datastore has none.
+// Return an error if the layouts do not match or on system failures.
+func (b *Bitcask) checkPartition(index, count int) error {
+	want := fmt.Sprintf("%d/%d", index, count)
+	filePath := path.Join(b.dataStore.Path(), partitionFile)
+
+	data, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) && b.usrOpts.accessPermission == ReadWrite {
+		return os.WriteFile(filePath, []byte(want), os.FileMode(0666))
+	}
+	if err != nil {
+		return err
+	}
+
+	got := strings.TrimSpace(string(data))
+	if got != want {
+		return fmt.Errorf("%s: %w (got %s, want %s)", b.dataStore.Path(), errPartitionMismatch, got, want)
+	}
+
+	return nil
+}
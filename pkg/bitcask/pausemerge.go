@@ -0,0 +1,76 @@
+package bitcask
+
+// PauseMerge pauses the merges to yield the disk bandwidth to the foreground traffic,
+// until ResumeMerge is called. A merge in progress stops between two keys, releasing
+// the bitcask so that reads and writes go on, and keeps the records it rewrote so far.
+// Once resumed, it takes the writes made meanwhile over the records it rewrote.
+// The merges started while paused, automatic ones included, wait for ResumeMerge.
+// A merge of a bitcask opened with WithDedup only pauses before it starts.
+// A merge resumed while the bitcask is frozen fails with ErrFrozen,
+// its merge files are reclaimed by the next merge.
+func (b *Bitcask) PauseMerge() {
+	b.accessMu.Lock()
+	b.setMergePause(true, b.mergeThrottled)
+	b.accessMu.Unlock()
+}
+
+// ResumeMerge resumes the merges paused by PauseMerge.
+// The merges stay paused while the latency target of WithMergeLatencyTarget is exceeded.
+func (b *Bitcask) ResumeMerge() {
+	b.accessMu.Lock()
+	b.setMergePause(false, b.mergeThrottled)
+	b.accessMu.Unlock()
+}
+
+// MergePaused reports whether the merges are paused,
+// either by PauseMerge or by the latency target of WithMergeLatencyTarget.
+func (b *Bitcask) MergePaused() bool {
+	b.startRead()
+	defer b.endRead()
+
+	return b.mergePaused || b.mergeThrottled
+}
+
+// setMergePause sets the pause of PauseMerge and the one of the latency target,
+// the merges wait until both are lifted.
+// It is called with the access lock held.
+func (b *Bitcask) setMergePause(paused, throttled bool) {
+	wasHeld := b.mergePaused || b.mergeThrottled
+	b.mergePaused, b.mergeThrottled = paused, throttled
+	held := paused || throttled
+	if held && !wasHeld {
+		b.mergeResumed = make(chan struct{})
+	} else if !held && wasHeld {
+		close(b.mergeResumed)
+	}
+}
+
+// waitMergeResumed releases the access lock while the merges are paused
+// and reports whether it waited.
+// It is called with the access lock held and returns with it held.
+func (b *Bitcask) waitMergeResumed() bool {
+	waited := false
+	for b.mergePaused || b.mergeThrottled {
+		resumed := b.mergeResumed
+		b.accessMu.Unlock()
+		<-resumed
+		b.accessMu.Lock()
+		waited = true
+	}
+
+	return waited
+}
+
+// PauseMerge pauses the merges of all partitions.
+func (p *Partitioned) PauseMerge() {
+	for _, b := range p.parts {
+		b.PauseMerge()
+	}
+}
+
+// ResumeMerge resumes the merges of all partitions.
+func (p *Partitioned) ResumeMerge() {
+	for _, b := range p.parts {
+		b.ResumeMerge()
+	}
+}
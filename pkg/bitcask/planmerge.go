@@ -0,0 +1,69 @@
+package bitcask
+
+import (
+	"sort"
+
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+// MergePlan describes the work a merge would do if it started now.
+type MergePlan struct {
+	// Files are the data files the merge would compact and remove, ordered by name.
+	Files []string
+	// KeysWritten is the number of live records the merge would rewrite.
+	KeysWritten int
+	// KeysExpired is the number of keys the merge would drop for being older than WithMaxRecordAge.
+	KeysExpired int
+	// ReadBytes is the size in bytes of the compacted files.
+	ReadBytes int64
+	// WriteBytes is the size in bytes of the rewritten records.
+	WriteBytes int64
+	// ReclaimedBytes is the disk space the merge would free, the compacted files minus the rewritten records.
+	ReclaimedBytes int64
+}
+
+// PlanMerge reports which files a merge would compact, the bytes it would read and write
+// and the disk space it would reclaim, without changing anything or reading the files.
+// The keys deleted since the last merge are counted as rewritten, so the reclaimed
+// space is underestimated by the size of their tombstones.
+// The active file of a writer is never compacted, a reader plans for a writer
+// opening the datastore next, which compacts all the files.
+func (b *Bitcask) PlanMerge() MergePlan {
+	var plan MergePlan
+
+	b.startRead()
+
+	active := ""
+	if b.activeFile != nil {
+		active = b.activeFile.Name()
+	}
+	for name, f := range b.usage.files {
+		if name == active {
+			continue
+		}
+		plan.Files = append(plan.Files, name)
+		plan.ReadBytes += f.total
+	}
+	b.keyDir.Iterate(func(key string, rec recfmt.KeyDirRec) bool {
+		if rec.FileId == active {
+			return true
+		}
+		if b.expired(rec) {
+			plan.KeysExpired++
+			return true
+		}
+		plan.KeysWritten++
+		plan.WriteBytes += recordSize(key, rec)
+		return true
+	})
+
+	b.endRead()
+
+	sort.Strings(plan.Files)
+	plan.ReclaimedBytes = plan.ReadBytes - plan.WriteBytes
+	if plan.ReclaimedBytes < 0 {
+		plan.ReclaimedBytes = 0
+	}
+
+	return plan
+}
@@ -0,0 +1,359 @@
+package bitcask
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+	"github.com/zaher1307/bitcask/internal/keydir"
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+type (
+	// PrefixUsage reports the keys starting with a prefix configured by WithPrefixes.
+	// The records referenced by the keydir are live, tombstones included,
+	// the overwritten and deleted records are dead until a merge removes their file.
+	PrefixUsage struct {
+		// Prefix is the configured prefix, the empty prefix holds the keys matching no prefix.
+		Prefix string
+		// Keys is the number of keys in the keydir.
+		Keys int
+		// LiveBytes is the size in bytes of the live records.
+		LiveBytes int64
+		// DeadBytes is the size in bytes of the dead records.
+		DeadBytes int64
+	}
+
+	// prefixUsage tracks the keys, live bytes and dead bytes of every configured prefix.
+	// It is updated with the access lock held.
+	prefixUsage struct {
+		// prefixes are ordered from the longest, a key counts for the first one it starts with.
+		prefixes []string
+		stats    map[string]*prefixStat
+	}
+
+	// prefixStat holds the usage of a prefix, its dead bytes are kept by data file
+	// so that the bytes of the files removed by a merge are forgotten.
+	prefixStat struct {
+		keys int
+		live int64
+		dead map[string]int64
+	}
+)
+
+// WithPrefixes tracks the keys, live bytes and dead bytes of the keys starting with
+// every given prefix, reported by PrefixStats. A key counts for the longest prefix
+// it starts with, the keys matching none count for the empty prefix.
+// Opening the bitcask then reads the data files once to find the prefixes of their dead records.
+func WithPrefixes(prefixes ...string) Option {
+	return optionFunc(func(o *options) {
+		o.prefixes = append(o.prefixes, prefixes...)
+	})
+}
+
+// newPrefixUsage creates the usage of the given prefixes and the empty prefix.
+func newPrefixUsage(prefixes []string) *prefixUsage {
+	u := &prefixUsage{stats: map[string]*prefixStat{"": {dead: make(map[string]int64)}}}
+	u.prefixes = []string{""}
+	for _, prefix := range prefixes {
+		if _, isExist := u.stats[prefix]; isExist {
+			continue
+		}
+		u.stats[prefix] = &prefixStat{dead: make(map[string]int64)}
+		u.prefixes = append(u.prefixes, prefix)
+	}
+	sort.Slice(u.prefixes, func(i, j int) bool { return len(u.prefixes[i]) > len(u.prefixes[j]) })
+
+	return u
+}
+
+// stat returns the usage of the prefix the key counts for.
+func (u *prefixUsage) stat(key string) *prefixStat {
+	for _, prefix := range u.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return u.stats[prefix]
+		}
+	}
+
+	return nil
+}
+
+// load counts the live records of the keydir and the dead records of the data files of the directory.
+// A partially written record at the end of a file is ignored.
+func (u *prefixUsage) load(dirPath string, kd keydir.KeyDir) error {
+	u.count(kd)
+
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".data") {
+			continue
+		}
+		data, err := os.ReadFile(path.Join(dirPath, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		i := 0
+		for i < len(data) {
+			recLen, err := recfmt.DataFileRecLen(data[i:])
+			if err != nil {
+				break
+			}
+			rec, _, err := recfmt.ParseDataFileRec(data[i : i+int(recLen)])
+			if err != nil {
+				break
+			}
+			cur, isExist := kd.Get(rec.Key)
+			if rec.Key != recfmt.BatchKey && (!isExist || cur.FileId != entry.Name() || cur.ValuePos != uint32(i)) {
+				u.stat(rec.Key).dead[entry.Name()] += int64(recLen)
+			}
+			i += int(recLen)
+		}
+	}
+
+	return nil
+}
+
+// count counts the keys and live bytes of the keydir again.
+func (u *prefixUsage) count(kd keydir.KeyDir) {
+	for _, stat := range u.stats {
+		stat.keys, stat.live = 0, 0
+	}
+	kd.Iterate(func(key string, rec recfmt.KeyDirRec) bool {
+		stat := u.stat(key)
+		stat.keys++
+		stat.live += recordSize(key, rec)
+		return true
+	})
+}
+
+// write accounts a record of the key written to the given file,
+// replacing the previous record of the key if there is one.
+func (u *prefixUsage) write(key, fileId string, size int64, old *recfmt.KeyDirRec, oldSize int64) {
+	stat := u.stat(key)
+	stat.live += size
+	if old == nil {
+		stat.keys++
+		return
+	}
+	stat.live -= oldSize
+	stat.dead[old.FileId] += oldSize
+}
+
+// remove accounts a key removed from the keydir, its record becomes dead.
+func (u *prefixUsage) remove(key string, rec recfmt.KeyDirRec) {
+	stat := u.stat(key)
+	size := recordSize(key, rec)
+	stat.keys--
+	stat.live -= size
+	stat.dead[rec.FileId] += size
+}
+
+// forget drops the dead bytes of the removed files.
+func (u *prefixUsage) forget(files []string) {
+	for _, stat := range u.stats {
+		for _, file := range files {
+			delete(stat.dead, file)
+		}
+	}
+}
+
+// PrefixStats reports the usage of every prefix configured by WithPrefixes, ordered by prefix.
+// Return nil if no prefix is configured.
+func (b *Bitcask) PrefixStats() []PrefixUsage {
+	if b.prefixUsage == nil {
+		return nil
+	}
+
+	b.startRead()
+	defer b.endRead()
+
+	res := make([]PrefixUsage, 0, len(b.prefixUsage.prefixes))
+	for _, prefix := range b.prefixUsage.prefixes {
+		stat := b.prefixUsage.stats[prefix]
+		usage := PrefixUsage{Prefix: prefix, Keys: stat.keys, LiveBytes: stat.live}
+		for _, dead := range stat.dead {
+			usage.DeadBytes += dead
+		}
+		res = append(res, usage)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Prefix < res[j].Prefix })
+
+	return res
+}
+
+// MergePrefix compacts the keys starting with prefix independently of the others.
+// Their records outside of the active file are rewritten into merge files, deleted keys
+// included so that their older records stay deleted, then the data files no key references
+// anymore are removed along with their hint files. The space of a tenant is thus reclaimed
+// once the files it shared with the other keys hold no live record, Merge reclaims it all.
+// The expired keys are left to Merge. The files are not removed with WithDedup, they may hold
+// values shared by other keys, nor with an eviction policy, they may hold the tombstones of evicted keys.
+// Return an error if ReadWrite permission is not set or on any system failures when writing data.
+func (b *Bitcask) MergePrefix(prefix string) (MergeResult, error) {
+	res, err := b.mergePrefix(prefix)
+	b.publish(Event{Kind: MergeEvent, Err: err})
+	b.audit("merge", err, fmt.Sprintf("prefix=%q files_removed=%d keys_written=%d bytes_written=%d",
+		prefix, res.FilesRemoved, res.KeysWritten, res.BytesWritten))
+
+	return res, err
+}
+
+// mergePrefix rewrites the records of the keys starting with prefix and removes the unreferenced files.
+func (b *Bitcask) mergePrefix(prefix string) (MergeResult, error) {
+	var res MergeResult
+
+	if b.usrOpts.accessPermission == ReadOnly {
+		return res, fmt.Errorf("MergePrefix: %w", ErrReadOnly)
+	}
+
+	b.mergeMu.Lock()
+	defer b.mergeMu.Unlock()
+
+	b.accessMu.Lock()
+	if b.frozen {
+		b.accessMu.Unlock()
+		return res, fmt.Errorf("MergePrefix: %w", ErrFrozen)
+	}
+	err := b.removeKeyDirFile()
+	if err != nil {
+		b.accessMu.Unlock()
+		return res, err
+	}
+
+	keys := make([]string, 0)
+	b.keyDir.Iterate(func(key string, rec recfmt.KeyDirRec) bool {
+		if strings.HasPrefix(key, prefix) && rec.FileId != b.activeFile.Name() && !b.expired(rec) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+
+	mergeFile := datastore.NewAppendFile(b.dataStore.Path(), b.fileFlags, datastore.Merge, b.usrOpts.clock.Now, b.usrOpts.maxFileSize)
+	newRecs := make([]recfmt.KeyDirRec, len(keys))
+	for i, key := range keys {
+		rec, _ := b.keyDir.Get(key)
+		newRecs[i], _, err = b.mergeWrite(mergeFile, nil, key, rec, rec.Tstamp)
+		if errors.Is(err, datastore.ErrKeyNotExist) {
+			newRecs[i], err = b.mergeTombstone(mergeFile, key)
+		}
+		if err != nil {
+			break
+		}
+	}
+	closeErr := mergeFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		b.accessMu.Unlock()
+		return res, err
+	}
+
+	for i, key := range keys {
+		old, _ := b.keyDir.Get(key)
+		size := recordSize(key, newRecs[i])
+		b.usage.write(newRecs[i].FileId, size, &old, recordSize(key, old))
+		if b.prefixUsage != nil {
+			b.prefixUsage.write(key, newRecs[i].FileId, size, &old, recordSize(key, old))
+		}
+		b.keyDir.Set(key, newRecs[i])
+		res.KeysWritten++
+		res.BytesWritten += size
+	}
+
+	var unused []string
+	evicting := b.usrOpts.maxMemory > 0 && b.usrOpts.evictionPolicy != NoEviction
+	if !b.usrOpts.dedup && !evicting {
+		unused, err = b.unreferencedFiles()
+	}
+	b.accessMu.Unlock()
+	if err != nil {
+		return res, err
+	}
+
+	// the reads and iterators started before the keydir was updated may still use the files
+	b.readMu.Lock()
+	b.readMu.Unlock()
+	b.waitIterators()
+
+	err = b.deleteOldFiles(unused)
+	if err != nil {
+		return res, err
+	}
+	res.FilesRemoved = len(unused)
+
+	b.accessMu.Lock()
+	b.lastMerge = b.usrOpts.clock.Now()
+	usage, err := loadDiskUsage(b.dataStore.Path(), b.keyDir)
+	if err == nil {
+		b.usage = usage
+	}
+	if b.prefixUsage != nil {
+		b.prefixUsage.forget(unused)
+	}
+	b.accessMu.Unlock()
+
+	return res, err
+}
+
+// mergeTombstone rewrites the tombstone of a deleted key into the merge file.
+// It is called with the access lock held.
+func (b *Bitcask) mergeTombstone(mergeFile *datastore.AppendFile, key string) (recfmt.KeyDirRec, error) {
+	tstamp := b.usrOpts.clock.Now().UnixMicro()
+
+	n, err := mergeFile.WriteTombstone(key, tstamp)
+	if err != nil {
+		return recfmt.KeyDirRec{}, err
+	}
+
+	newRec := recfmt.KeyDirRec{
+		FileId:   mergeFile.Name(),
+		ValuePos: uint32(n),
+		Tstamp:   tstamp,
+	}
+
+	return newRec, mergeFile.WriteHint(key, newRec)
+}
+
+// unreferencedFiles lists the data files other than the active file that no key references,
+// along with their hint files.
+// It is called with the access lock held.
+func (b *Bitcask) unreferencedFiles() ([]string, error) {
+	entries, err := os.ReadDir(b.dataStore.Path())
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool)
+	b.keyDir.Iterate(func(_ string, rec recfmt.KeyDirRec) bool {
+		referenced[rec.FileId] = true
+		return true
+	})
+
+	names := make(map[string]bool)
+	for _, entry := range entries {
+		names[entry.Name()] = true
+	}
+
+	res := make([]string, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".data") || name == b.activeFile.Name() || referenced[name] {
+			continue
+		}
+		res = append(res, name)
+		if hint := strings.TrimSuffix(name, ".data") + ".hint"; names[hint] {
+			res = append(res, hint)
+		}
+	}
+
+	return res, nil
+}
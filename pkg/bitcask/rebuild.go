@@ -0,0 +1,150 @@
+package bitcask
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+	"github.com/zaher1307/bitcask/internal/keydir"
+	"github.com/zaher1307/bitcask/internal/recfmt"
+	"github.com/zaher1307/bitcask/internal/sio"
+)
+
+// RebuildResult summarizes the work done by RebuildHints.
+type RebuildResult struct {
+	// HintsChecked is the number of data files whose hint file was checked.
+	HintsChecked int
+	// HintsRebuilt is the number of missing or corrupted hint files written again.
+	HintsRebuilt int
+	// HintsRemoved is the number of hint files removed as their data file does not exist.
+	HintsRemoved int
+	// DamagedFiles lists the data files with a corrupted or truncated record,
+	// their hint file only covers the records before the damaged one.
+	DamagedFiles []string
+}
+
+// RebuildHints scans the data files of the datastore at the given path and writes again
+// the hint files that are missing or do not match their data file, then rebuilds the keydir file.
+// It fixes datastores whose hint files were deleted, damaged or written by older versions.
+// The datastore must not be opened by any other process while the hints are rebuilt.
+func RebuildHints(dataStorePath string) (RebuildResult, error) {
+	var res RebuildResult
+
+	if _, err := os.Stat(dataStorePath); err != nil {
+		return res, err
+	}
+
+	dataStore, err := datastore.NewDataStore(dataStorePath, datastore.ExclusiveLock)
+	if err != nil {
+		return res, err
+	}
+	defer dataStore.Close()
+
+	entries, err := os.ReadDir(dataStorePath)
+	if err != nil {
+		return res, err
+	}
+
+	dataFiles := make(map[string]bool)
+	hintFiles := make([]string, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		switch {
+		case strings.HasSuffix(name, ".data"):
+			dataFiles[strings.TrimSuffix(name, ".data")] = true
+		case strings.HasSuffix(name, ".hint"):
+			hintFiles = append(hintFiles, name)
+		}
+	}
+
+	for _, name := range hintFiles {
+		if !dataFiles[strings.TrimSuffix(name, ".hint")] {
+			err := os.Remove(path.Join(dataStorePath, name))
+			if err != nil {
+				return res, err
+			}
+			res.HintsRemoved++
+		}
+	}
+
+	ids := make([]string, 0, len(dataFiles))
+	for id := range dataFiles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		rebuilt, damaged, err := rebuildHint(dataStorePath, id)
+		if err != nil {
+			return res, err
+		}
+		res.HintsChecked++
+		if rebuilt {
+			res.HintsRebuilt++
+		}
+		if damaged {
+			res.DamagedFiles = append(res.DamagedFiles, id+".data")
+		}
+	}
+
+	err = keydir.RemoveFile(dataStorePath)
+	if err != nil {
+		return res, err
+	}
+	_, _, err = keydir.New(dataStorePath, keydir.SharedKeyDir, keydir.MapKind, false)
+	if err != nil {
+		return res, err
+	}
+
+	return res, nil
+}
+
+// rebuildHint checks the hint file of the data file with the given id
+// against the records of the data file and writes it again if they do not match.
+// Return whether the hint file was written and whether the data file is damaged.
+func rebuildHint(dataStorePath, id string) (bool, bool, error) {
+	data, err := os.ReadFile(path.Join(dataStorePath, id+".data"))
+	if err != nil {
+		return false, false, err
+	}
+
+	hint := make([]byte, 0)
+	_, err = recfmt.ScanDataFile(data, func(rec *recfmt.DataRec, offset uint32) {
+		hint = append(hint, recfmt.CompressHintFileRec(rec.Key, recfmt.KeyDirRec{
+			ValuePos:  offset,
+			ValueSize: rec.ValueSize,
+			Tstamp:    rec.Tstamp,
+		})...)
+	})
+	damaged := err != nil
+
+	hintPath := path.Join(dataStorePath, id+".hint")
+	old, err := os.ReadFile(hintPath)
+	if err == nil && bytes.Equal(old, hint) {
+		return false, damaged, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return false, damaged, err
+	}
+
+	file, err := sio.OpenFile(hintPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(0666))
+	if err != nil {
+		return false, damaged, err
+	}
+	_, err = file.Write(hint)
+	if err != nil {
+		file.File.Close()
+		return false, damaged, fmt.Errorf("%s: %w", hintPath, err)
+	}
+	err = file.File.Sync()
+	if err != nil {
+		file.File.Close()
+		return false, damaged, err
+	}
+
+	return true, damaged, file.File.Close()
+}
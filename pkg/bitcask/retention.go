@@ -0,0 +1,75 @@
+package bitcask
+
+import (
+	"log"
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+// WithMaxRecordAge makes the datastore keep the records for the given duration only.
+// Get reports the keys written longer ago as missing, and Merge drops them from
+// the merged files whether they were deleted or not, the other methods still
+// report them until they are merged.
+// The records of the active file are only dropped once a later merge finds them in an older file.
+func WithMaxRecordAge(age time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.maxRecordAge = age
+	})
+}
+
+// WithRetentionSweep makes a writer merge the datastore every interval,
+// to reclaim the space of the records older than WithMaxRecordAge without calling Merge.
+// The failed sweeps are logged and retried at the next interval.
+func WithRetentionSweep(interval time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.sweepInterval = interval
+	})
+}
+
+// expired reports whether the record is older than the retention period.
+func (b *Bitcask) expired(rec recfmt.KeyDirRec) bool {
+	if b.usrOpts.maxRecordAge <= 0 {
+		return false
+	}
+
+	return b.usrOpts.clock.Now().UnixMicro()-rec.Tstamp > b.usrOpts.maxRecordAge.Microseconds()
+}
+
+// startSweeper merges the datastore every sweep interval until stopSweeper is called.
+func (b *Bitcask) startSweeper() {
+	b.sweepStop = make(chan struct{})
+	b.sweepDone = make(chan struct{})
+
+	go func() {
+		defer close(b.sweepDone)
+
+		ticker := time.NewTicker(b.usrOpts.sweepInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.sweepStop:
+				return
+			case <-ticker.C:
+				res, err := b.merge()
+				if err != nil {
+					log.Printf("bitcask: retention sweep of %s failed: %v", b.dataStore.Path(), err)
+				} else if res.KeysExpired > 0 {
+					log.Printf("bitcask: retention sweep of %s dropped %d expired keys", b.dataStore.Path(), res.KeysExpired)
+				}
+			}
+		}
+	}()
+}
+
+// stopSweeper stops the sweeper and waits for the sweep in progress, if any.
+// The sweeper is stopped once, the later calls do nothing.
+func (b *Bitcask) stopSweeper() {
+	if b.sweepStop == nil {
+		return
+	}
+
+	close(b.sweepStop)
+	<-b.sweepDone
+	b.sweepStop, b.sweepDone = nil, nil
+}
@@ -0,0 +1,45 @@
+package bitcask
+
+import (
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/sio"
+)
+
+// ErrReadTimeout happens whenever reading a value takes longer than the timeout set by WithReadTimeout.
+var ErrReadTimeout = sio.ErrTimeout
+
+// WithReadRetries makes the reads of values try up to attempts times on transient errors,
+// waiting backoff before the first retry and doubling the wait after every retry.
+// It defaults to 5 attempts with a backoff of 1ms, other errors are never retried.
+func WithReadRetries(attempts int, backoff time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.readPolicy.Attempts = attempts
+		o.readPolicy.Backoff = backoff
+	})
+}
+
+// WithReadTimeout bounds the duration of the read of a value, retries included,
+// the read fails with ErrReadTimeout once the timeout expires.
+// It is meant for network file systems that may hang, by default reads have no timeout.
+func WithReadTimeout(timeout time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.readPolicy.Timeout = timeout
+	})
+}
+
+// IsTransient reports whether the error returned by a read may go away when the read is retried,
+// such as interrupted system calls, temporarily unavailable resources and timeouts.
+// Corruptions, missing keys and missing files are not transient.
+func IsTransient(err error) bool {
+	return sio.IsTransient(err)
+}
+
+// WithMaxOpenFiles sets the number of data files kept open for reading values,
+// so that most reads do not open and close their file. The least recently read files
+// are closed beyond it, it defaults to 64 and 0 opens the file on every read.
+func WithMaxOpenFiles(max int) Option {
+	return optionFunc(func(o *options) {
+		o.maxOpenFiles = max
+	})
+}
@@ -0,0 +1,39 @@
+//go:build unix
+
+package bitcask
+
+import (
+	"errors"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+func TestReadTimeout(t *testing.T) {
+	b, _ := Open(testBitcaskPath, ReadWrite, WithReadTimeout(50*time.Millisecond))
+
+	// reading a fifo without writer hangs like an unresponsive network file system
+	fifo := path.Join(testBitcaskPath, "hung.data")
+	err := syscall.Mkfifo(fifo, 0666)
+	if err != nil {
+		t.Skip(err)
+	}
+	b.keyDir.Set("key12", recfmt.KeyDirRec{FileId: "hung.data", ValueSize: 10})
+
+	_, err = b.Get("key12")
+	if !errors.Is(err, ErrReadTimeout) || !IsTransient(err) {
+		t.Errorf("got:%v, want a transient %v", err, ErrReadTimeout)
+	}
+
+	// release the hung read
+	w, err := os.OpenFile(fifo, os.O_WRONLY, 0)
+	if err == nil {
+		w.Close()
+	}
+	b.Close()
+	os.RemoveAll(testBitcaskPath)
+}
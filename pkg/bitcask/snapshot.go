@@ -0,0 +1,16 @@
+package bitcask
+
+// OpenSnapshot opens a copy of a datastore, such as a backup, for offline analysis.
+// The copy is opened without taking the datastore lock, so a lock file copied along
+// with the files does not get in the way, and nothing is ever written to it:
+// the writes fail with ErrReadOnly, the keydir file is not shared and the audit log is not kept.
+// All the files are treated as sealed, the directory must not be written while it is open.
+// It takes the same options as Open, the access permission options are ignored.
+// Return an error if the directory does not exist or on system failures.
+func OpenSnapshot(dirPath string, opts ...Option) (*Bitcask, error) {
+	usrOpts := parseUsrOpts(opts)
+	usrOpts.accessPermission = ReadOnly
+	usrOpts.audit = false
+
+	return open(dirPath, usrOpts, true)
+}
@@ -0,0 +1,184 @@
+package bitcask
+
+import (
+	"container/heap"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+type (
+	// Stats summarizes the health of the datastore.
+	Stats struct {
+		// Keys is the number of keys which are not deleted, expired keys included until a merge.
+		Keys int
+		// LiveBytes is the size in bytes of the records referenced by the keydir.
+		LiveBytes int64
+		// DeadBytes is the size in bytes of the overwritten and deleted records.
+		DeadBytes int64
+		// DataFiles is the number of data files, the active file included.
+		DataFiles int
+		// KeyDirBytes is the size of the keydir in bytes, estimated as in MemoryUsage.
+		KeyDirBytes int64
+		// LastMerge is when the last merge finished, it is zero
+		// if no merge ran since the bitcask was opened.
+		LastMerge time.Time
+	}
+
+	// KeyStat represents the size metadata of a single key.
+	KeyStat struct {
+		Key       string
+		ValueSize int64
+	}
+
+	// keyStatHeap is a min heap of key stats ordered by value size.
+	keyStatHeap []KeyStat
+)
+
+// Stats reports the health of the datastore for monitoring, the dead bytes
+// tell when a merge is worth running. It answers from the counters kept
+// up to date by the writes and merges, without walking the keydir.
+func (b *Bitcask) Stats() Stats {
+	b.startRead()
+	defer b.endRead()
+
+	return Stats{
+		Keys:        b.keyDir.Len() - len(b.deleted),
+		LiveBytes:   b.usage.total - b.usage.dead,
+		DeadBytes:   b.usage.dead,
+		DataFiles:   len(b.usage.files),
+		KeyDirBytes: b.keyDirBytes,
+		LastMerge:   b.lastMerge,
+	}
+}
+
+// LargestKeys returns the n keys with the largest values,
+// ordered from the largest to the smallest.
+// It only uses the keydir metadata and does not read the data files.
+func (b *Bitcask) LargestKeys(n int) []KeyStat {
+	if n <= 0 {
+		return []KeyStat{}
+	}
+
+	h := make(keyStatHeap, 0, n)
+
+	b.startRead()
+	b.keyDir.Iterate(func(key string, rec recfmt.KeyDirRec) bool {
+		stat := KeyStat{Key: key, ValueSize: int64(rec.ValueSize)}
+		if len(h) < n {
+			heap.Push(&h, stat)
+		} else if h[0].ValueSize < stat.ValueSize {
+			h[0] = stat
+			heap.Fix(&h, 0)
+		}
+		return true
+	})
+	b.endRead()
+
+	res := []KeyStat(h)
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].ValueSize != res[j].ValueSize {
+			return res[i].ValueSize > res[j].ValueSize
+		}
+		return res[i].Key < res[j].Key
+	})
+
+	return res
+}
+
+// MostWrittenKeys returns the n keys written the most times, ordered from the most written,
+// ignoring keys written once. The writes are the records of the key in the data files,
+// deleted keys included, so they are counted since the last merge which dropped the overwritten
+// records, unlike the write counters of WithAccessTracking counted since the bitcask was opened.
+// It reads all the data files as AnalyzeFragmentation does.
+// Return an error on system failures.
+func (b *Bitcask) MostWrittenKeys(n int) ([]HotKey, error) {
+	if n <= 0 {
+		return []HotKey{}, nil
+	}
+
+	entries, err := os.ReadDir(b.dataStore.Path())
+	if err != nil {
+		return nil, err
+	}
+
+	writes := make(map[string]int)
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".data") {
+			continue
+		}
+		err := countWrites(path.Join(b.dataStore.Path(), entry.Name()), writes)
+		if os.IsNotExist(err) {
+			// the file was removed by a merge since the directory was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res := make([]HotKey, 0)
+	for key, w := range writes {
+		if w > 1 {
+			res = append(res, HotKey{Key: key, Writes: w})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Writes != res[j].Writes {
+			return res[i].Writes > res[j].Writes
+		}
+		return res[i].Key < res[j].Key
+	})
+	if len(res) > n {
+		res = res[:n]
+	}
+
+	return res, nil
+}
+
+// countWrites adds the records of every key of the data file to writes,
+// the batch headers and a partially written record at the end of the file are ignored.
+func countWrites(file string, writes map[string]int) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	i := 0
+	for i < len(data) {
+		recLen, err := recfmt.DataFileRecLen(data[i:])
+		if err != nil {
+			break
+		}
+		rec, _, err := recfmt.ParseDataFileRec(data[i : i+int(recLen)])
+		if err != nil {
+			break
+		}
+		if rec.Key != recfmt.BatchKey {
+			writes[rec.Key]++
+		}
+		i += int(recLen)
+	}
+
+	return nil
+}
+
+func (h keyStatHeap) Len() int           { return len(h) }
+func (h keyStatHeap) Less(i, j int) bool { return h[i].ValueSize < h[j].ValueSize }
+func (h keyStatHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *keyStatHeap) Push(x any) {
+	*h = append(*h, x.(KeyStat))
+}
+
+func (h *keyStatHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
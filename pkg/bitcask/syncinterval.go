@@ -0,0 +1,56 @@
+package bitcask
+
+import (
+	"log"
+	"time"
+)
+
+// WithSyncInterval makes a writer flush the active file to the disk every interval,
+// a middle ground between WithSyncOnPut and WithSyncOnDemand: a crash loses at most
+// the writes of the last interval, and the writes do not wait for the disk.
+// It has no effect along with WithSyncOnPut. The failed flushes are logged
+// and retried at the next interval.
+func WithSyncInterval(interval time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.syncInterval = interval
+	})
+}
+
+// startSyncer flushes the active file every sync interval until stopSyncer is called.
+func (b *Bitcask) startSyncer() {
+	b.syncStop = make(chan struct{})
+	b.syncDone = make(chan struct{})
+
+	go func() {
+		defer close(b.syncDone)
+
+		ticker := time.NewTicker(b.usrOpts.syncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.syncStop:
+				return
+			case <-ticker.C:
+				// the active file is not replaced by a rotation while it is flushed
+				b.accessMu.RLock()
+				err := b.activeFile.Sync()
+				b.accessMu.RUnlock()
+				if err != nil {
+					log.Printf("bitcask: periodic sync of %s failed: %v", b.dataStore.Path(), err)
+				}
+			}
+		}
+	}()
+}
+
+// stopSyncer stops the syncer and waits for the flush in progress, if any.
+// The syncer is stopped once, the later calls do nothing.
+func (b *Bitcask) stopSyncer() {
+	if b.syncStop == nil {
+		return
+	}
+
+	close(b.syncStop)
+	<-b.syncDone
+	b.syncStop, b.syncDone = nil, nil
+}
@@ -0,0 +1,45 @@
+package bitcask
+
+import (
+	"runtime"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+)
+
+// ForceUnlock releases the lock this process holds on the datastore in dirPath,
+// so it can be opened again after a bitcask was left open, by a panic for example.
+// The bitcask left open must not be used anymore: its writes are no longer protected
+// from the new writer, and its pending writes may be lost.
+// The locks held by other processes are left untouched.
+// Return an error if the lock could not be released.
+func ForceUnlock(dirPath string) error {
+	_, err := datastore.ForceUnlock(dirPath)
+	return err
+}
+
+// Reopen releases the lock this process holds on the datastore in dirPath, if any,
+// then opens it with the given options as Open does.
+// It is meant for test suites and supervised restarts recovering from a bitcask
+// that was never closed, see ForceUnlock.
+func Reopen(dirPath string, opts ...Option) (*Bitcask, error) {
+	err := ForceUnlock(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return Open(dirPath, opts...)
+}
+
+// setFinalizer releases the lock of the bitcask if it is garbage collected without being closed,
+// so the datastore can be opened again without waiting for the process to exit.
+// The unsynced writes of such a bitcask are lost.
+func (b *Bitcask) setFinalizer() {
+	runtime.SetFinalizer(b, func(b *Bitcask) {
+		b.dataStore.Close()
+	})
+}
+
+// clearFinalizer removes the finalizer once the bitcask is closed.
+func (b *Bitcask) clearFinalizer() {
+	runtime.SetFinalizer(b, nil)
+}
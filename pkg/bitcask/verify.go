@@ -0,0 +1,91 @@
+package bitcask
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/zaher1307/bitcask/internal/datastore"
+	"github.com/zaher1307/bitcask/internal/recfmt"
+)
+
+const (
+	// AlwaysVerify validates the checksum of every record read by Get.
+	AlwaysVerify VerifyMode = 0
+	// VerifySampled validates the checksum of one out of verifySampleRate records read by Get.
+	VerifySampled VerifyMode = 1
+	// NoVerify never validates the checksum of records read by Get.
+	NoVerify VerifyMode = 2
+
+	// verifySampleRate is the number of reads per validated read in VerifySampled mode.
+	verifySampleRate = 64
+)
+
+// ErrCorruption happens whenever a record fails its checksum validation,
+// the errors returned are CorruptionError values locating the record.
+var ErrCorruption = recfmt.ErrDataCorruption
+
+// CorruptionError locates a corrupted record by its data file, offset and key.
+type CorruptionError = datastore.CorruptionError
+
+// VerifyMode specifies how often the checksums of the read records are validated.
+// Merge always validates the records it rewrites regardless of the mode.
+type VerifyMode int
+
+// WithVerify sets the checksum validation mode of the read path, it defaults to AlwaysVerify.
+func WithVerify(mode VerifyMode) Option {
+	return optionFunc(func(o *options) {
+		o.verifyMode = mode
+	})
+}
+
+// WithCorruptionHandler registers a function called with the key and the error
+// whenever a corrupted record is detected while reading.
+func WithCorruptionHandler(handler func(key string, err error)) Option {
+	return optionFunc(func(o *options) {
+		o.corruptionHandler = handler
+	})
+}
+
+// Corruptions returns the number of corrupted records detected while reading
+// since the bitcask was opened.
+func (b *Bitcask) Corruptions() uint64 {
+	return atomic.LoadUint64(&b.corruptions)
+}
+
+// shouldVerify decides whether the next read validates the record checksum.
+func (b *Bitcask) shouldVerify() bool {
+	switch b.usrOpts.verifyMode {
+	case NoVerify:
+		return false
+	case VerifySampled:
+		return atomic.AddUint64(&b.reads, 1)%verifySampleRate == 0
+	default:
+		return true
+	}
+}
+
+// readValue reads the value of the given keydir record from its data file
+// and reports the detected corruptions.
+func (b *Bitcask) readValue(key string, rec recfmt.KeyDirRec, verify bool) (string, error) {
+	data, err := b.readRecord(key, rec, verify)
+	if err != nil {
+		return "", err
+	}
+
+	return data.Value, nil
+}
+
+// readRecord reads the given keydir record from its data file, along with the metadata
+// stored with its value, and reports the detected corruptions.
+func (b *Bitcask) readRecord(key string, rec recfmt.KeyDirRec, verify bool) (*recfmt.DataRec, error) {
+	data, err := b.dataStore.ReadRecordFromFile(rec.FileId, key, rec.ValuePos, rec.ValueSize, verify)
+	if errors.Is(err, recfmt.ErrDataCorruption) {
+		atomic.AddUint64(&b.corruptions, 1)
+		b.publish(Event{Kind: CorruptionEvent, Key: key, Err: err})
+		if b.usrOpts.corruptionHandler != nil {
+			b.usrOpts.corruptionHandler(key, err)
+		}
+	}
+
+	return data, err
+}
@@ -0,0 +1,361 @@
+// Package cache uses a bitcask datastore as a persistent cache with expiring entries.
+// Cache stores string values by string keys, and the Ristretto and Store adapters follow
+// the method sets of the ristretto and gocache caches, so the code written against them
+// only changes the constructor. The adapters take keys and values of any type as these
+// libraries do: the keys are strings, byte slices or integers, and the values are stored
+// encoded with encoding/gob, so their types other than the basic ones must be registered
+// with gob.Register.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// expiresMeta is the metadata of the cache records holding their expiry time,
+// in microseconds since the epoch.
+const expiresMeta = "cache-expires"
+
+var (
+	// ErrNotFound happens whenever a key is missing from the cache or expired.
+	ErrNotFound = errors.New("key not found in cache")
+
+	// ErrInvalidKey happens whenever an adapter is given a key of an unsupported type.
+	ErrInvalidKey = errors.New("unsupported cache key type")
+)
+
+type (
+	// Cache stores the entries of a cache in a bitcask datastore, under keys starting with its prefix.
+	// It is safe for concurrent use as the datastore is.
+	Cache struct {
+		db     *bitcask.Bitcask
+		prefix string
+		now    func() time.Time
+	}
+
+	// Ristretto is a cache with the methods of a ristretto cache. The entries are written
+	// by Set before it returns, so Wait has nothing to wait for, and the costs are ignored.
+	Ristretto struct {
+		c *Cache
+	}
+
+	// Store is a cache with the methods of a gocache store, except Set taking the ttl
+	// instead of the options of gocache.
+	Store struct {
+		c *Cache
+	}
+)
+
+// New returns a cache storing its entries in the given datastore under keys starting with prefix,
+// so that several caches and other data can share the datastore.
+func New(db *bitcask.Bitcask, prefix string) *Cache {
+	return &Cache{db: db, prefix: prefix, now: time.Now}
+}
+
+// Get returns the value of key along with the time left before it expires, 0 for an entry without expiry.
+// Return ErrNotFound if key is missing or expired, or an error on any failure of the datastore.
+func (c *Cache) Get(key string) (string, time.Duration, error) {
+	value, meta, err := c.db.GetWithMeta(c.prefix + key)
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return "", 0, fmt.Errorf("%s: %w", key, ErrNotFound)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	ttl := time.Duration(0)
+	if expires, isSet := expiry(meta); isSet {
+		ttl = expires.Sub(c.now())
+		if ttl <= 0 {
+			return "", 0, fmt.Errorf("%s: %w", key, ErrNotFound)
+		}
+	}
+
+	return value, ttl, nil
+}
+
+// Set stores value by key, the entry expires after ttl unless ttl is 0.
+// Return an error on any failure of the datastore.
+func (c *Cache) Set(key, value string, ttl time.Duration) error {
+	var meta map[string]string
+	if ttl > 0 {
+		expires := c.now().Add(ttl)
+		meta = map[string]string{expiresMeta: strconv.FormatInt(expires.UnixMicro(), 10)}
+	}
+
+	return c.db.PutWithMeta(c.prefix+key, value, meta)
+}
+
+// Delete removes key from the cache, a missing key is not an error.
+// Return an error on any failure of the datastore.
+func (c *Cache) Delete(key string) error {
+	err := c.db.Delete(c.prefix + key)
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// Clear removes all the entries of the cache.
+// Return an error on any failure of the datastore.
+func (c *Cache) Clear() error {
+	it := c.db.Scan(c.prefix)
+	defer it.Close()
+
+	for it.Next() {
+		err := c.db.Delete(it.Key())
+		if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+			return err
+		}
+	}
+
+	return it.Err()
+}
+
+// Cleanup removes the expired entries of the cache, the expired entries are never
+// returned but take space until removed. An entry set again meanwhile is kept.
+// Return the number of entries removed, or an error on any failure of the datastore.
+func (c *Cache) Cleanup() (int, error) {
+	it := c.db.Scan(c.prefix)
+	defer it.Close()
+
+	n := 0
+	now := c.now()
+	for it.Next() {
+		key := it.Key()
+		keyMeta, err := c.db.KeyMeta(key)
+		if err != nil {
+			continue
+		}
+		_, meta, err := c.db.GetWithMeta(key)
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		if expires, isSet := expiry(meta); !isSet || now.Before(expires) {
+			continue
+		}
+		// the entry is only removed if it was not set again since it was read
+		deleted, err := c.db.DeleteIf(key, func(_ string, m bitcask.KeyMeta) bool {
+			return m.Tstamp.Equal(keyMeta.Tstamp)
+		})
+		if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+			return n, err
+		}
+		if deleted {
+			n++
+		}
+	}
+
+	return n, it.Err()
+}
+
+// NewRistretto returns the ristretto adapter of the cache.
+func NewRistretto(c *Cache) *Ristretto {
+	return &Ristretto{c: c}
+}
+
+// Get returns the value of key and whether it was found.
+// The failures of the datastore are reported as misses.
+func (r *Ristretto) Get(key interface{}) (interface{}, bool) {
+	k, err := keyString(key)
+	if err != nil {
+		return nil, false
+	}
+	value, _, err := r.c.Get(k)
+	if err != nil {
+		return nil, false
+	}
+	v, err := decodeValue(value)
+	if err != nil {
+		return nil, false
+	}
+
+	return v, true
+}
+
+// Set stores value by key without expiry and returns whether it was stored.
+func (r *Ristretto) Set(key, value interface{}, cost int64) bool {
+	return r.SetWithTTL(key, value, cost, 0)
+}
+
+// SetWithTTL stores value by key for ttl and returns whether it was stored.
+func (r *Ristretto) SetWithTTL(key, value interface{}, cost int64, ttl time.Duration) bool {
+	k, err := keyString(key)
+	if err != nil {
+		return false
+	}
+	v, err := encodeValue(value)
+	if err != nil {
+		return false
+	}
+
+	return r.c.Set(k, v, ttl) == nil
+}
+
+// Del removes key from the cache, its failures are dropped as Del has no result.
+func (r *Ristretto) Del(key interface{}) {
+	k, err := keyString(key)
+	if err != nil {
+		return
+	}
+	r.c.Delete(k)
+}
+
+// GetTTL returns the time left before key expires and whether it was found,
+// 0 for an entry without expiry.
+func (r *Ristretto) GetTTL(key interface{}) (time.Duration, bool) {
+	k, err := keyString(key)
+	if err != nil {
+		return 0, false
+	}
+	_, ttl, err := r.c.Get(k)
+
+	return ttl, err == nil
+}
+
+// Clear removes all the entries of the cache, its failures are dropped as Clear has no result.
+func (r *Ristretto) Clear() {
+	r.c.Clear()
+}
+
+// Wait returns at once, the entries are written by Set.
+func (r *Ristretto) Wait() {}
+
+// Close does nothing, the datastore is closed by its owner.
+func (r *Ristretto) Close() {}
+
+// NewStore returns the gocache adapter of the cache.
+func NewStore(c *Cache) *Store {
+	return &Store{c: c}
+}
+
+// Get returns the value of key.
+// Return ErrNotFound if key is missing or expired, or an error on any failure of the datastore.
+func (s *Store) Get(ctx context.Context, key any) (any, error) {
+	v, _, err := s.GetWithTTL(ctx, key)
+	return v, err
+}
+
+// GetWithTTL returns the value of key along with the time left before it expires,
+// 0 for an entry without expiry.
+// Return ErrNotFound if key is missing or expired, or an error on any failure of the datastore.
+func (s *Store) GetWithTTL(_ context.Context, key any) (any, time.Duration, error) {
+	k, err := keyString(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	value, ttl, err := s.c.Get(k)
+	if err != nil {
+		return nil, 0, err
+	}
+	v, err := decodeValue(value)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return v, ttl, nil
+}
+
+// Set stores value by key, the entry expires after ttl unless ttl is 0.
+// Return an error if the value cannot be encoded or on any failure of the datastore.
+func (s *Store) Set(_ context.Context, key, value any, ttl time.Duration) error {
+	k, err := keyString(key)
+	if err != nil {
+		return err
+	}
+	v, err := encodeValue(value)
+	if err != nil {
+		return err
+	}
+
+	return s.c.Set(k, v, ttl)
+}
+
+// Delete removes key from the cache, a missing key is not an error.
+// Return an error on any failure of the datastore.
+func (s *Store) Delete(_ context.Context, key any) error {
+	k, err := keyString(key)
+	if err != nil {
+		return err
+	}
+
+	return s.c.Delete(k)
+}
+
+// Clear removes all the entries of the cache.
+// Return an error on any failure of the datastore.
+func (s *Store) Clear(_ context.Context) error {
+	return s.c.Clear()
+}
+
+// GetType returns the type of the store.
+func (s *Store) GetType() string {
+	return "bitcask"
+}
+
+// keyString returns the cache key of a key given to an adapter.
+// Return ErrInvalidKey for the keys other than strings, byte slices and integers.
+func keyString(key interface{}) (string, error) {
+	switch k := key.(type) {
+	case string:
+		return k, nil
+	case []byte:
+		return string(k), nil
+	case int:
+		return strconv.FormatInt(int64(k), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(k), 10), nil
+	case int64:
+		return strconv.FormatInt(k, 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(k), 10), nil
+	case uint64:
+		return strconv.FormatUint(k, 10), nil
+	}
+
+	return "", fmt.Errorf("%T: %w", key, ErrInvalidKey)
+}
+
+// encodeValue encodes a value given to an adapter along with its type.
+func encodeValue(value interface{}) (string, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(&value)
+	if err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// decodeValue decodes a value encoded by encodeValue.
+func decodeValue(value string) (interface{}, error) {
+	var v interface{}
+	err := gob.NewDecoder(strings.NewReader(value)).Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// expiry returns the expiry time held by the metadata of a cache record and whether it is set.
+func expiry(meta map[string]string) (time.Time, bool) {
+	expires, err := strconv.ParseInt(meta[expiresMeta], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.UnixMicro(expires), true
+}
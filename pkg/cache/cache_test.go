@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// openTestCache opens a cache over a datastore in a temporary directory,
+// reading the time from now, which holds microseconds as the expiry times do.
+func openTestCache(t *testing.T, now *time.Time) (*Cache, *bitcask.Bitcask) {
+	t.Helper()
+
+	b, err := bitcask.Open(t.TempDir(), bitcask.ReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	c := New(b, "cache:")
+	c.now = func() time.Time { return *now }
+
+	return c, b
+}
+
+func TestCache(t *testing.T) {
+	now := time.UnixMicro(time.Now().UnixMicro())
+	c, b := openTestCache(t, &now)
+	b.Put("other", "value")
+
+	c.Set("kept", "1", 0)
+	c.Set("expiring", "2", time.Minute)
+	if value, ttl, err := c.Get("expiring"); value != "2" || ttl != time.Minute || err != nil {
+		t.Errorf("got:%q, %v, %v, want:2, 1m0s", value, ttl, err)
+	}
+
+	now = now.Add(time.Minute)
+	if _, _, err := c.Get("expiring"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got:%v, want:%v", err, ErrNotFound)
+	}
+	if value, ttl, err := c.Get("kept"); value != "1" || ttl != 0 || err != nil {
+		t.Errorf("got:%q, %v, %v, want:1 without expiry", value, ttl, err)
+	}
+	if n, err := c.Cleanup(); n != 1 || err != nil {
+		t.Errorf("got:%d, %v, want:1 entry removed", n, err)
+	}
+
+	if err := c.Delete("missing"); err != nil {
+		t.Errorf("got:%v, want:nil", err)
+	}
+	if err := c.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.Get("kept"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got:%v, want:%v", err, ErrNotFound)
+	}
+	// the keys outside of the prefix are left alone
+	if value, _ := b.Get("other"); value != "value" {
+		t.Errorf("got:%q, want:value", value)
+	}
+}
+
+func TestRistretto(t *testing.T) {
+	now := time.UnixMicro(time.Now().UnixMicro())
+	c, _ := openTestCache(t, &now)
+	r := NewRistretto(c)
+
+	if !r.Set("key", 42, 1) || !r.SetWithTTL([]byte("bytes"), []byte("v"), 1, time.Second) || !r.Set(7, "seven", 1) {
+		t.Fatal("Expected the values to be stored")
+	}
+	r.Wait()
+	if v, found := r.Get("key"); !found || v != 42 {
+		t.Errorf("got:%v, %t, want:42", v, found)
+	}
+	if v, found := r.Get(7); !found || v != "seven" {
+		t.Errorf("got:%v, %t, want:seven", v, found)
+	}
+	if ttl, found := r.GetTTL("bytes"); !found || ttl != time.Second {
+		t.Errorf("got:%v, %t, want:1s", ttl, found)
+	}
+	if r.Set(1.5, "float", 1) {
+		t.Error("Expected a float key to be rejected")
+	}
+
+	r.Del("key")
+	if _, found := r.Get("key"); found {
+		t.Error("Expected the deleted key to be missing")
+	}
+	now = now.Add(time.Second)
+	if _, found := r.Get("bytes"); found {
+		t.Error("Expected the expired key to be missing")
+	}
+}
+
+func TestStore(t *testing.T) {
+	now := time.UnixMicro(time.Now().UnixMicro())
+	c, _ := openTestCache(t, &now)
+	s := NewStore(c)
+	ctx := context.Background()
+	gob.Register(map[string]int{})
+
+	if err := s.Set(ctx, "key", map[string]int{"a": 1}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	v, ttl, err := s.GetWithTTL(ctx, "key")
+	if m, ok := v.(map[string]int); !ok || m["a"] != 1 || ttl != time.Minute || err != nil {
+		t.Errorf("got:%v, %v, %v, want:map[a:1], 1m0s", v, ttl, err)
+	}
+	if err := s.Delete(ctx, "key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got:%v, want:%v", err, ErrNotFound)
+	}
+	if _, err := s.Get(ctx, 1.5); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("got:%v, want:%v", err, ErrInvalidKey)
+	}
+	if s.GetType() != "bitcask" {
+		t.Errorf("got:%q, want:bitcask", s.GetType())
+	}
+}
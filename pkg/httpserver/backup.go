@@ -0,0 +1,259 @@
+package httpserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+const (
+	// backupsDir is the spool directory of the backup snapshots.
+	backupsDir = "backups"
+	// restoresDir is the spool directory of the uploaded backups.
+	restoresDir = "restores"
+
+	// offsetHeader holds the number of bytes of an uploaded file received so far.
+	offsetHeader = "Upload-Offset"
+)
+
+// backupReply is the reply to the creation of a backup snapshot.
+type backupReply struct {
+	ID       string                  `json:"id"`
+	Manifest *bitcask.BackupManifest `json:"manifest"`
+}
+
+// backups serves the backup snapshots:
+//
+//	POST /backups                 takes a snapshot and replies with its id and manifest.
+//	GET /backups/{id}/{file}      downloads a file of the snapshot, ranges resume downloads.
+//	DELETE /backups/{id}          removes the snapshot.
+func (s *server) backups(w http.ResponseWriter, r *http.Request) {
+	parts := pathParts(r, "/backups")
+	for _, part := range parts {
+		if !validName(part) {
+			http.Error(w, "invalid name", http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodPost && len(parts) == 0:
+		s.createBackup(w)
+	case r.Method == http.MethodGet && len(parts) == 2:
+		s.serveFile(w, r, path.Join(s.cfg.SpoolDir, backupsDir, parts[0], parts[1]))
+	case r.Method == http.MethodDelete && len(parts) == 1:
+		err := os.RemoveAll(path.Join(s.cfg.SpoolDir, backupsDir, parts[0]))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+// createBackup takes a snapshot of the datastore into the spool directory.
+func (s *server) createBackup(w http.ResponseWriter) {
+	id, err := newID()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	dir := path.Join(s.cfg.SpoolDir, backupsDir, id)
+	manifest, err := s.db.Backup(dir, s.cfg.SigningKey)
+	if err != nil {
+		// an interrupted snapshot has no manifest and is of no use
+		if removeErr := os.RemoveAll(dir); removeErr != nil {
+			err = fmt.Errorf("%v, %v", err, removeErr)
+		}
+		code := http.StatusInternalServerError
+		if errors.Is(err, bitcask.ErrFrozen) {
+			code = http.StatusConflict
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, backupReply{ID: id, Manifest: manifest})
+}
+
+// serveFile serves the file at the given path, with support for range requests.
+func (s *server) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	file, err := os.Open(name)
+	if os.IsNotExist(err) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.ServeContent(w, r, path.Base(name), stat.ModTime(), file)
+}
+
+// restores receives backups and restores them as new datastores:
+//
+//	HEAD /restores/{name}/{file}  replies with the bytes of the file received so far.
+//	PUT /restores/{name}/{file}?offset=n  appends the body to the file, n must be the bytes received so far.
+//	POST /restores/{name}         verifies the uploaded backup and restores it under the restore directory.
+func (s *server) restores(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.RestoreDir == "" {
+		http.Error(w, "restores are disabled", http.StatusForbidden)
+		return
+	}
+
+	parts := pathParts(r, "/restores")
+	for _, part := range parts {
+		if !validName(part) {
+			http.Error(w, "invalid name", http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodHead && len(parts) == 2:
+		size, err := fileSize(path.Join(s.cfg.SpoolDir, restoresDir, parts[0], parts[1]))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(offsetHeader, strconv.FormatInt(size, 10))
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPut && len(parts) == 2:
+		s.uploadFile(w, r, parts[0], parts[1])
+	case r.Method == http.MethodPost && len(parts) == 1:
+		s.restore(w, parts[0])
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+// uploadFile appends the request body to an uploaded file of the named backup.
+// The offset must match the bytes received so far, so an interrupted upload
+// is resumed from the offset replied by HEAD. Files larger than the upload limit
+// are sent in several requests.
+func (s *server) uploadFile(w http.ResponseWriter, r *http.Request, name, fileName string) {
+	offset := int64(0)
+	if query := r.URL.Query().Get("offset"); query != "" {
+		var err error
+		offset, err = strconv.ParseInt(query, 10, 64)
+		if err != nil || offset < 0 {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if r.ContentLength > s.cfg.MaxUploadSize {
+		msg := fmt.Sprintf("body of %d bytes exceeds the maximum of %d bytes", r.ContentLength, s.cfg.MaxUploadSize)
+		http.Error(w, msg, http.StatusRequestEntityTooLarge)
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, s.cfg.MaxUploadSize)
+
+	dir := path.Join(s.cfg.SpoolDir, restoresDir, name)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	file, err := os.OpenFile(path.Join(dir, fileName), os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if offset != size {
+		w.Header().Set(offsetHeader, strconv.FormatInt(size, 10))
+		http.Error(w, fmt.Sprintf("offset %d does not match the %d bytes received", offset, size), http.StatusConflict)
+		return
+	}
+
+	n, copyErr := io.Copy(file, body)
+	syncErr := file.Sync()
+	w.Header().Set(offsetHeader, strconv.FormatInt(size+n, 10))
+	var maxErr *http.MaxBytesError
+	if errors.As(copyErr, &maxErr) {
+		msg := fmt.Sprintf("body exceeds the maximum of %d bytes, upload stopped at %d bytes", maxErr.Limit, size+n)
+		http.Error(w, msg, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if copyErr != nil || syncErr != nil {
+		msg := fmt.Sprintf("upload interrupted at %d bytes", size+n)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restore verifies the named uploaded backup and restores it as a new datastore
+// in the restore directory, the uploaded files are removed once restored.
+func (s *server) restore(w http.ResponseWriter, name string) {
+	dir := path.Join(s.cfg.SpoolDir, restoresDir, name)
+	manifest, err := bitcask.Restore(dir, path.Join(s.cfg.RestoreDir, name), s.cfg.SigningKey)
+	if errors.Is(err, bitcask.ErrBackupInvalid) || os.IsNotExist(err) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = os.RemoveAll(dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, manifest)
+}
+
+// fileSize returns the size of the named file, or 0 if it does not exist.
+func fileSize(name string) (int64, error) {
+	stat, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return stat.Size(), nil
+}
+
+// newID returns a random id for a backup snapshot.
+func newID() (string, error) {
+	buf := make([]byte, 8)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,214 @@
+// Package httpserver serves a bitcask datastore over HTTP,
+// for the operations that need to stream files such as remote backups.
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/zaher1307/bitcask/pkg/auth"
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+const (
+	// defaultMaxUploadSize is the largest upload request body when Config.MaxUploadSize is not set.
+	defaultMaxUploadSize = 64 << 20
+	// maxHeaderBytes is the largest size of the request headers.
+	maxHeaderBytes = 64 << 10
+)
+
+// ErrNoAuth happens whenever the server is started on an address reachable from other hosts
+// without authenticating the requests.
+var ErrNoAuth = errors.New("authentication is required to listen on a non loopback address")
+
+type (
+	// Config configures the HTTP server.
+	Config struct {
+		// SpoolDir holds the backup snapshots served to the clients and the uploaded backups,
+		// it is created readable by the owner only. The default is a new directory in the
+		// system temporary directory, so the snapshots do not outlive the server.
+		SpoolDir string
+		// RestoreDir is the directory under which the uploaded backups are restored
+		// as new datastores, restores are rejected when it is empty.
+		RestoreDir string
+		// SigningKey signs the manifests of the backups and, when it is not empty,
+		// the uploaded backups must be signed with it to be restored.
+		SigningKey []byte
+		// Auth authenticates the requests with HTTP basic authentication,
+		// when it is nil every request is allowed and the server only listens on a loopback address.
+		Auth auth.Authenticator
+		// MaxUploadSize is the largest body of an upload request in bytes, the default is 64MB.
+		// Larger files are uploaded in several requests.
+		MaxUploadSize int64
+	}
+
+	// server represents an HTTP server serving a bitcask datastore.
+	server struct {
+		db  *bitcask.Bitcask
+		cfg Config
+		mux *http.ServeMux
+	}
+)
+
+// StartServer opens the datastore in the given directory with read and write permission
+// and serves it on the given address until the server fails.
+// Return ErrNoAuth if the address is not a loopback address and cfg.Auth is nil.
+func StartServer(dirPath, addr string, cfg Config) error {
+	if cfg.Auth == nil && !isLoopback(addr) {
+		return ErrNoAuth
+	}
+
+	b, err := bitcask.Open(dirPath, bitcask.WithReadWrite())
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	s, err := newServer(b, cfg)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:           addr,
+		Handler:        s,
+		MaxHeaderBytes: maxHeaderBytes,
+	}
+
+	return srv.ListenAndServe()
+}
+
+// newServer creates a server for the given datastore and its spool directory.
+func newServer(b *bitcask.Bitcask, cfg Config) (*server, error) {
+	if cfg.MaxUploadSize <= 0 {
+		cfg.MaxUploadSize = defaultMaxUploadSize
+	}
+	if cfg.SpoolDir == "" {
+		// a fixed name in the shared temporary directory could be created beforehand by another user
+		dir, err := os.MkdirTemp("", "bitcask-http-")
+		if err != nil {
+			return nil, err
+		}
+		cfg.SpoolDir = dir
+	}
+	for _, dir := range []string{backupsDir, restoresDir} {
+		err := os.MkdirAll(path.Join(cfg.SpoolDir, dir), 0700)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s := &server{
+		db:  b,
+		cfg: cfg,
+		mux: http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/backups", s.backups)
+	s.mux.HandleFunc("/backups/", s.backups)
+	s.mux.HandleFunc("/restores/", s.restores)
+
+	return s, nil
+}
+
+// isLoopback reports whether the listen address only accepts connections from the local host,
+// the address without a host listens on every interface.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+// ServeHTTP authorizes the request and dispatches it to the handler of its path.
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorize(w, r) {
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// authorize checks the credentials of the request against the permission needed by its path,
+// it replies with an error and returns false if the request is not allowed.
+func (s *server) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if s.cfg.Auth == nil {
+		return true
+	}
+
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="bitcask"`)
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return false
+	}
+
+	identity, err := s.cfg.Auth.Authenticate(user, password)
+	if errors.Is(err, auth.ErrUnauthorized) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="bitcask"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	if !identity.Permissions.Has(pathPermission(r.URL.Path)) {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
+
+// pathPermission returns the permission needed to request the given path.
+// The backups hold all the data and the restores create datastores,
+// so both are administrative operations.
+func pathPermission(p string) auth.Permission {
+	switch {
+	case p == "/backups" || strings.HasPrefix(p, "/backups/"):
+		return auth.Admin | auth.Read
+	default:
+		return auth.Admin
+	}
+}
+
+// pathParts splits the path after the given prefix into its non empty parts.
+func pathParts(r *http.Request, prefix string) []string {
+	parts := make([]string, 0)
+	for _, part := range strings.Split(strings.TrimPrefix(r.URL.Path, prefix), "/") {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	return parts
+}
+
+// validName reports whether name can be used as a file or directory name in the spool,
+// rejecting path separators and dot files.
+func validName(name string) bool {
+	return name != "" && name == path.Base(name) && name[0] != '.' && !strings.Contains(name, "\\")
+}
+
+// writeJSON replies with the given value encoded as JSON.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Printf("httpserver: cannot reply: %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package httpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/zaher1307/bitcask/pkg/auth"
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// startTestServer opens a datastore with a few keys and serves it on a local address.
+func startTestServer(t *testing.T, setup ...func(cfg *Config)) (*httptest.Server, Config) {
+	t.Helper()
+
+	dir := t.TempDir()
+	b, err := bitcask.Open(path.Join(dir, "db"), bitcask.ReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	for i := 0; i < 100; i++ {
+		b.Put(fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i))
+	}
+
+	cfg := Config{
+		SpoolDir:   path.Join(dir, "spool"),
+		RestoreDir: path.Join(dir, "restored"),
+		SigningKey: []byte("secret"),
+	}
+	for _, fn := range setup {
+		fn(&cfg)
+	}
+	s, err := newServer(b, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+
+	return ts, cfg
+}
+
+func do(t *testing.T, method, url string, body []byte, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res, data
+}
+
+func TestBackupStream(t *testing.T) {
+	ts, cfg := startTestServer(t)
+
+	res, data := do(t, http.MethodPost, ts.URL+"/backups", nil, nil)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("create backup: got %d %s", res.StatusCode, data)
+	}
+	var backup backupReply
+	err := json.Unmarshal(data, &backup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{"manifest.json"}
+	for _, file := range backup.Manifest.Files {
+		names = append(names, file.Name)
+	}
+	for _, name := range names {
+		url := ts.URL + "/backups/" + backup.ID + "/" + name
+		_, whole := do(t, http.MethodGet, url, nil, nil)
+
+		// the download is interrupted after 10 bytes and resumed with a range
+		upload := fmt.Sprintf("%s/restores/copy/%s", ts.URL, name)
+		do(t, http.MethodPut, upload, whole[:10], nil)
+		res, _ := do(t, http.MethodHead, upload, nil, nil)
+		offset := res.Header.Get(offsetHeader)
+		if offset != "10" {
+			t.Fatalf("%s: got offset %q, want %q", name, offset, "10")
+		}
+		res, rest := do(t, http.MethodGet, url, nil, http.Header{"Range": {"bytes=" + offset + "-"}})
+		if res.StatusCode != http.StatusPartialContent || !bytes.Equal(rest, whole[10:]) {
+			t.Fatalf("%s: got %d with %d bytes, want the rest of the file", name, res.StatusCode, len(rest))
+		}
+
+		res, _ = do(t, http.MethodPut, upload+"?offset=5", rest, nil)
+		if res.StatusCode != http.StatusConflict || res.Header.Get(offsetHeader) != "10" {
+			t.Errorf("%s: got %d, want the wrong offset to be rejected", name, res.StatusCode)
+		}
+		res, _ = do(t, http.MethodPut, upload+"?offset="+offset, rest, nil)
+		if res.StatusCode != http.StatusNoContent {
+			t.Fatalf("%s: upload got %d", name, res.StatusCode)
+		}
+	}
+
+	res, data = do(t, http.MethodPost, ts.URL+"/restores/copy", nil, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("restore: got %d %s", res.StatusCode, data)
+	}
+	b, err := bitcask.Open(path.Join(cfg.RestoreDir, "copy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		value, _ := b.Get(fmt.Sprintf("key%d", i))
+		if value != fmt.Sprintf("value%d", i) {
+			t.Errorf("got:%q, want:%q", value, fmt.Sprintf("value%d", i))
+		}
+	}
+	b.Close()
+
+	res, _ = do(t, http.MethodDelete, ts.URL+"/backups/"+backup.ID, nil, nil)
+	if _, err := os.Stat(path.Join(cfg.SpoolDir, backupsDir, backup.ID)); res.StatusCode != http.StatusNoContent || !os.IsNotExist(err) {
+		t.Errorf("delete backup: got %d, %v", res.StatusCode, err)
+	}
+}
+
+func TestRestoreRejectsInvalidBackup(t *testing.T) {
+	ts, _ := startTestServer(t)
+
+	res, _ := do(t, http.MethodPut, ts.URL+"/restores/bad/manifest.json", []byte(`{"files":[]}`), nil)
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("upload got %d", res.StatusCode)
+	}
+	res, _ = do(t, http.MethodPost, ts.URL+"/restores/bad", nil, nil)
+	if res.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("got %d, want the unsigned backup to be rejected", res.StatusCode)
+	}
+
+	res, _ = do(t, http.MethodGet, ts.URL+"/backups/..%2f/keydir", nil, nil)
+	if res.StatusCode == http.StatusOK {
+		t.Errorf("Expected paths outside the spool to be rejected")
+	}
+}
+
+func TestAuth(t *testing.T) {
+	ts, _ := startTestServer(t, func(cfg *Config) {
+		cfg.Auth = auth.NewStatic(
+			auth.NewUser("admin", "pass", "ops", auth.Read|auth.Admin),
+			auth.NewUser("app", "pass", "app", auth.Read|auth.Write),
+		)
+	})
+
+	basic := func(user, password string) http.Header {
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(user, password)
+		return req.Header
+	}
+
+	res, _ := do(t, http.MethodPost, ts.URL+"/backups", nil, nil)
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("without credentials: got %d", res.StatusCode)
+	}
+	res, _ = do(t, http.MethodPost, ts.URL+"/backups", nil, basic("admin", "wrong"))
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("with a wrong password: got %d", res.StatusCode)
+	}
+	res, _ = do(t, http.MethodPost, ts.URL+"/backups", nil, basic("app", "pass"))
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("without admin permission: got %d", res.StatusCode)
+	}
+	res, _ = do(t, http.MethodPost, ts.URL+"/backups", nil, basic("admin", "pass"))
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("with admin permission: got %d", res.StatusCode)
+	}
+}
+
+func TestUploadLimit(t *testing.T) {
+	ts, _ := startTestServer(t, func(cfg *Config) {
+		cfg.MaxUploadSize = 16
+	})
+
+	upload := ts.URL + "/restores/copy/1.data"
+	res, _ := do(t, http.MethodPut, upload, bytes.Repeat([]byte("x"), 17), nil)
+	if res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("got %d, want the large body to be rejected", res.StatusCode)
+	}
+	res, _ = do(t, http.MethodPut, upload, bytes.Repeat([]byte("x"), 16), nil)
+	if res.StatusCode != http.StatusNoContent || res.Header.Get(offsetHeader) != "16" {
+		t.Errorf("got %d with offset %q", res.StatusCode, res.Header.Get(offsetHeader))
+	}
+}
+
+func TestStartServerWithoutAuth(t *testing.T) {
+	for _, addr := range []string{":0", "0.0.0.0:0", "[::]:0"} {
+		if err := StartServer(t.TempDir(), addr, Config{}); !errors.Is(err, ErrNoAuth) {
+			t.Errorf("%s: got %v, want %v", addr, err, ErrNoAuth)
+		}
+	}
+	for _, addr := range []string{"127.0.0.1:8080", "[::1]:8080", "localhost:8080"} {
+		if !isLoopback(addr) {
+			t.Errorf("Expected %s to be a loopback address", addr)
+		}
+	}
+}
+
+func TestDefaultSpoolDir(t *testing.T) {
+	b, err := bitcask.Open(t.TempDir(), bitcask.ReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	s, err := newServer(b, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(s.cfg.SpoolDir)
+
+	info, err := os.Stat(s.cfg.SpoolDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		t.Errorf("got %v, want the spool directory private to its owner", perm)
+	}
+}
@@ -0,0 +1,138 @@
+// Package lockclient acquires locks with fencing tokens from a bitcask RESP server,
+// as the single instance locks of Redlock do with SET NX PX.
+package lockclient
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tidwall/resp"
+)
+
+// tokenSize is the number of random bytes of the tokens identifying the owners of the locks.
+const tokenSize = 16
+
+// ErrLockHeld happens whenever Acquire finds the lock held by another owner.
+var ErrLockHeld = errors.New("lock is held")
+
+type (
+	// Client sends the lock commands to a server over a single connection.
+	// It is safe for concurrent use, the commands are sent one at a time.
+	Client struct {
+		mu   sync.Mutex
+		conn net.Conn
+		rd   *resp.Reader
+		wr   *resp.Writer
+	}
+
+	// Lock is a lock acquired by Acquire.
+	Lock struct {
+		// Name is the key of the lock.
+		Name string
+		// Token is the random token identifying the owner of the lock.
+		Token string
+		// Fence is the fencing token of the lock, greater than the fence of every lock
+		// acquired before it on the server. It should be passed along with the requests
+		// to the guarded resources, which reject the fences lower than the greatest they saw.
+		Fence int64
+		// Validity is when the lock expires at the latest, measured from before
+		// the command was sent, the owner must be done by then.
+		Validity time.Time
+	}
+)
+
+// Dial connects to the server listening on addr.
+func Dial(addr string) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{conn: conn, rd: resp.NewReader(bufio.NewReader(conn)), wr: resp.NewWriter(conn)}, nil
+}
+
+// Close closes the connection, the locks acquired are left to expire or to other clients to release.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Auth authenticates the client on a server started with users.
+func (c *Client) Auth(user, password string) error {
+	_, err := c.do("AUTH", user, password)
+
+	return err
+}
+
+// Acquire acquires the lock of the given name for ttl with a new random token.
+// Return ErrLockHeld if the lock is held, or an error if the server failed.
+func (c *Client) Acquire(name string, ttl time.Duration) (Lock, error) {
+	if ttl < time.Millisecond {
+		return Lock{}, fmt.Errorf("lockclient: ttl %v is under a millisecond", ttl)
+	}
+	buf := make([]byte, tokenSize)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return Lock{}, err
+	}
+	token := hex.EncodeToString(buf)
+
+	start := time.Now()
+	v, err := c.do("LOCK", name, token, ttl.Milliseconds())
+	if err != nil {
+		return Lock{}, err
+	}
+	if v.IsNull() {
+		return Lock{}, fmt.Errorf("lockclient: %s: %w", name, ErrLockHeld)
+	}
+
+	return Lock{Name: name, Token: token, Fence: int64(v.Integer()), Validity: start.Add(ttl)}, nil
+}
+
+// Release releases the lock if it is still held by its owner.
+// Return whether the lock was released, or an error if the server failed.
+func (c *Client) Release(lock Lock) (bool, error) {
+	v, err := c.do("UNLOCK", lock.Name, lock.Token)
+	if err != nil {
+		return false, err
+	}
+
+	return v.Integer() == 1, nil
+}
+
+// Held reports whether the lock is still held by its owner with the same fence.
+// Return an error if the server failed.
+func (c *Client) Held(lock Lock) (bool, error) {
+	v, err := c.do("LOCKHELD", lock.Name, lock.Token, lock.Fence)
+	if err != nil {
+		return false, err
+	}
+
+	return v.Integer() == 1, nil
+}
+
+// do sends a command and returns its reply.
+// Return the error replied by the server as an error.
+func (c *Client) do(cmd string, args ...interface{}) (resp.Value, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err := c.wr.WriteMultiBulk(cmd, args...)
+	if err != nil {
+		return resp.Value{}, err
+	}
+	v, _, err := c.rd.ReadValue()
+	if err != nil {
+		return resp.Value{}, err
+	}
+	if v.Type() == resp.Error {
+		return resp.Value{}, fmt.Errorf("lockclient: %s: %w", cmd, v.Error())
+	}
+
+	return v, nil
+}
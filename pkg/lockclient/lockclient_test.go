@@ -0,0 +1,75 @@
+package lockclient
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+	"github.com/zaher1307/bitcask/pkg/respserver"
+)
+
+// startTestServer starts a resp server on a free port with a datastore
+// in a temporary directory and returns a connected client.
+func startTestServer(t *testing.T) *Client {
+	t.Helper()
+
+	b, err := bitcask.Open(t.TempDir(), bitcask.ReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := respserver.New(b, respserver.Config{})
+	go srv.Serve(l)
+	t.Cleanup(func() { srv.Close() })
+
+	c, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func TestLock(t *testing.T) {
+	c := startTestServer(t)
+
+	first, err := c.Acquire("lock", 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Acquire("lock", time.Second); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("got:%v, want:%v", err, ErrLockHeld)
+	}
+	if held, err := c.Held(first); !held || err != nil {
+		t.Errorf("got:%v, %v, want the lock held", held, err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	second, err := c.Acquire("lock", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Fence <= first.Fence || second.Token == first.Token {
+		t.Errorf("got:%+v after %+v, want a greater fence and a new token", second, first)
+	}
+	if held, _ := c.Held(first); held {
+		t.Error("Expected the expired lock not to be held")
+	}
+	if released, _ := c.Release(first); released {
+		t.Error("Expected the expired lock not to be released")
+	}
+	if released, err := c.Release(second); !released || err != nil {
+		t.Errorf("got:%v, %v, want the lock released", released, err)
+	}
+	if held, _ := c.Held(second); held {
+		t.Error("Expected the released lock not to be held")
+	}
+}
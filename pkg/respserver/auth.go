@@ -0,0 +1,133 @@
+package respserver
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/tidwall/resp"
+	"github.com/zaher1307/bitcask/pkg/auth"
+)
+
+// defaultUser is the user authenticated by AUTH when only a password is given.
+const defaultUser = "default"
+
+// commandPermissions holds the permission needed to run each command,
+// the commands not listed can be run before authenticating.
+var commandPermissions = map[string]auth.Permission{
+	"get":       auth.Read,
+	"scan":      auth.Read,
+	"object":    auth.Read,
+	"memory":    auth.Read,
+	"info":      auth.Read,
+	"subscribe": auth.Read,
+	"lockheld":  auth.Read,
+	"smembers":  auth.Read,
+	"lrange":    auth.Read,
+	"hget":      auth.Read,
+	"hgetall":   auth.Read,
+	"set":       auth.Write,
+	"del":       auth.Write,
+	"incr":      auth.Write,
+	"decr":      auth.Write,
+	"incrby":    auth.Write,
+	"decrby":    auth.Write,
+	"append":    auth.Write,
+	"lock":      auth.Write,
+	"unlock":    auth.Write,
+	"sadd":      auth.Write,
+	"srem":      auth.Write,
+	"lpush":     auth.Write,
+	"rpush":     auth.Write,
+	"hset":      auth.Write,
+	"config":    auth.Admin,
+	"slowlog":   auth.Admin,
+}
+
+// commandPermission returns the permission needed to run the given command.
+func commandPermission(name string, args []resp.Value) auth.Permission {
+	if name == "client" {
+		// a client can always manage its own connection
+		if len(args) > 1 {
+			switch strings.ToLower(args[1].String()) {
+			case "list", "kill":
+				return auth.Admin
+			}
+		}
+		return 0
+	}
+
+	return commandPermissions[name]
+}
+
+// authorize checks that the client is allowed to run the given command,
+// it replies with an error and returns false if it is not.
+func (s *server) authorize(c *client, name string, args []resp.Value) bool {
+	c.mu.Lock()
+	identity := c.identity
+	c.mu.Unlock()
+
+	if s.cfg.Auth != nil {
+		want := commandPermission(name, args)
+		if want != 0 && identity == nil {
+			c.wr.writeError("NOAUTH Authentication required.")
+			return false
+		}
+		if want != 0 && !identity.Permissions.Has(want) {
+			c.wr.writeError("NOPERM this user has no permissions to run the '" + name + "' command")
+			return false
+		}
+	}
+
+	role := ""
+	if identity != nil {
+		role = identity.Role
+	}
+	if rules, isExist := s.cfg.Roles[role]; isExist && !rules.allows(name, args) {
+		c.wr.writeError("NOPERM this user has no permissions to run the '" + name + "' command")
+		return false
+	}
+
+	return true
+}
+
+// authCmd authenticates the connection, AUTH [username] password.
+func (s *server) authCmd(c *client, args []resp.Value) {
+	if len(args) != 2 && len(args) != 3 {
+		wrongArgs(c, args)
+		return
+	}
+
+	user, password := defaultUser, args[1].String()
+	if len(args) == 3 {
+		user, password = args[1].String(), args[2].String()
+	}
+
+	if s.authenticate(c, user, password) {
+		c.wr.writeSimpleString("OK")
+	}
+}
+
+// authenticate sets the identity of the connection to the given user,
+// it replies with an error and returns false if the user is not authenticated.
+func (s *server) authenticate(c *client, user, password string) bool {
+	if s.cfg.Auth == nil {
+		c.wr.writeError("ERR AUTH called without any password configured for the default user.")
+		return false
+	}
+
+	identity, err := s.cfg.Auth.Authenticate(user, password)
+	if errors.Is(err, auth.ErrUnauthorized) {
+		c.wr.writeError("WRONGPASS " + err.Error())
+		return false
+	}
+	if err != nil {
+		c.wr.writeError("ERR " + err.Error())
+		return false
+	}
+
+	c.mu.Lock()
+	c.identity = &identity
+	c.mu.Unlock()
+
+	return true
+}
@@ -0,0 +1,215 @@
+package respserver
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tidwall/resp"
+	"github.com/zaher1307/bitcask/pkg/auth"
+)
+
+type (
+	// client represents a connection to the server.
+	// The fields guarded by mu are read by other connections through CLIENT LIST.
+	// wrMu serializes the replies with the notifications pushed to the subscribed client.
+	client struct {
+		id      int64
+		conn    net.Conn
+		rd      *requestReader
+		wr      *replyWriter
+		wrMu    sync.Mutex
+		created time.Time
+		closed  bool
+		subs    map[string]func()
+
+		mu         sync.Mutex
+		name       string
+		lastCmd    string
+		lastActive time.Time
+		bytesIn    int64
+		identity   *auth.Identity
+	}
+
+	// clients tracks the connected clients by id.
+	clients struct {
+		mu     sync.Mutex
+		byId   map[int64]*client
+		nextId int64
+	}
+)
+
+// newClients creates an empty client registry.
+func newClients() *clients {
+	return &clients{
+		byId: make(map[int64]*client),
+	}
+}
+
+// add registers a new client for the given connection.
+func (cs *clients) add(conn net.Conn, limits Limits) *client {
+	now := time.Now()
+	c := &client{
+		id:         atomic.AddInt64(&cs.nextId, 1),
+		conn:       conn,
+		rd:         newRequestReader(conn, limits),
+		wr:         newReplyWriter(conn),
+		created:    now,
+		subs:       make(map[string]func()),
+		lastActive: now,
+	}
+
+	cs.mu.Lock()
+	cs.byId[c.id] = c
+	cs.mu.Unlock()
+
+	return c
+}
+
+// remove closes the connection of the client and unregisters it.
+func (cs *clients) remove(c *client) {
+	cs.mu.Lock()
+	delete(cs.byId, c.id)
+	cs.mu.Unlock()
+
+	c.conn.Close()
+}
+
+// list returns the connected clients ordered by id.
+func (cs *clients) list() []*client {
+	cs.mu.Lock()
+	res := make([]*client, 0, len(cs.byId))
+	for _, c := range cs.byId {
+		res = append(res, c)
+	}
+	cs.mu.Unlock()
+
+	sort.Slice(res, func(i, j int) bool { return res[i].id < res[j].id })
+
+	return res
+}
+
+// received records a command of n bytes read from the client.
+func (c *client) received(n int, cmd string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.bytesIn += int64(n)
+	c.lastCmd = strings.ToLower(cmd)
+	c.lastActive = time.Now()
+}
+
+// info describes the client in the CLIENT LIST format.
+func (c *client) info(now time.Time) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return fmt.Sprintf("id=%d addr=%s name=%s age=%d idle=%d cmd=%s tot-net-in=%d tot-net-out=%d resp=%d",
+		c.id, c.conn.RemoteAddr(), c.name, int64(now.Sub(c.created).Seconds()),
+		int64(now.Sub(c.lastActive).Seconds()), c.lastCmd, c.bytesIn, atomic.LoadInt64(&c.wr.written), c.wr.proto)
+}
+
+// validClientName checks that the name can be given to a connection,
+// it replies with an error and returns false if it cannot.
+func validClientName(c *client, name string) bool {
+	if strings.ContainsAny(name, " \r\n") {
+		c.wr.writeError("ERR Client names cannot contain spaces, newlines or special characters.")
+		return false
+	}
+
+	return true
+}
+
+// clientCmd manages the connections, CLIENT ID | GETNAME | SETNAME name | LIST | KILL addr | KILL ID id | KILL ADDR addr.
+func (s *server) clientCmd(c *client, args []resp.Value) {
+	if len(args) < 2 {
+		wrongArgs(c, args)
+		return
+	}
+
+	switch strings.ToLower(args[1].String()) {
+	case "id":
+		c.wr.writeInteger(c.id)
+	case "getname":
+		c.mu.Lock()
+		name := c.name
+		c.mu.Unlock()
+		if name == "" {
+			c.wr.writeNull()
+		} else {
+			c.wr.writeBulk(name)
+		}
+	case "setname":
+		if len(args) != 3 {
+			wrongArgs(c, args)
+			return
+		}
+		name := args[2].String()
+		if !validClientName(c, name) {
+			return
+		}
+		c.mu.Lock()
+		c.name = name
+		c.mu.Unlock()
+		c.wr.writeSimpleString("OK")
+	case "list":
+		now := time.Now()
+		var sb strings.Builder
+		for _, other := range s.clients.list() {
+			sb.WriteString(other.info(now))
+			sb.WriteString("\n")
+		}
+		c.wr.writeBulk(sb.String())
+	case "kill":
+		s.clientKill(c, args)
+	default:
+		c.wr.writeError("ERR unknown subcommand '" + args[1].String() + "'. Try CLIENT ID, GETNAME, SETNAME, LIST or KILL.")
+	}
+}
+
+// clientKill closes the connections matching the given filter.
+func (s *server) clientKill(c *client, args []resp.Value) {
+	var match func(other *client) bool
+	switch {
+	case len(args) == 3:
+		addr := args[2].String()
+		match = func(other *client) bool { return other.conn.RemoteAddr().String() == addr }
+	case len(args) == 4 && strings.ToLower(args[2].String()) == "addr":
+		addr := args[3].String()
+		match = func(other *client) bool { return other.conn.RemoteAddr().String() == addr }
+	case len(args) == 4 && strings.ToLower(args[2].String()) == "id":
+		id := int64(args[3].Integer())
+		match = func(other *client) bool { return other.id == id }
+	default:
+		c.wr.writeError("ERR syntax error")
+		return
+	}
+
+	killed := 0
+	for _, other := range s.clients.list() {
+		if !match(other) {
+			continue
+		}
+		killed++
+		if other == c {
+			// the reply is sent before the connection is closed
+			c.closed = true
+		} else {
+			other.conn.Close()
+		}
+	}
+
+	if len(args) == 3 {
+		if killed == 0 {
+			c.wr.writeError("ERR No such client")
+		} else {
+			c.wr.writeSimpleString("OK")
+		}
+	} else {
+		c.wr.writeInteger(int64(killed))
+	}
+}
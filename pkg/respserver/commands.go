@@ -0,0 +1,451 @@
+package respserver
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/resp"
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+const (
+	// errOOM is the reply to writes rejected by the memory limit.
+	errOOM = "OOM command not allowed when used memory > 'maxmemory'."
+
+	// errValueTooLarge is the reply to writes of values larger than the datastore stores.
+	errValueTooLarge = "ERR value exceeds the maximum value size"
+
+	// scanCount is the number of keys SCAN returns when COUNT is not given.
+	scanCount = 10
+)
+
+// commands returns the handlers of all the supported commands by name.
+func (s *server) commands() map[string]handler {
+	return map[string]handler{
+		"ping":        s.ping,
+		"quit":        s.quit,
+		"hello":       s.hello,
+		"auth":        s.authCmd,
+		"set":         s.set,
+		"get":         s.get,
+		"del":         s.del,
+		"info":        s.info,
+		"memory":      s.memory,
+		"slowlog":     s.slowlogCmd,
+		"client":      s.clientCmd,
+		"incr":        s.incr,
+		"decr":        s.incr,
+		"incrby":      s.incr,
+		"decrby":      s.incr,
+		"append":      s.appendCmd,
+		"object":      s.object,
+		"config":      s.config,
+		"scan":        s.scan,
+		"subscribe":   s.subscribe,
+		"unsubscribe": s.unsubscribe,
+		"lock":        s.lock,
+		"unlock":      s.unlock,
+		"lockheld":    s.lockHeld,
+		"sadd":        s.sadd,
+		"srem":        s.srem,
+		"smembers":    s.smembers,
+		"lpush":       s.push,
+		"rpush":       s.push,
+		"lrange":      s.lrange,
+		"hset":        s.hset,
+		"hget":        s.hget,
+		"hgetall":     s.hgetall,
+	}
+}
+
+func (s *server) ping(c *client, args []resp.Value) {
+	switch len(args) {
+	case 1:
+		c.wr.writeSimpleString("PONG")
+	case 2:
+		c.wr.writeBulk(args[1].String())
+	default:
+		wrongArgs(c, args)
+	}
+}
+
+func (s *server) quit(c *client, args []resp.Value) {
+	c.wr.writeSimpleString("OK")
+	c.closed = true
+}
+
+// hello negotiates the protocol version, HELLO [protover [AUTH username password] [SETNAME clientname]].
+// The connection is authenticated and named before switching the protocol.
+func (s *server) hello(c *client, args []resp.Value) {
+	proto := c.wr.proto
+	if len(args) >= 2 {
+		proto = args[1].Integer()
+		if proto != resp2 && proto != resp3 {
+			c.wr.writeError("NOPROTO unsupported protocol version")
+			return
+		}
+	}
+
+	var user, password, name string
+	withAuth, withName := false, false
+	for i := 2; i < len(args); i++ {
+		option := strings.ToLower(args[i].String())
+		switch {
+		case option == "auth" && i+2 < len(args):
+			withAuth = true
+			user, password = args[i+1].String(), args[i+2].String()
+			i += 2
+		case option == "setname" && i+1 < len(args):
+			withName = true
+			name = args[i+1].String()
+			if !validClientName(c, name) {
+				return
+			}
+			i++
+		default:
+			c.wr.writeError("ERR Syntax error in HELLO option '" + args[i].String() + "'")
+			return
+		}
+	}
+
+	if withAuth && !s.authenticate(c, user, password) {
+		return
+	}
+	if withName {
+		c.mu.Lock()
+		c.name = name
+		c.mu.Unlock()
+	}
+	c.wr.proto = proto
+
+	c.wr.writeMap(4)
+	c.wr.writeBulk("server")
+	c.wr.writeBulk("bitcask")
+	c.wr.writeBulk("proto")
+	c.wr.writeInteger(int64(c.wr.proto))
+	c.wr.writeBulk("mode")
+	c.wr.writeBulk("standalone")
+	c.wr.writeBulk("role")
+	c.wr.writeBulk("master")
+}
+
+// set stores a value, SET key value [NX [PX milliseconds|EX seconds]].
+func (s *server) set(c *client, args []resp.Value) {
+	if len(args) < 3 {
+		wrongArgs(c, args)
+		return
+	}
+	if len(args) > 3 {
+		s.setNX(c, args)
+		return
+	}
+
+	err := s.db.Put(args[1].String(), args[2].String())
+	if errors.Is(err, bitcask.ErrInvalidKey) {
+		c.wr.writeError("ERR invalid key")
+	} else if errors.Is(err, bitcask.ErrValueTooLarge) {
+		c.wr.writeError(errValueTooLarge)
+	} else if errors.Is(err, bitcask.ErrOutOfMemory) {
+		c.wr.writeError(errOOM)
+	} else if err != nil {
+		c.wr.writeError("ERR cannot set key to value in this store")
+	} else {
+		c.wr.writeSimpleString("OK")
+	}
+}
+
+func (s *server) get(c *client, args []resp.Value) {
+	if len(args) != 2 {
+		wrongArgs(c, args)
+		return
+	}
+
+	value, err := s.db.Get(args[1].String())
+	if err != nil {
+		c.wr.writeNull()
+	} else {
+		c.wr.writeBulk(value)
+	}
+}
+
+func (s *server) del(c *client, args []resp.Value) {
+	if len(args) != 2 {
+		wrongArgs(c, args)
+		return
+	}
+
+	err := s.db.Delete(args[1].String())
+	if err != nil {
+		c.wr.writeError("ERR cannot delete this item")
+	} else {
+		c.wr.writeSimpleString("OK")
+	}
+}
+
+// scan iterates over the keys, SCAN cursor [COUNT count].
+// The cursor starts and ends at 0, the other cursors are the hex encoded last key
+// of the previous reply so that the scan resumes after it.
+func (s *server) scan(c *client, args []resp.Value) {
+	if len(args) != 2 && len(args) != 4 {
+		wrongArgs(c, args)
+		return
+	}
+
+	cursor := ""
+	if args[1].String() != "0" {
+		key, err := hex.DecodeString(args[1].String())
+		if err != nil || len(key) == 0 {
+			c.wr.writeError("ERR invalid cursor")
+			return
+		}
+		cursor = string(key)
+	}
+
+	count := scanCount
+	if len(args) == 4 {
+		if strings.ToLower(args[2].String()) != "count" {
+			c.wr.writeError("ERR syntax error")
+			return
+		}
+		n, err := strconv.Atoi(args[3].String())
+		if err != nil || n < 1 {
+			c.wr.writeError("ERR value is not an integer or out of range")
+			return
+		}
+		count = n
+	}
+
+	keys, next := s.db.ListKeysPage(cursor, count)
+	nextCursor := "0"
+	if next != "" {
+		nextCursor = hex.EncodeToString([]byte(next))
+	}
+
+	c.wr.writeArray(2)
+	c.wr.writeBulk(nextCursor)
+	c.wr.writeArray(len(keys))
+	for _, key := range keys {
+		c.wr.writeBulk(key)
+	}
+}
+
+// appendCmd appends a value to a key, APPEND key value.
+func (s *server) appendCmd(c *client, args []resp.Value) {
+	if len(args) != 3 {
+		wrongArgs(c, args)
+		return
+	}
+
+	n, err := s.db.AppendValue(args[1].String(), args[2].String())
+	if errors.Is(err, bitcask.ErrInvalidKey) {
+		c.wr.writeError("ERR invalid key")
+	} else if errors.Is(err, bitcask.ErrValueTooLarge) {
+		c.wr.writeError(errValueTooLarge)
+	} else if errors.Is(err, bitcask.ErrOutOfMemory) {
+		c.wr.writeError(errOOM)
+	} else if err != nil {
+		c.wr.writeError("ERR cannot set key to value in this store")
+	} else {
+		c.wr.writeInteger(int64(n))
+	}
+}
+
+// incr serves INCR key, DECR key, INCRBY key delta and DECRBY key delta.
+func (s *server) incr(c *client, args []resp.Value) {
+	name := strings.ToLower(args[0].String())
+	byDelta := name == "incrby" || name == "decrby"
+	if (byDelta && len(args) != 3) || (!byDelta && len(args) != 2) {
+		wrongArgs(c, args)
+		return
+	}
+
+	delta := int64(1)
+	if byDelta {
+		var err error
+		delta, err = strconv.ParseInt(args[2].String(), 10, 64)
+		if err != nil {
+			c.wr.writeError("ERR value is not an integer or out of range")
+			return
+		}
+	}
+	if strings.HasPrefix(name, "decr") {
+		if delta == math.MinInt64 {
+			c.wr.writeError("ERR decrement would overflow")
+			return
+		}
+		delta = -delta
+	}
+
+	value, err := s.db.Incr(args[1].String(), delta)
+	switch {
+	case errors.Is(err, bitcask.ErrNotInteger):
+		c.wr.writeError("ERR value is not an integer or out of range")
+	case errors.Is(err, bitcask.ErrOverflow):
+		c.wr.writeError("ERR increment or decrement would overflow")
+	case errors.Is(err, bitcask.ErrInvalidKey):
+		c.wr.writeError("ERR invalid key")
+	case errors.Is(err, bitcask.ErrOutOfMemory):
+		c.wr.writeError(errOOM)
+	case err != nil:
+		c.wr.writeError("ERR cannot set key to value in this store")
+	default:
+		c.wr.writeInteger(value)
+	}
+}
+
+// info reports the server stats, INFO [section].
+// The keyspace section walks the whole keydir, so it is only reported when asked for
+// by INFO keyspace or INFO all.
+func (s *server) info(c *client, args []resp.Value) {
+	section := "default"
+	if len(args) > 1 {
+		section = strings.ToLower(args[1].String())
+	}
+
+	var sb strings.Builder
+	if section == "default" || section == "all" || section == "memory" {
+		mem := s.db.MemoryUsage()
+		limit, policy := s.db.MaxMemory()
+		fmt.Fprintf(&sb, "# Memory\r\nused_memory_keydir:%d\r\nused_memory_total:%d\r\n"+
+			"maxmemory:%d\r\nmaxmemory_policy:%s\r\n\r\n", mem.KeyDir, mem.Total, limit, policy)
+	}
+	if section == "default" || section == "all" || section == "stats" {
+		fmt.Fprintf(&sb, "# Stats\r\nevicted_keys:%d\r\nclock_skews:%d\r\n\r\n",
+			s.db.Evictions(), s.db.ClockSkews())
+	}
+	if section == "all" || section == "keyspace" {
+		stats := s.db.KeyspaceStats()
+		fmt.Fprintf(&sb, "# Keyspace\r\nkeys:%d\r\nkey_bytes:%d\r\nvalue_bytes:%d\r\n"+
+			"key_lengths:%s\r\nvalue_sizes:%s\r\nages_sec:%s\r\n\r\n",
+			stats.Keys, stats.KeyBytes, stats.ValueBytes,
+			formatHistogram(stats.KeyLengths), formatHistogram(stats.ValueSizes), formatHistogram(stats.Ages))
+	}
+
+	c.wr.writeBulk(strings.TrimSuffix(sb.String(), "\r\n"))
+}
+
+// formatHistogram formats the histogram buckets as le_max=count pairs.
+func formatHistogram(h bitcask.Histogram) string {
+	parts := make([]string, len(h))
+	for i, bucket := range h {
+		parts[i] = fmt.Sprintf("le_%d=%d", bucket.Max, bucket.Count)
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// memory reports the space used by a key, MEMORY USAGE key.
+func (s *server) memory(c *client, args []resp.Value) {
+	if len(args) != 3 || strings.ToLower(args[1].String()) != "usage" {
+		c.wr.writeError("ERR syntax error, try MEMORY USAGE key")
+		return
+	}
+
+	usage, err := s.db.KeySize(args[2].String())
+	if err != nil {
+		c.wr.writeNull()
+	} else {
+		c.wr.writeInteger(usage.Record + usage.KeyDir)
+	}
+}
+
+// object reports the access stats of a key, OBJECT FREQ key or OBJECT IDLETIME key.
+// FREQ is the number of writes to the key since the server started.
+func (s *server) object(c *client, args []resp.Value) {
+	if len(args) != 3 {
+		c.wr.writeError("ERR syntax error, try OBJECT FREQ|IDLETIME key")
+		return
+	}
+
+	sub := strings.ToLower(args[1].String())
+	if sub != "freq" && sub != "idletime" {
+		c.wr.writeError("ERR unknown subcommand '" + args[1].String() + "'. Try OBJECT FREQ or IDLETIME.")
+		return
+	}
+
+	access, err := s.db.KeyAccess(args[2].String())
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		c.wr.writeNull()
+		return
+	} else if err != nil {
+		c.wr.writeError("ERR " + err.Error())
+		return
+	}
+
+	if sub == "freq" {
+		c.wr.writeInteger(int64(access.Writes))
+	} else {
+		c.wr.writeInteger(int64(time.Since(access.LastAccess).Seconds()))
+	}
+}
+
+// config reads and changes the memory limit,
+// CONFIG GET maxmemory|maxmemory-policy or CONFIG SET maxmemory|maxmemory-policy value.
+func (s *server) config(c *client, args []resp.Value) {
+	if len(args) < 3 {
+		wrongArgs(c, args)
+		return
+	}
+
+	limit, policy := s.db.MaxMemory()
+	param := strings.ToLower(args[2].String())
+
+	switch strings.ToLower(args[1].String()) {
+	case "get":
+		if len(args) != 3 {
+			wrongArgs(c, args)
+			return
+		}
+		switch param {
+		case "maxmemory":
+			c.wr.writeMap(1)
+			c.wr.writeBulk(param)
+			c.wr.writeBulk(strconv.FormatInt(limit, 10))
+		case "maxmemory-policy":
+			c.wr.writeMap(1)
+			c.wr.writeBulk(param)
+			c.wr.writeBulk(policy.String())
+		default:
+			c.wr.writeMap(0)
+		}
+	case "set":
+		if len(args) != 4 {
+			wrongArgs(c, args)
+			return
+		}
+		value := args[3].String()
+		switch param {
+		case "maxmemory":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				c.wr.writeError("ERR Invalid argument '" + value + "' for CONFIG SET 'maxmemory'")
+				return
+			}
+			limit = n
+		case "maxmemory-policy":
+			p, err := bitcask.ParseEvictionPolicy(value)
+			if err != nil {
+				c.wr.writeError("ERR Invalid argument '" + value + "' for CONFIG SET 'maxmemory-policy'")
+				return
+			}
+			policy = p
+		default:
+			c.wr.writeError("ERR Unknown option or number of arguments for CONFIG SET - '" + args[2].String() + "'")
+			return
+		}
+		s.db.SetMaxMemory(limit, policy)
+		c.wr.writeSimpleString("OK")
+	default:
+		c.wr.writeError("ERR unknown subcommand '" + args[1].String() + "'. Try CONFIG GET or SET.")
+	}
+}
+
+// wrongArgs replies with the wrong number of arguments error of the command.
+func wrongArgs(c *client, args []resp.Value) {
+	c.wr.writeError("ERR wrong number of arguments for '" + strings.ToLower(args[0].String()) + "' command")
+}
@@ -0,0 +1,129 @@
+package respserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+const (
+	// handoffSocket is the name of the unix socket in the datastore directory
+	// the server listens on for handoff requests.
+	handoffSocket = ".handoff"
+	// handoffRequest is the line sent by the next server to take the datastore over.
+	handoffRequest = "HANDOFF"
+	// handoffTimeout bounds the wait for the running server to release the datastore.
+	handoffTimeout = time.Minute
+)
+
+// requestHandoff asks the server running on the given datastore to hand it over
+// and waits for it to release the datastore.
+// It returns without waiting if no server accepts handoff requests on the datastore.
+func requestHandoff(dirPath string) error {
+	conn, err := net.Dial("unix", path.Join(dirPath, handoffSocket))
+	if err != nil {
+		// no server is running with handoff enabled, the datastore is opened as usual
+		return nil
+	}
+	defer conn.Close()
+
+	err = conn.SetDeadline(time.Now().Add(handoffTimeout))
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(conn, handoffRequest+"\n")
+	if err != nil {
+		return err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("handoff: %w", err)
+	}
+	reply = strings.TrimSpace(reply)
+	if reply != "OK" {
+		return fmt.Errorf("handoff: %s", reply)
+	}
+
+	return nil
+}
+
+// listenHandoff listens for handoff requests on the socket of the given datastore,
+// replacing the socket left by a server that did not exit cleanly.
+func listenHandoff(dirPath string) (net.Listener, error) {
+	name := path.Join(dirPath, handoffSocket)
+	err := os.Remove(name)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return net.Listen("unix", name)
+}
+
+// acceptHandoff waits for a handoff request on l, then stops the server,
+// hands the datastore over and confirms it to the requester.
+// The socket is removed before the datastore is handed over,
+// so the directory is not modified after the keydir file is written.
+func acceptHandoff(l net.Listener, srv *Server, b *bitcask.Bitcask, dirPath string) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil || strings.TrimSpace(line) != handoffRequest {
+			io.WriteString(conn, "ERR unknown request\n")
+			conn.Close()
+			continue
+		}
+
+		log.Printf("respserver: handing %s over to the next server", dirPath)
+		l.Close()
+		srv.Close()
+		err = b.Handoff()
+		if err != nil {
+			io.WriteString(conn, "ERR "+singleLine(err.Error())+"\n")
+		} else {
+			_, err = io.WriteString(conn, "OK\n")
+		}
+		conn.Close()
+
+		return err
+	}
+}
+
+// serveWithHandoff serves the datastore until it is handed over to the next server
+// or the server fails.
+func serveWithHandoff(srv *Server, b *bitcask.Bitcask, dirPath, addr string) error {
+	l, err := listenHandoff(dirPath)
+	if err != nil {
+		b.Close()
+		return err
+	}
+
+	handoff := make(chan error, 1)
+	go func() { handoff <- acceptHandoff(l, srv, b, dirPath) }()
+
+	err = srv.ListenAndServe(addr)
+	if errors.Is(err, ErrServerClosed) {
+		return <-handoff
+	}
+
+	l.Close()
+	<-handoff
+	b.Close()
+
+	return err
+}
@@ -0,0 +1,133 @@
+package respserver
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tidwall/resp"
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// setNX acquires a lock as SET key value NX [PX milliseconds|EX seconds] does,
+// the reply is null if the key is held.
+func (s *server) setNX(c *client, args []resp.Value) {
+	ttl := time.Duration(0)
+	nx := false
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToLower(args[i].String()); opt {
+		case "nx":
+			nx = true
+		case "px", "ex":
+			if i+1 == len(args) || ttl != 0 {
+				c.wr.writeError("ERR syntax error")
+				return
+			}
+			n, err := strconv.ParseInt(args[i+1].String(), 10, 64)
+			if err != nil || n <= 0 {
+				c.wr.writeError("ERR invalid expire time in 'set' command")
+				return
+			}
+			unit := time.Millisecond
+			if opt == "ex" {
+				unit = time.Second
+			}
+			ttl = time.Duration(n) * unit
+			i++
+		default:
+			c.wr.writeError("ERR syntax error")
+			return
+		}
+	}
+	if !nx {
+		c.wr.writeError("ERR PX and EX are only supported along with NX")
+		return
+	}
+
+	_, err := s.db.AcquireLock(args[1].String(), args[2].String(), ttl)
+	if errors.Is(err, bitcask.ErrLockHeld) {
+		c.wr.writeNull()
+	} else if err != nil {
+		writeLockError(c, err)
+	} else {
+		c.wr.writeSimpleString("OK")
+	}
+}
+
+// lock acquires a lock, LOCK key token milliseconds.
+// The reply is the fencing token of the lock, or null if the lock is held.
+func (s *server) lock(c *client, args []resp.Value) {
+	if len(args) != 4 {
+		wrongArgs(c, args)
+		return
+	}
+	ms, err := strconv.ParseInt(args[3].String(), 10, 64)
+	if err != nil || ms <= 0 {
+		c.wr.writeError("ERR invalid expire time in 'lock' command")
+		return
+	}
+
+	lock, err := s.db.AcquireLock(args[1].String(), args[2].String(), time.Duration(ms)*time.Millisecond)
+	if errors.Is(err, bitcask.ErrLockHeld) {
+		c.wr.writeNull()
+	} else if err != nil {
+		writeLockError(c, err)
+	} else {
+		c.wr.writeInteger(lock.Fence)
+	}
+}
+
+// unlock releases a lock held by the given token, UNLOCK key token.
+// The reply is 1 if the lock was released and 0 otherwise.
+func (s *server) unlock(c *client, args []resp.Value) {
+	if len(args) != 3 {
+		wrongArgs(c, args)
+		return
+	}
+
+	released, err := s.db.ReleaseLock(args[1].String(), args[2].String())
+	if err != nil {
+		writeLockError(c, err)
+	} else if released {
+		c.wr.writeInteger(1)
+	} else {
+		c.wr.writeInteger(0)
+	}
+}
+
+// lockHeld checks that a lock is still held, LOCKHELD key token fence.
+// The reply is 1 if the lock is held by the token with the given fencing token and 0 otherwise.
+func (s *server) lockHeld(c *client, args []resp.Value) {
+	if len(args) != 4 {
+		wrongArgs(c, args)
+		return
+	}
+	fence, err := strconv.ParseInt(args[3].String(), 10, 64)
+	if err != nil {
+		c.wr.writeError("ERR value is not an integer or out of range")
+		return
+	}
+
+	held, err := s.db.LockHeld(bitcask.Lock{Name: args[1].String(), Token: args[2].String(), Fence: fence})
+	if err != nil {
+		c.wr.writeError("ERR cannot read this item")
+	} else if held {
+		c.wr.writeInteger(1)
+	} else {
+		c.wr.writeInteger(0)
+	}
+}
+
+// writeLockError replies with the error of a failed lock write.
+func writeLockError(c *client, err error) {
+	if errors.Is(err, bitcask.ErrInvalidKey) {
+		c.wr.writeError("ERR invalid key")
+	} else if errors.Is(err, bitcask.ErrValueTooLarge) {
+		c.wr.writeError(errValueTooLarge)
+	} else if errors.Is(err, bitcask.ErrOutOfMemory) {
+		c.wr.writeError(errOOM)
+	} else {
+		c.wr.writeError("ERR cannot set key to value in this store")
+	}
+}
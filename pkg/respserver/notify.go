@@ -0,0 +1,133 @@
+package respserver
+
+import (
+	"github.com/tidwall/resp"
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+const (
+	// channelPrefix starts the names of the channels the datastore events are published on.
+	channelPrefix = "__bitcask__:"
+	// notifyBuffer is the number of events buffered for a subscribed client,
+	// the events arriving while it is full are dropped.
+	notifyBuffer = 128
+)
+
+// channelKinds holds the event kind published on each channel.
+var channelKinds = map[string]bitcask.EventKind{
+	channelPrefix + "rotation":   bitcask.RotationEvent,
+	channelPrefix + "merge":      bitcask.MergeEvent,
+	channelPrefix + "corruption": bitcask.CorruptionEvent,
+	channelPrefix + "eviction":   bitcask.EvictionEvent,
+}
+
+// subscribeModeCommands holds the commands RESP2 clients can run while subscribed.
+var subscribeModeCommands = map[string]bool{
+	"subscribe":   true,
+	"unsubscribe": true,
+	"ping":        true,
+	"quit":        true,
+}
+
+// subscribe subscribes the client to the events of the datastore, SUBSCRIBE channel [channel ...].
+// The channels are __bitcask__:rotation, __bitcask__:merge, __bitcask__:corruption and __bitcask__:eviction.
+func (s *server) subscribe(c *client, args []resp.Value) {
+	if len(args) < 2 {
+		wrongArgs(c, args)
+		return
+	}
+	for _, arg := range args[1:] {
+		if _, isExist := channelKinds[arg.String()]; !isExist {
+			c.wr.writeError("ERR unknown channel '" + arg.String() + "'")
+			return
+		}
+	}
+
+	for _, arg := range args[1:] {
+		channel := arg.String()
+		if _, isExist := c.subs[channel]; !isExist {
+			events, cancel := s.db.Subscribe(notifyBuffer, channelKinds[channel])
+			c.subs[channel] = cancel
+			go c.notify(channel, events)
+		}
+		writeSubscription(c, "subscribe", channel)
+	}
+}
+
+// unsubscribe cancels the given subscriptions of the client, or all of them
+// if none is given, UNSUBSCRIBE [channel ...].
+func (s *server) unsubscribe(c *client, args []resp.Value) {
+	channels := make([]string, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		channels = append(channels, arg.String())
+	}
+	if len(channels) == 0 {
+		for channel := range c.subs {
+			channels = append(channels, channel)
+		}
+	}
+	if len(channels) == 0 {
+		c.wr.writePush(3)
+		c.wr.writeBulk("unsubscribe")
+		c.wr.writeNull()
+		c.wr.writeInteger(0)
+		return
+	}
+
+	for _, channel := range channels {
+		if cancel, isExist := c.subs[channel]; isExist {
+			cancel()
+			delete(c.subs, channel)
+		}
+		writeSubscription(c, "unsubscribe", channel)
+	}
+}
+
+// writeSubscription confirms a subscription change with the number of subscribed channels.
+func writeSubscription(c *client, kind, channel string) {
+	c.wr.writePush(3)
+	c.wr.writeBulk(kind)
+	c.wr.writeBulk(channel)
+	c.wr.writeInteger(int64(len(c.subs)))
+}
+
+// notify pushes the events to the client until the subscription is canceled.
+func (c *client) notify(channel string, events <-chan bitcask.Event) {
+	for e := range events {
+		c.wrMu.Lock()
+		c.wr.writePush(3)
+		c.wr.writeBulk("message")
+		c.wr.writeBulk(channel)
+		c.wr.writeBulk(eventPayload(e))
+		c.wr.flush()
+		c.wrMu.Unlock()
+	}
+}
+
+// unsubscribeAll cancels all the subscriptions of the client.
+func (c *client) unsubscribeAll() {
+	for channel, cancel := range c.subs {
+		cancel()
+		delete(c.subs, channel)
+	}
+}
+
+// eventPayload describes the event in a notification message.
+func eventPayload(e bitcask.Event) string {
+	switch {
+	case e.Kind == bitcask.RotationEvent:
+		return e.File
+	case e.Kind == bitcask.MergeEvent && e.Err != nil:
+		return "failed: " + e.Err.Error()
+	case e.Kind == bitcask.MergeEvent:
+		return "ok"
+	default:
+		return e.Key
+	}
+}
+
+// allowedWhileSubscribed reports whether the client can run the given command,
+// RESP2 clients can only manage their subscriptions while subscribed.
+func allowedWhileSubscribed(c *client, name string) bool {
+	return len(c.subs) == 0 || c.wr.proto == resp3 || subscribeModeCommands[name]
+}
@@ -0,0 +1,301 @@
+package respserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/resp"
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+const (
+	// defaultMaxValueSize is the largest argument accepted when Limits.MaxValueSize is not set.
+	defaultMaxValueSize = 16 << 20
+	// defaultMaxInlineSize is the longest inline command accepted when Limits.MaxInlineSize is not set.
+	defaultMaxInlineSize = 64 << 10
+	// maxArgs is the largest number of arguments of a command.
+	maxArgs = 1 << 20
+	// argsPrealloc is the largest number of arguments allocated before they are read,
+	// the arguments of a longer command grow as they arrive.
+	argsPrealloc = 16
+	// bulkChunkSize is the number of bytes of an argument read at once, the buffer
+	// of the argument grows with its chunks instead of taking the announced size upfront.
+	bulkChunkSize = 64 << 10
+)
+
+type (
+	// Limits bounds the size of the requests, so that a client cannot force huge allocations.
+	// The zero value of a field selects its default.
+	Limits struct {
+		// MaxKeySize is the longest key in bytes, by default the keys are only checked by the datastore.
+		MaxKeySize int
+		// MaxValueSize is the largest argument in bytes, the default is 16MB and the maximum is
+		// bitcask.MaxValueSize, 256MB. Larger arguments are skipped without being read into memory
+		// and the command is rejected.
+		MaxValueSize int
+		// MaxInlineSize is the longest inline command in bytes, the default is 64KB.
+		MaxInlineSize int
+	}
+
+	// requestReader reads the commands of a client within the limits.
+	requestReader struct {
+		rd     *bufio.Reader
+		limits Limits
+	}
+
+	// protocolError is a malformed request, the connection is closed after replying to it.
+	protocolError struct {
+		msg string
+	}
+
+	// limitError is a command with an argument over the limits, it is rejected
+	// but the connection can still be used.
+	limitError struct {
+		msg string
+	}
+)
+
+// newRequestReader creates a reader of the commands sent on rd.
+func newRequestReader(rd io.Reader, limits Limits) *requestReader {
+	if limits.MaxValueSize <= 0 {
+		limits.MaxValueSize = defaultMaxValueSize
+	}
+	if limits.MaxValueSize > bitcask.MaxValueSize {
+		limits.MaxValueSize = bitcask.MaxValueSize
+	}
+	if limits.MaxInlineSize <= 0 {
+		limits.MaxInlineSize = defaultMaxInlineSize
+	}
+
+	return &requestReader{rd: bufio.NewReader(rd), limits: limits}
+}
+
+func (e *protocolError) Error() string {
+	return "Protocol error: " + e.msg
+}
+
+func (e *limitError) Error() string {
+	return e.msg
+}
+
+// readCommand reads the next command, sent either as an array of bulk strings or inline.
+// Return the command arguments and the number of bytes read.
+// Return a *limitError if an argument is too large, the command is then fully consumed.
+func (r *requestReader) readCommand() ([]resp.Value, int, error) {
+	c, err := r.rd.ReadByte()
+	if err != nil {
+		return nil, 0, err
+	}
+	if c != '*' {
+		err = r.rd.UnreadByte()
+		if err != nil {
+			return nil, 0, err
+		}
+		return r.readInline()
+	}
+
+	count, n, err := r.readInt(1)
+	if err != nil {
+		return nil, n, err
+	}
+	if count < 0 || count > maxArgs {
+		return nil, n, &protocolError{"invalid multibulk length"}
+	}
+
+	prealloc := count
+	if prealloc > argsPrealloc {
+		prealloc = argsPrealloc
+	}
+	args := make([]resp.Value, 0, prealloc)
+	var tooLarge error
+	for i := 0; i < count; i++ {
+		c, err := r.rd.ReadByte()
+		if err != nil {
+			return nil, n, unexpectedEOF(err)
+		}
+		n++
+		if c != '$' {
+			return nil, n, &protocolError{"expected '$', got '" + string(c) + "'"}
+		}
+
+		size, rn, err := r.readInt(0)
+		n += rn
+		if err != nil {
+			return nil, n, err
+		}
+		if size < 0 {
+			return nil, n, &protocolError{"invalid bulk length"}
+		}
+
+		if size > r.limits.MaxValueSize {
+			// the argument is skipped so that the next commands can still be read
+			skipped, err := io.CopyN(io.Discard, r.rd, int64(size)+2)
+			n += int(skipped)
+			if err != nil {
+				return nil, n, unexpectedEOF(err)
+			}
+			tooLarge = &limitError{fmt.Sprintf("ERR argument of %d bytes exceeds the maximum of %d bytes", size, r.limits.MaxValueSize)}
+			continue
+		}
+
+		buf, rn, err := r.readBulk(size + 2)
+		n += rn
+		if err != nil {
+			return nil, n, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, n, &protocolError{"invalid bulk line ending"}
+		}
+		args = append(args, resp.BytesValue(buf[:size]))
+	}
+	if tooLarge != nil {
+		return nil, n, tooLarge
+	}
+
+	return args, n, nil
+}
+
+// readBulk reads the size bytes of an argument in chunks, so that the memory
+// taken by an argument follows the bytes actually sent by the client.
+func (r *requestReader) readBulk(size int) ([]byte, int, error) {
+	capacity := size
+	if capacity > bulkChunkSize {
+		capacity = bulkChunkSize
+	}
+	buf := make([]byte, 0, capacity)
+	n := 0
+	for len(buf) < size {
+		chunk := size - len(buf)
+		if chunk > bulkChunkSize {
+			chunk = bulkChunkSize
+		}
+		start := len(buf)
+		buf = append(buf, make([]byte, chunk)...)
+		rn, err := io.ReadFull(r.rd, buf[start:])
+		n += rn
+		if err != nil {
+			return nil, n, unexpectedEOF(err)
+		}
+	}
+
+	return buf, n, nil
+}
+
+// readInt reads a line holding an integer, n is the number of bytes already read.
+func (r *requestReader) readInt(n int) (int, int, error) {
+	line, rn, err := r.readLine(r.limits.MaxInlineSize)
+	n += rn
+	if err != nil {
+		return 0, n, err
+	}
+
+	x, err := strconv.Atoi(line)
+	if err != nil {
+		return 0, n, &protocolError{"invalid length"}
+	}
+
+	return x, n, nil
+}
+
+// readLine reads a line ending with \r\n, or \n for inline commands, of at most max bytes.
+func (r *requestReader) readLine(max int) (string, int, error) {
+	var sb strings.Builder
+	n := 0
+	for {
+		chunk, err := r.rd.ReadSlice('\n')
+		n += len(chunk)
+		if sb.Len()+len(chunk) > max+2 {
+			return "", n, &protocolError{"too big request line"}
+		}
+		sb.Write(chunk)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return "", n, unexpectedEOF(err)
+		}
+	}
+
+	line := strings.TrimSuffix(sb.String(), "\n")
+	return strings.TrimSuffix(line, "\r"), n, nil
+}
+
+// readInline reads a command sent as a line of space separated arguments,
+// an argument can be surrounded by double quotes to hold spaces.
+func (r *requestReader) readInline() ([]resp.Value, int, error) {
+	line, n, err := r.readLine(r.limits.MaxInlineSize)
+	if err != nil {
+		var perr *protocolError
+		if errors.As(err, &perr) {
+			return nil, n, &protocolError{"too big inline request"}
+		}
+		return nil, n, err
+	}
+
+	args := make([]resp.Value, 0)
+	var arg []byte
+	quote, closed, started := false, false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case closed && c != ' ':
+			return nil, n, &protocolError{"unbalanced quotes in request"}
+		case c == ' ' && !quote:
+			if started {
+				args = append(args, resp.BytesValue(arg))
+			}
+			arg, started, closed = nil, false, false
+		case c == '"' && quote:
+			quote, closed = false, true
+		case c == '"' && !started:
+			quote, started = true, true
+		default:
+			arg = append(arg, c)
+			started = true
+		}
+	}
+	if quote {
+		return nil, n, &protocolError{"unbalanced quotes in request"}
+	}
+	if started {
+		args = append(args, resp.BytesValue(arg))
+	}
+
+	return args, n, nil
+}
+
+// keyArgs holds the position of the key argument of the commands taking one.
+var keyArgs = map[string]int{
+	"get": 1, "set": 1, "del": 1, "append": 1,
+	"incr": 1, "decr": 1, "incrby": 1, "decrby": 1,
+	"lock": 1, "unlock": 1, "lockheld": 1,
+	"sadd": 1, "srem": 1, "smembers": 1, "lpush": 1, "rpush": 1, "lrange": 1,
+	"hset": 1, "hget": 1, "hgetall": 1,
+	"object": 2, "memory": 2,
+}
+
+// checkKeySize rejects the commands with a key longer than the limit,
+// it replies with an error and returns false if the key is too long.
+func (s *server) checkKeySize(c *client, name string, args []resp.Value) bool {
+	max := s.cfg.Limits.MaxKeySize
+	i, isExist := keyArgs[name]
+	if max <= 0 || !isExist || i >= len(args) || len(args[i].Bytes()) <= max {
+		return true
+	}
+
+	c.wr.writeError(fmt.Sprintf("ERR key of %d bytes exceeds the maximum of %d bytes", len(args[i].Bytes()), max))
+	return false
+}
+
+// unexpectedEOF reports the end of the connection in the middle of a command as such.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -1,66 +1,275 @@
+// Package respserver serves a bitcask datastore over the redis serialization protocol (RESP),
+// so it can be used with redis clients.
 package respserver
 
 import (
 	"errors"
+	"io"
 	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/tidwall/resp"
+	"github.com/zaher1307/bitcask/pkg/auth"
 	"github.com/zaher1307/bitcask/pkg/bitcask"
 )
 
+type (
+	// handler executes a command, args holds the command name followed by its arguments.
+	handler func(c *client, args []resp.Value)
+
+	// Config configures the resp server.
+	Config struct {
+		// Auth authenticates the clients with the AUTH command,
+		// when it is nil every client is allowed to run every command.
+		Auth auth.Authenticator
+		// Roles restricts the commands of the clients by the role of their user,
+		// the clients that are not authenticated have the empty role.
+		Roles map[string]Rules
+		// Limits bounds the size of the requests.
+		Limits Limits
+		// Handoff makes StartServerWithConfig take the datastore over from the server
+		// running on it, and hand the datastore over to the next server that asks for it,
+		// so that a new version of the server replaces the running one with minimal downtime.
+		// The requests are exchanged on a unix socket in the datastore directory.
+		Handoff bool
+	}
+
+	// Server serves a bitcask datastore opened by the application,
+	// so the datastore can be shared with in-process code.
+	Server struct {
+		srv *server
+	}
+
+	// server represents a resp server serving a bitcask datastore.
+	server struct {
+		db       *bitcask.Bitcask
+		cfg      Config
+		handlers map[string]handler
+		slowlog  *slowlog
+		clients  *clients
+
+		mu        sync.Mutex
+		listeners map[net.Listener]struct{}
+		closed    bool
+	}
+)
+
+// ErrServerClosed is returned by Serve and ListenAndServe after the server is closed.
+var ErrServerClosed = errors.New("respserver: server closed")
+
+// StartServer opens the datastore in the given directory with read and write permission
+// and serves it on the given port until the server fails.
 func StartServer(dirPath, port string) error {
-	bitcask, err := bitcask.Open(dirPath, bitcask.ReadWrite)
+	return StartServerWithConfig(dirPath, port, Config{})
+}
+
+// StartServerWithConfig is like StartServer with the given config.
+// The server returns nil once it hands the datastore over to the next server.
+func StartServerWithConfig(dirPath, port string, cfg Config) error {
+	if cfg.Handoff {
+		err := requestHandoff(dirPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	b, err := bitcask.Open(dirPath, bitcask.WithReadWrite(), bitcask.WithAccessTracking())
 	if err != nil {
 		return err
 	}
-    defer bitcask.Close()
+	info := b.OpenInfo()
+	log.Printf("respserver: loaded %d keys of %s in %v, keydir file used: %t, data files parsed: %d, hint files used: %d, hint files rejected: %d",
+		info.Keys, dirPath, info.Duration, info.KeyDirFile, len(info.DataFilesParsed), len(info.HintFilesUsed), len(info.HintFilesRejected))
 
-	s := resp.NewServer()
+	srv := New(b, cfg)
+	if cfg.Handoff {
+		return serveWithHandoff(srv, b, dirPath, ":"+port)
+	}
+	defer b.Close()
 
-	s.HandleFunc("set", func(conn *resp.Conn, args []resp.Value) bool {
-		if len(args) != 3 {
-			conn.WriteError(errors.New("ERR wrong number of arguments for 'set' command"))
-		} else {
-			err = bitcask.Put(args[1].String(), args[2].String())
-			if err != nil {
-				conn.WriteError(errors.New("ERR cannot set key to value in this store"))
+	return srv.ListenAndServe(":" + port)
+}
+
+// New creates a server for the given datastore, which must be opened with read and write permission.
+// The datastore stays owned by the caller, the server never closes it.
+// OBJECT FREQ and OBJECT IDLETIME need the datastore to be opened with WithAccessTracking.
+func New(b *bitcask.Bitcask, cfg Config) *Server {
+	s := newServer(b)
+	s.cfg = cfg
+
+	return &Server{srv: s}
+}
+
+// ListenAndServe accepts connections on the given address and serves them
+// until the server is closed or fails.
+func (s *Server) ListenAndServe(addr string) error {
+	return s.srv.listenAndServe(addr)
+}
+
+// Serve serves the connections accepted by l until the server is closed or fails,
+// l is closed when Serve returns.
+func (s *Server) Serve(l net.Listener) error {
+	return s.srv.serveListener(l)
+}
+
+// Close stops accepting connections and closes the connected clients.
+// The datastore is left open.
+func (s *Server) Close() error {
+	s.srv.mu.Lock()
+	s.srv.closed = true
+	var err error
+	for l := range s.srv.listeners {
+		lerr := l.Close()
+		if err == nil {
+			err = lerr
+		}
+	}
+	s.srv.mu.Unlock()
+
+	for _, c := range s.srv.clients.list() {
+		c.conn.Close()
+	}
+
+	return err
+}
+
+// newServer creates a server for the given datastore.
+func newServer(b *bitcask.Bitcask) *server {
+	s := &server{
+		db:        b,
+		slowlog:   newSlowlog(defaultSlowlogThreshold, defaultSlowlogMaxLen),
+		clients:   newClients(),
+		listeners: make(map[net.Listener]struct{}),
+	}
+	s.handlers = s.commands()
+
+	return s
+}
+
+// listenAndServe accepts connections on the given address and serves each one in its own goroutine.
+func (s *server) listenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.serveListener(l)
+}
+
+// serveListener serves each connection accepted by l in its own goroutine.
+func (s *server) serveListener(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
 			}
-			conn.WriteSimpleString("OK")
+			return err
 		}
-		return true
-	})
+		go s.serve(conn)
+	}
+}
 
-	s.HandleFunc("get", func(conn *resp.Conn, args []resp.Value) bool {
-		if len(args) != 2 {
-			conn.WriteError(errors.New("ERR wrong number of arguments for 'get' command"))
-		} else {
-			s, err := bitcask.Get(args[1].String())
-			if err != nil {
-				conn.WriteNull()
-			} else {
-				conn.WriteString(s)
+// serve reads the commands of a connection and executes them until the connection is closed.
+func (s *server) serve(conn net.Conn) {
+	c := s.clients.add(conn, s.cfg.Limits)
+	defer s.clients.remove(c)
+
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return
+	}
+
+	defer c.unsubscribeAll()
+
+	for !c.closed {
+		args, n, err := c.rd.readCommand()
+		var limitErr *limitError
+		if err != nil && !errors.As(err, &limitErr) {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				c.wrMu.Lock()
+				replyProtocolError(c, err)
+				c.wrMu.Unlock()
 			}
+			return
+		}
+		if limitErr == nil && len(args) == 0 {
+			continue
 		}
-		return true
-	})
 
-	s.HandleFunc("del", func(conn *resp.Conn, args []resp.Value) bool {
-		if len(args) != 2 {
-			conn.WriteError(errors.New("ERR wrong number of arguments for 'get' command"))
+		c.wrMu.Lock()
+		if limitErr != nil {
+			c.received(n, "")
+			c.wr.writeError(limitErr.msg)
 		} else {
-			err := bitcask.Delete(args[1].String())
-			if err != nil {
-				conn.WriteError(errors.New("ERR cannot delete this item"))
-			} else {
-				conn.WriteSimpleString("OK")
-			}
+			c.received(n, args[0].String())
+			s.execute(c, args)
+		}
+		err = c.wr.flush()
+		c.wrMu.Unlock()
+
+		if err != nil {
+			log.Printf("respserver: cannot reply to %s: %v", conn.RemoteAddr(), err)
+			return
 		}
-		return true
-	})
+	}
+}
+
+// replyProtocolError replies to a request that cannot be read before the connection is closed.
+func replyProtocolError(c *client, err error) {
+	var protoErr *protocolError
+	if errors.As(err, &protoErr) {
+		c.wr.writeError("ERR " + err.Error())
+	} else {
+		c.wr.writeError("ERR Protocol error: " + err.Error())
+	}
+	c.wr.flush()
+}
 
-	if err := s.ListenAndServe(":" + port); err != nil {
-		log.Fatal(err)
+// execute runs the handler of the given command.
+func (s *server) execute(c *client, args []resp.Value) {
+	name := strings.ToLower(args[0].String())
+	h, isExist := s.handlers[name]
+	if !isExist {
+		c.wr.writeError("ERR unknown command '" + args[0].String() + "'")
+		return
+	}
+	if !allowedWhileSubscribed(c, name) {
+		c.wr.writeError("ERR Can't execute '" + name + "': only SUBSCRIBE / UNSUBSCRIBE / PING / QUIT are allowed in this context")
+		return
+	}
+	if !s.authorize(c, name, args) {
+		return
+	}
+	if !s.checkKeySize(c, name, args) {
+		return
 	}
 
-	return nil
+	start := time.Now()
+	h(c, args)
+	s.slowlog.record(c, args, start, time.Since(start))
 }
@@ -0,0 +1,741 @@
+package respserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tidwall/resp"
+	"github.com/zaher1307/bitcask/pkg/auth"
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// startTestServer starts a resp server on a free port with a datastore
+// in a temporary directory and returns a connected client.
+// The setup functions can adjust the server before it starts serving.
+func startTestServer(t *testing.T, setup ...func(s *server)) *testClient {
+	t.Helper()
+
+	b, err := bitcask.Open(t.TempDir(), bitcask.ReadWrite, bitcask.WithAccessTracking())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := fmt.Sprint(l.Addr().(*net.TCPAddr).Port)
+	l.Close()
+
+	s := newServer(b)
+	for _, fn := range setup {
+		fn(s)
+	}
+	go s.listenAndServe("127.0.0.1:" + port)
+
+	return dialTestClient(t, "127.0.0.1:"+port)
+}
+
+// dialTestClient connects a new client to the server listening on addr.
+func dialTestClient(t *testing.T, addr string) *testClient {
+	t.Helper()
+
+	var conn net.Conn
+	var err error
+	for i := 0; i < 50; i++ {
+		conn, err = net.Dial("tcp", addr)
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	br := bufio.NewReader(conn)
+	return &testClient{t: t, addr: addr, conn: conn, br: br, rd: resp.NewReader(br), wr: resp.NewWriter(conn)}
+}
+
+// testClient sends commands to the server under test.
+type testClient struct {
+	t    *testing.T
+	addr string
+	conn net.Conn
+	br   *bufio.Reader
+	rd   *resp.Reader
+	wr   *resp.Writer
+}
+
+// do sends a command and returns its reply.
+func (c *testClient) do(args ...interface{}) resp.Value {
+	c.t.Helper()
+
+	err := c.wr.WriteMultiBulk(fmt.Sprint(args[0]), args[1:]...)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	v, _, err := c.rd.ReadValue()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	return v
+}
+
+// doRaw sends a command and returns the next n bytes of the reply,
+// it is used to check replies the resp reader does not understand.
+func (c *testClient) doRaw(n int, args ...interface{}) string {
+	c.t.Helper()
+
+	err := c.wr.WriteMultiBulk(fmt.Sprint(args[0]), args[1:]...)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	buf := make([]byte, n)
+	_, err = io.ReadFull(c.br, buf)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	return string(buf)
+}
+
+func TestHello(t *testing.T) {
+	t.Run("resp2 by default", func(t *testing.T) {
+		c := startTestServer(t)
+
+		got := c.do("HELLO").Array()
+		if len(got) != 8 || got[3].Integer() != 2 {
+			t.Errorf("got:%v, want a resp2 array with proto 2", got)
+		}
+	})
+
+	t.Run("switch to resp3", func(t *testing.T) {
+		c := startTestServer(t)
+
+		want := "%4\r\n$6\r\nserver\r\n$7\r\nbitcask\r\n$5\r\nproto\r\n:3\r\n" +
+			"$4\r\nmode\r\n$10\r\nstandalone\r\n$4\r\nrole\r\n$6\r\nmaster\r\n"
+		if got := c.doRaw(len(want), "HELLO", 3); got != want {
+			t.Errorf("got:%q, want:%q", got, want)
+		}
+		if got := c.doRaw(3, "GET", "unknown"); got != "_\r\n" {
+			t.Errorf("got:%q, want:%q", got, "_\r\n")
+		}
+	})
+
+	t.Run("auth and setname", func(t *testing.T) {
+		c := startTestServer(t, func(s *server) {
+			s.cfg.Auth = auth.NewStatic(auth.NewUser("viewer", "pass", "app", auth.Read))
+		})
+
+		got := c.do("HELLO", 2, "AUTH", "viewer", "pass", "SETNAME", "first").Array()
+		if len(got) != 8 || got[3].Integer() != 2 {
+			t.Errorf("got:%v, want a resp2 array with proto 2", got)
+		}
+		if got := c.do("GET", "key1"); !got.IsNull() {
+			t.Errorf("get after hello auth: got %v", got)
+		}
+		if got := c.do("CLIENT", "GETNAME").String(); got != "first" {
+			t.Errorf("getname: got %q, want %q", got, "first")
+		}
+
+		want := "%4\r\n$6\r\nserver\r\n$7\r\nbitcask\r\n$5\r\nproto\r\n:3\r\n"
+		if got := c.doRaw(len(want), "HELLO", 3, "setname", "second", "auth", "viewer", "pass"); got != want {
+			t.Errorf("got:%q, want:%q", got, want)
+		}
+	})
+
+	t.Run("rejected options keep the protocol", func(t *testing.T) {
+		c := startTestServer(t, func(s *server) {
+			s.cfg.Auth = auth.NewStatic(auth.NewUser("viewer", "pass", "app", auth.Read))
+		})
+
+		if got := c.do("HELLO", 3, "AUTH", "viewer", "wrong").Error(); got == nil || !strings.HasPrefix(got.Error(), "WRONGPASS") {
+			t.Errorf("hello with a wrong password: got %v", got)
+		}
+		if got := c.do("HELLO", 3, "AUTH", "viewer").Error(); got == nil || got.Error() != "ERR Syntax error in HELLO option 'AUTH'" {
+			t.Errorf("hello without a password: got %v", got)
+		}
+		if got := c.do("HELLO", 3, "SETNAME", "a name").Error(); got == nil || !strings.HasPrefix(got.Error(), "ERR Client names") {
+			t.Errorf("hello with an invalid name: got %v", got)
+		}
+		if got := c.do("GET", "key1").Error(); got == nil || !strings.HasPrefix(got.Error(), "NOAUTH") {
+			t.Errorf("get after a rejected hello: got %v", got)
+		}
+	})
+
+	t.Run("unsupported protocol", func(t *testing.T) {
+		c := startTestServer(t)
+
+		got := c.do("HELLO", 4).Error()
+		if got == nil || got.Error() != "NOPROTO unsupported protocol version" {
+			t.Errorf("got:%v", got)
+		}
+	})
+}
+
+func TestSlowlog(t *testing.T) {
+	c := startTestServer(t, func(s *server) {
+		s.slowlog = newSlowlog(0, 2)
+	})
+
+	c.do("SET", "key1", "value1")
+	c.do("GET", "key1")
+	c.do("GET", "key2")
+
+	if got := c.do("SLOWLOG", "LEN").Integer(); got != 2 {
+		t.Errorf("got:%d entries, want:%d", got, 2)
+	}
+
+	entries := c.do("SLOWLOG", "GET").Array()
+	if len(entries) != 2 {
+		t.Fatalf("got:%d entries, want:%d", len(entries), 2)
+	}
+	// the newest entry is the SLOWLOG LEN command itself
+	args := entries[1].Array()[3].Array()
+	if entries[1].Array()[0].Integer() != 2 || args[0].String() != "GET" || args[1].String() != "key2" {
+		t.Errorf("got:%v, want:GET key2 with id 2", entries[1])
+	}
+
+	c.do("SLOWLOG", "RESET")
+	// the reset command itself is logged after the log is emptied
+	if got := c.do("SLOWLOG", "LEN").Integer(); got != 1 {
+		t.Errorf("got:%d entries, want:%d", got, 1)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	c := startTestServer(t)
+
+	keys := []string{"a/b", "nul\x00key", "new\nline", "\r\n*1\r\n", strings.Repeat("k", 1<<16-1)}
+	for i, key := range keys {
+		if got := c.do("SET", key, i).String(); got != "OK" {
+			t.Fatalf("set %q: got %q", key, got)
+		}
+	}
+	for i, key := range keys {
+		if got := c.do("GET", key).String(); got != fmt.Sprint(i) {
+			t.Errorf("get %q: got %q, want %q", key, got, fmt.Sprint(i))
+		}
+	}
+
+	reply := c.do("SCAN", "0", "COUNT", len(keys))
+	var scanned []string
+	for _, v := range reply.Array()[1].Array() {
+		scanned = append(scanned, v.String())
+	}
+	sort.Strings(scanned)
+	want := append([]string(nil), keys...)
+	sort.Strings(want)
+	if !reflect.DeepEqual(scanned, want) {
+		t.Errorf("scan: got %d keys, want the %d keys unchanged", len(scanned), len(want))
+	}
+
+	// binary arguments echoed in errors must not break the reply framing
+	if got := c.do("OBJECT", "\r\n-ERR", "key").Error(); got == nil {
+		t.Error("object: want an error")
+	}
+	if got := c.do("PING").String(); got != "PONG" {
+		t.Errorf("ping after a binary error: got %q", got)
+	}
+
+	for _, key := range keys {
+		if got := c.do("DEL", key).String(); got != "OK" {
+			t.Errorf("del %q: got %q", key, got)
+		}
+		if got := c.do("GET", key); !got.IsNull() {
+			t.Errorf("get deleted %q: got %q", key, got.String())
+		}
+	}
+
+	for _, key := range []string{"", strings.Repeat("k", 1<<16)} {
+		if got := c.do("SET", key, "value").Error(); got == nil || got.Error() != "ERR invalid key" {
+			t.Errorf("set invalid key: got %v", got)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	c := startTestServer(t)
+	other := dialTestClient(t, c.addr)
+
+	if got := c.do("CLIENT", "SETNAME", "first").String(); got != "OK" {
+		t.Fatalf("setname: got %q", got)
+	}
+	if got := c.do("CLIENT", "GETNAME").String(); got != "first" {
+		t.Errorf("getname: got %q, want %q", got, "first")
+	}
+	id := c.do("CLIENT", "ID").Integer()
+	otherId := other.do("CLIENT", "ID").Integer()
+	if id == otherId {
+		t.Errorf("id: got the same id %d for both clients", id)
+	}
+
+	list := c.do("CLIENT", "LIST").String()
+	lines := strings.Split(strings.TrimSuffix(list, "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("list: got %d clients, want %d:\n%s", len(lines), 2, list)
+	}
+	var line string
+	for _, l := range lines {
+		if strings.HasPrefix(l, fmt.Sprintf("id=%d ", id)) {
+			line = l
+		}
+	}
+	if !strings.Contains(line, "name=first") || !strings.Contains(line, "cmd=client") {
+		t.Errorf("list: got %q", line)
+	}
+	if strings.Contains(line, "tot-net-in=0 ") || strings.Contains(line, "tot-net-out=0 ") {
+		t.Errorf("list: got %q, want non zero traffic", line)
+	}
+
+	if got := c.do("CLIENT", "KILL", "ID", otherId).Integer(); got != 1 {
+		t.Errorf("kill: got %d killed, want %d", got, 1)
+	}
+	other.conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := other.br.ReadByte(); err == nil {
+		t.Errorf("kill: killed client is still connected")
+	}
+
+	if got := c.do("CLIENT", "KILL", "127.0.0.1:1").Error(); got == nil || got.Error() != "ERR No such client" {
+		t.Errorf("kill unknown addr: got %v", got)
+	}
+}
+
+func TestIncr(t *testing.T) {
+	c := startTestServer(t)
+
+	if got := c.do("INCR", "counter").Integer(); got != 1 {
+		t.Errorf("incr: got %d, want %d", got, 1)
+	}
+	if got := c.do("INCRBY", "counter", 41).Integer(); got != 42 {
+		t.Errorf("incrby: got %d, want %d", got, 42)
+	}
+	if got := c.do("DECRBY", "counter", 50).Integer(); got != -8 {
+		t.Errorf("decrby: got %d, want %d", got, -8)
+	}
+	if got := c.do("GET", "counter").String(); got != "-8" {
+		t.Errorf("get: got %q, want %q", got, "-8")
+	}
+
+	c.do("SET", "text", "abc")
+	if got := c.do("DECR", "text").Error(); got == nil || got.Error() != "ERR value is not an integer or out of range" {
+		t.Errorf("decr text: got %v", got)
+	}
+}
+
+func TestSetNX(t *testing.T) {
+	c := startTestServer(t)
+
+	if got := c.do("SET", "lock", "owner1", "NX", "PX", 50).String(); got != "OK" {
+		t.Errorf("set nx: got %q, want %q", got, "OK")
+	}
+	if got := c.do("SET", "lock", "owner2", "NX", "PX", 1000); !got.IsNull() {
+		t.Errorf("set nx held: got %v, want null", got)
+	}
+	if got := c.do("SET", "lock", "owner2", "PX", 1000).Error(); got == nil {
+		t.Error("set px: want an error without NX")
+	}
+	if got := c.do("UNLOCK", "lock", "owner2").Integer(); got != 0 {
+		t.Errorf("unlock other owner: got %d, want %d", got, 0)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	fence := c.do("LOCK", "lock", "owner2", 1000).Integer()
+	if fence <= 0 {
+		t.Fatalf("lock expired: got %d, want a fence", fence)
+	}
+	if got := c.do("LOCKHELD", "lock", "owner2", fence).Integer(); got != 1 {
+		t.Errorf("lockheld: got %d, want %d", got, 1)
+	}
+	if got := c.do("UNLOCK", "lock", "owner2").Integer(); got != 1 {
+		t.Errorf("unlock: got %d, want %d", got, 1)
+	}
+	if got := c.do("LOCKHELD", "lock", "owner2", fence).Integer(); got != 0 {
+		t.Errorf("lockheld released: got %d, want %d", got, 0)
+	}
+}
+
+func TestCollections(t *testing.T) {
+	c := startTestServer(t)
+
+	if got := c.do("SADD", "set", "b", "a", "b").Integer(); got != 2 {
+		t.Errorf("sadd: got %d, want %d", got, 2)
+	}
+	c.do("SREM", "set", "b")
+	if got := c.do("SMEMBERS", "set").Array(); len(got) != 1 || got[0].String() != "a" {
+		t.Errorf("smembers: got %v, want [a]", got)
+	}
+
+	c.do("RPUSH", "list", "c")
+	if got := c.do("LPUSH", "list", "b", "a").Integer(); got != 3 {
+		t.Errorf("lpush: got %d, want %d", got, 3)
+	}
+	got := c.do("LRANGE", "list", 0, -1).Array()
+	if len(got) != 3 || got[0].String() != "a" || got[2].String() != "c" {
+		t.Errorf("lrange: got %v, want [a b c]", got)
+	}
+
+	if got := c.do("LPUSH", "set", "x").Error(); got == nil || !strings.HasPrefix(got.Error(), "WRONGTYPE") {
+		t.Errorf("lpush set: got %v, want WRONGTYPE", got)
+	}
+
+	if got := c.do("HSET", "session", "user", "ann", "ttl", "60").Integer(); got != 2 {
+		t.Errorf("hset: got %d, want %d", got, 2)
+	}
+	if got := c.do("HSET", "session", "ttl", "30").Integer(); got != 0 {
+		t.Errorf("hset existing: got %d, want %d", got, 0)
+	}
+	if got := c.do("HGET", "session", "ttl").String(); got != "30" {
+		t.Errorf("hget: got %q, want %q", got, "30")
+	}
+	if got := c.do("HGET", "session", "missing"); !got.IsNull() {
+		t.Errorf("hget missing: got %v, want null", got)
+	}
+	got = c.do("HGETALL", "session").Array()
+	if len(got) != 4 || got[0].String() != "ttl" || got[1].String() != "30" || got[2].String() != "user" {
+		t.Errorf("hgetall: got %v, want [ttl 30 user ann]", got)
+	}
+	if got := c.do("HSET", "session", "user").Error(); got == nil {
+		t.Error("hset: expected an error for a field without value")
+	}
+}
+
+func TestObject(t *testing.T) {
+	c := startTestServer(t)
+
+	c.do("SET", "key", "value1")
+	c.do("SET", "key", "value2")
+	if got := c.do("OBJECT", "FREQ", "key").Integer(); got != 2 {
+		t.Errorf("freq: got %d, want %d", got, 2)
+	}
+	if got := c.do("OBJECT", "IDLETIME", "key").Integer(); got > 1 {
+		t.Errorf("idletime: got %d, want at most %d", got, 1)
+	}
+	if got := c.do("OBJECT", "FREQ", "unknown"); !got.IsNull() {
+		t.Errorf("freq unknown: got %v, want null", got)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	c := startTestServer(t)
+
+	c.do("SET", "key1", "value")
+	if got := c.do("CONFIG", "SET", "maxmemory", 1).String(); got != "OK" {
+		t.Fatalf("config set: got %q", got)
+	}
+	got := c.do("CONFIG", "GET", "maxmemory-policy").Array()
+	if len(got) != 2 || got[1].String() != "noeviction" {
+		t.Errorf("config get: got %v", got)
+	}
+	if got := c.do("SET", "key2", "value").Error(); got == nil || !strings.HasPrefix(got.Error(), "OOM") {
+		t.Errorf("set past the limit: got %v", got)
+	}
+
+	c.do("CONFIG", "SET", "maxmemory-policy", "allkeys-random")
+	if got := c.do("SET", "key2", "value").String(); got != "OK" {
+		t.Errorf("set with eviction: got %q", got)
+	}
+	if got := c.do("CONFIG", "SET", "maxmemory-policy", "volatile-ttl").Error(); got == nil {
+		t.Errorf("Expected volatile-ttl to be rejected")
+	}
+}
+
+func TestNew(t *testing.T) {
+	b, err := bitcask.Open(t.TempDir(), bitcask.ReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	b.Put("shared", "in-process")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New(b, Config{})
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(l) }()
+
+	c := dialTestClient(t, l.Addr().String())
+	if got := c.do("GET", "shared").String(); got != "in-process" {
+		t.Errorf("got:%q, want:%q", got, "in-process")
+	}
+	c.do("SET", "key", "from-client")
+	if got, _ := b.Get("key"); got != "from-client" {
+		t.Errorf("got:%q, want:%q", got, "from-client")
+	}
+
+	srv.Close()
+	if err := <-done; !errors.Is(err, ErrServerClosed) {
+		t.Errorf("got:%v, want:%v", err, ErrServerClosed)
+	}
+	if err := b.Put("key", "after-close"); err != nil {
+		t.Errorf("the datastore is closed with the server: %v", err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	sub := startTestServer(t)
+
+	if got := sub.do("SUBSCRIBE", "__bitcask__:nope").Error(); got == nil {
+		t.Errorf("Expected an unknown channel to be rejected")
+	}
+	reply := sub.do("SUBSCRIBE", "__bitcask__:rotation").Array()
+	if len(reply) != 3 || reply[0].String() != "subscribe" || reply[2].Integer() != 1 {
+		t.Fatalf("got %v", reply)
+	}
+	if got := sub.do("GET", "key").Error(); got == nil {
+		t.Errorf("Expected GET to be rejected while subscribed")
+	}
+
+	c := dialTestClient(t, sub.addr)
+	value := strings.Repeat("v", 1024)
+	for i := 0; i < 20; i++ {
+		c.do("SET", fmt.Sprintf("key%d", i), value)
+	}
+
+	sub.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	msg, _, err := sub.rd.ReadValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := msg.Array(); len(got) != 3 || got[0].String() != "message" ||
+		got[1].String() != "__bitcask__:rotation" || !strings.HasSuffix(got[2].String(), ".data") {
+		t.Errorf("got %v", msg)
+	}
+}
+
+func TestHandoff(t *testing.T) {
+	dir := t.TempDir()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := fmt.Sprint(l.Addr().(*net.TCPAddr).Port)
+	l.Close()
+
+	start := func() chan error {
+		done := make(chan error, 1)
+		go func() { done <- StartServerWithConfig(dir, port, Config{Handoff: true}) }()
+		return done
+	}
+
+	old := start()
+	c := dialTestClient(t, "127.0.0.1:"+port)
+	c.do("SET", "key", "value")
+
+	next := start()
+	if err := <-old; err != nil {
+		t.Fatalf("the old server failed to hand over: %v", err)
+	}
+	if _, err := os.Stat(path.Join(dir, "keydir")); err != nil {
+		t.Errorf("the keydir was not written for the next server: %v", err)
+	}
+
+	c = dialTestClient(t, "127.0.0.1:"+port)
+	if got := c.do("GET", "key").String(); got != "value" {
+		t.Errorf("got:%q, want:%q", got, "value")
+	}
+
+	requestHandoff(dir)
+	if err := <-next; err != nil {
+		t.Errorf("the next server failed to hand over: %v", err)
+	}
+}
+
+func TestInfoKeyspace(t *testing.T) {
+	c := startTestServer(t)
+	c.do("SET", "key", "value")
+
+	got := c.do("INFO", "keyspace").String()
+	for _, want := range []string{"keys:1\r\n", "key_lengths:le_0=0,le_1=0,le_3=1\r\n", "value_sizes:le_0=0,le_1=0,le_3=0,le_7=1\r\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got:%q, want it to contain %q", got, want)
+		}
+	}
+	if got := c.do("INFO").String(); strings.Contains(got, "# Keyspace") {
+		t.Errorf("got:%q, want no keyspace section by default", got)
+	}
+}
+
+func TestScan(t *testing.T) {
+	c := startTestServer(t)
+
+	for i := 0; i < 25; i++ {
+		c.do("SET", fmt.Sprintf("key%02d", i), "value")
+	}
+
+	var keys []string
+	cursor := "0"
+	for {
+		reply := c.do("SCAN", cursor, "COUNT", 10).Array()
+		if len(reply) != 2 {
+			t.Fatalf("got %v", reply)
+		}
+		for _, key := range reply[1].Array() {
+			keys = append(keys, key.String())
+		}
+		cursor = reply[0].String()
+		if cursor == "0" {
+			break
+		}
+	}
+
+	if len(keys) != 25 || keys[0] != "key00" || keys[24] != "key24" {
+		t.Errorf("got %v", keys)
+	}
+	if got := c.do("SCAN", "zz").Error(); got == nil {
+		t.Errorf("Expected an invalid cursor to be rejected")
+	}
+}
+
+func TestAuth(t *testing.T) {
+	c := startTestServer(t, func(s *server) {
+		s.cfg.Auth = auth.NewStatic(
+			auth.NewUser("default", "pass", "app", auth.Read|auth.Write),
+			auth.NewUser("viewer", "pass", "app", auth.Read),
+		)
+	})
+
+	if got := c.do("PING").String(); got != "PONG" {
+		t.Errorf("ping: got %q", got)
+	}
+	if got := c.do("GET", "key1").Error(); got == nil || !strings.HasPrefix(got.Error(), "NOAUTH") {
+		t.Errorf("get before auth: got %v", got)
+	}
+	if got := c.do("AUTH", "wrong").Error(); got == nil || !strings.HasPrefix(got.Error(), "WRONGPASS") {
+		t.Errorf("auth with a wrong password: got %v", got)
+	}
+	if got := c.do("AUTH", "pass").String(); got != "OK" {
+		t.Errorf("auth: got %q", got)
+	}
+	if got := c.do("SET", "key1", "value").String(); got != "OK" {
+		t.Errorf("set: got %q", got)
+	}
+	if got := c.do("CONFIG", "GET", "maxmemory").Error(); got == nil || !strings.HasPrefix(got.Error(), "NOPERM") {
+		t.Errorf("config without admin permission: got %v", got)
+	}
+
+	c.do("AUTH", "viewer", "pass")
+	if got := c.do("GET", "key1").String(); got != "value" {
+		t.Errorf("get: got %q", got)
+	}
+	if got := c.do("DEL", "key1").Error(); got == nil || !strings.HasPrefix(got.Error(), "NOPERM") {
+		t.Errorf("del without write permission: got %v", got)
+	}
+	if got := c.do("CLIENT", "ID").Integer(); got == 0 {
+		t.Errorf("Expected a client to manage its own connection")
+	}
+}
+
+func TestRoles(t *testing.T) {
+	rulesFile := path.Join(t.TempDir(), "roles")
+	os.WriteFile(rulesFile, []byte("# role rule commands\napp deny CONFIG client|kill\nviewer allow get scan ping auth\n"), 0600)
+	roles, err := LoadRules(rulesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := startTestServer(t, func(s *server) {
+		s.cfg.Auth = auth.NewStatic(
+			auth.NewUser("app", "pass", "app", auth.Read|auth.Write|auth.Admin),
+			auth.NewUser("viewer", "pass", "viewer", auth.Read|auth.Write),
+		)
+		s.cfg.Roles = roles
+	})
+
+	c.do("AUTH", "app", "pass")
+	if got := c.do("CONFIG", "GET", "maxmemory").Error(); got == nil || !strings.HasPrefix(got.Error(), "NOPERM") {
+		t.Errorf("denied config: got %v", got)
+	}
+	if got := c.do("CLIENT", "KILL", "ID", 0).Error(); got == nil || !strings.HasPrefix(got.Error(), "NOPERM") {
+		t.Errorf("denied client kill: got %v", got)
+	}
+	if got := c.do("CLIENT", "LIST").Error(); got != nil {
+		t.Errorf("client list: got %v", got)
+	}
+
+	c.do("AUTH", "viewer", "pass")
+	if got := c.do("SET", "key1", "value").Error(); got == nil || !strings.HasPrefix(got.Error(), "NOPERM") {
+		t.Errorf("set outside the allowed commands: got %v", got)
+	}
+	if got := c.do("GET", "key1"); got.Error() != nil {
+		t.Errorf("allowed get: got %v", got.Error())
+	}
+}
+
+func TestLimits(t *testing.T) {
+	c := startTestServer(t, func(s *server) {
+		s.cfg.Limits = Limits{MaxKeySize: 8, MaxValueSize: 16, MaxInlineSize: 32}
+	})
+
+	if got := c.do("SET", "longkey12", "value").Error(); got == nil || got.Error() != "ERR key of 9 bytes exceeds the maximum of 8 bytes" {
+		t.Errorf("set long key: got %v", got)
+	}
+	if got := c.do("SET", "key1", strings.Repeat("v", 100)).Error(); got == nil || got.Error() != "ERR argument of 100 bytes exceeds the maximum of 16 bytes" {
+		t.Errorf("set large value: got %v", got)
+	}
+	if got := c.do("PING").String(); got != "PONG" {
+		t.Errorf("ping after a rejected command: got %q", got)
+	}
+
+	c.conn.Write([]byte("SET key1 \"a value\"\r\nGET key1\r\n"))
+	for _, want := range []string{"OK", "a value"} {
+		v, _, err := c.rd.ReadValue()
+		if err != nil || v.String() != want {
+			t.Errorf("inline command: got %q, %v, want %q", v.String(), err, want)
+		}
+	}
+
+	c.conn.Write([]byte(strings.Repeat("x", 100) + "\r\n"))
+	v, _, _ := c.rd.ReadValue()
+	if v.Error() == nil || v.Error().Error() != "ERR Protocol error: too big inline request" {
+		t.Errorf("long inline command: got %v", v)
+	}
+	if _, _, err := c.rd.ReadValue(); err == nil {
+		t.Errorf("Expected the connection to be closed")
+	}
+}
+
+func TestHugeHeaders(t *testing.T) {
+	limits := Limits{MaxValueSize: bitcask.MaxValueSize}
+	for _, header := range []string{
+		fmt.Sprintf("*%d\r\n", maxArgs),
+		fmt.Sprintf("*1\r\n$%d\r\nvalue", bitcask.MaxValueSize),
+	} {
+		client, conn := net.Pipe()
+		go func() {
+			client.Write([]byte(header))
+			client.Close()
+		}()
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		_, _, err := newRequestReader(conn, limits).readCommand()
+		runtime.ReadMemStats(&after)
+		conn.Close()
+
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%q: got %v, want %v", header, err, io.ErrUnexpectedEOF)
+		}
+		// only the bytes sent are allocated, not the announced sizes
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+			t.Errorf("%q: allocated %d bytes", header, allocated)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package respserver
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tidwall/resp"
+)
+
+// Rules restricts the commands the clients of a role can run, on top of their permissions.
+// The commands are named in lower case, optionally followed by a subcommand
+// as in "client|kill", in which case the rule only applies to that subcommand.
+type Rules struct {
+	// Allow lists the only commands the role can run, every command is allowed when it is empty.
+	Allow []string
+	// Deny lists the commands the role cannot run, it takes precedence over Allow.
+	Deny []string
+}
+
+// allows reports whether the rules allow running the given command.
+func (r Rules) allows(name string, args []resp.Value) bool {
+	full := name
+	if len(args) > 1 {
+		full = name + "|" + strings.ToLower(args[1].String())
+	}
+
+	for _, cmd := range r.Deny {
+		if cmd == name || cmd == full {
+			return false
+		}
+	}
+	if len(r.Allow) == 0 {
+		return true
+	}
+	for _, cmd := range r.Allow {
+		if cmd == name || cmd == full {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LoadRules reads the rules of the roles from the given file.
+// Every line holds a role, allow or deny, and the commands it applies to, separated by spaces.
+// A role may have several lines, their commands are added up.
+// Empty lines and lines starting with # are ignored.
+func LoadRules(name string) (map[string]Rules, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	roles := make(map[string]Rules)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%s:%d: want a role, allow or deny, and commands", name, line)
+		}
+		rules := roles[fields[0]]
+		cmds := strings.Fields(strings.ToLower(strings.Join(fields[2:], " ")))
+		switch strings.ToLower(fields[1]) {
+		case "allow":
+			rules.Allow = append(rules.Allow, cmds...)
+		case "deny":
+			rules.Deny = append(rules.Deny, cmds...)
+		default:
+			return nil, fmt.Errorf("%s:%d: want allow or deny, got %q", name, line, fields[1])
+		}
+		roles[fields[0]] = rules
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
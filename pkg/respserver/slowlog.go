@@ -0,0 +1,178 @@
+package respserver
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/resp"
+)
+
+const (
+	// defaultSlowlogThreshold is the execution time above which a command is logged.
+	defaultSlowlogThreshold = 10 * time.Millisecond
+	// defaultSlowlogMaxLen is the number of entries kept in the slow log.
+	defaultSlowlogMaxLen = 128
+
+	// slowlogMaxArgs and slowlogMaxArgLen bound the size of the logged arguments.
+	slowlogMaxArgs   = 32
+	slowlogMaxArgLen = 128
+)
+
+type (
+	// slowlogEntry represents a command that took longer than the slow log threshold.
+	slowlogEntry struct {
+		id       int64
+		time     time.Time
+		duration time.Duration
+		args     []string
+		addr     string
+	}
+
+	// slowlog is a ring buffer of the latest slow commands.
+	slowlog struct {
+		mu        sync.Mutex
+		threshold time.Duration
+		entries   []slowlogEntry
+		next      int
+		nextId    int64
+	}
+)
+
+// newSlowlog creates a slow log keeping at most maxLen entries.
+func newSlowlog(threshold time.Duration, maxLen int) *slowlog {
+	return &slowlog{
+		threshold: threshold,
+		entries:   make([]slowlogEntry, 0, maxLen),
+	}
+}
+
+// record logs the command if it took longer than the threshold.
+func (l *slowlog) record(c *client, args []resp.Value, start time.Time, duration time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if duration < l.threshold || cap(l.entries) == 0 {
+		return
+	}
+
+	entry := slowlogEntry{
+		id:       l.nextId,
+		time:     start,
+		duration: duration,
+		args:     slowlogArgs(args),
+		addr:     c.conn.RemoteAddr().String(),
+	}
+	l.nextId++
+
+	if len(l.entries) < cap(l.entries) {
+		l.entries = append(l.entries, entry)
+	} else {
+		l.entries[l.next] = entry
+	}
+	l.next = (l.next + 1) % cap(l.entries)
+}
+
+// latest returns up to n entries from the newest to the oldest.
+func (l *slowlog) latest(n int) []slowlogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if n < 0 || n > len(l.entries) {
+		n = len(l.entries)
+	}
+
+	res := make([]slowlogEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		res = append(res, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+
+	return res
+}
+
+// len returns the number of entries in the slow log.
+func (l *slowlog) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.entries)
+}
+
+// reset removes all the entries of the slow log.
+func (l *slowlog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = l.entries[:0]
+	l.next = 0
+}
+
+// slowlogArgs copies the command arguments, trimming them like redis does.
+func slowlogArgs(args []resp.Value) []string {
+	// the credentials are never kept
+	if strings.EqualFold(args[0].String(), "auth") {
+		return []string{args[0].String(), "(redacted)"}
+	}
+
+	n := len(args)
+	if n > slowlogMaxArgs {
+		n = slowlogMaxArgs
+	}
+
+	res := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if i == slowlogMaxArgs-1 && len(args) > slowlogMaxArgs {
+			res = append(res, "... ("+strconv.Itoa(len(args)-slowlogMaxArgs+1)+" more arguments)")
+			break
+		}
+		arg := args[i].String()
+		if len(arg) > slowlogMaxArgLen {
+			arg = arg[:slowlogMaxArgLen] + "... (" + strconv.Itoa(len(arg)-slowlogMaxArgLen) + " more bytes)"
+		}
+		res = append(res, arg)
+	}
+
+	return res
+}
+
+// slowlogCmd inspects the slow log, SLOWLOG GET [count] | LEN | RESET.
+func (s *server) slowlogCmd(c *client, args []resp.Value) {
+	if len(args) < 2 {
+		wrongArgs(c, args)
+		return
+	}
+
+	switch strings.ToLower(args[1].String()) {
+	case "get":
+		n := 10
+		if len(args) == 3 {
+			n = args[2].Integer()
+		} else if len(args) > 3 {
+			wrongArgs(c, args)
+			return
+		}
+
+		entries := s.slowlog.latest(n)
+		c.wr.writeArray(len(entries))
+		for _, e := range entries {
+			c.wr.writeArray(6)
+			c.wr.writeInteger(e.id)
+			c.wr.writeInteger(e.time.Unix())
+			c.wr.writeInteger(e.duration.Microseconds())
+			c.wr.writeArray(len(e.args))
+			for _, arg := range e.args {
+				c.wr.writeBulk(arg)
+			}
+			c.wr.writeBulk(e.addr)
+			c.wr.writeBulk("")
+		}
+	case "len":
+		c.wr.writeInteger(int64(s.slowlog.len()))
+	case "reset":
+		s.slowlog.reset()
+		c.wr.writeSimpleString("OK")
+	default:
+		c.wr.writeError("ERR unknown subcommand '" + args[1].String() + "'. Try SLOWLOG GET, LEN or RESET.")
+	}
+}
@@ -0,0 +1,201 @@
+package respserver
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/resp"
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+	"github.com/zaher1307/bitcask/pkg/structures"
+)
+
+// errWrongType is the reply to the commands applied to a key holding another structure.
+const errWrongType = "WRONGTYPE Operation against a key holding the wrong kind of value"
+
+// sadd adds members to a set, SADD key member [member ...].
+func (s *server) sadd(c *client, args []resp.Value) {
+	if len(args) < 3 {
+		wrongArgs(c, args)
+		return
+	}
+
+	n, err := structures.SetAdd(s.db, args[1].String(), argStrings(args[2:])...)
+	if err != nil {
+		writeStructureError(c, err)
+	} else {
+		c.wr.writeInteger(int64(n))
+	}
+}
+
+// srem removes members from a set, SREM key member [member ...].
+func (s *server) srem(c *client, args []resp.Value) {
+	if len(args) < 3 {
+		wrongArgs(c, args)
+		return
+	}
+
+	n, err := structures.SetRemove(s.db, args[1].String(), argStrings(args[2:])...)
+	if err != nil {
+		writeStructureError(c, err)
+	} else {
+		c.wr.writeInteger(int64(n))
+	}
+}
+
+// smembers lists the members of a set, SMEMBERS key.
+func (s *server) smembers(c *client, args []resp.Value) {
+	if len(args) != 2 {
+		wrongArgs(c, args)
+		return
+	}
+
+	members, err := structures.SetMembers(s.db, args[1].String())
+	if err != nil {
+		writeStructureError(c, err)
+		return
+	}
+	c.wr.writeArray(len(members))
+	for _, m := range members {
+		c.wr.writeBulk(m)
+	}
+}
+
+// push inserts items in a list, LPUSH key item [item ...] or RPUSH key item [item ...].
+func (s *server) push(c *client, args []resp.Value) {
+	if len(args) < 3 {
+		wrongArgs(c, args)
+		return
+	}
+
+	insert := structures.ListAppend
+	if strings.ToLower(args[0].String()) == "lpush" {
+		insert = structures.ListPush
+	}
+	n, err := insert(s.db, args[1].String(), argStrings(args[2:])...)
+	if err != nil {
+		writeStructureError(c, err)
+	} else {
+		c.wr.writeInteger(int64(n))
+	}
+}
+
+// lrange lists the items of a list, LRANGE key start stop.
+func (s *server) lrange(c *client, args []resp.Value) {
+	if len(args) != 4 {
+		wrongArgs(c, args)
+		return
+	}
+	start, err := strconv.Atoi(args[2].String())
+	if err != nil {
+		c.wr.writeError("ERR value is not an integer or out of range")
+		return
+	}
+	stop, err := strconv.Atoi(args[3].String())
+	if err != nil {
+		c.wr.writeError("ERR value is not an integer or out of range")
+		return
+	}
+
+	items, err := structures.ListRange(s.db, args[1].String(), start, stop)
+	if err != nil {
+		writeStructureError(c, err)
+		return
+	}
+	c.wr.writeArray(len(items))
+	for _, item := range items {
+		c.wr.writeBulk(item)
+	}
+}
+
+// hset sets fields of a hash, HSET key field value [field value ...].
+func (s *server) hset(c *client, args []resp.Value) {
+	if len(args) < 4 || len(args)%2 != 0 {
+		wrongArgs(c, args)
+		return
+	}
+
+	fields := make(map[string]string, (len(args)-2)/2)
+	for i := 2; i < len(args); i += 2 {
+		fields[args[i].String()] = args[i+1].String()
+	}
+	n, err := structures.HashSet(s.db, args[1].String(), fields)
+	if err != nil {
+		writeStructureError(c, err)
+	} else {
+		c.wr.writeInteger(int64(n))
+	}
+}
+
+// hget returns the value of a field of a hash, HGET key field.
+func (s *server) hget(c *client, args []resp.Value) {
+	if len(args) != 3 {
+		wrongArgs(c, args)
+		return
+	}
+
+	value, isExist, err := structures.HashGet(s.db, args[1].String(), args[2].String())
+	switch {
+	case err != nil:
+		writeStructureError(c, err)
+	case !isExist:
+		c.wr.writeNull()
+	default:
+		c.wr.writeBulk(value)
+	}
+}
+
+// hgetall lists the fields of a hash along with their values, HGETALL key.
+func (s *server) hgetall(c *client, args []resp.Value) {
+	if len(args) != 2 {
+		wrongArgs(c, args)
+		return
+	}
+
+	hash, err := structures.HashGetAll(s.db, args[1].String())
+	if err != nil {
+		writeStructureError(c, err)
+		return
+	}
+	fields := make([]string, 0, len(hash))
+	for field := range hash {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	c.wr.writeArray(2 * len(fields))
+	for _, field := range fields {
+		c.wr.writeBulk(field)
+		c.wr.writeBulk(hash[field])
+	}
+}
+
+// argStrings returns the arguments as strings.
+func argStrings(args []resp.Value) []string {
+	res := make([]string, len(args))
+	for i, arg := range args {
+		res[i] = arg.String()
+	}
+
+	return res
+}
+
+// writeStructureError replies with the error of a failed structure command.
+func writeStructureError(c *client, err error) {
+	switch {
+	case errors.Is(err, structures.ErrWrongType):
+		c.wr.writeError(errWrongType)
+	case errors.Is(err, structures.ErrTooLarge):
+		c.wr.writeError("ERR collection exceeds the maximum number of items")
+	case errors.Is(err, structures.ErrConflict):
+		c.wr.writeError("ERR too many concurrent changes of the key, try again")
+	case errors.Is(err, bitcask.ErrInvalidKey):
+		c.wr.writeError("ERR invalid key")
+	case errors.Is(err, bitcask.ErrValueTooLarge):
+		c.wr.writeError(errValueTooLarge)
+	case errors.Is(err, bitcask.ErrOutOfMemory):
+		c.wr.writeError(errOOM)
+	default:
+		c.wr.writeError("ERR cannot set key to value in this store")
+	}
+}
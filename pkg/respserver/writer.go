@@ -0,0 +1,137 @@
+package respserver
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// resp2 is the protocol version every connection starts with.
+	resp2 = 2
+	// resp3 is the protocol version negotiated with HELLO 3.
+	resp3 = 3
+)
+
+// replyWriter writes replies in the protocol version negotiated by the client.
+// RESP3 only types are downgraded to their RESP2 equivalents for RESP2 clients.
+type replyWriter struct {
+	// written is accessed atomically, it is kept first to stay 64-bit aligned on 32-bit platforms.
+	written int64
+	wr      *bufio.Writer
+	proto   int
+}
+
+// newReplyWriter creates a RESP2 reply writer on top of the given writer.
+func newReplyWriter(w io.Writer) *replyWriter {
+	return &replyWriter{
+		wr:    bufio.NewWriter(w),
+		proto: resp2,
+	}
+}
+
+// writeSimpleString writes a status reply.
+func (w *replyWriter) writeSimpleString(s string) {
+	w.writeLine('+', singleLine(s))
+}
+
+// writeError writes an error reply, msg must start with the error code.
+func (w *replyWriter) writeError(msg string) {
+	w.writeLine('-', singleLine(msg))
+}
+
+// writeInteger writes an integer reply.
+func (w *replyWriter) writeInteger(n int64) {
+	w.writeLine(':', strconv.FormatInt(n, 10))
+}
+
+// writeBulk writes a binary safe string reply.
+func (w *replyWriter) writeBulk(s string) {
+	w.writeLine('$', strconv.Itoa(len(s)))
+	w.writeRaw(s)
+	w.writeRaw("\r\n")
+}
+
+// writeNull writes a null reply.
+func (w *replyWriter) writeNull() {
+	if w.proto == resp3 {
+		w.writeRaw("_\r\n")
+	} else {
+		w.writeRaw("$-1\r\n")
+	}
+}
+
+// writeArray writes the header of an array reply of n elements,
+// the elements are written by the following calls.
+func (w *replyWriter) writeArray(n int) {
+	w.writeLine('*', strconv.Itoa(n))
+}
+
+// writeMap writes the header of a map reply of n key/value pairs,
+// the keys and values are written alternately by the following calls.
+// RESP2 clients receive a flat array of 2n elements.
+func (w *replyWriter) writeMap(n int) {
+	if w.proto == resp3 {
+		w.writeLine('%', strconv.Itoa(n))
+	} else {
+		w.writeArray(2 * n)
+	}
+}
+
+// writePush writes the header of an out of band push of n elements,
+// the elements are written by the following calls.
+// RESP2 clients receive an array of n elements.
+func (w *replyWriter) writePush(n int) {
+	if w.proto == resp3 {
+		w.writeLine('>', strconv.Itoa(n))
+	} else {
+		w.writeArray(n)
+	}
+}
+
+// writeDouble writes a floating point reply.
+// RESP2 clients receive the number as a bulk string.
+func (w *replyWriter) writeDouble(f float64) {
+	var s string
+	switch {
+	case math.IsInf(f, 1):
+		s = "inf"
+	case math.IsInf(f, -1):
+		s = "-inf"
+	default:
+		s = strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	if w.proto == resp3 {
+		w.writeLine(',', s)
+	} else {
+		w.writeBulk(s)
+	}
+}
+
+// writeLine writes a single line reply with the given type byte.
+func (w *replyWriter) writeLine(typ byte, s string) {
+	w.writeRaw(string(typ))
+	w.writeRaw(s)
+	w.writeRaw("\r\n")
+}
+
+// writeRaw buffers the given bytes, errors are reported by flush.
+func (w *replyWriter) writeRaw(s string) {
+	n, _ := w.wr.WriteString(s)
+	atomic.AddInt64(&w.written, int64(n))
+}
+
+// flush sends the buffered replies to the client.
+func (w *replyWriter) flush() error {
+	return w.wr.Flush()
+}
+
+// singleLine replaces the line breaks of s with spaces
+// so it can be sent as a simple string or error.
+func singleLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,304 @@
+// Package sessions stores the sessions of web applications in a bitcask datastore.
+// Its Store and Session follow the API of gorilla/sessions, Get, New and Save taking
+// the request and the response writer, so the handlers written for a gorilla store only
+// change the import. The cookie holds the random id of the session, the values are kept
+// in the datastore encoded with encoding/gob, and the types stored in Values other than
+// the basic ones must be registered with gob.Register as with gorilla.
+package sessions
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+const (
+	// keyPrefix starts the keys of the sessions in the datastore.
+	keyPrefix = "session:"
+
+	// expiresMeta is the metadata of the session records holding their expiry time,
+	// in microseconds since the epoch.
+	expiresMeta = "session-expires"
+
+	// idSize is the number of random bytes of the session ids.
+	idSize = 32
+
+	// defaultMaxAge is the lifetime in seconds of the sessions of a new store, 30 days.
+	defaultMaxAge = 86400 * 30
+)
+
+type (
+	// Options are the attributes of the session cookie. MaxAge is also the lifetime
+	// of the session in the datastore: a session is dropped MaxAge seconds after
+	// it was last saved, kept until deleted when MaxAge is 0, and deleted by Save
+	// when MaxAge is negative.
+	Options struct {
+		Path     string
+		Domain   string
+		MaxAge   int
+		Secure   bool
+		HttpOnly bool
+		SameSite http.SameSite
+	}
+
+	// Session holds the values of a session between the requests.
+	Session struct {
+		// ID is the id of the session, empty until the session is saved.
+		ID string
+		// Values are the values of the session.
+		Values map[interface{}]interface{}
+		// Options are the options of the session, a copy of the options of the store.
+		Options *Options
+		// IsNew is set for a session which was not found in the datastore.
+		IsNew bool
+
+		store *Store
+		name  string
+	}
+
+	// Store stores the sessions in a bitcask datastore.
+	// It is safe for concurrent use as the datastore is.
+	Store struct {
+		// Options are the options of the new sessions.
+		Options *Options
+
+		db  *bitcask.Bitcask
+		now func() time.Time
+	}
+)
+
+// NewStore returns a store keeping the sessions in the given datastore, under keys starting
+// with "session:". The sessions last 30 days and their cookies are HttpOnly and SameSite=Lax
+// unless the options of the store are changed.
+func NewStore(db *bitcask.Bitcask) *Store {
+	return &Store{
+		Options: &Options{
+			Path:     "/",
+			MaxAge:   defaultMaxAge,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+		db:  db,
+		now: time.Now,
+	}
+}
+
+// Name returns the name of the session, which is also the name of its cookie.
+func (s *Session) Name() string {
+	return s.name
+}
+
+// Store returns the store of the session.
+func (s *Session) Store() *Store {
+	return s.store
+}
+
+// Save saves the session with its store.
+func (s *Session) Save(r *http.Request, w http.ResponseWriter) error {
+	return s.store.Save(r, w, s)
+}
+
+// Get returns the session of the given name sent with the request, or a new session
+// if the request has none or its session expired. Unlike gorilla, the sessions are not cached
+// per request, every call loads the session from the datastore again.
+func (st *Store) Get(r *http.Request, name string) (*Session, error) {
+	return st.New(r, name)
+}
+
+// New returns the session of the given name sent with the request, or a new session
+// if the request has none or its session expired.
+// Return the new session along with an error if the session cannot be read.
+func (st *Store) New(r *http.Request, name string) (*Session, error) {
+	opts := *st.Options
+	s := &Session{
+		Values:  make(map[interface{}]interface{}),
+		Options: &opts,
+		IsNew:   true,
+		store:   st,
+		name:    name,
+	}
+
+	c, err := r.Cookie(name)
+	if err != nil || !validID(c.Value) {
+		return s, nil
+	}
+	values, err := st.load(c.Value)
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	s.ID = c.Value
+	s.Values = values
+	s.IsNew = false
+
+	return s, nil
+}
+
+// Save stores the values of the session and sets its cookie in the response,
+// a new id is generated for a new session. A session with a negative MaxAge is deleted
+// along with its cookie.
+// Return an error if the values cannot be encoded or on any failure of the datastore.
+func (st *Store) Save(r *http.Request, w http.ResponseWriter, s *Session) error {
+	if s.Options.MaxAge < 0 {
+		if s.ID != "" {
+			err := st.db.Delete(keyPrefix + s.ID)
+			if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+				return err
+			}
+		}
+		http.SetCookie(w, newCookie(s.name, "", s.Options))
+		return nil
+	}
+
+	if s.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		s.ID = id
+	}
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(s.Values)
+	if err != nil {
+		return fmt.Errorf("session %s: %w", s.name, err)
+	}
+	var meta map[string]string
+	if s.Options.MaxAge > 0 {
+		expires := st.now().Add(time.Duration(s.Options.MaxAge) * time.Second)
+		meta = map[string]string{expiresMeta: strconv.FormatInt(expires.UnixMicro(), 10)}
+	}
+	err = st.db.PutWithMeta(keyPrefix+s.ID, buf.String(), meta)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, newCookie(s.name, s.ID, s.Options))
+
+	return nil
+}
+
+// Cleanup deletes the expired sessions from the datastore, the expired sessions are never
+// returned but take space until deleted. A session saved again meanwhile is kept.
+// Return the number of sessions deleted, or an error on any failure of the datastore.
+func (st *Store) Cleanup() (int, error) {
+	it := st.db.Scan(keyPrefix)
+	defer it.Close()
+
+	n := 0
+	now := st.now()
+	for it.Next() {
+		key := it.Key()
+		keyMeta, err := st.db.KeyMeta(key)
+		if err != nil {
+			continue
+		}
+		_, meta, err := st.db.GetWithMeta(key)
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return n, err
+		}
+		if !expired(meta, now) {
+			continue
+		}
+		// the session is only deleted if it was not saved again since it was read
+		deleted, err := st.db.DeleteIf(key, func(_ string, m bitcask.KeyMeta) bool {
+			return m.Tstamp.Equal(keyMeta.Tstamp)
+		})
+		if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+			return n, err
+		}
+		if deleted {
+			n++
+		}
+	}
+
+	return n, it.Err()
+}
+
+// load reads the values of the session of the given id.
+// Return ErrKeyNotFound if the session does not exist or expired.
+func (st *Store) load(id string) (map[interface{}]interface{}, error) {
+	value, meta, err := st.db.GetWithMeta(keyPrefix + id)
+	if err != nil {
+		return nil, err
+	}
+	if expired(meta, st.now()) {
+		return nil, fmt.Errorf("session %s: %w", id, bitcask.ErrKeyNotFound)
+	}
+
+	values := make(map[interface{}]interface{})
+	err = gob.NewDecoder(strings.NewReader(value)).Decode(&values)
+	if err != nil {
+		return nil, fmt.Errorf("session %s: %w", id, err)
+	}
+
+	return values, nil
+}
+
+// expired reports whether the session record holding the given metadata expired at now,
+// the records without expiry never expire.
+func expired(meta map[string]string, now time.Time) bool {
+	expires, err := strconv.ParseInt(meta[expiresMeta], 10, 64)
+	if err != nil {
+		return false
+	}
+
+	return now.UnixMicro() >= expires
+}
+
+// newID returns a random session id.
+func newID() (string, error) {
+	buf := make([]byte, idSize)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// validID reports whether id looks like an id returned by newID,
+// the other cookies are not looked up in the datastore.
+func validID(id string) bool {
+	if len(id) != 2*idSize {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+
+	return err == nil
+}
+
+// newCookie returns the cookie of the session with the given name and value,
+// an expired cookie if MaxAge is negative.
+func newCookie(name, value string, opts *Options) *http.Cookie {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     opts.Path,
+		Domain:   opts.Domain,
+		MaxAge:   opts.MaxAge,
+		Secure:   opts.Secure,
+		HttpOnly: opts.HttpOnly,
+		SameSite: opts.SameSite,
+	}
+	if opts.MaxAge > 0 {
+		c.Expires = time.Now().Add(time.Duration(opts.MaxAge) * time.Second)
+	} else if opts.MaxAge < 0 {
+		c.Expires = time.Unix(1, 0)
+	}
+
+	return c
+}
@@ -0,0 +1,122 @@
+package sessions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// openTestStore opens a store over a datastore in a temporary directory.
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	b, err := bitcask.Open(t.TempDir(), bitcask.ReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	return NewStore(b)
+}
+
+// save saves the session and returns the cookie set in the response.
+func save(t *testing.T, s *Session) *http.Cookie {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	err := s.Save(httptest.NewRequest(http.MethodGet, "/", nil), w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+
+	return cookies[0]
+}
+
+// get returns the session of the given name sent with the cookie.
+func get(t *testing.T, st *Store, name string, c *http.Cookie) *Session {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if c != nil {
+		r.AddCookie(c)
+	}
+	s, err := st.Get(r, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestSession(t *testing.T) {
+	st := openTestStore(t)
+
+	s := get(t, st, "sid", nil)
+	if !s.IsNew || s.Name() != "sid" {
+		t.Fatalf("got IsNew %t, name %q, want a new session named sid", s.IsNew, s.Name())
+	}
+	s.Values["user"] = "ann"
+	s.Values["visits"] = 3
+	c := save(t, s)
+	if c.Value != s.ID || !c.HttpOnly || c.MaxAge != defaultMaxAge {
+		t.Errorf("got cookie %v, want the session id with the default options", c)
+	}
+
+	s = get(t, st, "sid", c)
+	if s.IsNew || s.Values["user"] != "ann" || s.Values["visits"] != 3 {
+		t.Errorf("got IsNew %t, values %v, want the saved values", s.IsNew, s.Values)
+	}
+
+	// unknown and malformed ids start new sessions
+	if s := get(t, st, "sid", &http.Cookie{Name: "sid", Value: "session:x"}); !s.IsNew {
+		t.Error("Expected a new session for a malformed id")
+	}
+
+	s.Options.MaxAge = -1
+	c = save(t, s)
+	if c.MaxAge >= 0 {
+		t.Errorf("got cookie max age %d, want a deleted cookie", c.MaxAge)
+	}
+	if s := get(t, st, "sid", &http.Cookie{Name: "sid", Value: s.ID}); !s.IsNew {
+		t.Error("Expected the deleted session to be gone")
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	st := openTestStore(t)
+	now := time.Now()
+	st.now = func() time.Time { return now }
+
+	st.Options.MaxAge = 60
+	s := get(t, st, "sid", nil)
+	s.Values["user"] = "ann"
+	expiring := save(t, s)
+
+	st.Options.MaxAge = 0
+	s = get(t, st, "sid", nil)
+	s.Values["user"] = "bob"
+	kept := save(t, s)
+
+	now = now.Add(time.Minute)
+	if s := get(t, st, "sid", expiring); !s.IsNew {
+		t.Error("Expected the expired session to be gone")
+	}
+	if s := get(t, st, "sid", kept); s.IsNew || s.Values["user"] != "bob" {
+		t.Errorf("got IsNew %t, values %v, want the session without expiry", s.IsNew, s.Values)
+	}
+
+	n, err := st.Cleanup()
+	if n != 1 || err != nil {
+		t.Errorf("got %d, %v, want 1 session deleted", n, err)
+	}
+	if st.db.Has(keyPrefix + expiring.Value) {
+		t.Error("Expected the expired session to be deleted")
+	}
+}
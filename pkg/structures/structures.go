@@ -0,0 +1,398 @@
+// Package structures stores counters, small sets, small lists and small hashes in single values
+// of a bitcask datastore. Every change reads the value along with its version, applies
+// the change and writes it back with a compare and swap, retrying when a concurrent
+// change won, so the changes are never lost without holding the datastore locked.
+// The whole value is read and written by every change, so the collections are meant to stay small.
+package structures
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+const (
+	// MaxItems is the maximum number of members of a set, items of a list or fields of a hash.
+	MaxItems = 4096
+
+	// maxAttempts is the number of compare and swap attempts of a change before it gives up.
+	maxAttempts = 16
+
+	// setTag, listTag and hashTag start the encoded sets, lists and hashes.
+	setTag  = 's'
+	listTag = 'l'
+	hashTag = 'h'
+)
+
+var (
+	// ErrWrongType happens whenever a key holds a value of another structure.
+	ErrWrongType = errors.New("key holds a value of another type")
+
+	// ErrTooLarge happens whenever a change would grow a collection past MaxItems.
+	ErrTooLarge = errors.New("collection exceeds the maximum number of items")
+
+	// ErrConflict happens whenever a change keeps losing against concurrent changes of the key.
+	ErrConflict = errors.New("too many concurrent changes of the key")
+)
+
+// Store is the datastore holding the structures, implemented by *bitcask.Bitcask
+// and *bitcask.Partitioned.
+type Store interface {
+	// GetVersion returns the value of the key along with its version.
+	GetVersion(key string) (string, int64, error)
+	// CompareAndSwap stores the value if the key is still at version, 0 for a missing key.
+	CompareAndSwap(key, value string, version int64) (bool, error)
+}
+
+// CounterGet returns the counter stored by key, a missing key counts as 0.
+func CounterGet(s Store, key string) (int64, error) {
+	value, _, err := get(s, key)
+	if err != nil || value == "" {
+		return 0, err
+	}
+
+	return parseCounter(value)
+}
+
+// CounterAdd adds delta to the counter stored by key and returns the new value.
+// The counters are stored as base 10 integers, as bitcask.Incr stores them.
+func CounterAdd(s Store, key string, delta int64) (int64, error) {
+	var res int64
+	err := update(s, key, func(value string) (string, error) {
+		cur := int64(0)
+		if value != "" {
+			var err error
+			cur, err = parseCounter(value)
+			if err != nil {
+				return "", err
+			}
+		}
+		if (delta > 0 && cur > math.MaxInt64-delta) || (delta < 0 && cur < math.MinInt64-delta) {
+			return "", bitcask.ErrOverflow
+		}
+		res = cur + delta
+
+		return strconv.FormatInt(res, 10), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return res, nil
+}
+
+// SetAdd adds the members to the set stored by key and returns the number of members added.
+func SetAdd(s Store, key string, members ...string) (int, error) {
+	added := 0
+	err := update(s, key, func(value string) (string, error) {
+		set, err := decode(value, setTag)
+		if err != nil {
+			return "", err
+		}
+		added = 0
+		for _, m := range members {
+			i := sort.SearchStrings(set, m)
+			if i < len(set) && set[i] == m {
+				continue
+			}
+			set = append(set, "")
+			copy(set[i+1:], set[i:])
+			set[i] = m
+			added++
+		}
+		if len(set) > MaxItems {
+			return "", ErrTooLarge
+		}
+
+		return encode(setTag, set), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return added, nil
+}
+
+// SetRemove removes the members from the set stored by key and returns the number of members removed.
+func SetRemove(s Store, key string, members ...string) (int, error) {
+	removed := 0
+	err := update(s, key, func(value string) (string, error) {
+		set, err := decode(value, setTag)
+		if err != nil {
+			return "", err
+		}
+		removed = 0
+		for _, m := range members {
+			i := sort.SearchStrings(set, m)
+			if i < len(set) && set[i] == m {
+				set = append(set[:i], set[i+1:]...)
+				removed++
+			}
+		}
+
+		return encode(setTag, set), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
+
+// SetMembers returns the members of the set stored by key in ascending order,
+// a missing key is an empty set.
+func SetMembers(s Store, key string) ([]string, error) {
+	value, _, err := get(s, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return decode(value, setTag)
+}
+
+// ListPush inserts the items at the head of the list stored by key, one after the other
+// as LPUSH does, so the last item ends up first. Return the length of the list.
+func ListPush(s Store, key string, items ...string) (int, error) {
+	return listInsert(s, key, items, true)
+}
+
+// ListAppend appends the items at the tail of the list stored by key as RPUSH does.
+// Return the length of the list.
+func ListAppend(s Store, key string, items ...string) (int, error) {
+	return listInsert(s, key, items, false)
+}
+
+// ListRange returns the items of the list stored by key from start to stop included,
+// negative indexes count from the tail as in LRANGE, a missing key is an empty list.
+func ListRange(s Store, key string, start, stop int) ([]string, error) {
+	value, _, err := get(s, key)
+	if err != nil {
+		return nil, err
+	}
+	list, err := decode(value, listTag)
+	if err != nil {
+		return nil, err
+	}
+
+	n := len(list)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return []string{}, nil
+	}
+
+	return list[start : stop+1], nil
+}
+
+// listInsert inserts the items at the head or at the tail of the list stored by key.
+func listInsert(s Store, key string, items []string, head bool) (int, error) {
+	n := 0
+	err := update(s, key, func(value string) (string, error) {
+		list, err := decode(value, listTag)
+		if err != nil {
+			return "", err
+		}
+		if len(list)+len(items) > MaxItems {
+			return "", ErrTooLarge
+		}
+		if head {
+			res := make([]string, 0, len(list)+len(items))
+			for i := len(items) - 1; i >= 0; i-- {
+				res = append(res, items[i])
+			}
+			list = append(res, list...)
+		} else {
+			list = append(list, items...)
+		}
+		n = len(list)
+
+		return encode(listTag, list), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+// HashSet sets the fields of the hash stored by key to their values and returns the number of fields added.
+func HashSet(s Store, key string, fields map[string]string) (int, error) {
+	added := 0
+	err := update(s, key, func(value string) (string, error) {
+		hash, err := decodeHash(value)
+		if err != nil {
+			return "", err
+		}
+		added = 0
+		for field, v := range fields {
+			if _, isExist := hash[field]; !isExist {
+				added++
+			}
+			hash[field] = v
+		}
+		if len(hash) > MaxItems {
+			return "", ErrTooLarge
+		}
+
+		return encodeHash(hash), nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return added, nil
+}
+
+// HashGet returns the value of the field of the hash stored by key and whether the field exists,
+// a missing key is an empty hash.
+func HashGet(s Store, key, field string) (string, bool, error) {
+	hash, err := HashGetAll(s, key)
+	if err != nil {
+		return "", false, err
+	}
+	v, isExist := hash[field]
+
+	return v, isExist, nil
+}
+
+// HashGetAll returns the fields of the hash stored by key along with their values,
+// a missing key is an empty hash.
+func HashGetAll(s Store, key string) (map[string]string, error) {
+	value, _, err := get(s, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeHash(value)
+}
+
+// get returns the value of key along with its version, a missing key is an empty value at version 0.
+func get(s Store, key string) (string, int64, error) {
+	value, version, err := s.GetVersion(key)
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return "", 0, nil
+	}
+
+	return value, version, err
+}
+
+// update applies fn to the value of key and swaps the result in,
+// retrying with the new value when a concurrent change won.
+func update(s Store, key string, fn func(value string) (string, error)) error {
+	for i := 0; i < maxAttempts; i++ {
+		value, version, err := get(s, key)
+		if err != nil {
+			return err
+		}
+		value, err = fn(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		swapped, err := s.CompareAndSwap(key, value, version)
+		if err != nil || swapped {
+			return err
+		}
+	}
+
+	return fmt.Errorf("%s: %w", key, ErrConflict)
+}
+
+// parseCounter parses a counter value.
+func parseCounter(value string) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, ErrWrongType
+	}
+
+	return n, nil
+}
+
+// encode encodes the items as the tag followed by the length prefixed items.
+func encode(tag byte, items []string) string {
+	size := 1
+	for _, item := range items {
+		size += binary.MaxVarintLen64 + len(item)
+	}
+	buf := make([]byte, 1, size)
+	buf[0] = tag
+	for _, item := range items {
+		buf = binary.AppendUvarint(buf, uint64(len(item)))
+		buf = append(buf, item...)
+	}
+
+	return string(buf)
+}
+
+// encodeHash encodes the hash as its fields in ascending order, each followed by its value.
+func encodeHash(hash map[string]string) string {
+	fields := make([]string, 0, len(hash))
+	for field := range hash {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	items := make([]string, 0, 2*len(fields))
+	for _, field := range fields {
+		items = append(items, field, hash[field])
+	}
+
+	return encode(hashTag, items)
+}
+
+// decodeHash decodes a value encoded by encodeHash, an empty value is an empty hash.
+// Return ErrWrongType if the value is not a hash.
+func decodeHash(value string) (map[string]string, error) {
+	items, err := decode(value, hashTag)
+	if err != nil {
+		return nil, err
+	}
+	if len(items)%2 != 0 {
+		return nil, ErrWrongType
+	}
+
+	hash := make(map[string]string, len(items)/2)
+	for i := 0; i < len(items); i += 2 {
+		hash[items[i]] = items[i+1]
+	}
+
+	return hash, nil
+}
+
+// decode decodes the items of a value encoded with the given tag, an empty value holds no items.
+// Return ErrWrongType if the value is not encoded with the tag.
+func decode(value string, tag byte) ([]string, error) {
+	items := make([]string, 0)
+	if value == "" {
+		return items, nil
+	}
+	if value[0] != tag {
+		return nil, ErrWrongType
+	}
+
+	buf := []byte(value[1:])
+	for len(buf) > 0 {
+		n, k := binary.Uvarint(buf)
+		if k <= 0 || n > uint64(len(buf)-k) {
+			return nil, ErrWrongType
+		}
+		items = append(items, string(buf[k:k+int(n)]))
+		buf = buf[k+int(n):]
+	}
+
+	return items, nil
+}
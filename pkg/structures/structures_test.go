@@ -0,0 +1,178 @@
+package structures
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/zaher1307/bitcask/pkg/bitcask"
+)
+
+// openTestStore opens a datastore in a temporary directory.
+func openTestStore(t *testing.T) *bitcask.Bitcask {
+	t.Helper()
+
+	b, err := bitcask.Open(t.TempDir(), bitcask.ReadWrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	return b
+}
+
+func TestCounter(t *testing.T) {
+	b := openTestStore(t)
+
+	if n, err := CounterAdd(b, "counter", 5); n != 5 || err != nil {
+		t.Errorf("got:%d, %v, want:5", n, err)
+	}
+	// counters are compatible with Incr
+	if n, _ := b.Incr("counter", 2); n != 7 {
+		t.Errorf("got:%d, want:7", n)
+	}
+	if n, err := CounterGet(b, "counter"); n != 7 || err != nil {
+		t.Errorf("got:%d, %v, want:7", n, err)
+	}
+	if n, err := CounterGet(b, "missing"); n != 0 || err != nil {
+		t.Errorf("got:%d, %v, want:0", n, err)
+	}
+}
+
+func TestSet(t *testing.T) {
+	b := openTestStore(t)
+
+	if n, err := SetAdd(b, "set", "b", "a", "c", "a"); n != 3 || err != nil {
+		t.Errorf("got:%d, %v, want:3 added", n, err)
+	}
+	if n, _ := SetAdd(b, "set", "c", "d"); n != 1 {
+		t.Errorf("got:%d, want:1 added", n)
+	}
+	if n, _ := SetRemove(b, "set", "a", "x"); n != 1 {
+		t.Errorf("got:%d, want:1 removed", n)
+	}
+	members, err := SetMembers(b, "set")
+	if err != nil || !reflect.DeepEqual(members, []string{"b", "c", "d"}) {
+		t.Errorf("got:%v, %v, want:[b c d]", members, err)
+	}
+	if members, _ := SetMembers(b, "missing"); len(members) != 0 {
+		t.Errorf("got:%v, want an empty set", members)
+	}
+}
+
+func TestList(t *testing.T) {
+	b := openTestStore(t)
+
+	ListPush(b, "list", "b", "a")
+	if n, err := ListAppend(b, "list", "c", ""); n != 4 || err != nil {
+		t.Errorf("got:%d, %v, want:4", n, err)
+	}
+
+	cases := []struct {
+		start, stop int
+		want        []string
+	}{
+		{0, -1, []string{"a", "b", "c", ""}},
+		{1, 2, []string{"b", "c"}},
+		{-2, 100, []string{"c", ""}},
+		{3, 1, []string{}},
+	}
+	for _, c := range cases {
+		got, err := ListRange(b, "list", c.start, c.stop)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("range %d %d: got:%q, %v, want:%q", c.start, c.stop, got, err, c.want)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	b := openTestStore(t)
+
+	if n, err := HashSet(b, "hash", map[string]string{"a": "1", "b": ""}); n != 2 || err != nil {
+		t.Errorf("got:%d, %v, want:2 added", n, err)
+	}
+	if n, _ := HashSet(b, "hash", map[string]string{"b": "2", "c": "3"}); n != 1 {
+		t.Errorf("got:%d, want:1 added", n)
+	}
+	if v, isExist, err := HashGet(b, "hash", "b"); v != "2" || !isExist || err != nil {
+		t.Errorf("got:%q, %t, %v, want:2", v, isExist, err)
+	}
+	if _, isExist, _ := HashGet(b, "hash", "x"); isExist {
+		t.Error("Expected a missing field")
+	}
+	hash, err := HashGetAll(b, "hash")
+	if err != nil || !reflect.DeepEqual(hash, map[string]string{"a": "1", "b": "2", "c": "3"}) {
+		t.Errorf("got:%v, %v, want:map[a:1 b:2 c:3]", hash, err)
+	}
+	if hash, _ := HashGetAll(b, "missing"); len(hash) != 0 {
+		t.Errorf("got:%v, want an empty hash", hash)
+	}
+
+	fields := make(map[string]string, MaxItems)
+	for i := 0; i < MaxItems; i++ {
+		fields[fmt.Sprint(i)] = ""
+	}
+	if _, err := HashSet(b, "hash", fields); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got:%v, want:%v", err, ErrTooLarge)
+	}
+}
+
+func TestWrongType(t *testing.T) {
+	b := openTestStore(t)
+	SetAdd(b, "set", "a")
+	b.Put("text", "value")
+
+	if _, err := ListPush(b, "set", "a"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("got:%v, want:%v", err, ErrWrongType)
+	}
+	if _, err := SetMembers(b, "text"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("got:%v, want:%v", err, ErrWrongType)
+	}
+	if _, err := CounterAdd(b, "set", 1); !errors.Is(err, ErrWrongType) {
+		t.Errorf("got:%v, want:%v", err, ErrWrongType)
+	}
+	if _, err := HashGetAll(b, "set"); !errors.Is(err, ErrWrongType) {
+		t.Errorf("got:%v, want:%v", err, ErrWrongType)
+	}
+}
+
+func TestConcurrentChanges(t *testing.T) {
+	b := openTestStore(t)
+
+	var wg sync.WaitGroup
+	var added int64
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				n, err := SetAdd(b, "set", fmt.Sprintf("member%d-%d", i, j))
+				if err != nil && !errors.Is(err, ErrConflict) {
+					t.Error(err)
+				}
+				atomic.AddInt64(&added, int64(n))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// every change either landed or reported the conflict, none is lost silently
+	members, _ := SetMembers(b, "set")
+	if int64(len(members)) != added {
+		t.Errorf("got:%d members, want:%d", len(members), added)
+	}
+
+	if _, err := SetAdd(b, "full", make([]string, MaxItems+1)...); err != nil {
+		t.Errorf("got:%v, want the duplicates folded", err)
+	}
+	items := make([]string, MaxItems+1)
+	if _, err := ListAppend(b, "full", items...); !errors.Is(err, ErrWrongType) {
+		t.Errorf("got:%v, want:%v", err, ErrWrongType)
+	}
+	if _, err := ListAppend(b, "list", items...); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got:%v, want:%v", err, ErrTooLarge)
+	}
+}